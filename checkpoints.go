@@ -0,0 +1,119 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+)
+
+/*
+Saves read positions of a file into the checkpoint file configured for the file. Not safe for concurrent use,
+LineProcessed is called by the consumer, see processedLinePositions, and Save is called after the consumer is done.
+A nil *fileCheckpointer is valid and does nothing, i.e checkpoints are disabled
+*/
+type fileCheckpointer struct {
+	store         *inputs.CheckpointStore
+	filePath      string
+	checkpoint    inputs.FileCheckpoint
+	hasCheckpoint bool
+}
+
+// checkpoints and ingest progress are saved this often while processing (after the data of processed lines is saved), and when done
+const CHECKPOINT_SAVE_INTERVAL time.Duration = 30 * time.Second
+
+// checkpoint file path => store, files may share the same checkpoint file
+var checkpointStores map[string]*inputs.CheckpointStore = make(map[string]*inputs.CheckpointStore)
+var checkpointStoresMutex sync.Mutex
+
+func getCheckpointStore(checkpointFilePath string) *inputs.CheckpointStore {
+	checkpointStoresMutex.Lock()
+	defer checkpointStoresMutex.Unlock()
+	store, ok := checkpointStores[checkpointFilePath]
+	if !ok {
+		var err error
+		store, err = inputs.LoadCheckpointStore(checkpointFilePath)
+		if err != nil {
+			slog.Error("Failed to load checkpoints, saved read positions will be ignored", "checkpointFile", checkpointFilePath, "error", err)
+		}
+		checkpointStores[checkpointFilePath] = store
+	}
+	return store
+}
+
+// Returns the saved checkpoint for the file, nil if checkpoints are disabled or there is no saved checkpoint for the file
+func getSavedCheckpoint(filePath string) *inputs.FileCheckpoint {
+	config := getConfigForFile(filePath)
+	if len(config.CheckpointFile) < 1 {
+		return nil
+	}
+	checkpoint, ok := getCheckpointStore(config.CheckpointFile).Get(filePath)
+	if !ok {
+		return nil
+	}
+	return &checkpoint
+}
+
+func newFileCheckpointer(filePath string) *fileCheckpointer {
+	config := getConfigForFile(filePath)
+	if len(config.CheckpointFile) < 1 || filePath == STDIN_FILE_PATH {
+		return nil
+	}
+	return &fileCheckpointer{store: getCheckpointStore(config.CheckpointFile), filePath: filePath}
+}
+
+// lastTimestamp is the timestamp of the last parsed line, zero if it's not known
+func (checkpointer *fileCheckpointer) LineProcessed(line inputs.LogLine, lastTimestamp time.Time) {
+	if checkpointer == nil || line.Source == nil {
+		return
+	}
+	checkpointer.checkpoint.FileIdentity = *line.Source
+	checkpointer.checkpoint.Offset = line.Offset
+	if !lastTimestamp.IsZero() {
+		checkpointer.checkpoint.LastTimestamp = lastTimestamp
+	}
+	checkpointer.hasCheckpoint = true
+}
+
+/*
+Returns a function saving the current checkpoint, which may be called later by another goroutine. nil if there is nothing to save
+*/
+func (checkpointer *fileCheckpointer) checkpointSaver() func() {
+	if checkpointer == nil || !checkpointer.hasCheckpoint {
+		return nil
+	}
+	checkpoint := checkpointer.checkpoint
+	return func() {
+		checkpoint.Updated = time.Now()
+		checkpointer.store.Set(checkpointer.filePath, checkpoint)
+		if err := checkpointer.store.Save(); err != nil {
+			slog.Error("Failed to save checkpoint", "filePath", checkpointer.filePath, "error", err)
+		}
+	}
+}
+
+func (checkpointer *fileCheckpointer) Save() {
+	if saveCheckpoint := checkpointer.checkpointSaver(); saveCheckpoint != nil {
+		saveCheckpoint()
+	}
+}
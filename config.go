@@ -0,0 +1,866 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/SBOsoft/SBOLogProcessor/db"
+	"github.com/SBOsoft/SBOLogProcessor/handlers"
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+)
+
+func getConfigForFile(filePath string) *ConfigForAMonitoredFile {
+	globalConfigMutex.RLock()
+	defer globalConfigMutex.RUnlock()
+	foundConfig, ok := globalConfig[filePath]
+	if !ok {
+		foundConfig, ok = globalConfig[DEFAULT_CONFIG_KEY]
+	}
+
+	if !ok {
+		slog.Warn("Failed to find configuration for file", "filePath", filePath)
+	}
+
+	return foundConfig
+}
+
+/*
+This function will run before logging is set up. Don't use slog here yet
+*/
+func parseCommandArgs() {
+	logLevelPtr := flag.String("l", "info", "Log level. Defaults to info. Supported values are: debug, info, warn.")
+	profilePtr := flag.String("p", "metrics", "Active profile. Defaults to metrics which will create metrics. Available options are: metrics, count, security. Where count will output total stats from the given file and security will output malicious IPs and security stats.")
+	confFilePtr := flag.String("c", "", "Configuration file in json format. There is no default value but you will want to pass a config file when -m=metrics. ")
+
+	followPtr := flag.Bool("f", false, "Follow changes to the file, as in tail -f")
+	windowSizePtr := flag.Int("w", 1, "Statistics window size in minutes, e.g to report request statistics for every 5 minute window.")
+	startFromPtr := flag.Int("s", START_FROM_BEGINNING, "When 0, file will be processed starting from the beginning. When -1, file will be processed starting from the end (i.e only lines appended after the program starts will be processed). Defaults to 0")
+	domainPtr := flag.String("d", "", "Domain name to report, needed when domain names are not available in logs")
+	handlerPtr := flag.String("a", "", "Enabled handler name, defaults to METRICS. Note: It's NOT possible to pass multiple handlers using command line parameters, you need to use a configuration file if you need to enable multiple handlers.")
+	writeToFileTargetPtr := flag.String("t", "", "Target file path, required when handler is WRITE_TO_FILE")
+
+	counterTopNPtr := flag.Int("n", COUNTER_TOPN_SIZE_DEFAULT, "Applies to count profile only: Number of items (such as IP addresses, referers, paths) to be displayed. Only the top n items will be displayed in the output.")
+	counterOutputIntervalPtr := flag.Int("i", COUNTER_OUTPUT_INTERVAL_DEFAULT, "Applies to count profile only: Number of seconds between successive count outputs")
+	bandwidthThresholdPtr := flag.Int64("b", 0, "Report clients receiving more than this many bytes in a time window (see -w). Defaults to 0 which disables the check")
+	backfillPtr := flag.Bool("r", false, "Process rotated files (e.g access.log.2.gz, access.log.1) oldest first, before the file itself")
+
+	helpPtr := flag.Bool("h", false, "Show command line parameters")
+
+	flag.Parse()
+
+	if *helpPtr {
+		fmt.Println()
+		fmt.Println("SBOLogProcessor command line tool for monitoring web server access logs and more. See https://github.com/SBOsoft/SBOLogProcessor for more details")
+		fmt.Println("Passing a configuration file using -c parameter is the recommended method for providing configuration options.")
+		fmt.Println("Command line arguments should suffice for the counter profile BUT a command line parameter for every possible configuration option may NOT be available.")
+		fmt.Println()
+		fmt.Println("Usage: 'sbologp [command line options, e.g -f -p=metrics] access-log-file-path' OR 'sbologp -c path-to-config-file.json'")
+		fmt.Println("For example: ./sbologp -f -p=count /var/log/apache/access.log OR ./sbologp -c sbologp-config.json")
+		fmt.Println("Use - as the file path to read from stdin, e.g zcat old.log.gz | ./sbologp -p=count -")
+		fmt.Println("Use 'sbologp db migrate -c config.json' to create or upgrade database tables, 'sbologp db status -c config.json' to view schema versions")
+		fmt.Println("Use 'sbologp db prune -c config.json' to delete old raw logs and roll up old metrics once, e.g from cron")
+		flag.PrintDefaults()
+		os.Exit(0)
+	}
+
+	switch *logLevelPtr {
+	case "info":
+		globalActiveLogLevel = slog.LevelInfo
+	case "warn":
+		globalActiveLogLevel = slog.LevelWarn
+	case "debug":
+		globalActiveLogLevel = slog.LevelDebug
+	}
+
+	globalActiveProfile = *profilePtr
+	if globalActiveProfile != SBO_GLOBAL_PROFILE_COUNT &&
+		globalActiveProfile != SBO_GLOBAL_PROFILE_METRICS &&
+		globalActiveProfile != SBO_GLOBAL_PROFILE_SECURITY {
+		fmt.Printf("Invalid profile value (invalid -p parameter): '%s' ", globalActiveProfile)
+		fmt.Println()
+		fmt.Println("Use -h parameter to view command line options")
+		//flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	configFileName := *confFilePtr
+	loadedConfigFromFile := false
+
+	if len(configFileName) > 0 {
+		loadedConfigFromFile = loadConfigFromFile(configFileName)
+	}
+
+	if !loadedConfigFromFile {
+		if len(flag.Arg(0)) > 0 {
+			handlerName := *handlerPtr
+			//default handlers for profiles
+			if len(handlerName) < 1 {
+				if globalActiveProfile == SBO_GLOBAL_PROFILE_COUNT {
+					handlerName = handlers.COUNTER_HANDLER_NAME
+				} else if globalActiveProfile == SBO_GLOBAL_PROFILE_METRICS {
+					handlerName = handlers.METRIC_GENERATOR_HANDLER_NAME
+				}
+			}
+
+			//Creating config here is not the best way to invoke the program
+			var cfFromCmdLine = ConfigForAMonitoredFile{
+				Follow:                *followPtr,
+				StartFrom:             *startFromPtr,
+				TimeWindowSizeMinutes: *windowSizePtr,
+
+				DomainName: *domainPtr,
+
+				Handlers: []string{handlerName}, //<- only 1 handler is supported
+
+				FilePath:              flag.Arg(0),
+				WriteToFileTargetFile: *writeToFileTargetPtr,
+
+				HandlerInstances: make(map[string]SBOLogHandlerInterface, 1),
+
+				WriteMetricsToDb:              false,
+				DbAddress:                     "",
+				DbUser:                        "",
+				DbPassword:                    "",
+				DbDatabase:                    "",
+				ReplaceExistingMetrics:        true,
+				MetricsWindowSize:             3,
+				CounterTopNForKeyedMetrics:    *counterTopNPtr,
+				CounterOutputIntervalSeconds:  *counterOutputIntervalPtr,
+				BandwidthClientBytesThreshold: *bandwidthThresholdPtr,
+				BackfillRotatedFiles:          *backfillPtr}
+
+			globalConfig[cfFromCmdLine.FilePath] = &cfFromCmdLine
+		} else {
+			fmt.Println("Invalid options, cannot continue, missing log file path. Either a configuration file or command line parameters are required. Use -h parameter to view command line options. See https://github.com/SBOsoft/SBOLogProcessor for more details")
+			os.Exit(1)
+		}
+
+	}
+}
+
+/*
+TODO should be improved
+First we load the config file into a map[string]map[string]interface{} because we want to know if
+values for were provided for each field or not so that we can override with values defined under defaults
+'interface{}' requires a lot of type conversions float64 => int, []interface{} => []string
+*/
+func loadConfigFromFile(configFileName string) bool {
+	var configLoadedFromFile map[string]map[string]interface{} = make(map[string]map[string]interface{})
+	fileInfo, err := os.Stat(configFileName)
+	if os.IsNotExist(err) {
+		//no config file provided
+		slog.Error("Configuration file path parameter, -c, points to non-existent file. It must point to a json file. Ignoring parameter", "file", configFileName)
+		return false
+	}
+
+	if fileInfo.IsDir() {
+		slog.Error("Configuration file path parameter, -c, points to a directory. It must point to a json file. Ignoring parameter")
+		return false
+	}
+
+	configFileBytes, err := os.ReadFile(configFileName)
+	if err != nil {
+		slog.Error("Failed to read configuration file", "file", configFileName, "error", err)
+		return false
+	}
+
+	err = json.Unmarshal(configFileBytes, &configLoadedFromFile)
+	if err != nil {
+		slog.Error("Failed to load configuration from file", "file", configFileName, "error", err)
+		return false
+	}
+
+	for fp, conf := range configLoadedFromFile {
+		//validation and defaults
+		mapCounterOutputIntervalSeconds, ok := conf["CounterOutputIntervalSeconds"].(float64)
+		if !ok || mapCounterOutputIntervalSeconds < 1 {
+			mapCounterOutputIntervalSeconds = 30
+		}
+		conf["CounterOutputIntervalSeconds_ok"] = ok
+
+		mapCounterTopNForKeyedMetrics, ok := conf["CounterTopNForKeyedMetrics"].(float64)
+		if !ok || (mapCounterTopNForKeyedMetrics < 1 || mapCounterTopNForKeyedMetrics > 100) {
+			mapCounterTopNForKeyedMetrics = 10
+		}
+		conf["CounterTopNForKeyedMetrics_ok"] = ok
+
+		intMetricsWindowSize, ok := conf["MetricsWindowSize"].(float64)
+		conf["MetricsWindowSize_ok"] = ok
+		windowSizeToUse := 3
+		if ok {
+			windowSizeToUse = int(intMetricsWindowSize)
+		}
+		if !ok || (intMetricsWindowSize < 2 || intMetricsWindowSize > 10) {
+			//allow sensible values only
+			windowSizeToUse = 3
+		}
+		mapEnabled, ok := conf["Enabled"].(bool)
+		conf["Enabled_ok"] = ok
+		mapFilePath, ok := conf["FilePath"].(string)
+		conf["FilePath_ok"] = ok
+		mapHandlers, ok := conf["Handlers"].([]interface{})
+		conf["Handlers_ok"] = ok
+
+		mapStartFrom, ok := conf["StartFrom"].(float64)
+		conf["StartFrom_ok"] = ok
+		mapSkipIfLineMatchesRegex, ok := conf["SkipIfLineMatchesRegex"].(string)
+		conf["SkipIfLineMatchesRegex_ok"] = ok
+		mapFollow, ok := conf["Follow"].(bool)
+		conf["Follow_ok"] = ok
+		mapDomainName, ok := conf["DomainName"].(string)
+		conf["DomainName_ok"] = ok
+		mapHostId, ok := conf["HostId"].(float64)
+		conf["HostId_ok"] = ok
+
+		mapTimeWindowSizeMinutes, ok := conf["TimeWindowSizeMinutes"].(float64)
+		conf["TimeWindowSizeMinutes_ok"] = ok
+		mapWriteToFileTargetFile, ok := conf["WriteToFileTargetFile"].(string)
+		conf["WriteToFileTargetFile_ok"] = ok
+		mapWriteMetricsToDb, ok := conf["WriteMetricsToDb"].(bool)
+		conf["WriteMetricsToDb_ok"] = ok
+		mapDbDriver, ok := conf["DbDriver"].(string)
+		conf["DbDriver_ok"] = ok
+		mapDbAddress, ok := conf["DbAddress"].(string)
+		conf["DbAddress_ok"] = ok
+		mapDbUser, ok := conf["DbUser"].(string)
+		conf["DbUser_ok"] = ok
+		mapDbPassword, ok := conf["DbPassword"].(string)
+		conf["DbPassword_ok"] = ok
+		mapDbDatabase, ok := conf["DbDatabase"].(string)
+		conf["DbDatabase_ok"] = ok
+		mapDbSpoolDirectory, ok := conf["DbSpoolDirectory"].(string)
+		conf["DbSpoolDirectory_ok"] = ok
+		mapDbSpoolMaxSizeMB, ok := conf["DbSpoolMaxSizeMB"].(float64)
+		conf["DbSpoolMaxSizeMB_ok"] = ok
+		mapRawLogRetentionDays, ok := conf["RawLogRetentionDays"].(float64)
+		conf["RawLogRetentionDays_ok"] = ok
+		mapMetricsRetentionDays, ok := conf["MetricsRetentionDays"].(float64)
+		conf["MetricsRetentionDays_ok"] = ok
+		mapHourlyMetricsRetentionDays, ok := conf["HourlyMetricsRetentionDays"].(float64)
+		conf["HourlyMetricsRetentionDays_ok"] = ok
+		mapReplaceExistingMetrics, ok := conf["ReplaceExistingMetrics"].(bool)
+		conf["ReplaceExistingMetrics_ok"] = ok
+		mapMetricPushFormat, ok := conf["MetricPushFormat"].(string)
+		conf["MetricPushFormat_ok"] = ok
+		mapMetricPushNetwork, ok := conf["MetricPushNetwork"].(string)
+		conf["MetricPushNetwork_ok"] = ok
+		mapMetricPushAddress, ok := conf["MetricPushAddress"].(string)
+		conf["MetricPushAddress_ok"] = ok
+		mapMetricPushNameTemplate, ok := conf["MetricPushNameTemplate"].(string)
+		conf["MetricPushNameTemplate_ok"] = ok
+		mapInfluxOutput, ok := conf["InfluxOutput"].(string)
+		conf["InfluxOutput_ok"] = ok
+		mapInfluxToken, ok := conf["InfluxToken"].(string)
+		conf["InfluxToken_ok"] = ok
+		mapInfluxGzip, ok := conf["InfluxGzip"].(bool)
+		conf["InfluxGzip_ok"] = ok
+		mapOtlpEndpoint, ok := conf["OtlpEndpoint"].(string)
+		conf["OtlpEndpoint_ok"] = ok
+		mapOtlpEncoding, ok := conf["OtlpEncoding"].(string)
+		conf["OtlpEncoding_ok"] = ok
+		mapOtlpHeaders, ok := conf["OtlpHeaders"].(map[string]interface{})
+		conf["OtlpHeaders_ok"] = ok
+		mapElasticsearchUrl, ok := conf["ElasticsearchUrl"].(string)
+		conf["ElasticsearchUrl_ok"] = ok
+		mapElasticsearchIndex, ok := conf["ElasticsearchIndex"].(string)
+		conf["ElasticsearchIndex_ok"] = ok
+		mapElasticsearchUser, ok := conf["ElasticsearchUser"].(string)
+		conf["ElasticsearchUser_ok"] = ok
+		mapElasticsearchPassword, ok := conf["ElasticsearchPassword"].(string)
+		conf["ElasticsearchPassword_ok"] = ok
+		mapElasticsearchApiKey, ok := conf["ElasticsearchApiKey"].(string)
+		conf["ElasticsearchApiKey_ok"] = ok
+		mapLokiUrl, ok := conf["LokiUrl"].(string)
+		conf["LokiUrl_ok"] = ok
+		mapLokiLineFormat, ok := conf["LokiLineFormat"].(string)
+		conf["LokiLineFormat_ok"] = ok
+		mapLokiTenantId, ok := conf["LokiTenantId"].(string)
+		conf["LokiTenantId_ok"] = ok
+		mapLokiUser, ok := conf["LokiUser"].(string)
+		conf["LokiUser_ok"] = ok
+		mapLokiPassword, ok := conf["LokiPassword"].(string)
+		conf["LokiPassword_ok"] = ok
+
+		mapSaveLogsToDb, ok := conf["SaveLogsToDb"].(bool)
+		conf["SaveLogsToDb_ok"] = ok
+		mapSaveLogsToDbMaskIPs, ok := conf["SaveLogsToDbMaskIPs"].(bool)
+		conf["SaveLogsToDbMaskIPs_ok"] = ok
+		mapSaveLogsToDbOnlyRelevant, ok := conf["SaveLogsToDbOnlyRelevant"].(float64)
+		conf["SaveLogsToDbOnlyRelevant_ok"] = ok
+		mapRedactSensitiveData, ok := conf["RedactSensitiveData"].(bool)
+		conf["RedactSensitiveData_ok"] = ok
+		mapHotlinkAllowedDomains, ok := conf["HotlinkAllowedDomains"].([]interface{})
+		conf["HotlinkAllowedDomains_ok"] = ok
+		mapBandwidthClientBytesThreshold, ok := conf["BandwidthClientBytesThreshold"].(float64)
+		conf["BandwidthClientBytesThreshold_ok"] = ok
+		mapRefererSpamBlocklistFile, ok := conf["RefererSpamBlocklistFile"].(string)
+		conf["RefererSpamBlocklistFile_ok"] = ok
+		mapRefererSpamHeuristics, ok := conf["RefererSpamHeuristics"].(bool)
+		conf["RefererSpamHeuristics_ok"] = ok
+		mapCheckpointFile, ok := conf["CheckpointFile"].(string)
+		conf["CheckpointFile_ok"] = ok
+		mapBackfillRotatedFiles, ok := conf["BackfillRotatedFiles"].(bool)
+		conf["BackfillRotatedFiles_ok"] = ok
+		mapSyslogUDPAddress, ok := conf["SyslogUDPAddress"].(string)
+		conf["SyslogUDPAddress_ok"] = ok
+		mapSyslogTCPAddress, ok := conf["SyslogTCPAddress"].(string)
+		conf["SyslogTCPAddress_ok"] = ok
+		mapContainerLogFormat, ok := conf["ContainerLogFormat"].(string)
+		conf["ContainerLogFormat_ok"] = ok
+		mapContainerLogStream, ok := conf["ContainerLogStream"].(string)
+		conf["ContainerLogStream_ok"] = ok
+		mapContainerNameAsDomainName, ok := conf["ContainerNameAsDomainName"].(bool)
+		conf["ContainerNameAsDomainName_ok"] = ok
+		mapHttpIngestAddress, ok := conf["HttpIngestAddress"].(string)
+		conf["HttpIngestAddress_ok"] = ok
+		mapHttpIngestToken, ok := conf["HttpIngestToken"].(string)
+		conf["HttpIngestToken_ok"] = ok
+		mapPrometheusAddress, ok := conf["PrometheusAddress"].(string)
+		conf["PrometheusAddress_ok"] = ok
+		mapPrometheusMaxSeries, ok := conf["PrometheusMaxSeries"].(float64)
+		conf["PrometheusMaxSeries_ok"] = ok
+		mapOSMetricsEnabled, ok := conf["OSMetricsEnabled"].(bool)
+		conf["OSMetricsEnabled_ok"] = ok
+		mapOSMetricsIntervalMinutes, ok := conf["OSMetricsIntervalMinutes"].(float64)
+		conf["OSMetricsIntervalMinutes_ok"] = ok
+
+		handlersArrayAsStrings := make([]string, len(mapHandlers))
+		for indexInHandlers, handlerNameValue := range mapHandlers {
+			handlersArrayAsStrings[indexInHandlers] = fmt.Sprint(handlerNameValue)
+		}
+		hotlinkAllowedDomainsAsStrings := make([]string, len(mapHotlinkAllowedDomains))
+		for indexInDomains, domainValue := range mapHotlinkAllowedDomains {
+			hotlinkAllowedDomainsAsStrings[indexInDomains] = fmt.Sprint(domainValue)
+		}
+		otlpHeadersAsStrings := make(map[string]string, len(mapOtlpHeaders))
+		for headerName, headerValue := range mapOtlpHeaders {
+			otlpHeadersAsStrings[headerName] = fmt.Sprint(headerValue)
+		}
+		globalConfig[fp] = &ConfigForAMonitoredFile{
+			Enabled:                       mapEnabled,
+			FilePath:                      mapFilePath,
+			Handlers:                      handlersArrayAsStrings,
+			StartFrom:                     int(mapStartFrom),
+			SkipIfLineMatchesRegex:        mapSkipIfLineMatchesRegex,
+			Follow:                        mapFollow,
+			DomainName:                    mapDomainName,
+			HostId:                        int(mapHostId),
+			TimeWindowSizeMinutes:         int(mapTimeWindowSizeMinutes),
+			WriteToFileTargetFile:         mapWriteToFileTargetFile,
+			HandlerInstances:              make(map[string]SBOLogHandlerInterface),
+			WriteMetricsToDb:              mapWriteMetricsToDb,
+			DbDriver:                      mapDbDriver,
+			DbAddress:                     mapDbAddress,
+			DbUser:                        mapDbUser,
+			DbPassword:                    mapDbPassword,
+			DbDatabase:                    mapDbDatabase,
+			DbSpoolDirectory:              mapDbSpoolDirectory,
+			DbSpoolMaxSizeMB:              int(mapDbSpoolMaxSizeMB),
+			RawLogRetentionDays:           int(mapRawLogRetentionDays),
+			MetricsRetentionDays:          int(mapMetricsRetentionDays),
+			HourlyMetricsRetentionDays:    int(mapHourlyMetricsRetentionDays),
+			ReplaceExistingMetrics:        mapReplaceExistingMetrics,
+			MetricPushFormat:              mapMetricPushFormat,
+			MetricPushNetwork:             mapMetricPushNetwork,
+			MetricPushAddress:             mapMetricPushAddress,
+			MetricPushNameTemplate:        mapMetricPushNameTemplate,
+			InfluxOutput:                  mapInfluxOutput,
+			InfluxToken:                   mapInfluxToken,
+			InfluxGzip:                    mapInfluxGzip,
+			OtlpEndpoint:                  mapOtlpEndpoint,
+			OtlpEncoding:                  mapOtlpEncoding,
+			OtlpHeaders:                   otlpHeadersAsStrings,
+			ElasticsearchUrl:              mapElasticsearchUrl,
+			ElasticsearchIndex:            mapElasticsearchIndex,
+			ElasticsearchUser:             mapElasticsearchUser,
+			ElasticsearchPassword:         mapElasticsearchPassword,
+			ElasticsearchApiKey:           mapElasticsearchApiKey,
+			LokiUrl:                       mapLokiUrl,
+			LokiLineFormat:                mapLokiLineFormat,
+			LokiTenantId:                  mapLokiTenantId,
+			LokiUser:                      mapLokiUser,
+			LokiPassword:                  mapLokiPassword,
+			MetricsWindowSize:             windowSizeToUse,
+			CounterTopNForKeyedMetrics:    int(mapCounterTopNForKeyedMetrics),
+			CounterOutputIntervalSeconds:  int(mapCounterOutputIntervalSeconds),
+			SaveLogsToDb:                  mapSaveLogsToDb,
+			SaveLogsToDbMaskIPs:           mapSaveLogsToDbMaskIPs,
+			SaveLogsToDbOnlyRelevant:      int(mapSaveLogsToDbOnlyRelevant),
+			RedactSensitiveData:           mapRedactSensitiveData,
+			HotlinkAllowedDomains:         hotlinkAllowedDomainsAsStrings,
+			BandwidthClientBytesThreshold: int64(mapBandwidthClientBytesThreshold),
+			RefererSpamBlocklistFile:      mapRefererSpamBlocklistFile,
+			RefererSpamHeuristics:         mapRefererSpamHeuristics,
+			CheckpointFile:                mapCheckpointFile,
+			BackfillRotatedFiles:          mapBackfillRotatedFiles,
+			ContainerLogFormat:            mapContainerLogFormat,
+			ContainerLogStream:            mapContainerLogStream,
+			ContainerNameAsDomainName:     mapContainerNameAsDomainName,
+			SyslogUDPAddress:              mapSyslogUDPAddress,
+			SyslogTCPAddress:              mapSyslogTCPAddress,
+			HttpIngestAddress:             mapHttpIngestAddress,
+			HttpIngestToken:               mapHttpIngestToken,
+			PrometheusAddress:             mapPrometheusAddress,
+			PrometheusMaxSeries:           int(mapPrometheusMaxSeries),
+			OSMetricsEnabled:              mapOSMetricsEnabled,
+			OSMetricsIntervalMinutes:      int(mapOSMetricsIntervalMinutes)}
+
+	}
+	_, configContainsDefaultEntry := globalConfig[DEFAULT_CONFIG_KEY]
+	if configContainsDefaultEntry {
+		for filePath, _ := range globalConfig {
+			if filePath == DEFAULT_CONFIG_KEY || filePath == OSMETRICS_CONFIG_KEY {
+				continue
+			}
+			if !configLoadedFromFile[filePath]["Handlers_ok"].(bool) && len(globalConfig[filePath].Handlers) < 1 {
+				globalConfig[filePath].Handlers = globalConfig[DEFAULT_CONFIG_KEY].Handlers
+			}
+			if !configLoadedFromFile[filePath]["StartFrom_ok"].(bool) {
+				globalConfig[filePath].StartFrom = globalConfig[DEFAULT_CONFIG_KEY].StartFrom
+			}
+			if !configLoadedFromFile[filePath]["SkipIfLineMatchesRegex_ok"].(bool) {
+				globalConfig[filePath].SkipIfLineMatchesRegex = globalConfig[DEFAULT_CONFIG_KEY].SkipIfLineMatchesRegex
+			}
+
+			if !configLoadedFromFile[filePath]["Follow_ok"].(bool) {
+				globalConfig[filePath].Follow = globalConfig[DEFAULT_CONFIG_KEY].Follow
+			}
+			if !configLoadedFromFile[filePath]["DomainName_ok"].(bool) {
+				globalConfig[filePath].DomainName = globalConfig[DEFAULT_CONFIG_KEY].DomainName
+			}
+			if !configLoadedFromFile[filePath]["HostId_ok"].(bool) {
+				globalConfig[filePath].HostId = globalConfig[DEFAULT_CONFIG_KEY].HostId
+			}
+			if !configLoadedFromFile[filePath]["TimeWindowSizeMinutes_ok"].(bool) {
+				globalConfig[filePath].TimeWindowSizeMinutes = globalConfig[DEFAULT_CONFIG_KEY].TimeWindowSizeMinutes
+			}
+			if !configLoadedFromFile[filePath]["WriteToFileTargetFile_ok"].(bool) {
+				globalConfig[filePath].WriteToFileTargetFile = globalConfig[DEFAULT_CONFIG_KEY].WriteToFileTargetFile
+			}
+
+			if !configLoadedFromFile[filePath]["WriteMetricsToDb_ok"].(bool) {
+				globalConfig[filePath].WriteMetricsToDb = globalConfig[DEFAULT_CONFIG_KEY].WriteMetricsToDb
+			}
+			if !configLoadedFromFile[filePath]["DbDriver_ok"].(bool) {
+				globalConfig[filePath].DbDriver = globalConfig[DEFAULT_CONFIG_KEY].DbDriver
+			}
+			if !configLoadedFromFile[filePath]["DbAddress_ok"].(bool) {
+				globalConfig[filePath].DbAddress = globalConfig[DEFAULT_CONFIG_KEY].DbAddress
+			}
+			if !configLoadedFromFile[filePath]["DbUser_ok"].(bool) {
+				globalConfig[filePath].DbUser = globalConfig[DEFAULT_CONFIG_KEY].DbUser
+			}
+			if !configLoadedFromFile[filePath]["DbPassword_ok"].(bool) {
+				globalConfig[filePath].DbPassword = globalConfig[DEFAULT_CONFIG_KEY].DbPassword
+			}
+			if !configLoadedFromFile[filePath]["DbDatabase_ok"].(bool) {
+				globalConfig[filePath].DbDatabase = globalConfig[DEFAULT_CONFIG_KEY].DbDatabase
+			}
+			if !configLoadedFromFile[filePath]["DbSpoolDirectory_ok"].(bool) {
+				globalConfig[filePath].DbSpoolDirectory = globalConfig[DEFAULT_CONFIG_KEY].DbSpoolDirectory
+			}
+			if !configLoadedFromFile[filePath]["DbSpoolMaxSizeMB_ok"].(bool) {
+				globalConfig[filePath].DbSpoolMaxSizeMB = globalConfig[DEFAULT_CONFIG_KEY].DbSpoolMaxSizeMB
+			}
+			if !configLoadedFromFile[filePath]["RawLogRetentionDays_ok"].(bool) {
+				globalConfig[filePath].RawLogRetentionDays = globalConfig[DEFAULT_CONFIG_KEY].RawLogRetentionDays
+			}
+			if !configLoadedFromFile[filePath]["MetricsRetentionDays_ok"].(bool) {
+				globalConfig[filePath].MetricsRetentionDays = globalConfig[DEFAULT_CONFIG_KEY].MetricsRetentionDays
+			}
+			if !configLoadedFromFile[filePath]["HourlyMetricsRetentionDays_ok"].(bool) {
+				globalConfig[filePath].HourlyMetricsRetentionDays = globalConfig[DEFAULT_CONFIG_KEY].HourlyMetricsRetentionDays
+			}
+			if !configLoadedFromFile[filePath]["ReplaceExistingMetrics_ok"].(bool) {
+				globalConfig[filePath].ReplaceExistingMetrics = globalConfig[DEFAULT_CONFIG_KEY].ReplaceExistingMetrics
+			}
+			if !configLoadedFromFile[filePath]["MetricPushFormat_ok"].(bool) {
+				globalConfig[filePath].MetricPushFormat = globalConfig[DEFAULT_CONFIG_KEY].MetricPushFormat
+			}
+			if !configLoadedFromFile[filePath]["MetricPushNetwork_ok"].(bool) {
+				globalConfig[filePath].MetricPushNetwork = globalConfig[DEFAULT_CONFIG_KEY].MetricPushNetwork
+			}
+			if !configLoadedFromFile[filePath]["MetricPushAddress_ok"].(bool) {
+				globalConfig[filePath].MetricPushAddress = globalConfig[DEFAULT_CONFIG_KEY].MetricPushAddress
+			}
+			if !configLoadedFromFile[filePath]["MetricPushNameTemplate_ok"].(bool) {
+				globalConfig[filePath].MetricPushNameTemplate = globalConfig[DEFAULT_CONFIG_KEY].MetricPushNameTemplate
+			}
+			if !configLoadedFromFile[filePath]["InfluxOutput_ok"].(bool) {
+				globalConfig[filePath].InfluxOutput = globalConfig[DEFAULT_CONFIG_KEY].InfluxOutput
+			}
+			if !configLoadedFromFile[filePath]["InfluxToken_ok"].(bool) {
+				globalConfig[filePath].InfluxToken = globalConfig[DEFAULT_CONFIG_KEY].InfluxToken
+			}
+			if !configLoadedFromFile[filePath]["InfluxGzip_ok"].(bool) {
+				globalConfig[filePath].InfluxGzip = globalConfig[DEFAULT_CONFIG_KEY].InfluxGzip
+			}
+			if !configLoadedFromFile[filePath]["OtlpEndpoint_ok"].(bool) {
+				globalConfig[filePath].OtlpEndpoint = globalConfig[DEFAULT_CONFIG_KEY].OtlpEndpoint
+			}
+			if !configLoadedFromFile[filePath]["OtlpEncoding_ok"].(bool) {
+				globalConfig[filePath].OtlpEncoding = globalConfig[DEFAULT_CONFIG_KEY].OtlpEncoding
+			}
+			if !configLoadedFromFile[filePath]["OtlpHeaders_ok"].(bool) {
+				globalConfig[filePath].OtlpHeaders = globalConfig[DEFAULT_CONFIG_KEY].OtlpHeaders
+			}
+			if !configLoadedFromFile[filePath]["ElasticsearchUrl_ok"].(bool) {
+				globalConfig[filePath].ElasticsearchUrl = globalConfig[DEFAULT_CONFIG_KEY].ElasticsearchUrl
+			}
+			if !configLoadedFromFile[filePath]["ElasticsearchIndex_ok"].(bool) {
+				globalConfig[filePath].ElasticsearchIndex = globalConfig[DEFAULT_CONFIG_KEY].ElasticsearchIndex
+			}
+			if !configLoadedFromFile[filePath]["ElasticsearchUser_ok"].(bool) {
+				globalConfig[filePath].ElasticsearchUser = globalConfig[DEFAULT_CONFIG_KEY].ElasticsearchUser
+			}
+			if !configLoadedFromFile[filePath]["ElasticsearchPassword_ok"].(bool) {
+				globalConfig[filePath].ElasticsearchPassword = globalConfig[DEFAULT_CONFIG_KEY].ElasticsearchPassword
+			}
+			if !configLoadedFromFile[filePath]["ElasticsearchApiKey_ok"].(bool) {
+				globalConfig[filePath].ElasticsearchApiKey = globalConfig[DEFAULT_CONFIG_KEY].ElasticsearchApiKey
+			}
+			if !configLoadedFromFile[filePath]["LokiUrl_ok"].(bool) {
+				globalConfig[filePath].LokiUrl = globalConfig[DEFAULT_CONFIG_KEY].LokiUrl
+			}
+			if !configLoadedFromFile[filePath]["LokiLineFormat_ok"].(bool) {
+				globalConfig[filePath].LokiLineFormat = globalConfig[DEFAULT_CONFIG_KEY].LokiLineFormat
+			}
+			if !configLoadedFromFile[filePath]["LokiTenantId_ok"].(bool) {
+				globalConfig[filePath].LokiTenantId = globalConfig[DEFAULT_CONFIG_KEY].LokiTenantId
+			}
+			if !configLoadedFromFile[filePath]["LokiUser_ok"].(bool) {
+				globalConfig[filePath].LokiUser = globalConfig[DEFAULT_CONFIG_KEY].LokiUser
+			}
+			if !configLoadedFromFile[filePath]["LokiPassword_ok"].(bool) {
+				globalConfig[filePath].LokiPassword = globalConfig[DEFAULT_CONFIG_KEY].LokiPassword
+			}
+			if !configLoadedFromFile[filePath]["MetricsWindowSize_ok"].(bool) {
+				globalConfig[filePath].MetricsWindowSize = globalConfig[DEFAULT_CONFIG_KEY].MetricsWindowSize
+			}
+			if !configLoadedFromFile[filePath]["CounterTopNForKeyedMetrics_ok"].(bool) {
+				globalConfig[filePath].CounterTopNForKeyedMetrics = globalConfig[DEFAULT_CONFIG_KEY].CounterTopNForKeyedMetrics
+			}
+			if !configLoadedFromFile[filePath]["CounterOutputIntervalSeconds_ok"].(bool) {
+				globalConfig[filePath].CounterOutputIntervalSeconds = globalConfig[DEFAULT_CONFIG_KEY].CounterOutputIntervalSeconds
+			}
+			if !configLoadedFromFile[filePath]["SaveLogsToDb_ok"].(bool) {
+				globalConfig[filePath].SaveLogsToDb = globalConfig[DEFAULT_CONFIG_KEY].SaveLogsToDb
+			}
+			if !configLoadedFromFile[filePath]["SaveLogsToDbMaskIPs_ok"].(bool) {
+				globalConfig[filePath].SaveLogsToDbMaskIPs = globalConfig[DEFAULT_CONFIG_KEY].SaveLogsToDbMaskIPs
+			}
+			if !configLoadedFromFile[filePath]["SaveLogsToDbOnlyRelevant_ok"].(bool) {
+				globalConfig[filePath].SaveLogsToDbOnlyRelevant = globalConfig[DEFAULT_CONFIG_KEY].SaveLogsToDbOnlyRelevant
+			}
+			if !configLoadedFromFile[filePath]["RedactSensitiveData_ok"].(bool) {
+				globalConfig[filePath].RedactSensitiveData = globalConfig[DEFAULT_CONFIG_KEY].RedactSensitiveData
+			}
+			if !configLoadedFromFile[filePath]["HotlinkAllowedDomains_ok"].(bool) {
+				globalConfig[filePath].HotlinkAllowedDomains = globalConfig[DEFAULT_CONFIG_KEY].HotlinkAllowedDomains
+			}
+			if !configLoadedFromFile[filePath]["BandwidthClientBytesThreshold_ok"].(bool) {
+				globalConfig[filePath].BandwidthClientBytesThreshold = globalConfig[DEFAULT_CONFIG_KEY].BandwidthClientBytesThreshold
+			}
+			if !configLoadedFromFile[filePath]["RefererSpamBlocklistFile_ok"].(bool) {
+				globalConfig[filePath].RefererSpamBlocklistFile = globalConfig[DEFAULT_CONFIG_KEY].RefererSpamBlocklistFile
+			}
+			if !configLoadedFromFile[filePath]["RefererSpamHeuristics_ok"].(bool) {
+				globalConfig[filePath].RefererSpamHeuristics = globalConfig[DEFAULT_CONFIG_KEY].RefererSpamHeuristics
+			}
+			if !configLoadedFromFile[filePath]["CheckpointFile_ok"].(bool) {
+				globalConfig[filePath].CheckpointFile = globalConfig[DEFAULT_CONFIG_KEY].CheckpointFile
+			}
+			if !configLoadedFromFile[filePath]["BackfillRotatedFiles_ok"].(bool) {
+				globalConfig[filePath].BackfillRotatedFiles = globalConfig[DEFAULT_CONFIG_KEY].BackfillRotatedFiles
+			}
+			if !configLoadedFromFile[filePath]["ContainerLogFormat_ok"].(bool) {
+				globalConfig[filePath].ContainerLogFormat = globalConfig[DEFAULT_CONFIG_KEY].ContainerLogFormat
+			}
+			if !configLoadedFromFile[filePath]["ContainerLogStream_ok"].(bool) {
+				globalConfig[filePath].ContainerLogStream = globalConfig[DEFAULT_CONFIG_KEY].ContainerLogStream
+			}
+			if !configLoadedFromFile[filePath]["ContainerNameAsDomainName_ok"].(bool) {
+				globalConfig[filePath].ContainerNameAsDomainName = globalConfig[DEFAULT_CONFIG_KEY].ContainerNameAsDomainName
+			}
+			if !configLoadedFromFile[filePath]["OSMetricsEnabled_ok"].(bool) {
+				globalConfig[filePath].OSMetricsEnabled = globalConfig[DEFAULT_CONFIG_KEY].OSMetricsEnabled
+			}
+			if !configLoadedFromFile[filePath]["OSMetricsIntervalMinutes_ok"].(bool) {
+				globalConfig[filePath].OSMetricsIntervalMinutes = globalConfig[DEFAULT_CONFIG_KEY].OSMetricsIntervalMinutes
+			}
+		}
+
+		_, ok := globalConfig[OSMETRICS_CONFIG_KEY]
+		if ok {
+			if len(globalConfig[OSMETRICS_CONFIG_KEY].DbDriver) < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].DbDriver = globalConfig[DEFAULT_CONFIG_KEY].DbDriver
+			}
+			if len(globalConfig[OSMETRICS_CONFIG_KEY].DbAddress) < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].DbAddress = globalConfig[DEFAULT_CONFIG_KEY].DbAddress
+			}
+			if len(globalConfig[OSMETRICS_CONFIG_KEY].DbDatabase) < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].DbDatabase = globalConfig[DEFAULT_CONFIG_KEY].DbDatabase
+			}
+			if len(globalConfig[OSMETRICS_CONFIG_KEY].DbPassword) < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].DbPassword = globalConfig[DEFAULT_CONFIG_KEY].DbPassword
+			}
+			if len(globalConfig[OSMETRICS_CONFIG_KEY].DbUser) < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].DbUser = globalConfig[DEFAULT_CONFIG_KEY].DbUser
+			}
+			if globalConfig[OSMETRICS_CONFIG_KEY].HostId < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].HostId = globalConfig[DEFAULT_CONFIG_KEY].HostId
+			}
+			if len(globalConfig[OSMETRICS_CONFIG_KEY].InfluxOutput) < 1 {
+				globalConfig[OSMETRICS_CONFIG_KEY].InfluxOutput = globalConfig[DEFAULT_CONFIG_KEY].InfluxOutput
+				globalConfig[OSMETRICS_CONFIG_KEY].InfluxToken = globalConfig[DEFAULT_CONFIG_KEY].InfluxToken
+				globalConfig[OSMETRICS_CONFIG_KEY].InfluxGzip = globalConfig[DEFAULT_CONFIG_KEY].InfluxGzip
+			}
+		}
+	}
+
+	for filePath, fileConfig := range globalConfig {
+		if !db.IsValidDbDriver(fileConfig.DbDriver) {
+			slog.Error("Invalid DbDriver", "filePath", filePath, "DbDriver", fileConfig.DbDriver)
+			return false
+		}
+		if !inputs.IsValidContainerLogFormat(fileConfig.ContainerLogFormat) {
+			slog.Error("Invalid ContainerLogFormat", "filePath", filePath, "ContainerLogFormat", fileConfig.ContainerLogFormat)
+			return false
+		}
+		if !inputs.IsValidContainerLogStream(fileConfig.ContainerLogStream) {
+			//lines of other streams are ignored, so every line would be ignored
+			slog.Error("Invalid ContainerLogStream", "filePath", filePath, "ContainerLogStream", fileConfig.ContainerLogStream)
+			return false
+		}
+		if fileConfig.ContainerNameAsDomainName && !inputs.IsFilePathPattern(filePath) {
+			//file path patterns are handled when matching files are found
+			if containerName := inputs.ContainerDomainNameFromLogPath(filePath); len(containerName) > 0 {
+				fileConfig.DomainName = containerName
+			}
+		}
+	}
+
+	slog.Debug("Loaded config from file", "file", configFileName)
+	return true
+}
+
+/////////////////////////Config
+
+const START_FROM_BEGINNING int = 0
+const START_FROM_END int = -1
+
+// file path for reading log lines from stdin, e.g zcat old.log.gz | sbologp -p count -
+const STDIN_FILE_PATH string = "-"
+
+const (
+	HANDLER_METRICS   string = "metrics"
+	HANDLER_ATTACKERS string = "attackers"
+)
+
+type ConfigForAMonitoredFile struct {
+	Enabled   bool
+	FilePath  string
+	Handlers  []string
+	StartFrom int
+	//Not implemented yet
+	SkipIfLineMatchesRegex string
+	//Follow changes to the file, like tail -f
+	Follow bool
+	//if not available in logs
+	DomainName string
+	//Unique host id, must be configured by the user
+	HostId int
+	//used for metrics. Only the following specific values are supported: Other values will be ignored. Defaults to 10
+	// supported values: 1, 5, 10, 15, 30, 60
+	TimeWindowSizeMinutes int
+	//used for logs "re-logged" to a different file. parsed log entries will be written as 1 json entry per line into this file
+	//only used by writetofile.go
+	WriteToFileTargetFile string
+	HandlerInstances      map[string]SBOLogHandlerInterface
+	WriteMetricsToDb      bool
+	//database type, mysql (default when empty), postgres or sqlite. Schemas are created and upgraded using sbologp db migrate, see db/migrations.
+	//For sqlite DbDatabase is the path of the database file, which is created with its schema if it does not exist
+	DbDriver string
+	//Required when WriteMetricsToDb or OSMetricsEnabled are used
+	//to save OS metrics define an entry under OSMETRICS_CONFIG_KEY
+	DbAddress  string
+	DbUser     string
+	DbPassword string
+	DbDatabase string
+	//rows which can't be saved because the database is not available are written into files under this directory
+	//and saved when the database is available again. Each input has its own subdirectory. Empty means rows are lost
+	DbSpoolDirectory string
+	//oldest rows are dropped when the spool of an input is larger than this, 1024 (1GB) when 0
+	DbSpoolMaxSizeMB int
+	//retention settings of DomainName, applied hourly while running and by sbologp db prune. 0 means data is kept forever.
+	//Entries without DomainName configure domains without their own entries. Raw logs older than RawLogRetentionDays days are deleted,
+	//metrics older than MetricsRetentionDays days are rolled up into hourly metrics (sbo_metrics_hourly)
+	//and hourly metrics older than HourlyMetricsRetentionDays days are rolled up into daily metrics (sbo_metrics_daily), which are kept forever
+	RawLogRetentionDays        int
+	MetricsRetentionDays       int
+	HourlyMetricsRetentionDays int
+	//when true then if a metric entry already exists the will be replaced,
+	// when false then if a metric entry already exists then the value will be added to the existing value.
+	// Lines of files which were processed before are skipped (see db/ingestprogress.go), so false is safe when files are processed again
+	ReplaceExistingMetrics bool
+	//metric windows are pushed to MetricPushAddress (e.g 127.0.0.1:8125) when set, in addition to the database.
+	//MetricPushFormat is statsd (default), dogstatsd or graphite, MetricPushNetwork is udp (default for statsd) or tcp (default for graphite).
+	//Metric names are built using MetricPushNameTemplate with {domain}, {source}, {metric} and {key} placeholders, defaults to sbologp.{domain}.{metric}.{key}
+	//(sbologp.{metric} for dogstatsd, domain and key are sent as tags, sbologp.{domain}.{source}.{metric}.{key} for graphite). Requires the METRICS handler
+	MetricPushFormat       string
+	MetricPushNetwork      string
+	MetricPushAddress      string
+	MetricPushNameTemplate string
+	//metric windows are written in InfluxDB line protocol to InfluxOutput when set, in addition to the database. InfluxOutput is a file path
+	//or the url of an http write endpoint, e.g http://localhost:8086/api/v2/write?org=myorg&bucket=sbologp. InfluxToken is sent as
+	//"Authorization: Token <InfluxToken>" when set. When InfluxGzip is true requests are gzip compressed and files are written as gzip files.
+	//Under OSMETRICS_CONFIG_KEY OS metrics are written too. Requires the METRICS handler for log metrics
+	InfluxOutput string
+	InfluxToken  string
+	InfluxGzip   bool
+	//metric windows are exported to an OpenTelemetry collector using OTLP/HTTP when OtlpEndpoint is set, e.g http://localhost:4318.
+	//Metrics are sent to OtlpEndpoint/v1/metrics as delta sums, the OTLP_LOGS handler sends log entries to OtlpEndpoint/v1/logs.
+	//OtlpEncoding is protobuf (default) or json, OtlpHeaders are sent with each request, e.g {"Authorization": "Bearer <token>"}
+	OtlpEndpoint string
+	OtlpEncoding string
+	OtlpHeaders  map[string]string
+	//the ELASTICSEARCH handler sends log entries to Elasticsearch or OpenSearch at ElasticsearchUrl (e.g http://localhost:9200) using the _bulk api.
+	//ElasticsearchIndex is the index name with {domain} and {date} (UTC, e.g 2025.07.02) placeholders, defaults to sbologp-{date}.
+	//An index template is created for the indices unless there is one. Basic authentication is used when ElasticsearchUser is set,
+	//ElasticsearchApiKey is sent as "Authorization: ApiKey <ElasticsearchApiKey>" when set. Client IPs are omitted when SaveLogsToDbMaskIPs is true
+	ElasticsearchUrl      string
+	ElasticsearchIndex    string
+	ElasticsearchUser     string
+	ElasticsearchPassword string
+	ElasticsearchApiKey   string
+	//the LOKI handler pushes log entries to Grafana Loki at LokiUrl (e.g http://localhost:3100), labelled with domain, host, status_class, ua_family and human.
+	//LokiLineFormat is raw (default, lines as read) or json (parsed entries). LokiTenantId is sent as X-Scope-OrgID when set,
+	//basic authentication is used when LokiUser is set. Client IPs are masked when SaveLogsToDbMaskIPs is true
+	LokiUrl        string
+	LokiLineFormat string
+	LokiTenantId   string
+	LokiUser       string
+	LokiPassword   string
+	//Only a limited number of most recent time window values will be kept active and others will be removed out of scope (and saved)
+	// e.g if we encounter logs for 202507021121 and 202507021122 and 202507021123 then we should be able to handle them
+	// e.g if they are somehow unordered, e.g a request takes too long to complete and is logged after subsequent requests
+	// or when timewindow goes out of scope when new time window values are encountered
+	// this assumes/requires that the logs are in chronological order
+	MetricsWindowSize int
+	//number of top N items like IP addresses to be displayed in outputs for counter mode (when -p=count option is provided)
+	CounterTopNForKeyedMetrics int
+	//when following, interval for updating stats/output for counter mode (when -p=count option is provided)
+	CounterOutputIntervalSeconds int
+	//when true logs will be saved into an SBOanalytics mysql database
+	SaveLogsToDb bool
+	//when true, IP addresses will not be saved into SBOanalytics database
+	SaveLogsToDbMaskIPs bool
+	//when 1 requests from bots, scanners, 30x, 40x etc will be skipped. when 0 all logs will be saved into the database
+	//other values MAY be added in the future so you must treat it as an enum, which supports only 0 and 1 for the time being
+	SaveLogsToDbOnlyRelevant int
+	//when true, sensitive data such as passwords, api keys, JWTs, session ids and email addresses found in request uris and referers
+	//will be replaced with --REDACTED-- before handlers see the log entry or it's saved into the database.
+	//Requests containing sensitive data are counted regardless of this setting
+	RedactSensitiveData bool
+	//requests for static assets (images, videos etc) with a referer other than DomainName, domains in log lines (vhost logs)
+	//or domains in this list are considered hotlinking. Subdomains are allowed too, e.g cdn.example.com is allowed if example.com is in the list
+	HotlinkAllowedDomains []string
+	//clients receiving more than this many bytes in a time window (see TimeWindowSizeMinutes) will be reported. 0 disables client bandwidth checks.
+	//Note that ip addresses of reported clients are used as metric keys, clients are not reported when SaveLogsToDbMaskIPs is true
+	BandwidthClientBytesThreshold int64
+	//file containing spam referer domains, one domain per line. Requests with these referers are counted as referer spam instead of referers.
+	//Subdomains of listed domains are considered spam too. The file is loaded for each monitored file, referers flagged by heuristics
+	//(see RefererSpamHeuristics) are spam for the monitored file they were flagged for only
+	RefererSpamBlocklistFile string
+	//when true, referers will also be flagged as spam using heuristics, e.g visits from the referer are not followed by asset requests.
+	//Do not enable if static assets are not served from the monitored web server, e.g they are served from a CDN
+	RefererSpamHeuristics bool
+	//local json file to save read positions (checkpoints) into, e.g ./sbologp-checkpoints.json. Empty disables checkpoints.
+	//When there is a saved checkpoint for the file, processing resumes from the checkpoint and StartFrom is ignored.
+	//Files may share the same checkpoint file
+	CheckpointFile string
+	//when true, rotated versions of the file (e.g access.log.2.gz, access.log.1) are processed oldest first, before the file itself.
+	//StartFrom is ignored for the file itself when rotated files are found. Use with CheckpointFile, so rotated files are not processed again after restarts
+	BackfillRotatedFiles bool
+	//set to docker (json-file logging driver), cri (containerd, cri-o, kubernetes) or auto when the file is a container log file.
+	//Lines written by the container are unwrapped and partial lines are joined before they are parsed
+	ContainerLogFormat string
+	//when set to stdout or stderr, lines written to other streams are ignored. Empty for all streams
+	ContainerLogStream string
+	//when true, container name (or short container id if the name can't be found) found using the path of a container log file is used as DomainName,
+	//e.g web for /var/lib/docker/containers/<id>/<id>-json.log of a container named web. Capture groups in file path patterns take precedence
+	ContainerNameAsDomainName bool
+	//addresses to receive syslog messages on, e.g :5140 or 127.0.0.1:5140. Empty disables the protocol.
+	//Only used under SYSLOG_CONFIG_KEY, messages are processed using syslog:<tag> entries
+	SyslogUDPAddress string
+	SyslogTCPAddress string
+	//address to receive logs pushed via http on, e.g :8514 or 127.0.0.1:8514, and the bearer token clients must send.
+	//Only used under HTTP_INGEST_CONFIG_KEY, lines are processed using http:<source> entries
+	HttpIngestAddress string
+	HttpIngestToken   string
+	//address to expose metrics for Prometheus on, e.g :9464 or 127.0.0.1:9464, and the maximum number of series per metric (label value combinations).
+	//New series are counted using __other__ label values after the limit is reached, defaults to 1000. Only used under PROMETHEUS_CONFIG_KEY
+	PrometheusAddress   string
+	PrometheusMaxSeries int
+
+	//Enable OS metrics collection. Ignored for individual files and can be configured only under OSMETRICS_CONFIG_KEY
+	OSMetricsEnabled bool
+	//OS metrics collection minutes. Only the following specific values are supported: Other values will be ignored. Defaults to 10
+	// supported values: 1, 5, 10, 15, 30, 60
+	OSMetricsIntervalMinutes int
+}
+
+/*
+Don't log db password (note logging globalConfig directly won't call this method and will log the password)
+*/
+func (sd ConfigForAMonitoredFile) LogValue() slog.Value {
+	copySd := sd
+	copySd.DbPassword = "--REDACTED--"
+	if len(copySd.HttpIngestToken) > 0 {
+		copySd.HttpIngestToken = "--REDACTED--"
+	}
+	if len(copySd.InfluxToken) > 0 {
+		copySd.InfluxToken = "--REDACTED--"
+	}
+	if len(copySd.ElasticsearchPassword) > 0 {
+		copySd.ElasticsearchPassword = "--REDACTED--"
+	}
+	if len(copySd.ElasticsearchApiKey) > 0 {
+		copySd.ElasticsearchApiKey = "--REDACTED--"
+	}
+	if len(copySd.LokiPassword) > 0 {
+		copySd.LokiPassword = "--REDACTED--"
+	}
+	if len(copySd.OtlpHeaders) > 0 {
+		//header values are usually credentials
+		redactedHeaders := make(map[string]string, len(copySd.OtlpHeaders))
+		for headerName := range copySd.OtlpHeaders {
+			redactedHeaders[headerName] = "--REDACTED--"
+		}
+		copySd.OtlpHeaders = redactedHeaders
+	}
+	logBytes, _ := json.Marshal(copySd)
+	return slog.StringValue(string(logBytes[:]))
+}
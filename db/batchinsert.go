@@ -0,0 +1,240 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// rows per multi-row INSERT statement, larger batches are split into multiple statements in the same transaction
+const DB_MAX_ROWS_PER_STATEMENT int = 100
+
+// a metric row of a batch, see SBOStorage.SaveMetricDataBatch
+type MetricDataRow struct {
+	Data            *metrics.SBOMetricWindowDataToBeSaved
+	DomainId        int
+	ReplaceIfExists bool
+}
+
+// a raw log row of a batch, see SBOStorage.SaveRawLogBatch
+type RawLogRow struct {
+	Data     *logparsers.SBOHttpRequestLog
+	DomainId int
+	HostId   int
+	MaskIPs  bool
+}
+
+/*
+SQL differences between backends for multi-row inserts. Row templates use ? placeholders,
+which are replaced with $1, $2 etc when numberedPlaceholders is true
+*/
+type batchInsertDialect struct {
+	numberedPlaceholders bool
+	metricInsertPrefix   string
+	metricRowTemplate    string
+	metricAddSuffix      string
+	metricReplaceSuffix  string
+	metricArgs           func(row *MetricDataRow) []any
+	rawLogInsertPrefix   string
+	rawLogRowTemplate    string
+	//rows with a line hash which was saved before are skipped, see ingestprogress.go
+	rawLogInsertSuffix string
+	rawLogArgs         func(row *RawLogRow) []any
+}
+
+/*
+Prepared statements for multi-row inserts keyed by SQL. Statements are prepared on first use and reused,
+there are at most DB_MAX_ROWS_PER_STATEMENT statements per table since SQL depends only on the number of rows
+*/
+type batchStatements struct {
+	syncMutex  sync.Mutex
+	statements map[string]*sql.Stmt
+}
+
+func (statements *batchStatements) get(dbInstance *sql.DB, query string) (*sql.Stmt, error) {
+	statements.syncMutex.Lock()
+	defer statements.syncMutex.Unlock()
+	if statements.statements == nil {
+		statements.statements = make(map[string]*sql.Stmt)
+	}
+	if stmt, ok := statements.statements[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := dbInstance.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	statements.statements[query] = stmt
+	return stmt, nil
+}
+
+func (statements *batchStatements) close() {
+	statements.syncMutex.Lock()
+	defer statements.syncMutex.Unlock()
+	for _, stmt := range statements.statements {
+		stmt.Close()
+	}
+	statements.statements = nil
+}
+
+/*
+Returns rowCount comma separated copies of rowTemplate, e.g "(?, ?), (?, ?)" or "($1, $2), ($3, $4)" when numberedPlaceholders is true
+*/
+func multiRowValues(rowTemplate string, rowCount int, numberedPlaceholders bool) string {
+	var builder strings.Builder
+	placeholderNumber := 1
+	for row := 0; row < rowCount; row++ {
+		if row > 0 {
+			builder.WriteString(", ")
+		}
+		if !numberedPlaceholders {
+			builder.WriteString(rowTemplate)
+			continue
+		}
+		for _, char := range rowTemplate {
+			if char == '?' {
+				builder.WriteByte('$')
+				builder.WriteString(strconv.Itoa(placeholderNumber))
+				placeholderNumber++
+			} else {
+				builder.WriteRune(char)
+			}
+		}
+	}
+	return builder.String()
+}
+
+/*
+Executes multi-row inserts for rows in a single transaction, DB_MAX_ROWS_PER_STATEMENT rows per statement. Rows are inserted in order
+*/
+func execBatchInsert[T any](dbInstance *sql.DB, statements *batchStatements, rows []T, queryPrefix string, rowTemplate string, querySuffix string,
+	numberedPlaceholders bool, rowArgs func(row *T) []any) error {
+	if len(rows) < 1 {
+		return nil
+	}
+	if dbInstance == nil {
+		return errors.New("database is not initialized")
+	}
+	//statements are prepared before the transaction starts, preparing needs a connection which may not be available
+	//while the transaction is using one, e.g sqlite uses a single connection
+	chunkStatements := make([]*sql.Stmt, 0, len(rows)/DB_MAX_ROWS_PER_STATEMENT+1)
+	for start := 0; start < len(rows); start += DB_MAX_ROWS_PER_STATEMENT {
+		chunkLength := min(DB_MAX_ROWS_PER_STATEMENT, len(rows)-start)
+		stmt, err := statements.get(dbInstance, queryPrefix+multiRowValues(rowTemplate, chunkLength, numberedPlaceholders)+querySuffix)
+		if err != nil {
+			return err
+		}
+		chunkStatements = append(chunkStatements, stmt)
+	}
+	tx, err := dbInstance.Begin()
+	if err != nil {
+		return err
+	}
+	for chunkIndex, stmt := range chunkStatements {
+		start := chunkIndex * DB_MAX_ROWS_PER_STATEMENT
+		chunk := rows[start:min(start+DB_MAX_ROWS_PER_STATEMENT, len(rows))]
+		args := make([]any, 0, len(chunk)*strings.Count(rowTemplate, "?"))
+		for index := range chunk {
+			args = append(args, rowArgs(&chunk[index])...)
+		}
+		if _, err := tx.Stmt(stmt).Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Saves metric rows using dialect. Rows must not contain duplicate keys, see MergeMetricDataRows.
+Rows with ReplaceIfExists and other rows are saved using separate statements in the same order
+*/
+func saveMetricDataBatch(dbInstance *sql.DB, statements *batchStatements, dialect *batchInsertDialect, rows []MetricDataRow) error {
+	addRows := make([]MetricDataRow, 0, len(rows))
+	replaceRows := make([]MetricDataRow, 0)
+	for _, row := range rows {
+		if row.ReplaceIfExists {
+			replaceRows = append(replaceRows, row)
+		} else {
+			addRows = append(addRows, row)
+		}
+	}
+	err := execBatchInsert(dbInstance, statements, addRows, dialect.metricInsertPrefix, dialect.metricRowTemplate, dialect.metricAddSuffix,
+		dialect.numberedPlaceholders, dialect.metricArgs)
+	if err != nil {
+		return err
+	}
+	return execBatchInsert(dbInstance, statements, replaceRows, dialect.metricInsertPrefix, dialect.metricRowTemplate, dialect.metricReplaceSuffix,
+		dialect.numberedPlaceholders, dialect.metricArgs)
+}
+
+func saveRawLogBatch(dbInstance *sql.DB, statements *batchStatements, dialect *batchInsertDialect, rows []RawLogRow) error {
+	return execBatchInsert(dbInstance, statements, rows, dialect.rawLogInsertPrefix, dialect.rawLogRowTemplate, dialect.rawLogInsertSuffix,
+		dialect.numberedPlaceholders, dialect.rawLogArgs)
+}
+
+// null when the line hash is not known
+func rawLogLineHash(data *logparsers.SBOHttpRequestLog) any {
+	if len(data.LineHash) < 1 {
+		return nil
+	}
+	return data.LineHash
+}
+
+/*
+Merges rows with the same key (domain, metric type, key value as saved and time window), keeping the order of first occurrences.
+Values are added, or the last value is kept for rows with ReplaceIfExists. Backends may reject statements updating the same row twice,
+e.g postgres ON CONFLICT DO UPDATE
+*/
+func MergeMetricDataRows(rows []MetricDataRow) []MetricDataRow {
+	type metricRowKey struct {
+		domainId        int
+		metricType      int
+		keyValue        string
+		timeWindow      int64
+		replaceIfExists bool
+	}
+	indexes := make(map[metricRowKey]int)
+	merged := make([]MetricDataRow, 0, len(rows))
+	for _, row := range rows {
+		key := metricRowKey{row.DomainId, row.Data.MetricType, ReduceToMaxColumnLen(row.Data.KeyValue, 100), row.Data.TimeWindow, row.ReplaceIfExists}
+		index, found := indexes[key]
+		if !found {
+			indexes[key] = len(merged)
+			dataCopy := *row.Data
+			row.Data = &dataCopy
+			merged = append(merged, row)
+			continue
+		}
+		if row.ReplaceIfExists {
+			merged[index].Data.MetricValue = row.Data.MetricValue
+		} else {
+			merged[index].Data.MetricValue += row.Data.MetricValue
+		}
+	}
+	return merged
+}
@@ -0,0 +1,589 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	// rows are flushed when this many rows are buffered ...
+	DB_BATCH_MAX_ROWS int = 500
+	// ... or when the oldest buffered row was queued this long ago
+	DB_BATCH_FLUSH_INTERVAL time.Duration = time.Second
+	// rows waiting to be buffered. Saving blocks when the queue is full, i.e when the database can't keep up
+	DB_BATCH_QUEUE_SIZE int = 10000
+	// spooled rows are replayed this long after a failure, the interval is doubled after each failed retry up to DB_SPOOL_RETRY_MAX_INTERVAL
+	DB_SPOOL_RETRY_MIN_INTERVAL time.Duration = time.Second
+	DB_SPOOL_RETRY_MAX_INTERVAL time.Duration = 5 * time.Minute
+	// domain ids returned by GetDomainId when the database is not available and rows are spooled, see SBOBatchWriter.GetDomainId
+	DB_PENDING_DOMAIN_ID_BASE int = -1000000
+)
+
+var errDatabaseNotInitialized = errors.New("database is not initialized")
+
+// one of metric, rawLog, progress or afterSaved is set
+type batchWriterItem struct {
+	metric     *MetricDataRow
+	rawLog     *RawLogRow
+	progress   *IngestProgressRow
+	afterSaved func()
+}
+
+type pendingDomain struct {
+	domainName            string
+	timeWindowSizeMinutes int
+}
+
+/*
+Wraps a storage backend so SaveMetricData and SaveRawLog only queue rows, which are saved by a background goroutine
+using multi-row inserts in transactions, see DB_BATCH_* constants. Callers don't wait for the database,
+so Save* methods always return true and errors are only logged and counted in stats.
+Raw logs are inserted in the order they were queued. Metric rows with the same key are merged before saving, see MergeMetricDataRows.
+Ingest progress rows are saved after the rows queued before them were saved, see also AfterQueuedRowsSaved. Close must be called to save remaining rows.
+
+When a spool is used, rows which can't be saved are appended to the spool instead of being lost, and all rows are spooled
+until the spool is replayed, so rows are saved in order. Replaying is retried with exponential backoff, the storage is
+initialized again before each retry. Rows left in the spool when closing are replayed by the next writer using the same spool directory.
+*/
+type SBOBatchWriter struct {
+	SBOStorage
+	queue chan batchWriterItem
+	//may be nil
+	stats        *metrics.SBOPipelineStats
+	done         chan struct{}
+	closeOnce    sync.Once
+	metricRows   []MetricDataRow
+	rawLogRows   []RawLogRow
+	progressRows []IngestProgressRow
+	afterSaved   []func()
+	//nil when not spooling
+	spool *SBOSpool
+	//initializes the storage, e.g calls Init with the same parameters as the first time, may be nil
+	reconnect func() (bool, error)
+	//held for writing while reconnecting, other methods of the storage must not be called while it's closed and initialized again
+	storageMutex sync.RWMutex
+	//domains used while the database was not available, see GetDomainId
+	pendingDomainsMutex sync.Mutex
+	pendingDomainIds    map[string]int
+	pendingDomains      []pendingDomain
+	//true while rows are spooled instead of saved, i.e after a failure until the spool is replayed
+	spooling      bool
+	retryInterval time.Duration
+	nextRetry     time.Time
+}
+
+/*
+storage should be initialized by the caller, stats, spool and reconnect may be nil
+*/
+func NewSBOBatchWriter(storage SBOStorage, stats *metrics.SBOPipelineStats, spool *SBOSpool, reconnect func() (bool, error)) *SBOBatchWriter {
+	writer := &SBOBatchWriter{
+		SBOStorage:       storage,
+		queue:            make(chan batchWriterItem, DB_BATCH_QUEUE_SIZE),
+		stats:            stats,
+		done:             make(chan struct{}),
+		metricRows:       make([]MetricDataRow, 0, DB_BATCH_MAX_ROWS),
+		rawLogRows:       make([]RawLogRow, 0, DB_BATCH_MAX_ROWS),
+		progressRows:     make([]IngestProgressRow, 0),
+		afterSaved:       make([]func(), 0),
+		spool:            spool,
+		reconnect:        reconnect,
+		pendingDomainIds: make(map[string]int),
+		pendingDomains:   make([]pendingDomain, 0),
+		retryInterval:    DB_SPOOL_RETRY_MIN_INTERVAL}
+	if spool != nil && !spool.IsEmpty() {
+		//rows from a previous run are replayed first
+		writer.spooling = true
+		writer.nextRetry = time.Now()
+	}
+	go writer.run()
+	return writer
+}
+
+// always true when spooling, rows are accepted even if the database is not available
+func (writer *SBOBatchWriter) IsInitialized() bool {
+	if writer.spool != nil {
+		return true
+	}
+	writer.storageMutex.RLock()
+	defer writer.storageMutex.RUnlock()
+	return writer.SBOStorage.IsInitialized()
+}
+
+/*
+When spooling and the database is not available, returns a pending domain id (DB_PENDING_DOMAIN_ID_BASE or less) instead of failing.
+Pending ids are only meaningful for rows saved using this writer, the real domain id is found when rows are saved
+*/
+func (writer *SBOBatchWriter) GetDomainId(domainName string, timeWindowSizeInMinutes int) (int, error) {
+	if writer.spool != nil {
+		writer.pendingDomainsMutex.Lock()
+		pendingDomainId, found := writer.pendingDomainIds[domainName]
+		writer.pendingDomainsMutex.Unlock()
+		if found {
+			//don't wait for the database again, it was not available a moment ago
+			return pendingDomainId, nil
+		}
+	}
+	writer.storageMutex.RLock()
+	domainId, err := -1, errDatabaseNotInitialized
+	if writer.SBOStorage.IsInitialized() {
+		domainId, err = writer.SBOStorage.GetDomainId(domainName, timeWindowSizeInMinutes)
+	}
+	writer.storageMutex.RUnlock()
+	if writer.spool == nil || (err == nil && domainId > 0) {
+		return domainId, err
+	}
+
+	writer.pendingDomainsMutex.Lock()
+	defer writer.pendingDomainsMutex.Unlock()
+	if pendingDomainId, found := writer.pendingDomainIds[domainName]; found {
+		return pendingDomainId, nil
+	}
+	pendingDomainId := DB_PENDING_DOMAIN_ID_BASE - len(writer.pendingDomains)
+	writer.pendingDomainIds[domainName] = pendingDomainId
+	writer.pendingDomains = append(writer.pendingDomains, pendingDomain{domainName: domainName, timeWindowSizeMinutes: timeWindowSizeInMinutes})
+	return pendingDomainId, nil
+}
+
+func (writer *SBOBatchWriter) GetFileId(domainId int, hostname string, filePath string) (int, error) {
+	writer.storageMutex.RLock()
+	defer writer.storageMutex.RUnlock()
+	if !writer.SBOStorage.IsInitialized() {
+		return -1, errDatabaseNotInitialized
+	}
+	return writer.SBOStorage.GetFileId(domainId, hostname, filePath)
+}
+
+// pending domain ids are resolved first, fails while the database is not available
+func (writer *SBOBatchWriter) GetIngestOffset(domainId int, sourceId string) (int64, error) {
+	writer.storageMutex.RLock()
+	defer writer.storageMutex.RUnlock()
+	if !writer.SBOStorage.IsInitialized() {
+		return 0, errDatabaseNotInitialized
+	}
+	domainId, err := writer.resolveDomainId(domainId)
+	if err != nil {
+		return 0, err
+	}
+	if domainId < 1 {
+		return 0, errors.New("invalid domain id")
+	}
+	return writer.SBOStorage.GetIngestOffset(domainId, sourceId)
+}
+
+func (writer *SBOBatchWriter) getPendingDomain(domainId int) (pendingDomain, bool) {
+	if domainId > DB_PENDING_DOMAIN_ID_BASE {
+		return pendingDomain{}, false
+	}
+	writer.pendingDomainsMutex.Lock()
+	defer writer.pendingDomainsMutex.Unlock()
+	index := DB_PENDING_DOMAIN_ID_BASE - domainId
+	if index >= len(writer.pendingDomains) {
+		return pendingDomain{}, false
+	}
+	return writer.pendingDomains[index], true
+}
+
+// returns the real domain id for pending domain ids, other ids are returned as is
+func (writer *SBOBatchWriter) resolveDomainId(domainId int) (int, error) {
+	domain, found := writer.getPendingDomain(domainId)
+	if !found {
+		return domainId, nil
+	}
+	resolvedDomainId, err := writer.SBOStorage.GetDomainId(domain.domainName, domain.timeWindowSizeMinutes)
+	if err == nil && resolvedDomainId < 1 {
+		err = errors.New("invalid domain id")
+	}
+	return resolvedDomainId, err
+}
+
+func (writer *SBOBatchWriter) SaveMetricData(data *metrics.SBOMetricWindowDataToBeSaved, domainId int, replaceIfExists bool) (bool, error) {
+	writer.queue <- batchWriterItem{metric: &MetricDataRow{Data: data, DomainId: domainId, ReplaceIfExists: replaceIfExists}}
+	return true, nil
+}
+
+func (writer *SBOBatchWriter) SaveRawLog(data *logparsers.SBOHttpRequestLog, domainId int, hostId int, maskIPs bool) (bool, error) {
+	writer.queue <- batchWriterItem{rawLog: &RawLogRow{Data: data, DomainId: domainId, HostId: hostId, MaskIPs: maskIPs}}
+	return true, nil
+}
+
+// rows are queued, see SBOBatchWriter
+func (writer *SBOBatchWriter) SaveIngestProgressBatch(rows []IngestProgressRow) error {
+	for index := range rows {
+		writer.queue <- batchWriterItem{progress: &rows[index]}
+	}
+	return nil
+}
+
+/*
+callback is called by the writer goroutine after the rows queued before it were saved or spooled.
+It's not called if the rows are lost, e.g when spooling fails
+*/
+func (writer *SBOBatchWriter) AfterQueuedRowsSaved(callback func()) {
+	writer.queue <- batchWriterItem{afterSaved: callback}
+}
+
+/*
+Saves remaining rows, then closes the storage. Save* methods must not be called after Close
+*/
+func (writer *SBOBatchWriter) Close() (bool, error) {
+	writer.closeOnce.Do(func() {
+		close(writer.queue)
+		<-writer.done
+	})
+	if !writer.SBOStorage.IsInitialized() {
+		return true, nil
+	}
+	return writer.SBOStorage.Close()
+}
+
+func (writer *SBOBatchWriter) run() {
+	defer close(writer.done)
+	ticker := time.NewTicker(DB_BATCH_FLUSH_INTERVAL)
+	defer ticker.Stop()
+	var oldestQueued time.Time
+	for {
+		select {
+		case item, ok := <-writer.queue:
+			if !ok {
+				writer.flush()
+				//one last try, without waiting for the retry interval
+				if writer.spooling && !writer.retrySpool() {
+					slog.Warn("Rows are kept in the spool, they will be saved when processing starts again", "rows", writer.spool.Rows())
+				}
+				return
+			}
+			if writer.pendingCount() == 0 {
+				oldestQueued = time.Now()
+			}
+			if item.metric != nil {
+				writer.metricRows = append(writer.metricRows, *item.metric)
+			} else if item.rawLog != nil {
+				writer.rawLogRows = append(writer.rawLogRows, *item.rawLog)
+			} else if item.progress != nil {
+				writer.progressRows = append(writer.progressRows, *item.progress)
+			} else {
+				writer.afterSaved = append(writer.afterSaved, item.afterSaved)
+			}
+			if len(writer.metricRows)+len(writer.rawLogRows) >= DB_BATCH_MAX_ROWS {
+				writer.flush()
+			}
+		case <-ticker.C:
+			if writer.pendingCount() > 0 && time.Since(oldestQueued) >= DB_BATCH_FLUSH_INTERVAL {
+				writer.flush()
+			}
+			if writer.spooling && !time.Now().Before(writer.nextRetry) {
+				writer.retrySpool()
+			}
+		}
+	}
+}
+
+// rows and callbacks waiting to be flushed
+func (writer *SBOBatchWriter) pendingCount() int {
+	return len(writer.metricRows) + len(writer.rawLogRows) + len(writer.progressRows) + len(writer.afterSaved)
+}
+
+func (writer *SBOBatchWriter) flush() {
+	if writer.pendingCount() == 0 {
+		return
+	}
+	startTime := time.Now()
+	//rows which were queued and saved, i.e before merging metric rows
+	rowsWritten := 0
+	errorCount := 0
+	mergedMetricRows := MergeMetricDataRows(writer.metricRows)
+	//rows which were committed must not be spooled, metric values are added to existing values when spooled rows are saved
+	rawLogsSaved := false
+	metricsSaved := false
+	progressSaved := false
+	retryProgress := false
+	if !writer.spooling {
+		if err := writer.saveRawLogRows(writer.rawLogRows); err != nil {
+			errorCount++
+			slog.Error("Failed to save raw log batch", "rows", len(writer.rawLogRows), "error", err)
+			writer.startSpooling()
+		} else {
+			rawLogsSaved = true
+			rowsWritten += len(writer.rawLogRows)
+		}
+	}
+	if !writer.spooling {
+		if err := writer.saveMetricRows(mergedMetricRows); err != nil {
+			errorCount++
+			slog.Error("Failed to save metric batch", "rows", len(mergedMetricRows), "error", err)
+			writer.startSpooling()
+		} else {
+			metricsSaved = true
+			rowsWritten += len(writer.metricRows)
+		}
+	}
+	//saved last, progress must not be saved unless rows queued before it were saved
+	if !writer.spooling && errorCount == 0 {
+		if err := writer.saveProgressRows(writer.progressRows); err != nil {
+			errorCount++
+			slog.Error("Failed to save ingest progress", "rows", len(writer.progressRows), "error", err)
+			writer.startSpooling()
+			//without a spool rows are saved again in the next flush, saving an offset again does not change anything
+			retryProgress = writer.spool == nil
+		} else {
+			progressSaved = true
+			rowsWritten += len(writer.progressRows)
+		}
+	}
+	spooledRows := 0
+	if writer.spooling {
+		records := make([]spoolRecord, 0, len(writer.rawLogRows)+len(mergedMetricRows)+len(writer.progressRows))
+		if !rawLogsSaved {
+			for index := range writer.rawLogRows {
+				records = append(records, writer.rawLogSpoolRecord(&writer.rawLogRows[index]))
+			}
+		}
+		if !metricsSaved {
+			for index := range mergedMetricRows {
+				records = append(records, writer.metricSpoolRecord(&mergedMetricRows[index]))
+			}
+		}
+		if !progressSaved {
+			for index := range writer.progressRows {
+				records = append(records, writer.progressSpoolRecord(&writer.progressRows[index]))
+			}
+		}
+		if err := writer.spool.Append(records); err != nil {
+			errorCount++
+			slog.Error("Failed to spool rows, rows are lost", "rows", len(records), "error", err)
+		} else {
+			spooledRows = len(records)
+		}
+	}
+	slog.Debug("Flushed database batch", "rawLogRows", len(writer.rawLogRows), "metricRows", len(writer.metricRows), "mergedMetricRows", len(mergedMetricRows),
+		"spooledRows", spooledRows, "errors", errorCount, "duration", time.Since(startTime))
+	if writer.stats != nil {
+		writer.stats.DbRowsWritten.Add(int64(rowsWritten))
+		writer.stats.DbBatchesWritten.Add(1)
+		writer.stats.DbWriteErrors.Add(int64(errorCount))
+		writer.stats.DbWriteNanos.Add(int64(time.Since(startTime)))
+	}
+	//rows which could not be saved are either spooled or lost
+	if errorCount == 0 || spooledRows > 0 {
+		for _, callback := range writer.afterSaved {
+			callback()
+		}
+	}
+	writer.metricRows = writer.metricRows[:0]
+	writer.rawLogRows = writer.rawLogRows[:0]
+	if !retryProgress {
+		writer.progressRows = writer.progressRows[:0]
+	}
+	writer.afterSaved = writer.afterSaved[:0]
+}
+
+// saves rows, resolving pending domain ids first. Rows are modified
+func (writer *SBOBatchWriter) saveRawLogRows(rows []RawLogRow) error {
+	if !writer.SBOStorage.IsInitialized() {
+		return errDatabaseNotInitialized
+	}
+	for index := range rows {
+		domainId, err := writer.resolveDomainId(rows[index].DomainId)
+		if err != nil {
+			return err
+		}
+		rows[index].DomainId = domainId
+	}
+	return writer.SBOStorage.SaveRawLogBatch(rows)
+}
+
+// saves rows, resolving pending domain ids first. Rows are modified
+func (writer *SBOBatchWriter) saveMetricRows(rows []MetricDataRow) error {
+	if !writer.SBOStorage.IsInitialized() {
+		return errDatabaseNotInitialized
+	}
+	for index := range rows {
+		domainId, err := writer.resolveDomainId(rows[index].DomainId)
+		if err != nil {
+			return err
+		}
+		rows[index].DomainId = domainId
+	}
+	return writer.SBOStorage.SaveMetricDataBatch(rows)
+}
+
+// saves rows, resolving pending domain ids first. Rows are modified
+func (writer *SBOBatchWriter) saveProgressRows(rows []IngestProgressRow) error {
+	if len(rows) < 1 {
+		return nil
+	}
+	if !writer.SBOStorage.IsInitialized() {
+		return errDatabaseNotInitialized
+	}
+	for index := range rows {
+		domainId, err := writer.resolveDomainId(rows[index].DomainId)
+		if err != nil {
+			return err
+		}
+		rows[index].DomainId = domainId
+	}
+	return writer.SBOStorage.SaveIngestProgressBatch(rows)
+}
+
+func (writer *SBOBatchWriter) startSpooling() {
+	if writer.spool == nil || writer.spooling {
+		return
+	}
+	slog.Warn("Database is not available, rows will be spooled until it's available again", "retryIn", DB_SPOOL_RETRY_MIN_INTERVAL)
+	writer.spooling = true
+	writer.retryInterval = DB_SPOOL_RETRY_MIN_INTERVAL
+	writer.nextRetry = time.Now().Add(writer.retryInterval)
+}
+
+// pending domain ids are replaced with domain names, since pending ids are only valid in this writer
+func (writer *SBOBatchWriter) newSpoolRecord(domainId int) (spoolRecord, int) {
+	record := spoolRecord{}
+	if domain, found := writer.getPendingDomain(domainId); found {
+		record.DomainName = domain.domainName
+		record.TimeWindowSizeMinutes = domain.timeWindowSizeMinutes
+		domainId = 0
+	}
+	return record, domainId
+}
+
+func (writer *SBOBatchWriter) metricSpoolRecord(row *MetricDataRow) spoolRecord {
+	record, domainId := writer.newSpoolRecord(row.DomainId)
+	record.Metric = &MetricDataRow{Data: row.Data, DomainId: domainId, ReplaceIfExists: row.ReplaceIfExists}
+	return record
+}
+
+func (writer *SBOBatchWriter) rawLogSpoolRecord(row *RawLogRow) spoolRecord {
+	record, domainId := writer.newSpoolRecord(row.DomainId)
+	dataCopy := *row.Data
+	if row.MaskIPs {
+		//IPs are not saved, so they are not written into the spool either
+		dataCopy.ClientIP = ""
+	}
+	if len(dataCopy.LineHash) < 1 {
+		//spooled rows may be replayed twice (see SBOSpool.Replay), rows with the same line hash are inserted once
+		dataCopy.LineHash = newSpoolLineHash()
+	}
+	record.RawLog = &RawLogRow{Data: &dataCopy, DomainId: domainId, HostId: row.HostId, MaskIPs: row.MaskIPs}
+	return record
+}
+
+func (writer *SBOBatchWriter) progressSpoolRecord(row *IngestProgressRow) spoolRecord {
+	record, domainId := writer.newSpoolRecord(row.DomainId)
+	record.Progress = &IngestProgressRow{DomainId: domainId, SourceId: row.SourceId, Offset: row.Offset}
+	return record
+}
+
+/*
+Initializes the storage again and replays the spool. Returns true if the spool was replayed, otherwise the next retry is scheduled
+*/
+func (writer *SBOBatchWriter) retrySpool() bool {
+	writer.storageMutex.Lock()
+	if writer.reconnect != nil {
+		if writer.SBOStorage.IsInitialized() {
+			writer.SBOStorage.Close()
+		}
+		writer.reconnect()
+	}
+	initialized := writer.SBOStorage.IsInitialized()
+	writer.storageMutex.Unlock()
+
+	err := errDatabaseNotInitialized
+	if initialized {
+		err = writer.spool.Replay(writer.saveSpooledRecords)
+	}
+	if err != nil {
+		writer.retryInterval = min(writer.retryInterval*2, DB_SPOOL_RETRY_MAX_INTERVAL)
+		writer.nextRetry = time.Now().Add(writer.retryInterval)
+		slog.Warn("Failed to save spooled rows", "rows", writer.spool.Rows(), "retryIn", writer.retryInterval, "error", err)
+		if writer.stats != nil {
+			writer.stats.DbWriteErrors.Add(1)
+		}
+		return false
+	}
+	slog.Info("Database is available, saved spooled rows")
+	writer.spooling = false
+	writer.retryInterval = DB_SPOOL_RETRY_MIN_INTERVAL
+	return true
+}
+
+// records are of the same type, see SBOSpool.Replay
+func (writer *SBOBatchWriter) saveSpooledRecords(records []spoolRecord) error {
+	startTime := time.Now()
+	domainIds := make([]int, len(records))
+	for index, record := range records {
+		if len(record.DomainName) < 1 {
+			continue
+		}
+		domainId, err := writer.SBOStorage.GetDomainId(record.DomainName, record.TimeWindowSizeMinutes)
+		if err != nil {
+			return err
+		}
+		domainIds[index] = domainId
+	}
+	var err error
+	switch records[0].recordType() {
+	case SPOOL_RECORD_METRIC:
+		rows := make([]MetricDataRow, 0, len(records))
+		for index, record := range records {
+			row := *record.Metric
+			if len(record.DomainName) > 0 {
+				row.DomainId = domainIds[index]
+			}
+			rows = append(rows, row)
+		}
+		err = writer.SBOStorage.SaveMetricDataBatch(MergeMetricDataRows(rows))
+	case SPOOL_RECORD_RAW_LOG:
+		rows := make([]RawLogRow, 0, len(records))
+		for index, record := range records {
+			row := *record.RawLog
+			if len(record.DomainName) > 0 {
+				row.DomainId = domainIds[index]
+			}
+			rows = append(rows, row)
+		}
+		err = writer.SBOStorage.SaveRawLogBatch(rows)
+	case SPOOL_RECORD_INGEST_PROGRESS:
+		rows := make([]IngestProgressRow, 0, len(records))
+		for index, record := range records {
+			row := *record.Progress
+			if len(record.DomainName) > 0 {
+				row.DomainId = domainIds[index]
+			}
+			rows = append(rows, row)
+		}
+		err = writer.SBOStorage.SaveIngestProgressBatch(rows)
+	}
+	if err != nil {
+		return err
+	}
+	if writer.stats != nil {
+		writer.stats.DbRowsWritten.Add(int64(len(records)))
+		writer.stats.DbBatchesWritten.Add(1)
+		writer.stats.DbWriteNanos.Add(int64(time.Since(startTime)))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func TestMultiRowValues(t *testing.T) {
+	if values := multiRowValues("(?, ?)", 2, false); values != "(?, ?), (?, ?)" {
+		t.Errorf("Unexpected values %v", values)
+	}
+	if values := multiRowValues("(?, now())", 3, true); values != "($1, now()), ($2, now()), ($3, now())" {
+		t.Errorf("Unexpected numbered values %v", values)
+	}
+}
+
+func TestMergeMetricDataRows(t *testing.T) {
+	newRow := func(keyValue string, value int64, replaceIfExists bool) MetricDataRow {
+		return MetricDataRow{Data: metrics.NewSBOMetricWindowDataToBeSaved("f", 1, keyValue, 202507011000, value), DomainId: 1, ReplaceIfExists: replaceIfExists}
+	}
+	rows := []MetricDataRow{newRow("a", 1, false), newRow("b", 2, false), newRow("a", 3, false), newRow("c", 4, true), newRow("c", 5, true)}
+	merged := MergeMetricDataRows(rows)
+	if len(merged) != 3 || merged[0].Data.KeyValue != "a" || merged[0].Data.MetricValue != 4 || merged[1].Data.MetricValue != 2 || merged[2].Data.MetricValue != 5 {
+		t.Errorf("Unexpected merge result %+v %+v %+v", merged[0].Data, merged[1].Data, merged[2].Data)
+	}
+	if rows[0].Data.MetricValue != 1 {
+		t.Errorf("Merging must not modify queued rows")
+	}
+}
+
+func TestBatchWriterSQLite(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	storage := NewSBOSQLiteDB()
+	storage.Init("", "", "", databaseFile)
+	stats := &metrics.SBOPipelineStats{}
+	writer := NewSBOBatchWriter(storage, stats, nil, nil)
+	const rawLogCount = DB_BATCH_MAX_ROWS*2 + 17
+	for index := 0; index < rawLogCount; index++ {
+		logEntry := &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC),
+			Path: fmt.Sprintf("/%v", index), Status: "200", UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0")}
+		writer.SaveRawLog(logEntry, 1, 1, false)
+		//values must be added for this key
+		writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", 202507011000, 2), 1, false)
+		//last value must be kept for this key
+		writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 2, "x", 202507011000, int64(index)), 1, true)
+	}
+	writer.Close()
+	if stats.DbRowsWritten.Load() != int64(rawLogCount*3) || stats.DbWriteErrors.Load() != 0 || stats.DbBatchesWritten.Load() < 3 {
+		t.Errorf("Unexpected stats rows=%v errors=%v batches=%v", stats.DbRowsWritten.Load(), stats.DbWriteErrors.Load(), stats.DbBatchesWritten.Load())
+	}
+
+	sbosdb := NewSBOSQLiteDB()
+	sbosdb.Init("", "", "", databaseFile)
+	defer sbosdb.Close()
+	var rawLogs, addedValue, replacedValue int64
+	var firstPath, lastPath string
+	sbosdb.DbInstance.QueryRow("SELECT count(*) FROM sbo_rawlogs").Scan(&rawLogs)
+	sbosdb.DbInstance.QueryRow("SELECT request_uri FROM sbo_rawlogs ORDER BY log_id LIMIT 1").Scan(&firstPath)
+	sbosdb.DbInstance.QueryRow("SELECT request_uri FROM sbo_rawlogs ORDER BY log_id DESC LIMIT 1").Scan(&lastPath)
+	sbosdb.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE metric_type=1").Scan(&addedValue)
+	sbosdb.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE metric_type=2").Scan(&replacedValue)
+	if rawLogs != int64(rawLogCount) || firstPath != "/0" || lastPath != fmt.Sprintf("/%v", rawLogCount-1) {
+		t.Errorf("Unexpected raw logs count=%v first=%v last=%v", rawLogs, firstPath, lastPath)
+	}
+	if addedValue != int64(rawLogCount*2) || replacedValue != int64(rawLogCount-1) {
+		t.Errorf("Unexpected metric values added=%v replaced=%v", addedValue, replacedValue)
+	}
+}
+
+func TestBatchWriterAfterQueuedRowsSaved(t *testing.T) {
+	storage := NewSBOSQLiteDB()
+	storage.Init("", "", "", filepath.Join(t.TempDir(), "sbo.db"))
+	stats := &metrics.SBOPipelineStats{}
+	writer := NewSBOBatchWriter(storage, stats, nil, nil)
+	defer writer.Close()
+	for index := 0; index < 10; index++ {
+		writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 1, fmt.Sprintf("%v", index), 202507011000, 1), 1, false)
+	}
+	rowsWhenCalled := make(chan int64, 1)
+	writer.AfterQueuedRowsSaved(func() {
+		rowsWhenCalled <- stats.DbRowsWritten.Load()
+	})
+	//not closed, rows are flushed after DB_BATCH_FLUSH_INTERVAL
+	select {
+	case rows := <-rowsWhenCalled:
+		if rows != 10 {
+			t.Errorf("Callback was called before rows were saved, rows=%v", rows)
+		}
+	case <-time.After(5 * DB_BATCH_FLUSH_INTERVAL):
+		t.Fatal("Callback was not called")
+	}
+	//callbacks without rows are called too
+	writer.AfterQueuedRowsSaved(func() {
+		rowsWhenCalled <- stats.DbRowsWritten.Load()
+	})
+	select {
+	case <-rowsWhenCalled:
+	case <-time.After(5 * DB_BATCH_FLUSH_INTERVAL):
+		t.Fatal("Callback was not called when there were no rows")
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+/*
+Idempotent ingestion: processing lines which were processed before must not change metrics or add raw logs again.
+A source is a file identified by the hash of its first line (see inputs.FileIdentity), so it's recognized after it's renamed
+(rotated), compressed or copied. After all metrics of the lines of a source up to an offset are saved, the offset is saved
+into sbo_ingest_progress and lines before the offset are skipped when the source is processed again.
+Raw logs of files are saved with a line hash (see LineHash) and rows with the same hash are inserted once,
+e.g when a file is processed again after the process was killed before its progress was saved
+*/
+
+// a row of sbo_ingest_progress, see SBOStorage.SaveIngestProgressBatch
+type IngestProgressRow struct {
+	DomainId int
+	SourceId string
+	//offset of the line after the last processed line, i.e lines ending at or before this offset were processed
+	Offset int64
+}
+
+type ingestProgressDialect struct {
+	//parameters: domain id, source id
+	selectOffset string
+	//parameters: domain id, source id, offset. Offsets must not decrease
+	saveOffset string
+}
+
+var mysqlIngestProgressDialect = ingestProgressDialect{
+	selectOffset: "SELECT committed_offset FROM sbo_ingest_progress WHERE domain_id = ? AND source_id = ?",
+	saveOffset: "INSERT INTO sbo_ingest_progress (domain_id, source_id, committed_offset, updated) VALUES (?, ?, ?, now()) " +
+		" ON DUPLICATE KEY UPDATE committed_offset = GREATEST(committed_offset, VALUES(committed_offset)), updated = now()"}
+
+var postgresIngestProgressDialect = ingestProgressDialect{
+	selectOffset: "SELECT committed_offset FROM sbo_ingest_progress WHERE domain_id = $1 AND source_id = $2",
+	saveOffset: "INSERT INTO sbo_ingest_progress (domain_id, source_id, committed_offset, updated) VALUES ($1, $2, $3, now()) " +
+		" ON CONFLICT (domain_id, source_id) DO UPDATE SET committed_offset = GREATEST(sbo_ingest_progress.committed_offset, EXCLUDED.committed_offset), updated = now()"}
+
+var sqliteIngestProgressDialect = ingestProgressDialect{
+	selectOffset: "SELECT committed_offset FROM sbo_ingest_progress WHERE domain_id = ? AND source_id = ?",
+	saveOffset: "INSERT INTO sbo_ingest_progress (domain_id, source_id, committed_offset, updated) VALUES (?, ?, ?, datetime('now')) " +
+		" ON CONFLICT (domain_id, source_id) DO UPDATE SET committed_offset = max(committed_offset, excluded.committed_offset), updated = datetime('now')"}
+
+/*
+Returns the hash of a line read from a file, identified by sourceId and the offset of the line after it (see inputs.LogLine).
+Identical lines at different offsets have different hashes, so they are not deduplicated
+*/
+func LineHash(sourceId string, offset int64, line string) string {
+	hash := sha256.New()
+	hash.Write([]byte(sourceId))
+	hash.Write([]byte{'\n'})
+	hash.Write([]byte(strconv.FormatInt(offset, 10)))
+	hash.Write([]byte{'\n'})
+	hash.Write([]byte(line))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// 0 when the source was not processed before
+func getIngestOffset(dbInstance *sql.DB, dialect *ingestProgressDialect, domainId int, sourceId string) (int64, error) {
+	if dbInstance == nil {
+		return 0, errDatabaseNotInitialized
+	}
+	var offset int64
+	err := dbInstance.QueryRow(dialect.selectOffset, domainId, sourceId).Scan(&offset)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return offset, err
+}
+
+// saves rows in a transaction, saved offsets are not decreased
+func saveIngestProgressBatch(dbInstance *sql.DB, dialect *ingestProgressDialect, rows []IngestProgressRow) error {
+	if len(rows) < 1 {
+		return nil
+	}
+	if dbInstance == nil {
+		return errDatabaseNotInitialized
+	}
+	tx, err := dbInstance.Begin()
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := tx.Exec(dialect.saveOffset, row.DomainId, row.SourceId, row.Offset); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
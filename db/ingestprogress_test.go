@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func TestLineHash(t *testing.T) {
+	if LineHash("a", 10, "line") != LineHash("a", 10, "line") {
+		t.Errorf("Line hash must not change")
+	}
+	if LineHash("a", 10, "line") == LineHash("a", 20, "line") || LineHash("a", 10, "line") == LineHash("b", 10, "line") {
+		t.Errorf("Identical lines at different offsets or in different files must have different hashes")
+	}
+}
+
+func TestIngestProgressSQLite(t *testing.T) {
+	sbosdb := NewSBOSQLiteDB()
+	if _, err := sbosdb.Init("", "", "", filepath.Join(t.TempDir(), "sbo.db")); err != nil {
+		t.Fatalf("Init failed %v", err)
+	}
+	defer sbosdb.Close()
+	if offset, err := sbosdb.GetIngestOffset(1, "source"); offset != 0 || err != nil {
+		t.Errorf("Unexpected offset for a new source %v %v", offset, err)
+	}
+	sbosdb.SaveIngestProgressBatch([]IngestProgressRow{{DomainId: 1, SourceId: "source", Offset: 100}, {DomainId: 2, SourceId: "source", Offset: 5}})
+	//offsets must not decrease, e.g when a file is processed again from the beginning
+	sbosdb.SaveIngestProgressBatch([]IngestProgressRow{{DomainId: 1, SourceId: "source", Offset: 50}})
+	if offset, err := sbosdb.GetIngestOffset(1, "source"); offset != 100 || err != nil {
+		t.Errorf("Unexpected offset %v %v", offset, err)
+	}
+
+	newLogEntry := func(lineHash string) *logparsers.SBOHttpRequestLog {
+		return &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC), Path: "/", Status: "200",
+			UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0"), LineHash: lineHash}
+	}
+	rows := []RawLogRow{{Data: newLogEntry("a"), DomainId: 1}, {Data: newLogEntry("b"), DomainId: 1}, {Data: newLogEntry(""), DomainId: 1}}
+	sbosdb.SaveRawLogBatch(rows)
+	//lines without a hash are not deduplicated
+	if err := sbosdb.SaveRawLogBatch(rows); err != nil {
+		t.Errorf("SaveRawLogBatch failed for duplicate rows %v", err)
+	}
+	sbosdb.SaveRawLog(newLogEntry("a"), 1, 1, false)
+	var rawLogCount int64
+	sbosdb.DbInstance.QueryRow("SELECT count(*) FROM sbo_rawlogs").Scan(&rawLogCount)
+	if rawLogCount != 4 {
+		t.Errorf("Unexpected raw log count %v", rawLogCount)
+	}
+}
+
+func TestBatchWriterSpoolsIngestProgress(t *testing.T) {
+	directory := t.TempDir()
+	databaseFile := filepath.Join(directory, "sbo.db")
+	spool, err := NewSBOSpool(filepath.Join(directory, "spool"), 0, nil)
+	if err != nil {
+		t.Fatalf("NewSBOSpool failed %v", err)
+	}
+	//the database is not available, directory can't be opened as a database file
+	storage := NewSBOSQLiteDB()
+	storage.Init("", "", "", directory)
+	writer := NewSBOBatchWriter(storage, nil, spool, nil)
+	domainId, _ := writer.GetDomainId("example.com", 1)
+	writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "", 202507011000, 3), domainId, false)
+	writer.SaveIngestProgressBatch([]IngestProgressRow{{DomainId: domainId, SourceId: "source", Offset: 100}})
+	writer.Close()
+	if spool.Rows() != 2 {
+		t.Fatalf("Unexpected spooled rows %v", spool.Rows())
+	}
+
+	storage = NewSBOSQLiteDB()
+	storage.Init("", "", "", databaseFile)
+	writer = NewSBOBatchWriter(storage, nil, spool, nil)
+	writer.Close()
+	sbosdb := NewSBOSQLiteDB()
+	sbosdb.Init("", "", "", databaseFile)
+	defer sbosdb.Close()
+	domainId, _ = sbosdb.GetDomainId("example.com", 1)
+	if offset, err := sbosdb.GetIngestOffset(domainId, "source"); offset != 100 || err != nil || !spool.IsEmpty() {
+		t.Errorf("Unexpected offset after replay %v %v", offset, err)
+	}
+}
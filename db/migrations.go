@@ -0,0 +1,206 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Database schema is created and upgraded using migrations embedded into the binary, see the migrations directory.
+Each driver has its own directory with sql files named like <version>-<description>.sql, where version uses
+yyyymmddxxxx format, same as SBOanalytics database scripts. Migrations are applied in version order and
+applied versions are saved in sbo_schema_version table.
+
+Each migration is applied in a transaction. MySQL commits DDL statements implicitly though,
+so migrations must be safe to apply again, e.g using CREATE TABLE IF NOT EXISTS.
+*/
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const SCHEMA_VERSION_TABLE_NAME string = "sbo_schema_version"
+
+// same for all drivers
+const schemaVersionTableDDL string = "CREATE TABLE IF NOT EXISTS " + SCHEMA_VERSION_TABLE_NAME + " (" +
+	" version BIGINT NOT NULL PRIMARY KEY, description VARCHAR(255) NOT NULL, applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)"
+
+var schemaVersionTableExistsQueries = map[string]string{
+	DB_DRIVER_MYSQL:    "SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = '" + SCHEMA_VERSION_TABLE_NAME + "'",
+	DB_DRIVER_POSTGRES: "SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = '" + SCHEMA_VERSION_TABLE_NAME + "'",
+	DB_DRIVER_SQLITE:   "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = '" + SCHEMA_VERSION_TABLE_NAME + "'"}
+
+var migrationFileNameRegex = regexp.MustCompile(`^([0-9]{12})-(.+)\.sql$`)
+
+type SchemaMigration struct {
+	Version     int64
+	Description string
+	script      string
+}
+
+// empty driver means mysql, see IsValidDbDriver
+func normalizeDbDriver(dbDriver string) string {
+	if len(dbDriver) < 1 {
+		return DB_DRIVER_MYSQL
+	}
+	return dbDriver
+}
+
+/*
+Returns migrations for the driver, ordered by version
+*/
+func SchemaMigrations(dbDriver string) ([]SchemaMigration, error) {
+	directory := path.Join("migrations", normalizeDbDriver(dbDriver))
+	entries, err := fs.ReadDir(migrationFiles, directory)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database driver '%v'", dbDriver)
+	}
+	migrations := make([]SchemaMigration, 0, len(entries))
+	for _, entry := range entries {
+		matches := migrationFileNameRegex.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		script, err := migrationFiles.ReadFile(path.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		migrations = append(migrations, SchemaMigration{Version: version, Description: strings.ReplaceAll(matches[2], "-", " "), script: string(script)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+/*
+Returns the schema version this version of the app needs, i.e the version of the last migration
+*/
+func RequiredSchemaVersion(dbDriver string) int64 {
+	migrations, err := SchemaMigrations(dbDriver)
+	if err != nil || len(migrations) < 1 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+/*
+Splits a migration script into statements. Statements must end with ; at the end of a line, lines starting with -- are ignored
+*/
+func splitSQLStatements(script string) []string {
+	statements := make([]string, 0)
+	var statement strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if len(trimmedLine) < 1 || strings.HasPrefix(trimmedLine, "--") {
+			continue
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmedLine, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(statement.String()), ";"))
+			statement.Reset()
+		}
+	}
+	if remaining := strings.TrimSpace(statement.String()); len(remaining) > 0 {
+		statements = append(statements, remaining)
+	}
+	return statements
+}
+
+/*
+Returns the current schema version, i.e the version of the last applied migration. 0 if no migrations were applied,
+e.g for an empty database or a database set up before sbo_schema_version table was added
+*/
+func getSchemaVersion(dbInstance *sql.DB, dbDriver string) (int64, error) {
+	if dbInstance == nil {
+		return 0, errDatabaseNotInitialized
+	}
+	var tableCount int
+	if err := dbInstance.QueryRow(schemaVersionTableExistsQueries[normalizeDbDriver(dbDriver)]).Scan(&tableCount); err != nil {
+		return 0, err
+	}
+	if tableCount < 1 {
+		return 0, nil
+	}
+	var version int64
+	err := dbInstance.QueryRow("SELECT COALESCE(MAX(version), 0) FROM " + SCHEMA_VERSION_TABLE_NAME).Scan(&version)
+	return version, err
+}
+
+/*
+Applies migrations newer than the current schema version in order, each in its own transaction.
+Returns applied migrations, which are applied before an error too
+*/
+func migrateSchema(dbInstance *sql.DB, dbDriver string) ([]SchemaMigration, error) {
+	applied := make([]SchemaMigration, 0)
+	if dbInstance == nil {
+		return applied, errDatabaseNotInitialized
+	}
+	migrations, err := SchemaMigrations(dbDriver)
+	if err != nil {
+		return applied, err
+	}
+	if _, err := dbInstance.Exec(schemaVersionTableDDL); err != nil {
+		return applied, err
+	}
+	currentVersion, err := getSchemaVersion(dbInstance, dbDriver)
+	if err != nil {
+		return applied, err
+	}
+	insertVersionSQL := "INSERT INTO " + SCHEMA_VERSION_TABLE_NAME + " (version, description) VALUES " +
+		multiRowValues("(?, ?)", 1, normalizeDbDriver(dbDriver) == DB_DRIVER_POSTGRES)
+	for _, migration := range migrations {
+		if migration.Version <= currentVersion {
+			continue
+		}
+		tx, err := dbInstance.Begin()
+		if err != nil {
+			return applied, err
+		}
+		for _, statement := range splitSQLStatements(migration.script) {
+			if _, err = tx.Exec(statement); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			_, err = tx.Exec(insertVersionSQL, migration.Version, migration.Description)
+		}
+		if err != nil {
+			tx.Rollback()
+			return applied, errors.Join(fmt.Errorf("migration %v (%v) failed", migration.Version, migration.Description), err)
+		}
+		if err = tx.Commit(); err != nil {
+			return applied, err
+		}
+		slog.Info("Applied database migration", "version", migration.Version, "description", migration.Description)
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
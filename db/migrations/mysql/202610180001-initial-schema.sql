@@ -0,0 +1,72 @@
+-- MySQL schema for SBOLogProcessor, same as the schema created by SBOanalytics database scripts.
+-- Tables are only created if they don't exist, so this is safe for databases which were set up using SBOanalytics scripts.
+-- Applied using sbologp db migrate, see migrations.go
+
+CREATE TABLE IF NOT EXISTS sbo_domains (
+    domain_id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    domain_name VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    timeWindowSizeMinutes INT NOT NULL DEFAULT 1,
+    UNIQUE KEY sbo_domains_domain_name_idx (domain_name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS sbo_log_files (
+    file_id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    domain_id INT NOT NULL,
+    host_name VARCHAR(255) NOT NULL,
+    file_path VARCHAR(500) NOT NULL,
+    created DATETIME NOT NULL,
+    UNIQUE KEY sbo_log_files_file_idx (domain_id, host_name, file_path)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS sbo_metrics (
+    domain_id INT NOT NULL,
+    metric_type INT NOT NULL,
+    key_value VARCHAR(100) NOT NULL,
+    -- yyyymmddhhmm
+    time_window BIGINT NOT NULL,
+    metric_value BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window),
+    KEY sbo_metrics_time_window_idx (time_window)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS sbo_rawlogs (
+    log_id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    domain_id INT NOT NULL,
+    host_id INT NOT NULL,
+    request_ts DATETIME NOT NULL,
+    -- INET6_ATON value, null when IPs are masked
+    client_ip VARBINARY(16) NULL,
+    remote_user VARCHAR(100) NULL,
+    http_method VARCHAR(20) NULL,
+    path3 VARCHAR(100) NULL,
+    request_uri VARCHAR(100) NULL,
+    http_status SMALLINT NOT NULL DEFAULT 0,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    referer VARCHAR(100) NULL,
+    is_malicious SMALLINT NOT NULL DEFAULT 0,
+    ua_string VARCHAR(100) NULL,
+    ua_os VARCHAR(20) NULL,
+    ua_family VARCHAR(20) NULL,
+    ua_device_type VARCHAR(20) NULL,
+    ua_is_human VARCHAR(20) NULL,
+    ua_intent VARCHAR(20) NULL,
+    KEY sbo_rawlogs_domain_ts_idx (domain_id, request_ts)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS sbo_os_metrics (
+    host_id INT NOT NULL,
+    metrics_ts DATETIME NOT NULL,
+    up_duration_minutes INT NOT NULL DEFAULT 0,
+    users INT NOT NULL DEFAULT 0,
+    load_average1 DECIMAL(8,2) NULL,
+    load_average5 DECIMAL(8,2) NULL,
+    load_average15 DECIMAL(8,2) NULL,
+    swap_use BIGINT NOT NULL DEFAULT 0,
+    cache_use BIGINT NOT NULL DEFAULT 0,
+    memory_use BIGINT NOT NULL DEFAULT 0,
+    memory_free BIGINT NOT NULL DEFAULT 0,
+    memory_available BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (host_id, metrics_ts)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,24 @@
+-- Hourly and daily metrics, rolled up from sbo_metrics by retention jobs, see retention.go.
+-- Same columns as sbo_metrics, time_window is yyyymmddhh00 for hourly and yyyymmdd0000 for daily rows
+
+CREATE TABLE IF NOT EXISTS sbo_metrics_hourly (
+    domain_id INT NOT NULL,
+    metric_type INT NOT NULL,
+    key_value VARCHAR(100) NOT NULL,
+    time_window BIGINT NOT NULL,
+    metric_value BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window),
+    KEY sbo_metrics_hourly_time_window_idx (time_window)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS sbo_metrics_daily (
+    domain_id INT NOT NULL,
+    metric_type INT NOT NULL,
+    key_value VARCHAR(100) NOT NULL,
+    time_window BIGINT NOT NULL,
+    metric_value BIGINT NOT NULL DEFAULT 0,
+    created DATETIME NOT NULL,
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window),
+    KEY sbo_metrics_daily_time_window_idx (time_window)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,29 @@
+-- Idempotent ingestion, see ingestprogress.go.
+-- line_hash identifies a line of a file (hash of the file identity, offset and the line), null for lines without a file e.g syslog.
+-- Rows with the same hash are inserted once
+
+-- MySQL commits DDL statements implicitly and has no IF NOT EXISTS for columns and indexes,
+-- so statements are only run when information_schema shows they were not applied before, e.g by a failed attempt
+
+SET @sbo_migration_sql = IF((SELECT count(*) FROM information_schema.columns
+    WHERE table_schema = DATABASE() AND table_name = 'sbo_rawlogs' AND column_name = 'line_hash') = 0,
+    'ALTER TABLE sbo_rawlogs ADD COLUMN line_hash CHAR(64) NULL', 'DO 0');
+PREPARE sbo_migration_statement FROM @sbo_migration_sql;
+EXECUTE sbo_migration_statement;
+DEALLOCATE PREPARE sbo_migration_statement;
+
+SET @sbo_migration_sql = IF((SELECT count(*) FROM information_schema.statistics
+    WHERE table_schema = DATABASE() AND table_name = 'sbo_rawlogs' AND index_name = 'sbo_rawlogs_line_hash_idx') = 0,
+    'ALTER TABLE sbo_rawlogs ADD UNIQUE KEY sbo_rawlogs_line_hash_idx (domain_id, line_hash)', 'DO 0');
+PREPARE sbo_migration_statement FROM @sbo_migration_sql;
+EXECUTE sbo_migration_statement;
+DEALLOCATE PREPARE sbo_migration_statement;
+
+-- lines of a source (a file identified by the hash of its first line) up to committed_offset were processed and their metrics were saved
+CREATE TABLE IF NOT EXISTS sbo_ingest_progress (
+    domain_id INT NOT NULL,
+    source_id CHAR(64) NOT NULL,
+    committed_offset BIGINT NOT NULL DEFAULT 0,
+    updated DATETIME NOT NULL,
+    PRIMARY KEY (domain_id, source_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
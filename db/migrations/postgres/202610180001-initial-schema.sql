@@ -0,0 +1,70 @@
+-- PostgreSQL schema for SBOLogProcessor, equivalent to the mysql schema of SBOanalytics
+-- Applied using sbologp db migrate, see migrations.go
+
+CREATE TABLE IF NOT EXISTS sbo_domains (
+    domain_id SERIAL PRIMARY KEY,
+    domain_name VARCHAR(255) NOT NULL UNIQUE,
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    timeWindowSizeMinutes INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS sbo_log_files (
+    file_id SERIAL PRIMARY KEY,
+    domain_id INTEGER NOT NULL,
+    host_name VARCHAR(255) NOT NULL,
+    file_path VARCHAR(1024) NOT NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (domain_id, host_name, file_path)
+);
+
+CREATE TABLE IF NOT EXISTS sbo_metrics (
+    domain_id INTEGER NOT NULL,
+    metric_type INTEGER NOT NULL,
+    key_value VARCHAR(100) NOT NULL,
+    -- yyyymmddhhmm
+    time_window BIGINT NOT NULL,
+    metric_value BIGINT NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window)
+);
+CREATE INDEX IF NOT EXISTS sbo_metrics_time_window_idx ON sbo_metrics (time_window);
+
+CREATE TABLE IF NOT EXISTS sbo_rawlogs (
+    log_id BIGSERIAL PRIMARY KEY,
+    domain_id INTEGER NOT NULL,
+    host_id INTEGER NOT NULL,
+    request_ts TIMESTAMPTZ NOT NULL,
+    -- null when IPs are masked
+    client_ip INET NULL,
+    remote_user VARCHAR(100) NULL,
+    http_method VARCHAR(20) NULL,
+    path3 VARCHAR(100) NULL,
+    request_uri VARCHAR(100) NULL,
+    http_status SMALLINT NOT NULL DEFAULT 0,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    referer VARCHAR(100) NULL,
+    is_malicious SMALLINT NOT NULL DEFAULT 0,
+    ua_string VARCHAR(100) NULL,
+    ua_os VARCHAR(20) NULL,
+    ua_family VARCHAR(20) NULL,
+    ua_device_type VARCHAR(20) NULL,
+    ua_is_human VARCHAR(20) NULL,
+    ua_intent VARCHAR(20) NULL
+);
+CREATE INDEX IF NOT EXISTS sbo_rawlogs_domain_ts_idx ON sbo_rawlogs (domain_id, request_ts);
+
+CREATE TABLE IF NOT EXISTS sbo_os_metrics (
+    host_id INTEGER NOT NULL,
+    metrics_ts TIMESTAMPTZ NOT NULL,
+    up_duration_minutes INTEGER NOT NULL DEFAULT 0,
+    users INTEGER NOT NULL DEFAULT 0,
+    load_average1 NUMERIC(8,2) NULL,
+    load_average5 NUMERIC(8,2) NULL,
+    load_average15 NUMERIC(8,2) NULL,
+    swap_use BIGINT NOT NULL DEFAULT 0,
+    cache_use BIGINT NOT NULL DEFAULT 0,
+    memory_use BIGINT NOT NULL DEFAULT 0,
+    memory_free BIGINT NOT NULL DEFAULT 0,
+    memory_available BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (host_id, metrics_ts)
+);
@@ -0,0 +1,24 @@
+-- Hourly and daily metrics, rolled up from sbo_metrics by retention jobs, see retention.go.
+-- Same columns as sbo_metrics, time_window is yyyymmddhh00 for hourly and yyyymmdd0000 for daily rows
+
+CREATE TABLE IF NOT EXISTS sbo_metrics_hourly (
+    domain_id INTEGER NOT NULL,
+    metric_type INTEGER NOT NULL,
+    key_value VARCHAR(100) NOT NULL,
+    time_window BIGINT NOT NULL,
+    metric_value BIGINT NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window)
+);
+CREATE INDEX IF NOT EXISTS sbo_metrics_hourly_time_window_idx ON sbo_metrics_hourly (time_window);
+
+CREATE TABLE IF NOT EXISTS sbo_metrics_daily (
+    domain_id INTEGER NOT NULL,
+    metric_type INTEGER NOT NULL,
+    key_value VARCHAR(100) NOT NULL,
+    time_window BIGINT NOT NULL,
+    metric_value BIGINT NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window)
+);
+CREATE INDEX IF NOT EXISTS sbo_metrics_daily_time_window_idx ON sbo_metrics_daily (time_window);
@@ -0,0 +1,15 @@
+-- Idempotent ingestion, see ingestprogress.go.
+-- line_hash identifies a line of a file (hash of the file identity, offset and the line), null for lines without a file e.g syslog.
+-- Rows with the same hash are inserted once
+
+ALTER TABLE sbo_rawlogs ADD COLUMN IF NOT EXISTS line_hash CHAR(64) NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS sbo_rawlogs_line_hash_idx ON sbo_rawlogs (domain_id, line_hash);
+
+-- lines of a source (a file identified by the hash of its first line) up to committed_offset were processed and their metrics were saved
+CREATE TABLE IF NOT EXISTS sbo_ingest_progress (
+    domain_id INTEGER NOT NULL,
+    source_id CHAR(64) NOT NULL,
+    committed_offset BIGINT NOT NULL DEFAULT 0,
+    updated TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (domain_id, source_id)
+);
@@ -0,0 +1,70 @@
+-- SQLite schema for SBOLogProcessor, equivalent to the mysql schema of SBOanalytics
+-- Applied automatically when the database is opened, see sqlitedb.go and migrations.go
+
+CREATE TABLE IF NOT EXISTS sbo_domains (
+    domain_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain_name TEXT NOT NULL UNIQUE,
+    created TEXT NOT NULL,
+    timeWindowSizeMinutes INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS sbo_log_files (
+    file_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain_id INTEGER NOT NULL,
+    host_name TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    created TEXT NOT NULL,
+    UNIQUE (domain_id, host_name, file_path)
+);
+
+CREATE TABLE IF NOT EXISTS sbo_metrics (
+    domain_id INTEGER NOT NULL,
+    metric_type INTEGER NOT NULL,
+    key_value TEXT NOT NULL,
+    -- yyyymmddhhmm
+    time_window INTEGER NOT NULL,
+    metric_value INTEGER NOT NULL DEFAULT 0,
+    created TEXT NOT NULL,
+    PRIMARY KEY (domain_id, metric_type, key_value, time_window)
+);
+CREATE INDEX IF NOT EXISTS sbo_metrics_time_window_idx ON sbo_metrics (time_window);
+
+CREATE TABLE IF NOT EXISTS sbo_rawlogs (
+    log_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain_id INTEGER NOT NULL,
+    host_id INTEGER NOT NULL,
+    request_ts TEXT NOT NULL,
+    -- null when IPs are masked
+    client_ip TEXT NULL,
+    remote_user TEXT NULL,
+    http_method TEXT NULL,
+    path3 TEXT NULL,
+    request_uri TEXT NULL,
+    http_status INTEGER NOT NULL DEFAULT 0,
+    bytes_sent INTEGER NOT NULL DEFAULT 0,
+    referer TEXT NULL,
+    is_malicious INTEGER NOT NULL DEFAULT 0,
+    ua_string TEXT NULL,
+    ua_os TEXT NULL,
+    ua_family TEXT NULL,
+    ua_device_type TEXT NULL,
+    ua_is_human TEXT NULL,
+    ua_intent TEXT NULL
+);
+CREATE INDEX IF NOT EXISTS sbo_rawlogs_domain_ts_idx ON sbo_rawlogs (domain_id, request_ts);
+
+CREATE TABLE IF NOT EXISTS sbo_os_metrics (
+    host_id INTEGER NOT NULL,
+    metrics_ts TEXT NOT NULL,
+    up_duration_minutes INTEGER NOT NULL DEFAULT 0,
+    users INTEGER NOT NULL DEFAULT 0,
+    load_average1 REAL NULL,
+    load_average5 REAL NULL,
+    load_average15 REAL NULL,
+    swap_use INTEGER NOT NULL DEFAULT 0,
+    cache_use INTEGER NOT NULL DEFAULT 0,
+    memory_use INTEGER NOT NULL DEFAULT 0,
+    memory_free INTEGER NOT NULL DEFAULT 0,
+    memory_available INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (host_id, metrics_ts)
+);
@@ -0,0 +1,15 @@
+-- Idempotent ingestion, see ingestprogress.go.
+-- line_hash identifies a line of a file (hash of the file identity, offset and the line), null for lines without a file e.g syslog.
+-- Rows with the same hash are inserted once
+
+ALTER TABLE sbo_rawlogs ADD COLUMN line_hash TEXT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS sbo_rawlogs_line_hash_idx ON sbo_rawlogs (domain_id, line_hash);
+
+-- lines of a source (a file identified by the hash of its first line) up to committed_offset were processed and their metrics were saved
+CREATE TABLE IF NOT EXISTS sbo_ingest_progress (
+    domain_id INTEGER NOT NULL,
+    source_id TEXT NOT NULL,
+    committed_offset INTEGER NOT NULL DEFAULT 0,
+    updated TEXT NOT NULL,
+    PRIMARY KEY (domain_id, source_id)
+);
@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	statements := splitSQLStatements("-- comment\nCREATE TABLE a (\n    x INT -- inline\n);\n\nCREATE INDEX b ON a (x);\nSELECT 1")
+	if len(statements) != 3 || statements[0] != "CREATE TABLE a (\n    x INT -- inline\n)" || statements[1] != "CREATE INDEX b ON a (x)" || statements[2] != "SELECT 1" {
+		t.Errorf("Unexpected statements %q", statements)
+	}
+}
+
+func TestSchemaMigrations(t *testing.T) {
+	for _, dbDriver := range []string{"", DB_DRIVER_MYSQL, DB_DRIVER_POSTGRES, DB_DRIVER_SQLITE} {
+		migrations, err := SchemaMigrations(dbDriver)
+		if err != nil || len(migrations) < 1 {
+			t.Fatalf("No migrations for %v: %v", dbDriver, err)
+		}
+		for index, migration := range migrations {
+			if len(splitSQLStatements(migration.script)) < 1 || len(migration.Description) < 1 || (index > 0 && migration.Version <= migrations[index-1].Version) {
+				t.Errorf("Invalid migration %v for %v", migration.Version, dbDriver)
+			}
+		}
+		if RequiredSchemaVersion(dbDriver) != migrations[len(migrations)-1].Version {
+			t.Errorf("Unexpected required version for %v", dbDriver)
+		}
+	}
+	//all drivers must have the same schema versions
+	if RequiredSchemaVersion(DB_DRIVER_MYSQL) != RequiredSchemaVersion(DB_DRIVER_POSTGRES) || RequiredSchemaVersion(DB_DRIVER_MYSQL) != RequiredSchemaVersion(DB_DRIVER_SQLITE) {
+		t.Errorf("Required schema versions of drivers are different")
+	}
+	if _, err := SchemaMigrations("oracle"); err == nil {
+		t.Errorf("Expected an error for an unsupported driver")
+	}
+}
+
+// MySQL commits DDL statements implicitly, so a failed migration may be applied again, see migrations.go
+func TestMySQLMigrationsCanBeAppliedAgain(t *testing.T) {
+	migrations, _ := SchemaMigrations(DB_DRIVER_MYSQL)
+	for _, migration := range migrations {
+		for _, statement := range splitSQLStatements(migration.script) {
+			upperCaseStatement := strings.ToUpper(statement)
+			if strings.HasPrefix(upperCaseStatement, "ALTER TABLE") || strings.HasPrefix(upperCaseStatement, "CREATE INDEX") ||
+				strings.HasPrefix(upperCaseStatement, "CREATE UNIQUE INDEX") ||
+				(strings.HasPrefix(upperCaseStatement, "CREATE TABLE") && !strings.HasPrefix(upperCaseStatement, "CREATE TABLE IF NOT EXISTS")) {
+				t.Errorf("Statement in migration %v can't be applied again %q", migration.Version, statement)
+			}
+		}
+	}
+}
+
+func TestMigrateSchemaSQLite(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	//a database created before schema versions, only some of the tables exist
+	dbInstance, _ := sql.Open("sqlite", databaseFile)
+	if _, err := dbInstance.Exec("CREATE TABLE sbo_domains (domain_id INTEGER PRIMARY KEY AUTOINCREMENT, domain_name TEXT NOT NULL UNIQUE, created TEXT NOT NULL, timeWindowSizeMinutes INTEGER NOT NULL DEFAULT 1)"); err != nil {
+		t.Fatalf("Failed to create table %v", err)
+	}
+	if version, err := getSchemaVersion(dbInstance, DB_DRIVER_SQLITE); version != 0 || err != nil {
+		t.Errorf("Unexpected schema version %v %v", version, err)
+	}
+	dbInstance.Close()
+
+	//migrations are applied when opened
+	sbosdb := NewSBOSQLiteDB()
+	if initialized, err := sbosdb.Init("", "", "", databaseFile); !initialized {
+		t.Fatalf("Init failed %v", err)
+	}
+	defer sbosdb.Close()
+	version, err := sbosdb.GetSchemaVersion()
+	if err != nil || version != RequiredSchemaVersion(DB_DRIVER_SQLITE) {
+		t.Errorf("Unexpected schema version %v %v", version, err)
+	}
+	if applied, err := sbosdb.MigrateSchema(); len(applied) != 0 || err != nil {
+		t.Errorf("Migrations must not be applied again %v %v", applied, err)
+	}
+	var rows int
+	if err := sbosdb.DbInstance.QueryRow("SELECT count(*) FROM sbo_rawlogs").Scan(&rows); err != nil {
+		t.Errorf("Tables must be created %v", err)
+	}
+}
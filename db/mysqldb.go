@@ -24,6 +24,7 @@ import (
 	"log/slog"
 	"runtime/debug"
 	"sync"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 
@@ -31,13 +32,57 @@ import (
 	"github.com/SBOsoft/SBOLogProcessor/metrics"
 )
 
+/*
+MySQL storage backend
+*/
 type SBOAnalyticsDB struct {
 	DbInstance     *sql.DB
-	IsInitialized  bool
+	isInitialized  bool
 	syncMutex      sync.Mutex
 	domainIdsCache map[string]int
+	statements     batchStatements
 }
 
+var mysqlBatchInsertDialect = batchInsertDialect{
+	metricInsertPrefix:  "INSERT INTO sbo_metrics (domain_id, metric_type, key_value, time_window, metric_value, created) VALUES ",
+	metricRowTemplate:   "(?, ?, ?, ?, ?, now())",
+	metricAddSuffix:     " ON DUPLICATE KEY UPDATE metric_value=metric_value+VALUES(metric_value)",
+	metricReplaceSuffix: " ON DUPLICATE KEY UPDATE metric_value=VALUES(metric_value)",
+	metricArgs: func(row *MetricDataRow) []any {
+		return []any{row.DomainId, row.Data.MetricType, ReduceToMaxColumnLen(row.Data.KeyValue, 100), row.Data.TimeWindow, row.Data.MetricValue}
+	},
+	rawLogInsertPrefix: "INSERT INTO sbo_rawlogs (domain_id, host_id, request_ts, client_ip, remote_user, http_method, " +
+		" path3, request_uri, http_status, bytes_sent, referer, is_malicious, " +
+		" ua_string, ua_os, ua_family, ua_device_type, ua_is_human, ua_intent, line_hash) VALUES ",
+	rawLogInsertSuffix: " ON DUPLICATE KEY UPDATE log_id=log_id",
+	//INET6_ATON(null) is null, used when IPs are masked
+	rawLogRowTemplate: "(?, ?, ?, INET6_ATON(?), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	rawLogArgs: func(row *RawLogRow) []any {
+		data := row.Data
+		var clientIP any = nil
+		uaString := ReduceToMaxColumnLen(data.UserAgent.FullName, 100)
+		if row.MaskIPs {
+			uaString = ReduceToMaxColumnLenKeepingLastPart(data.UserAgent.FullName, 100)
+		} else {
+			clientIP = data.ClientIP
+		}
+		return []any{row.DomainId, row.HostId, data.Timestamp, clientIP,
+			ReduceToMaxColumnLen(data.RemoteUser, 100),
+			ReduceToMaxColumnLen(data.Method, 20),
+			ReduceToMaxColumnLen(rawLogPath3(data), 100),
+			ReduceToMaxColumnLen(data.Path, 100),
+			data.Status, data.BytesSent,
+			ReduceToMaxColumnLen(data.Referer, 100),
+			data.Malicious,
+			uaString,
+			ReduceToMaxColumnLen(data.UserAgent.OS, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Family, 20),
+			ReduceToMaxColumnLen(data.UserAgent.DeviceType, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Human, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Intent, 20),
+			rawLogLineHash(data)}
+	}}
+
 func NewSBOAnalyticsDB() *SBOAnalyticsDB {
 	rv := SBOAnalyticsDB{
 		domainIdsCache: make(map[string]int)}
@@ -47,7 +92,7 @@ func NewSBOAnalyticsDB() *SBOAnalyticsDB {
 func (sboadb *SBOAnalyticsDB) Init(dbUser string, dbPassword string, dbAddress string, databaseName string) (bool, error) {
 	sboadb.syncMutex.Lock()
 	defer sboadb.syncMutex.Unlock()
-	if sboadb.IsInitialized {
+	if sboadb.isInitialized {
 		//already initialized
 		return true, nil
 	}
@@ -69,18 +114,55 @@ func (sboadb *SBOAnalyticsDB) Init(dbUser string, dbPassword string, dbAddress s
 	pingErr := sboadb.DbInstance.Ping()
 	if pingErr != nil {
 		slog.Error("Failed to ping the db after connection", "error", pingErr)
-		return false, err
+		//so a later Init call doesn't leak the connection pool
+		sboadb.DbInstance.Close()
+		return false, pingErr
 	}
-	sboadb.IsInitialized = true
+	sboadb.isInitialized = true
 	return true, nil
 }
 
+func (sboadb *SBOAnalyticsDB) IsInitialized() bool {
+	sboadb.syncMutex.Lock()
+	defer sboadb.syncMutex.Unlock()
+	return sboadb.isInitialized
+}
+
+func (sboadb *SBOAnalyticsDB) GetSchemaVersion() (int64, error) {
+	return getSchemaVersion(sboadb.DbInstance, DB_DRIVER_MYSQL)
+}
+
+func (sboadb *SBOAnalyticsDB) MigrateSchema() ([]SchemaMigration, error) {
+	return migrateSchema(sboadb.DbInstance, DB_DRIVER_MYSQL)
+}
+
+func (sboadb *SBOAnalyticsDB) GetIngestOffset(domainId int, sourceId string) (int64, error) {
+	return getIngestOffset(sboadb.DbInstance, &mysqlIngestProgressDialect, domainId, sourceId)
+}
+
+func (sboadb *SBOAnalyticsDB) SaveIngestProgressBatch(rows []IngestProgressRow) error {
+	return saveIngestProgressBatch(sboadb.DbInstance, &mysqlIngestProgressDialect, rows)
+}
+
+func (sboadb *SBOAnalyticsDB) GetDomains() (map[string]int, error) {
+	return getDomains(sboadb.DbInstance)
+}
+
+func (sboadb *SBOAnalyticsDB) ApplyRetention(domainId int, policy RetentionPolicy, now time.Time, stop <-chan struct{}) (RetentionResult, error) {
+	return applyRetention(sboadb.DbInstance, &mysqlRetentionDialect, domainId, policy, now, stop)
+}
+
 func (sboadb *SBOAnalyticsDB) Close() (bool, error) {
 	if sboadb.DbInstance == nil {
 		stackTrace := debug.Stack()
 		slog.Warn("Trying to close an invalid database connection", "stackTrace", string(stackTrace))
 		return false, nil
 	}
+	//Init can be called again after Close, e.g to reconnect
+	sboadb.syncMutex.Lock()
+	sboadb.isInitialized = false
+	sboadb.syncMutex.Unlock()
+	sboadb.statements.close()
 	err := sboadb.DbInstance.Close()
 	if err != nil {
 		return false, err
@@ -159,59 +241,10 @@ func (sboadb *SBOAnalyticsDB) SaveMetricData(data *metrics.SBOMetricWindowDataTo
 }
 
 func (sboadb *SBOAnalyticsDB) SaveRawLog(data *logparsers.SBOHttpRequestLog, domainId int, hostId int, maskIPs bool) (bool, error) {
-	var sql string = "INSERT INTO sbo_rawlogs (domain_id, host_id, request_ts, client_ip, remote_user, http_method, " +
-		" path3, request_uri, http_status, bytes_sent, referer, is_malicious, " +
-		" ua_string, ua_os, ua_family, ua_device_type, ua_is_human, ua_intent) " +
-		" VALUES (?, ?, ?, "
-	if !maskIPs {
-		sql += " INET6_ATON(?) "
-	} else {
-		sql += " null "
-	}
-	sql += ", ?, ?, " +
-		" ?, ?, ?, ?, ?, ?, " +
-		"?, ?, ?, ?, ?, ?) "
-
-	var err error = nil
-	pathUpTo3rd := data.Path3
-	if len(pathUpTo3rd) < 1 {
-		pathUpTo3rd = data.Path2
-	}
-	if len(pathUpTo3rd) < 1 {
-		pathUpTo3rd = data.Path1
-	}
-
-	if !maskIPs {
-		_, err = sboadb.DbInstance.Exec(sql, domainId, hostId, data.Timestamp, data.ClientIP,
-			ReduceToMaxColumnLen(data.RemoteUser, 100),
-			ReduceToMaxColumnLen(data.Method, 20),
-			ReduceToMaxColumnLen(pathUpTo3rd, 100),
-			ReduceToMaxColumnLen(data.Path, 100),
-			data.Status, data.BytesSent,
-			ReduceToMaxColumnLen(data.Referer, 100),
-			data.Malicious,
-			ReduceToMaxColumnLen(data.UserAgent.FullName, 100),
-			ReduceToMaxColumnLen(data.UserAgent.OS, 20),
-			ReduceToMaxColumnLen(data.UserAgent.Family, 20),
-			ReduceToMaxColumnLen(data.UserAgent.DeviceType, 20),
-			ReduceToMaxColumnLen(data.UserAgent.Human, 20),
-			ReduceToMaxColumnLen(data.UserAgent.Intent, 20))
-	} else {
-		_, err = sboadb.DbInstance.Exec(sql, domainId, hostId, data.Timestamp,
-			ReduceToMaxColumnLen(data.RemoteUser, 100),
-			ReduceToMaxColumnLen(data.Method, 20),
-			ReduceToMaxColumnLen(pathUpTo3rd, 100),
-			ReduceToMaxColumnLen(data.Path, 100),
-			data.Status, data.BytesSent,
-			ReduceToMaxColumnLen(data.Referer, 100),
-			data.Malicious,
-			ReduceToMaxColumnLenKeepingLastPart(data.UserAgent.FullName, 100),
-			ReduceToMaxColumnLen(data.UserAgent.OS, 20),
-			ReduceToMaxColumnLen(data.UserAgent.Family, 20),
-			ReduceToMaxColumnLen(data.UserAgent.DeviceType, 20),
-			ReduceToMaxColumnLen(data.UserAgent.Human, 20),
-			ReduceToMaxColumnLen(data.UserAgent.Intent, 20))
-	}
+	dialect := &mysqlBatchInsertDialect
+	row := RawLogRow{Data: data, DomainId: domainId, HostId: hostId, MaskIPs: maskIPs}
+	_, err := sboadb.DbInstance.Exec(dialect.rawLogInsertPrefix+multiRowValues(dialect.rawLogRowTemplate, 1, dialect.numberedPlaceholders)+dialect.rawLogInsertSuffix,
+		dialect.rawLogArgs(&row)...)
 	if err != nil {
 		slog.Error("SaveRawLog failed", "domainId", domainId, "hostId", hostId, "timestamp", data.Timestamp, "error", err)
 		return false, err
@@ -221,6 +254,14 @@ func (sboadb *SBOAnalyticsDB) SaveRawLog(data *logparsers.SBOHttpRequestLog, dom
 	}
 }
 
+func (sboadb *SBOAnalyticsDB) SaveMetricDataBatch(rows []MetricDataRow) error {
+	return saveMetricDataBatch(sboadb.DbInstance, &sboadb.statements, &mysqlBatchInsertDialect, rows)
+}
+
+func (sboadb *SBOAnalyticsDB) SaveRawLogBatch(rows []RawLogRow) error {
+	return saveRawLogBatch(sboadb.DbInstance, &sboadb.statements, &mysqlBatchInsertDialect, rows)
+}
+
 func ReduceToMaxColumnLen(str string, colSize int) string {
 	if len(str) <= colSize {
 		return str
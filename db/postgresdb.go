@@ -0,0 +1,284 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+/*
+PostgreSQL storage backend, see migrations/postgres for the schema
+*/
+type SBOPostgresDB struct {
+	DbInstance     *sql.DB
+	isInitialized  bool
+	syncMutex      sync.Mutex
+	domainIdsCache map[string]int
+	statements     batchStatements
+}
+
+var postgresBatchInsertDialect = batchInsertDialect{
+	numberedPlaceholders: true,
+	metricInsertPrefix:   "INSERT INTO sbo_metrics (domain_id, metric_type, key_value, time_window, metric_value, created) VALUES ",
+	metricRowTemplate:    "(?, ?, ?, ?, ?, now())",
+	metricAddSuffix:      " ON CONFLICT (domain_id, metric_type, key_value, time_window) DO UPDATE SET metric_value=sbo_metrics.metric_value+EXCLUDED.metric_value",
+	metricReplaceSuffix:  " ON CONFLICT (domain_id, metric_type, key_value, time_window) DO UPDATE SET metric_value=EXCLUDED.metric_value",
+	metricArgs: func(row *MetricDataRow) []any {
+		return []any{row.DomainId, row.Data.MetricType, ReduceToMaxColumnLen(row.Data.KeyValue, 100), row.Data.TimeWindow, row.Data.MetricValue}
+	},
+	rawLogInsertPrefix: "INSERT INTO sbo_rawlogs (domain_id, host_id, request_ts, client_ip, remote_user, http_method, " +
+		" path3, request_uri, http_status, bytes_sent, referer, is_malicious, " +
+		" ua_string, ua_os, ua_family, ua_device_type, ua_is_human, ua_intent, line_hash) VALUES ",
+	rawLogInsertSuffix: " ON CONFLICT (domain_id, line_hash) DO NOTHING",
+	//client IPs are saved using inet type, values which are not valid IP addresses are saved as null
+	rawLogRowTemplate: "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	rawLogArgs: func(row *RawLogRow) []any {
+		data := row.Data
+		var clientIP any = nil
+		if !row.MaskIPs && net.ParseIP(data.ClientIP) != nil {
+			clientIP = data.ClientIP
+		}
+		uaString := ReduceToMaxColumnLen(data.UserAgent.FullName, 100)
+		if row.MaskIPs {
+			uaString = ReduceToMaxColumnLenKeepingLastPart(data.UserAgent.FullName, 100)
+		}
+		//status is a string in parsed logs, e.g - for some invalid requests
+		httpStatus, _ := strconv.Atoi(data.Status)
+		return []any{row.DomainId, row.HostId, data.Timestamp, clientIP,
+			ReduceToMaxColumnLen(data.RemoteUser, 100),
+			ReduceToMaxColumnLen(data.Method, 20),
+			ReduceToMaxColumnLen(rawLogPath3(data), 100),
+			ReduceToMaxColumnLen(data.Path, 100),
+			httpStatus, data.BytesSent,
+			ReduceToMaxColumnLen(data.Referer, 100),
+			data.Malicious,
+			uaString,
+			ReduceToMaxColumnLen(data.UserAgent.OS, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Family, 20),
+			ReduceToMaxColumnLen(data.UserAgent.DeviceType, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Human, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Intent, 20),
+			rawLogLineHash(data)}
+	}}
+
+func NewSBOPostgresDB() *SBOPostgresDB {
+	rv := SBOPostgresDB{
+		domainIdsCache: make(map[string]int)}
+	return &rv
+}
+
+/*
+dbAddress is host or host:port. SSL is used when the server supports it, unless PGSSLMODE environment variable is set
+*/
+func (sbopdb *SBOPostgresDB) Init(dbUser string, dbPassword string, dbAddress string, databaseName string) (bool, error) {
+	sbopdb.syncMutex.Lock()
+	defer sbopdb.syncMutex.Unlock()
+	if sbopdb.isInitialized {
+		//already initialized
+		return true, nil
+	}
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(dbUser, dbPassword),
+		Host:   dbAddress,
+		Path:   "/" + databaseName}
+	if len(os.Getenv("PGSSLMODE")) < 1 {
+		dsn.RawQuery = "sslmode=prefer"
+	}
+
+	var err error
+	sbopdb.DbInstance, err = sql.Open("postgres", dsn.String())
+	if err != nil {
+		slog.Error("Failed to connect to postgres db", "error", err)
+		return false, err
+	}
+
+	pingErr := sbopdb.DbInstance.Ping()
+	if pingErr != nil {
+		slog.Error("Failed to ping the db after connection", "error", pingErr)
+		//so a later Init call doesn't leak the connection pool
+		sbopdb.DbInstance.Close()
+		return false, pingErr
+	}
+	sbopdb.isInitialized = true
+	return true, nil
+}
+
+func (sbopdb *SBOPostgresDB) IsInitialized() bool {
+	sbopdb.syncMutex.Lock()
+	defer sbopdb.syncMutex.Unlock()
+	return sbopdb.isInitialized
+}
+
+func (sbopdb *SBOPostgresDB) GetSchemaVersion() (int64, error) {
+	return getSchemaVersion(sbopdb.DbInstance, DB_DRIVER_POSTGRES)
+}
+
+func (sbopdb *SBOPostgresDB) MigrateSchema() ([]SchemaMigration, error) {
+	return migrateSchema(sbopdb.DbInstance, DB_DRIVER_POSTGRES)
+}
+
+func (sbopdb *SBOPostgresDB) GetIngestOffset(domainId int, sourceId string) (int64, error) {
+	return getIngestOffset(sbopdb.DbInstance, &postgresIngestProgressDialect, domainId, sourceId)
+}
+
+func (sbopdb *SBOPostgresDB) SaveIngestProgressBatch(rows []IngestProgressRow) error {
+	return saveIngestProgressBatch(sbopdb.DbInstance, &postgresIngestProgressDialect, rows)
+}
+
+func (sbopdb *SBOPostgresDB) GetDomains() (map[string]int, error) {
+	return getDomains(sbopdb.DbInstance)
+}
+
+func (sbopdb *SBOPostgresDB) ApplyRetention(domainId int, policy RetentionPolicy, now time.Time, stop <-chan struct{}) (RetentionResult, error) {
+	return applyRetention(sbopdb.DbInstance, &postgresRetentionDialect, domainId, policy, now, stop)
+}
+
+func (sbopdb *SBOPostgresDB) Close() (bool, error) {
+	if sbopdb.DbInstance == nil {
+		stackTrace := debug.Stack()
+		slog.Warn("Trying to close an invalid database connection", "stackTrace", string(stackTrace))
+		return false, nil
+	}
+	//Init can be called again after Close, e.g to reconnect
+	sbopdb.syncMutex.Lock()
+	sbopdb.isInitialized = false
+	sbopdb.syncMutex.Unlock()
+	sbopdb.statements.close()
+	err := sbopdb.DbInstance.Close()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (sbopdb *SBOPostgresDB) GetDomainId(domainName string, timeWindowSizeInMinutes int) (int, error) {
+	sbopdb.syncMutex.Lock()
+	defer sbopdb.syncMutex.Unlock()
+
+	if sbopdb.domainIdsCache[domainName] > 0 {
+		return sbopdb.domainIdsCache[domainName], nil
+	}
+	//Note timeWindowSizeInMinutes is set only on initial creation, same as mysql.
+	//DO UPDATE is a no-op update so RETURNING returns the id of an existing row too
+	var domainId int
+	err := sbopdb.DbInstance.QueryRow("INSERT INTO sbo_domains (domain_name, created, timeWindowSizeMinutes) VALUES ($1, now(), $2) "+
+		" ON CONFLICT (domain_name) DO UPDATE SET domain_name=EXCLUDED.domain_name RETURNING domain_id",
+		ReduceToMaxColumnLen(domainName, 255), timeWindowSizeInMinutes).Scan(&domainId)
+	if err != nil {
+		slog.Error("db.GetDomainId failed", "domainName", domainName, "error", err)
+		return -1, err
+	}
+	sbopdb.domainIdsCache[domainName] = domainId
+	return domainId, nil
+}
+
+func (sbopdb *SBOPostgresDB) GetFileId(domainId int, hostname string, filePath string) (int, error) {
+	var fileId int
+	err := sbopdb.DbInstance.QueryRow("INSERT INTO sbo_log_files (domain_id, host_name, file_path, created) VALUES ($1, $2, $3, now()) "+
+		" ON CONFLICT (domain_id, host_name, file_path) DO UPDATE SET file_path=EXCLUDED.file_path RETURNING file_id",
+		domainId, hostname, filePath).Scan(&fileId)
+	if err != nil {
+		slog.Error("db.GetFileId failed", "domainId", domainId, "hostname", hostname, "filePath", filePath, "error", err)
+		return -1, err
+	}
+	return fileId, nil
+}
+
+func (sbopdb *SBOPostgresDB) SaveMetricData(data *metrics.SBOMetricWindowDataToBeSaved, domainId int, replaceIfExists bool) (bool, error) {
+	var sql string = "INSERT INTO sbo_metrics (domain_id, metric_type, key_value, time_window, metric_value, created) " +
+		" VALUES ($1, $2, $3, $4, $5, now()) ON CONFLICT (domain_id, metric_type, key_value, time_window) "
+	if replaceIfExists {
+		sql += "DO UPDATE SET metric_value=EXCLUDED.metric_value"
+	} else {
+		sql += "DO UPDATE SET metric_value=sbo_metrics.metric_value+EXCLUDED.metric_value"
+	}
+	_, err := sbopdb.DbInstance.Exec(sql, domainId, data.MetricType, ReduceToMaxColumnLen(data.KeyValue, 100), data.TimeWindow, data.MetricValue)
+	if err != nil {
+		slog.Error("SaveMetricData failed", "domainId", domainId, "data.FilePath", data.FilePath, "error", err)
+		return false, err
+	} else {
+		return true, nil
+	}
+}
+
+func (sbopdb *SBOPostgresDB) SaveRawLog(data *logparsers.SBOHttpRequestLog, domainId int, hostId int, maskIPs bool) (bool, error) {
+	dialect := &postgresBatchInsertDialect
+	row := RawLogRow{Data: data, DomainId: domainId, HostId: hostId, MaskIPs: maskIPs}
+	_, err := sbopdb.DbInstance.Exec(dialect.rawLogInsertPrefix+multiRowValues(dialect.rawLogRowTemplate, 1, dialect.numberedPlaceholders)+dialect.rawLogInsertSuffix,
+		dialect.rawLogArgs(&row)...)
+	if err != nil {
+		slog.Error("SaveRawLog failed", "domainId", domainId, "hostId", hostId, "timestamp", data.Timestamp, "error", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (sbopdb *SBOPostgresDB) SaveMetricDataBatch(rows []MetricDataRow) error {
+	return saveMetricDataBatch(sbopdb.DbInstance, &sbopdb.statements, &postgresBatchInsertDialect, rows)
+}
+
+func (sbopdb *SBOPostgresDB) SaveRawLogBatch(rows []RawLogRow) error {
+	return saveRawLogBatch(sbopdb.DbInstance, &sbopdb.statements, &postgresBatchInsertDialect, rows)
+}
+
+func (sbopdb *SBOPostgresDB) SaveOSMetrics(uptimeInfo *metrics.UptimeInfo, memoryInfo *metrics.MemoryInfo, hostId int) (bool, error) {
+	var sql string = "INSERT INTO sbo_os_metrics (host_id, metrics_ts, up_duration_minutes, users, " +
+		" load_average1, load_average5, load_average15, " +
+		" swap_use, cache_use, memory_use, memory_free, memory_available) " +
+		" VALUES ($1, now(), $2, $3, " +
+		" $4, $5, $6, " +
+		" $7, $8, $9, $10, $11) "
+	var swapUse int64 = 0
+	var cacheUse int64 = 0
+	var memUse int64 = 0
+	var memFree int64 = 0
+	var memAvailable int64 = 0
+	//memoryInfo may be nil
+	if memoryInfo != nil {
+		swapUse = memoryInfo.SwapUse
+		cacheUse = memoryInfo.CachUse
+		memUse = memoryInfo.MemUse
+		memFree = memoryInfo.MemFree
+		memAvailable = memoryInfo.MemAvailable
+	}
+	_, err := sbopdb.DbInstance.Exec(sql, hostId, uptimeInfo.UpDurationMinutes, uptimeInfo.Users,
+		uptimeInfo.LoadAverage1, uptimeInfo.LoadAverage5, uptimeInfo.LoadAverage15,
+		swapUse, cacheUse, memUse, memFree, memAvailable)
+	if err != nil {
+		slog.Error("SaveOSMetrics failed", "hostId", hostId, "uptimeInfo", uptimeInfo, "memoryInfo", memoryInfo, "error", err)
+		return false, err
+	} else {
+		return true, nil
+	}
+}
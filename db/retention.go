@@ -0,0 +1,265 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+Retention jobs delete old raw logs and roll up old metrics into coarser tables:
+sbo_metrics rows are added into sbo_metrics_hourly, then hourly rows are added into sbo_metrics_daily.
+Work is done in small batches, each in its own transaction, to avoid long locks. A time window is rolled up and deleted
+in the same transaction and rolled up values are added to existing values, so rows inserted after a time window
+was rolled up (e.g when processing old logs) are rolled up correctly next time.
+*/
+
+const (
+	METRICS_TABLE        string = "sbo_metrics"
+	METRICS_HOURLY_TABLE string = "sbo_metrics_hourly"
+	METRICS_DAILY_TABLE  string = "sbo_metrics_daily"
+
+	// raw logs deleted per statement
+	DB_RETENTION_RAW_LOG_BATCH_SIZE int = 1000
+	// time windows selected per query, each time window is rolled up in its own transaction
+	DB_RETENTION_TIME_WINDOW_BATCH_SIZE int = 100
+)
+
+/*
+Retention settings of a domain in days, 0 means data is kept forever
+*/
+type RetentionPolicy struct {
+	RawLogDays int
+	//metrics older than this are rolled up into hourly metrics
+	MetricDays int
+	//hourly metrics older than this are rolled up into daily metrics, daily metrics are kept forever
+	HourlyMetricDays int
+}
+
+func (policy RetentionPolicy) IsEmpty() bool {
+	return policy.RawLogDays < 1 && policy.MetricDays < 1 && policy.HourlyMetricDays < 1
+}
+
+// rows deleted from each table
+type RetentionResult struct {
+	RawLogsDeleted        int64
+	MetricsRolledUp       int64
+	HourlyMetricsRolledUp int64
+}
+
+type retentionDialect struct {
+	//parameters: domain id, timestamp, limit
+	deleteRawLogs   string
+	rawLogTimestamp func(timestamp time.Time) any
+	//%[1]s is the target table, %[2]s is the source table. Parameters: target time window, domain id, source time window
+	rollupTimeWindow string
+	//%s is the table. Parameters: time window, domain id, limit
+	selectTimeWindows string
+	//%s is the table. Parameters: domain id, time window
+	deleteTimeWindow string
+}
+
+var mysqlRetentionDialect = retentionDialect{
+	deleteRawLogs:   "DELETE FROM sbo_rawlogs WHERE domain_id = ? AND request_ts < ? LIMIT ?",
+	rawLogTimestamp: func(timestamp time.Time) any { return timestamp },
+	rollupTimeWindow: "INSERT INTO %[1]s (domain_id, metric_type, key_value, time_window, metric_value, created) " +
+		" SELECT domain_id, metric_type, key_value, ?, SUM(metric_value), now() FROM %[2]s WHERE domain_id = ? AND time_window = ? " +
+		" GROUP BY domain_id, metric_type, key_value ON DUPLICATE KEY UPDATE %[1]s.metric_value = %[1]s.metric_value + VALUES(metric_value)",
+	selectTimeWindows: "SELECT DISTINCT time_window FROM %s WHERE time_window < ? AND domain_id = ? ORDER BY time_window LIMIT ?",
+	deleteTimeWindow:  "DELETE FROM %s WHERE domain_id = ? AND time_window = ?"}
+
+var postgresRetentionDialect = retentionDialect{
+	deleteRawLogs:   "DELETE FROM sbo_rawlogs WHERE log_id IN (SELECT log_id FROM sbo_rawlogs WHERE domain_id = $1 AND request_ts < $2 LIMIT $3)",
+	rawLogTimestamp: func(timestamp time.Time) any { return timestamp },
+	rollupTimeWindow: "INSERT INTO %[1]s (domain_id, metric_type, key_value, time_window, metric_value, created) " +
+		" SELECT domain_id, metric_type, key_value, $1::bigint, SUM(metric_value), now() FROM %[2]s WHERE domain_id = $2 AND time_window = $3 " +
+		" GROUP BY domain_id, metric_type, key_value ON CONFLICT (domain_id, metric_type, key_value, time_window) " +
+		" DO UPDATE SET metric_value = %[1]s.metric_value + EXCLUDED.metric_value",
+	selectTimeWindows: "SELECT DISTINCT time_window FROM %s WHERE time_window < $1 AND domain_id = $2 ORDER BY time_window LIMIT $3",
+	deleteTimeWindow:  "DELETE FROM %s WHERE domain_id = $1 AND time_window = $2"}
+
+var sqliteRetentionDialect = retentionDialect{
+	deleteRawLogs:   "DELETE FROM sbo_rawlogs WHERE log_id IN (SELECT log_id FROM sbo_rawlogs WHERE domain_id = ? AND request_ts < ? LIMIT ?)",
+	rawLogTimestamp: func(timestamp time.Time) any { return timestamp.UTC().Format(SQLITE_TIMESTAMP_FORMAT) },
+	rollupTimeWindow: "INSERT INTO %[1]s (domain_id, metric_type, key_value, time_window, metric_value, created) " +
+		" SELECT domain_id, metric_type, key_value, ?, SUM(metric_value), datetime('now') FROM %[2]s WHERE domain_id = ? AND time_window = ? " +
+		" GROUP BY domain_id, metric_type, key_value ON CONFLICT (domain_id, metric_type, key_value, time_window) " +
+		" DO UPDATE SET metric_value = metric_value + excluded.metric_value",
+	selectTimeWindows: "SELECT DISTINCT time_window FROM %s WHERE time_window < ? AND domain_id = ? ORDER BY time_window LIMIT ?",
+	deleteTimeWindow:  "DELETE FROM %s WHERE domain_id = ? AND time_window = ?"}
+
+var errRetentionStopped = errors.New("retention job was stopped")
+
+func isStopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+Returns the time window (yyyymmddhhmm) of timestamp truncated using divisor, e.g 100 for hours and 10000 for days
+*/
+func truncatedTimeWindow(timestamp time.Time, divisor int64) int64 {
+	timeWindow, _ := strconv.ParseInt(timestamp.Format("200601021504"), 10, 64)
+	return timeWindow / divisor * divisor
+}
+
+// domain name => domain id
+func getDomains(dbInstance *sql.DB) (map[string]int, error) {
+	if dbInstance == nil {
+		return nil, errDatabaseNotInitialized
+	}
+	rows, err := dbInstance.Query("SELECT domain_id, domain_name FROM sbo_domains")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	domains := make(map[string]int)
+	for rows.Next() {
+		var domainId int
+		var domainName string
+		if err := rows.Scan(&domainId, &domainName); err != nil {
+			return nil, err
+		}
+		domains[domainName] = domainId
+	}
+	return domains, rows.Err()
+}
+
+/*
+Applies policy to data of the domain. now is used to find cutoff times, metric time windows are compared using now's location.
+Stops between batches when stop is closed, stop may be nil. Returns rows deleted until an error too
+*/
+func applyRetention(dbInstance *sql.DB, dialect *retentionDialect, domainId int, policy RetentionPolicy, now time.Time, stop <-chan struct{}) (RetentionResult, error) {
+	result := RetentionResult{}
+	if dbInstance == nil {
+		return result, errDatabaseNotInitialized
+	}
+	var err error
+	if policy.RawLogDays > 0 {
+		result.RawLogsDeleted, err = deleteOldRawLogs(dbInstance, dialect, domainId, now.AddDate(0, 0, -policy.RawLogDays), stop)
+		if err != nil {
+			return result, err
+		}
+	}
+	if policy.MetricDays > 0 {
+		//complete hours only
+		beforeTimeWindow := truncatedTimeWindow(now.AddDate(0, 0, -policy.MetricDays), 100)
+		result.MetricsRolledUp, err = rollupTimeWindows(dbInstance, dialect, METRICS_TABLE, METRICS_HOURLY_TABLE, 100, domainId, beforeTimeWindow, stop)
+		if err != nil {
+			return result, err
+		}
+	}
+	if policy.HourlyMetricDays > 0 {
+		//complete days only
+		beforeTimeWindow := truncatedTimeWindow(now.AddDate(0, 0, -policy.HourlyMetricDays), 10000)
+		result.HourlyMetricsRolledUp, err = rollupTimeWindows(dbInstance, dialect, METRICS_HOURLY_TABLE, METRICS_DAILY_TABLE, 10000, domainId, beforeTimeWindow, stop)
+		if err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func deleteOldRawLogs(dbInstance *sql.DB, dialect *retentionDialect, domainId int, before time.Time, stop <-chan struct{}) (int64, error) {
+	var deleted int64 = 0
+	for {
+		if isStopped(stop) {
+			return deleted, errRetentionStopped
+		}
+		result, err := dbInstance.Exec(dialect.deleteRawLogs, domainId, dialect.rawLogTimestamp(before), DB_RETENTION_RAW_LOG_BATCH_SIZE)
+		if err != nil {
+			return deleted, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += rowsAffected
+		if rowsAffected < int64(DB_RETENTION_RAW_LOG_BATCH_SIZE) {
+			return deleted, nil
+		}
+	}
+}
+
+/*
+Rolls up time windows before beforeTimeWindow from sourceTable into targetTable, one time window per transaction.
+Target time windows are source time windows truncated using divisor. Returns the number of deleted source rows
+*/
+func rollupTimeWindows(dbInstance *sql.DB, dialect *retentionDialect, sourceTable string, targetTable string, divisor int64,
+	domainId int, beforeTimeWindow int64, stop <-chan struct{}) (int64, error) {
+	var rolledUp int64 = 0
+	rollupQuery := fmt.Sprintf(dialect.rollupTimeWindow, targetTable, sourceTable)
+	selectQuery := fmt.Sprintf(dialect.selectTimeWindows, sourceTable)
+	deleteQuery := fmt.Sprintf(dialect.deleteTimeWindow, sourceTable)
+	for {
+		timeWindows, err := selectTimeWindows(dbInstance, selectQuery, beforeTimeWindow, domainId)
+		if err != nil || len(timeWindows) < 1 {
+			return rolledUp, err
+		}
+		for _, timeWindow := range timeWindows {
+			if isStopped(stop) {
+				return rolledUp, errRetentionStopped
+			}
+			tx, err := dbInstance.Begin()
+			if err != nil {
+				return rolledUp, err
+			}
+			if _, err = tx.Exec(rollupQuery, timeWindow/divisor*divisor, domainId, timeWindow); err != nil {
+				tx.Rollback()
+				return rolledUp, err
+			}
+			result, err := tx.Exec(deleteQuery, domainId, timeWindow)
+			if err != nil {
+				tx.Rollback()
+				return rolledUp, err
+			}
+			if err = tx.Commit(); err != nil {
+				return rolledUp, err
+			}
+			rowsAffected, _ := result.RowsAffected()
+			rolledUp += rowsAffected
+		}
+	}
+}
+
+func selectTimeWindows(dbInstance *sql.DB, query string, beforeTimeWindow int64, domainId int) ([]int64, error) {
+	rows, err := dbInstance.Query(query, beforeTimeWindow, domainId, DB_RETENTION_TIME_WINDOW_BATCH_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	timeWindows := make([]int64, 0, DB_RETENTION_TIME_WINDOW_BATCH_SIZE)
+	for rows.Next() {
+		var timeWindow int64
+		if err := rows.Scan(&timeWindow); err != nil {
+			return nil, err
+		}
+		timeWindows = append(timeWindows, timeWindow)
+	}
+	return timeWindows, rows.Err()
+}
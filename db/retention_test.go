@@ -0,0 +1,115 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func TestTruncatedTimeWindow(t *testing.T) {
+	timestamp := time.Date(2025, 7, 1, 10, 23, 0, 0, time.UTC)
+	if timeWindow := truncatedTimeWindow(timestamp, 100); timeWindow != 202507011000 {
+		t.Errorf("Unexpected hourly time window %v", timeWindow)
+	}
+	if timeWindow := truncatedTimeWindow(timestamp, 10000); timeWindow != 202507010000 {
+		t.Errorf("Unexpected daily time window %v", timeWindow)
+	}
+}
+
+func TestApplyRetentionSQLite(t *testing.T) {
+	sbosdb := NewSBOSQLiteDB()
+	if _, err := sbosdb.Init("", "", "", filepath.Join(t.TempDir(), "sbo.db")); err != nil {
+		t.Fatalf("Init failed %v", err)
+	}
+	defer sbosdb.Close()
+	domainId, _ := sbosdb.GetDomainId("example.com", 1)
+	otherDomainId, _ := sbosdb.GetDomainId("example.org", 1)
+	now := time.Date(2025, 7, 20, 12, 30, 0, 0, time.UTC)
+
+	rawLogs := []RawLogRow{}
+	for _, daysAgo := range []int{1, 5, 9, 10, 30} {
+		logEntry := &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: now.AddDate(0, 0, -daysAgo), Path: "/", Status: "200",
+			UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0")}
+		rawLogs = append(rawLogs, RawLogRow{Data: logEntry, DomainId: domainId}, RawLogRow{Data: logEntry, DomainId: otherDomainId})
+	}
+	if err := sbosdb.SaveRawLogBatch(rawLogs); err != nil {
+		t.Fatalf("SaveRawLogBatch failed %v", err)
+	}
+	metricRows := []MetricDataRow{}
+	//2 days ago, rolled up into 2 hours, then into 1 day
+	for _, timeWindow := range []int64{202507181001, 202507181002, 202507181159, 202507191500} {
+		metricRows = append(metricRows, MetricDataRow{Data: metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", timeWindow, 2), DomainId: domainId},
+			MetricDataRow{Data: metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", timeWindow, 2), DomainId: otherDomainId})
+	}
+	if err := sbosdb.SaveMetricDataBatch(metricRows); err != nil {
+		t.Fatalf("SaveMetricDataBatch failed %v", err)
+	}
+
+	domains, err := sbosdb.GetDomains()
+	if err != nil || len(domains) != 2 || domains["example.com"] != domainId {
+		t.Errorf("Unexpected domains %v %v", domains, err)
+	}
+	policy := RetentionPolicy{RawLogDays: 7, MetricDays: 1, HourlyMetricDays: 1}
+	result, err := sbosdb.ApplyRetention(domainId, policy, now, nil)
+	if err != nil || result.RawLogsDeleted != 3 || result.MetricsRolledUp != 3 || result.HourlyMetricsRolledUp != 2 {
+		t.Errorf("Unexpected retention result %+v %v", result, err)
+	}
+
+	count := func(query string, args ...any) int64 {
+		var value int64
+		if err := sbosdb.DbInstance.QueryRow(query, args...).Scan(&value); err != nil {
+			t.Errorf("Query failed %v %v", query, err)
+		}
+		return value
+	}
+	if rawLogCount := count("SELECT count(*) FROM sbo_rawlogs WHERE domain_id = ?", domainId); rawLogCount != 2 {
+		t.Errorf("Unexpected raw log count %v", rawLogCount)
+	}
+	if metricCount := count("SELECT count(*) FROM sbo_metrics WHERE domain_id = ?", domainId); metricCount != 1 {
+		t.Errorf("Unexpected metric count %v", metricCount)
+	}
+	if dailyValue := count("SELECT metric_value FROM sbo_metrics_daily WHERE domain_id = ? AND time_window = 202507180000", domainId); dailyValue != 6 {
+		t.Errorf("Unexpected daily value %v", dailyValue)
+	}
+	//other domain is not changed
+	if rawLogCount := count("SELECT count(*) FROM sbo_rawlogs WHERE domain_id = ?", otherDomainId); rawLogCount != 5 {
+		t.Errorf("Unexpected raw log count for other domain %v", rawLogCount)
+	}
+
+	//rows added after a rollup are added to existing rolled up values
+	sbosdb.SaveMetricDataBatch([]MetricDataRow{{Data: metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", 202507181030, 5), DomainId: domainId}})
+	if _, err = sbosdb.ApplyRetention(domainId, policy, now, nil); err != nil {
+		t.Errorf("ApplyRetention failed %v", err)
+	}
+	if dailyValue := count("SELECT metric_value FROM sbo_metrics_daily WHERE domain_id = ? AND time_window = 202507180000", domainId); dailyValue != 11 {
+		t.Errorf("Unexpected daily value after second run %v", dailyValue)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if _, err = sbosdb.ApplyRetention(otherDomainId, policy, now, stop); err != errRetentionStopped {
+		t.Errorf("Expected stopped error, got %v", err)
+	}
+}
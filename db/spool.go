@@ -0,0 +1,391 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	// new segment files are started when the current segment is larger than this, or than a quarter of the maximum size of the spool
+	DB_SPOOL_SEGMENT_MAX_BYTES int64 = 16 * 1024 * 1024
+	// used when the maximum size of a spool is not positive
+	DB_SPOOL_DEFAULT_MAX_BYTES int64  = 1024 * 1024 * 1024
+	DB_SPOOL_SEGMENT_EXTENSION string = ".jsonl"
+	DB_SPOOL_OFFSET_EXTENSION  string = ".offset"
+)
+
+// see spoolRecord.recordType
+const (
+	SPOOL_RECORD_INVALID int = iota
+	SPOOL_RECORD_METRIC
+	SPOOL_RECORD_RAW_LOG
+	SPOOL_RECORD_INGEST_PROGRESS
+)
+
+/*
+A row in a spool. One of Metric, RawLog or Progress is set.
+DomainName is set instead of the domain id of the row when the domain id was not known,
+i.e the database was not available, the domain id is found when the record is replayed
+*/
+type spoolRecord struct {
+	Metric                *MetricDataRow     `json:",omitempty"`
+	RawLog                *RawLogRow         `json:",omitempty"`
+	Progress              *IngestProgressRow `json:",omitempty"`
+	DomainName            string             `json:",omitempty"`
+	TimeWindowSizeMinutes int                `json:",omitempty"`
+}
+
+// SPOOL_RECORD_INVALID unless exactly one row with its data is set
+func (record *spoolRecord) recordType() int {
+	switch {
+	case record.Metric != nil && record.RawLog == nil && record.Progress == nil && record.Metric.Data != nil:
+		return SPOOL_RECORD_METRIC
+	case record.Metric == nil && record.RawLog != nil && record.Progress == nil && record.RawLog.Data != nil:
+		return SPOOL_RECORD_RAW_LOG
+	case record.Metric == nil && record.RawLog == nil && record.Progress != nil && len(record.Progress.SourceId) > 0:
+		return SPOOL_RECORD_INGEST_PROGRESS
+	}
+	return SPOOL_RECORD_INVALID
+}
+
+type spoolSegment struct {
+	path string
+	size int64
+	//bytes replayed so far, saved in the .offset file of the segment
+	offset int64
+	//rows which were not replayed yet
+	rows int64
+}
+
+/*
+Write-ahead spool for rows which could not be saved into the database, see SBOBatchWriter.
+Rows are appended to segment files (json lines) in a directory and replayed in the same order later.
+Replayed parts of segments are recorded in .offset files, so rows are not saved twice after restarts.
+When the spool is larger than its maximum size, oldest segments are deleted.
+Not safe for concurrent use.
+*/
+type SBOSpool struct {
+	directory       string
+	maxBytes        int64
+	segmentMaxBytes int64
+	//may be nil
+	stats *metrics.SBOPipelineStats
+	//oldest first
+	segments     []*spoolSegment
+	nextSequence int64
+	//segment rows are appended to, nil until the first append. Segments of previous runs are not appended to, they may end with a partial line
+	currentSegment *spoolSegment
+}
+
+var spoolSegmentNameRegex = regexp.MustCompile(`^([0-9]{20})` + regexp.QuoteMeta(DB_SPOOL_SEGMENT_EXTENSION) + `$`)
+
+/*
+Opens the spool in directory, creating the directory if necessary. Segments left from previous runs are replayed first.
+stats may be nil
+*/
+func NewSBOSpool(directory string, maxBytes int64, stats *metrics.SBOPipelineStats) (*SBOSpool, error) {
+	if maxBytes < 1 {
+		maxBytes = DB_SPOOL_DEFAULT_MAX_BYTES
+	}
+	spool := &SBOSpool{
+		directory:       directory,
+		maxBytes:        maxBytes,
+		segmentMaxBytes: max(min(DB_SPOOL_SEGMENT_MAX_BYTES, maxBytes/4), 1),
+		stats:           stats,
+		segments:        make([]*spoolSegment, 0),
+		nextSequence:    1}
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+	//ReadDir returns entries sorted by name, i.e by sequence
+	for _, entry := range entries {
+		matches := spoolSegmentNameRegex.FindStringSubmatch(entry.Name())
+		if matches == nil || entry.IsDir() {
+			continue
+		}
+		sequence, _ := strconv.ParseInt(matches[1], 10, 64)
+		spool.nextSequence = max(spool.nextSequence, sequence+1)
+		segment, err := loadSpoolSegment(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		spool.segments = append(spool.segments, segment)
+	}
+	spool.updateStats()
+	if !spool.IsEmpty() {
+		slog.Info("Found rows spooled by a previous run", "directory", directory, "rows", spool.Rows(), "bytes", spool.Bytes())
+	}
+	return spool, nil
+}
+
+func loadSpoolSegment(segmentPath string) (*spoolSegment, error) {
+	segment := &spoolSegment{path: segmentPath}
+	if offsetBytes, err := os.ReadFile(segmentPath + DB_SPOOL_OFFSET_EXTENSION); err == nil {
+		segment.offset, _ = strconv.ParseInt(strings.TrimSpace(string(offsetBytes)), 10, 64)
+	}
+	file, err := os.Open(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	segment.size = fileInfo.Size()
+	segment.offset = min(max(segment.offset, 0), segment.size)
+	if _, err = file.Seek(segment.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buffer := make([]byte, 65536)
+	for {
+		bytesRead, err := file.Read(buffer)
+		segment.rows += int64(bytes.Count(buffer[:bytesRead], []byte{'\n'}))
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return segment, nil
+}
+
+// true when there are no rows to replay
+func (spool *SBOSpool) IsEmpty() bool {
+	return spool.Rows() < 1
+}
+
+// rows which were not replayed yet
+func (spool *SBOSpool) Rows() int64 {
+	var rows int64 = 0
+	for _, segment := range spool.segments {
+		rows += segment.rows
+	}
+	return rows
+}
+
+// size of segments, excluding parts which were replayed
+func (spool *SBOSpool) Bytes() int64 {
+	var size int64 = 0
+	for _, segment := range spool.segments {
+		size += segment.size - segment.offset
+	}
+	return size
+}
+
+func (spool *SBOSpool) updateStats() {
+	if spool.stats != nil {
+		spool.stats.DbSpoolRows.Store(spool.Rows())
+		spool.stats.DbSpoolBytes.Store(spool.Bytes())
+	}
+}
+
+/*
+Appends records to the spool and syncs the segment file. Oldest segments are deleted if the spool becomes larger than its maximum size
+*/
+func (spool *SBOSpool) Append(records []spoolRecord) error {
+	if len(records) < 1 {
+		return nil
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for index := range records {
+		if err := encoder.Encode(&records[index]); err != nil {
+			return err
+		}
+	}
+	if spool.currentSegment == nil || spool.currentSegment.size >= spool.segmentMaxBytes {
+		spool.currentSegment = &spoolSegment{path: filepath.Join(spool.directory, fmt.Sprintf("%020d%v", spool.nextSequence, DB_SPOOL_SEGMENT_EXTENSION))}
+		spool.nextSequence++
+		spool.segments = append(spool.segments, spool.currentSegment)
+	}
+	file, err := os.OpenFile(spool.currentSegment.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	bytesWritten, err := file.Write(buffer.Bytes())
+	spool.currentSegment.size += int64(bytesWritten)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		//the segment may end with a partial line now, start a new segment next time
+		spool.currentSegment = nil
+		return err
+	}
+	spool.currentSegment.rows += int64(len(records))
+
+	for spool.Bytes() > spool.maxBytes && len(spool.segments) > 1 {
+		oldestSegment := spool.segments[0]
+		slog.Warn("Spool is full, dropping oldest rows", "directory", spool.directory, "segment", oldestSegment.path, "rows", oldestSegment.rows)
+		if spool.stats != nil {
+			spool.stats.DbSpoolDroppedRows.Add(oldestSegment.rows)
+		}
+		spool.removeOldestSegment()
+	}
+	spool.updateStats()
+	return nil
+}
+
+func (spool *SBOSpool) removeOldestSegment() {
+	segment := spool.segments[0]
+	os.Remove(segment.path)
+	os.Remove(segment.path + DB_SPOOL_OFFSET_EXTENSION)
+	spool.segments = spool.segments[1:]
+	if spool.currentSegment == segment {
+		spool.currentSegment = nil
+	}
+}
+
+/*
+Replays records in the order they were appended. apply is called with records of the same type (see spoolRecord.recordType),
+up to DB_BATCH_MAX_ROWS records at a time. Replay stops at the first error returned by apply and continues from the same record next time.
+Replayed segments are deleted.
+The replayed offset is saved after apply returns, so records are applied again if the process stops in between, or saving the offset fails.
+Raw logs and ingest progress are saved once anyway (raw logs have line hashes, see newSpoolLineHash), metric values which are added
+to existing values are added twice though.
+*/
+func (spool *SBOSpool) Replay(apply func(records []spoolRecord) error) error {
+	defer spool.updateStats()
+	for len(spool.segments) > 0 {
+		if err := spool.replaySegment(spool.segments[0], apply); err != nil {
+			return err
+		}
+		spool.removeOldestSegment()
+	}
+	return nil
+}
+
+func (spool *SBOSpool) replaySegment(segment *spoolSegment, apply func(records []spoolRecord) error) error {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = file.Seek(segment.offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	batch := make([]spoolRecord, 0, DB_BATCH_MAX_ROWS)
+	//lines read so far, including invalid lines which are skipped
+	var linesRead int64 = 0
+	position := segment.offset
+	applyBatch := func() error {
+		if len(batch) > 0 {
+			if err := apply(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		segment.offset = position
+		segment.rows = max(segment.rows-linesRead, 0)
+		linesRead = 0
+		spool.updateStats()
+		return spool.saveOffset(segment)
+	}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				//incomplete write, e.g the process was killed while appending
+				slog.Warn("Skipping incomplete line at the end of spool segment", "segment", segment.path, "offset", position)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var record spoolRecord
+		if json.Unmarshal(line, &record) != nil || record.recordType() == SPOOL_RECORD_INVALID {
+			slog.Warn("Skipping invalid line in spool segment", "segment", segment.path, "offset", position)
+			if spool.stats != nil {
+				spool.stats.DbSpoolDroppedRows.Add(1)
+			}
+			position += int64(len(line))
+			linesRead++
+			continue
+		}
+		if len(batch) > 0 && (len(batch) >= DB_BATCH_MAX_ROWS || batch[0].recordType() != record.recordType()) {
+			if err := applyBatch(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, record)
+		position += int64(len(line))
+		linesRead++
+	}
+	return applyBatch()
+}
+
+// Offsets are written into a temporary file first, so a crash while saving doesn't corrupt the offset file
+func (spool *SBOSpool) saveOffset(segment *spoolSegment) error {
+	tempFilePath := segment.path + DB_SPOOL_OFFSET_EXTENSION + ".tmp"
+	if err := os.WriteFile(tempFilePath, []byte(strconv.FormatInt(segment.offset, 10)), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, segment.path+DB_SPOOL_OFFSET_EXTENSION)
+}
+
+/*
+Returns a random line hash for raw logs which don't have one, e.g logs received via syslog, so they are inserted once when replayed twice
+*/
+func newSpoolLineHash() string {
+	randomBytes := make([]byte, 32)
+	rand.Read(randomBytes)
+	return hex.EncodeToString(randomBytes)
+}
+
+var spoolDirectoryUnsafeCharsRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+/*
+Returns the spool directory of an input under baseDirectory. Directory names are readable versions of input keys (e.g file paths),
+followed by a hash of the key so they are unique
+*/
+func SpoolDirectoryForInput(baseDirectory string, inputKey string) string {
+	name := strings.Trim(spoolDirectoryUnsafeCharsRegex.ReplaceAllString(inputKey, "_"), "_.")
+	if len(name) > 64 {
+		name = name[len(name)-64:]
+	}
+	hash := sha256.Sum256([]byte(inputKey))
+	return filepath.Join(baseDirectory, name+"-"+hex.EncodeToString(hash[:4]))
+}
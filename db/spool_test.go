@@ -0,0 +1,402 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func newTestSpoolRecord(index int, isMetric bool) spoolRecord {
+	if isMetric {
+		return spoolRecord{Metric: &MetricDataRow{Data: metrics.NewSBOMetricWindowDataToBeSaved("f", 1, fmt.Sprintf("%v", index), 202507011000, 1), DomainId: 1}}
+	}
+	return spoolRecord{RawLog: &RawLogRow{Data: &logparsers.SBOHttpRequestLog{Path: fmt.Sprintf("/%v", index), UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0")}, DomainId: 1},
+		DomainName: "example.com", TimeWindowSizeMinutes: 10}
+}
+
+func spoolRecordIndex(record spoolRecord) string {
+	if record.Metric != nil {
+		return record.Metric.Data.KeyValue
+	}
+	return strings.TrimPrefix(record.RawLog.Data.Path, "/")
+}
+
+func TestSpoolReplay(t *testing.T) {
+	directory := t.TempDir()
+	stats := &metrics.SBOPipelineStats{}
+	spool, err := NewSBOSpool(directory, 0, stats)
+	if err != nil {
+		t.Fatalf("NewSBOSpool failed %v", err)
+	}
+	//raw logs, metrics, raw logs
+	const recordCount = DB_BATCH_MAX_ROWS + 220
+	for index := 0; index < recordCount; index += 10 {
+		records := make([]spoolRecord, 0, 10)
+		for recordIndex := index; recordIndex < index+10; recordIndex++ {
+			records = append(records, newTestSpoolRecord(recordIndex, recordIndex >= 100 && recordIndex < 200))
+		}
+		if err := spool.Append(records); err != nil {
+			t.Fatalf("Append failed %v", err)
+		}
+	}
+	if spool.Rows() != int64(recordCount) || stats.DbSpoolRows.Load() != int64(recordCount) || stats.DbSpoolBytes.Load() < 1 {
+		t.Errorf("Unexpected rows %v %v", spool.Rows(), stats.DbSpoolRows.Load())
+	}
+
+	//fails on the third batch, i.e the second batch of raw logs
+	replayed := make([]string, 0)
+	batchSizes := make([]int, 0)
+	err = spool.Replay(func(records []spoolRecord) error {
+		if len(batchSizes) == 2 {
+			return errors.New("test error")
+		}
+		for _, record := range records {
+			if (record.Metric != nil) != (records[0].Metric != nil) {
+				t.Errorf("Batches must contain records of the same type")
+			}
+			replayed = append(replayed, spoolRecordIndex(record))
+		}
+		batchSizes = append(batchSizes, len(records))
+		return nil
+	})
+	if err == nil || len(batchSizes) != 2 || batchSizes[0] != 100 || batchSizes[1] != 100 || spool.Rows() != int64(recordCount-200) {
+		t.Errorf("Unexpected replay result err=%v batches=%v rows=%v", err, batchSizes, spool.Rows())
+	}
+
+	//replaying continues from the same record after restarts
+	spool, err = NewSBOSpool(directory, 0, stats)
+	if err != nil || spool.Rows() != int64(recordCount-200) {
+		t.Fatalf("Unexpected spool after reopening rows=%v err=%v", spool.Rows(), err)
+	}
+	err = spool.Replay(func(records []spoolRecord) error {
+		for _, record := range records {
+			replayed = append(replayed, spoolRecordIndex(record))
+		}
+		batchSizes = append(batchSizes, len(records))
+		return nil
+	})
+	if err != nil || !spool.IsEmpty() || stats.DbSpoolRows.Load() != 0 || stats.DbSpoolBytes.Load() != 0 {
+		t.Errorf("Unexpected replay result err=%v rows=%v", err, spool.Rows())
+	}
+	if len(replayed) != recordCount || batchSizes[2] != DB_BATCH_MAX_ROWS || batchSizes[3] != recordCount-200-DB_BATCH_MAX_ROWS {
+		t.Errorf("Unexpected replayed records %v batches=%v", len(replayed), batchSizes)
+	}
+	for index, recordIndex := range replayed {
+		if recordIndex != fmt.Sprintf("%v", index) {
+			t.Fatalf("Unexpected record at %v: %v", index, recordIndex)
+		}
+	}
+	if files, _ := os.ReadDir(directory); len(files) != 0 {
+		t.Errorf("Replayed segments must be deleted, found %v files", len(files))
+	}
+}
+
+func TestSpoolSkipsInvalidLines(t *testing.T) {
+	directory := t.TempDir()
+	spool, _ := NewSBOSpool(directory, 0, nil)
+	spool.Append([]spoolRecord{newTestSpoolRecord(0, true)})
+	//e.g the process was killed while writing
+	file, _ := os.OpenFile(spool.segments[0].path, os.O_WRONLY|os.O_APPEND, 0600)
+	file.WriteString("not json\n{\"Metric\":")
+	file.Close()
+
+	stats := &metrics.SBOPipelineStats{}
+	spool, _ = NewSBOSpool(directory, 0, stats)
+	spool.Append([]spoolRecord{newTestSpoolRecord(1, true)})
+	replayed := make([]string, 0)
+	err := spool.Replay(func(records []spoolRecord) error {
+		for _, record := range records {
+			replayed = append(replayed, spoolRecordIndex(record))
+		}
+		return nil
+	})
+	if err != nil || len(replayed) != 2 || replayed[0] != "0" || replayed[1] != "1" || stats.DbSpoolDroppedRows.Load() != 1 {
+		t.Errorf("Unexpected replay result err=%v replayed=%v dropped=%v", err, replayed, stats.DbSpoolDroppedRows.Load())
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	stats := &metrics.SBOPipelineStats{}
+	const maxBytes = 4096
+	spool, _ := NewSBOSpool(t.TempDir(), maxBytes, stats)
+	for index := 0; index < 100; index++ {
+		spool.Append([]spoolRecord{newTestSpoolRecord(index, true)})
+	}
+	if spool.Bytes() > maxBytes || stats.DbSpoolDroppedRows.Load() < 1 || spool.Rows()+stats.DbSpoolDroppedRows.Load() != 100 {
+		t.Errorf("Unexpected spool size bytes=%v rows=%v dropped=%v", spool.Bytes(), spool.Rows(), stats.DbSpoolDroppedRows.Load())
+	}
+	//oldest rows are dropped
+	replayed := make([]string, 0)
+	spool.Replay(func(records []spoolRecord) error {
+		for _, record := range records {
+			replayed = append(replayed, spoolRecordIndex(record))
+		}
+		return nil
+	})
+	if len(replayed) < 1 || replayed[len(replayed)-1] != "99" || replayed[0] == "0" {
+		t.Errorf("Unexpected replayed records %v", replayed)
+	}
+}
+
+func TestSpoolDirectoryForInput(t *testing.T) {
+	first := SpoolDirectoryForInput("/spool", "/var/log/nginx/access.log")
+	second := SpoolDirectoryForInput("/spool", "/var/log/nginx/access_log")
+	if filepath.Dir(first) != "/spool" || !strings.HasPrefix(filepath.Base(first), "var_log_nginx_access.log-") || first == second {
+		t.Errorf("Unexpected spool directories %v %v", first, second)
+	}
+}
+
+func TestBatchWriterSpoolSQLite(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	spoolDirectory := t.TempDir()
+	var databaseAvailable atomic.Bool
+	newWriter := func(stats *metrics.SBOPipelineStats) *SBOBatchWriter {
+		storage := NewSBOSQLiteDB()
+		reconnect := func() (bool, error) {
+			if !databaseAvailable.Load() {
+				return false, errors.New("test database is not available")
+			}
+			return storage.Init("", "", "", databaseFile)
+		}
+		reconnect()
+		spool, err := NewSBOSpool(spoolDirectory, 0, stats)
+		if err != nil {
+			t.Fatalf("NewSBOSpool failed %v", err)
+		}
+		return NewSBOBatchWriter(storage, stats, spool, reconnect)
+	}
+	saveRows := func(writer *SBOBatchWriter, firstIndex int, count int) {
+		domainId, err := writer.GetDomainId("example.com", 10)
+		if err != nil {
+			t.Errorf("GetDomainId must not fail when spooling %v", err)
+		}
+		for index := firstIndex; index < firstIndex+count; index++ {
+			logEntry := &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC),
+				Path: fmt.Sprintf("/%v", index), Status: "200", UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0")}
+			writer.SaveRawLog(logEntry, domainId, 1, true)
+			writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", 202507011000, 2), domainId, false)
+		}
+	}
+
+	//database is down, rows are kept in the spool after closing
+	stats := &metrics.SBOPipelineStats{}
+	writer := newWriter(stats)
+	if !writer.IsInitialized() {
+		t.Errorf("Writer must accept rows when spooling")
+	}
+	saveRows(writer, 0, 600)
+	writer.Close()
+	if stats.DbSpoolRows.Load() < 600 || stats.DbRowsWritten.Load() != 0 {
+		t.Errorf("Unexpected stats spooled=%v written=%v", stats.DbSpoolRows.Load(), stats.DbRowsWritten.Load())
+	}
+	segments, _ := filepath.Glob(filepath.Join(spoolDirectory, "*"+DB_SPOOL_SEGMENT_EXTENSION))
+	for _, segment := range segments {
+		if content, _ := os.ReadFile(segment); strings.Contains(string(content), "192.0.2.1") {
+			t.Errorf("Masked IPs must not be spooled")
+		}
+	}
+
+	//database is back, spooled rows are saved before new rows
+	databaseAvailable.Store(true)
+	stats = &metrics.SBOPipelineStats{}
+	writer = newWriter(stats)
+	saveRows(writer, 600, 100)
+	writer.Close()
+	if stats.DbSpoolRows.Load() != 0 || stats.DbRowsWritten.Load() < 700 {
+		t.Errorf("Unexpected stats spooled=%v written=%v", stats.DbSpoolRows.Load(), stats.DbRowsWritten.Load())
+	}
+
+	sbosdb := NewSBOSQLiteDB()
+	sbosdb.Init("", "", "", databaseFile)
+	defer sbosdb.Close()
+	var rawLogs, metricValue, domainId, rawLogDomainId int64
+	var firstPath, lastPath string
+	sbosdb.DbInstance.QueryRow("SELECT count(*) FROM sbo_rawlogs").Scan(&rawLogs)
+	sbosdb.DbInstance.QueryRow("SELECT request_uri FROM sbo_rawlogs ORDER BY log_id LIMIT 1").Scan(&firstPath)
+	sbosdb.DbInstance.QueryRow("SELECT request_uri FROM sbo_rawlogs ORDER BY log_id DESC LIMIT 1").Scan(&lastPath)
+	sbosdb.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE metric_type=1").Scan(&metricValue)
+	sbosdb.DbInstance.QueryRow("SELECT domain_id FROM sbo_domains WHERE domain_name='example.com'").Scan(&domainId)
+	sbosdb.DbInstance.QueryRow("SELECT DISTINCT domain_id FROM sbo_rawlogs").Scan(&rawLogDomainId)
+	if rawLogs != 700 || firstPath != "/0" || lastPath != "/699" {
+		t.Errorf("Unexpected raw logs count=%v first=%v last=%v", rawLogs, firstPath, lastPath)
+	}
+	if metricValue != 1400 || domainId < 1 || rawLogDomainId != domainId {
+		t.Errorf("Unexpected metric value=%v domainId=%v rawLogDomainId=%v", metricValue, domainId, rawLogDomainId)
+	}
+}
+
+func TestSpooledRawLogsAreSavedOnce(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	spoolDirectory := t.TempDir()
+	newWriter := func(databaseAvailable bool) *SBOBatchWriter {
+		storage := NewSBOSQLiteDB()
+		if databaseAvailable {
+			storage.Init("", "", "", databaseFile)
+		}
+		spool, err := NewSBOSpool(spoolDirectory, 0, nil)
+		if err != nil {
+			t.Fatalf("NewSBOSpool failed %v", err)
+		}
+		return NewSBOBatchWriter(storage, nil, spool, nil)
+	}
+
+	//database is down, rows without line hashes (e.g from syslog) and with line hashes are spooled
+	writer := newWriter(false)
+	domainId, _ := writer.GetDomainId("example.com", 10)
+	for index := 0; index < 10; index++ {
+		logEntry := &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC),
+			Path: fmt.Sprintf("/%v", index), Status: "200", UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0")}
+		if index%2 == 0 {
+			logEntry.LineHash = LineHash("source", int64(index), logEntry.Path)
+		}
+		writer.SaveRawLog(logEntry, domainId, 1, false)
+	}
+	writer.Close()
+	segments, _ := filepath.Glob(filepath.Join(spoolDirectory, "*"+DB_SPOOL_SEGMENT_EXTENSION))
+	savedSegments := make(map[string][]byte)
+	for _, segment := range segments {
+		savedSegments[segment], _ = os.ReadFile(segment)
+	}
+	if len(savedSegments) < 1 {
+		t.Fatal("Rows were not spooled")
+	}
+
+	//replayed, then replayed again as if the process stopped before the replayed offset was saved
+	newWriter(true).Close()
+	for segment, content := range savedSegments {
+		os.WriteFile(segment, content, 0600)
+	}
+	newWriter(true).Close()
+
+	sbosdb := NewSBOSQLiteDB()
+	sbosdb.Init("", "", "", databaseFile)
+	defer sbosdb.Close()
+	var rawLogs int64
+	sbosdb.DbInstance.QueryRow("SELECT count(*) FROM sbo_rawlogs").Scan(&rawLogs)
+	if rawLogs != 10 {
+		t.Errorf("Unexpected raw logs count %v", rawLogs)
+	}
+}
+
+// fails saving ingest progress while failProgress is true
+type testProgressFailingStorage struct {
+	*SBOSQLiteDB
+	failProgress atomic.Bool
+}
+
+func (storage *testProgressFailingStorage) SaveIngestProgressBatch(rows []IngestProgressRow) error {
+	if storage.failProgress.Load() {
+		return errors.New("test progress failure")
+	}
+	return storage.SBOSQLiteDB.SaveIngestProgressBatch(rows)
+}
+
+func TestSavedMetricsAreNotSpooledWhenProgressFails(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	spoolDirectory := t.TempDir()
+	newWriter := func(failProgress bool, useSpool bool) *SBOBatchWriter {
+		storage := &testProgressFailingStorage{SBOSQLiteDB: NewSBOSQLiteDB()}
+		storage.Init("", "", "", databaseFile)
+		storage.failProgress.Store(failProgress)
+		if !useSpool {
+			return NewSBOBatchWriter(storage, &metrics.SBOPipelineStats{}, nil, nil)
+		}
+		spool, err := NewSBOSpool(spoolDirectory, 0, nil)
+		if err != nil {
+			t.Fatalf("NewSBOSpool failed %v", err)
+		}
+		return NewSBOBatchWriter(storage, nil, spool, nil)
+	}
+	savedValues := func() (int64, int64) {
+		sbosdb := NewSBOSQLiteDB()
+		sbosdb.Init("", "", "", databaseFile)
+		defer sbosdb.Close()
+		var metricValue int64
+		sbosdb.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE metric_type=1").Scan(&metricValue)
+		domainId, _ := sbosdb.GetDomainId("example.com", 10)
+		offset, _ := sbosdb.GetIngestOffset(domainId, "source")
+		return metricValue, offset
+	}
+
+	//metrics are saved, progress is spooled and saved when the spool is replayed
+	writer := newWriter(true, true)
+	domainId, _ := writer.GetDomainId("example.com", 10)
+	writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", 202507011000, 2), domainId, false)
+	writer.SaveIngestProgressBatch([]IngestProgressRow{{DomainId: domainId, SourceId: "source", Offset: 100}})
+	writer.Close()
+	if metricValue, offset := savedValues(); metricValue != 2 || offset != 0 {
+		t.Fatalf("Unexpected values before replay metric=%v offset=%v", metricValue, offset)
+	}
+	newWriter(false, true).Close()
+	if metricValue, offset := savedValues(); metricValue != 2 || offset != 100 {
+		t.Errorf("Unexpected values after replay metric=%v offset=%v", metricValue, offset)
+	}
+
+	//without a spool, progress is saved again in the next flush
+	writer = newWriter(true, false)
+	writer.SaveMetricData(metrics.NewSBOMetricWindowDataToBeSaved("f", 1, "200", 202507011000, 3), domainId, false)
+	writer.SaveIngestProgressBatch([]IngestProgressRow{{DomainId: domainId, SourceId: "source", Offset: 200}})
+	deadline := time.Now().Add(5 * DB_BATCH_FLUSH_INTERVAL)
+	for writer.stats.DbWriteErrors.Load() < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	writer.SBOStorage.(*testProgressFailingStorage).failProgress.Store(false)
+	writer.Close()
+	if metricValue, offset := savedValues(); metricValue != 5 || offset != 200 {
+		t.Errorf("Unexpected values without a spool metric=%v offset=%v", metricValue, offset)
+	}
+}
+
+func TestIngestOffsetOfPendingDomain(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	spool, err := NewSBOSpool(t.TempDir(), 0, nil)
+	if err != nil {
+		t.Fatalf("NewSBOSpool failed %v", err)
+	}
+	storage := NewSBOSQLiteDB()
+	writer := NewSBOBatchWriter(storage, nil, spool, nil)
+	defer writer.Close()
+	pendingDomainId, err := writer.GetDomainId("example.com", 10)
+	if err != nil || pendingDomainId > DB_PENDING_DOMAIN_ID_BASE {
+		t.Fatalf("Unexpected domain id %v %v", pendingDomainId, err)
+	}
+	if _, err := writer.GetIngestOffset(pendingDomainId, "abc"); err == nil {
+		t.Error("Offset of a pending domain was read while the database is not available")
+	}
+
+	writer.storageMutex.Lock()
+	storage.Init("", "", "", databaseFile)
+	writer.storageMutex.Unlock()
+	domainId, _ := storage.GetDomainId("example.com", 10)
+	storage.SaveIngestProgressBatch([]IngestProgressRow{{DomainId: domainId, SourceId: "abc", Offset: 100}})
+	if offset, err := writer.GetIngestOffset(pendingDomainId, "abc"); err != nil || offset != 100 {
+		t.Errorf("Unexpected offset of a pending domain %v %v", offset, err)
+	}
+}
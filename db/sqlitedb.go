@@ -0,0 +1,299 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"database/sql"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// timestamps are saved as text in UTC using this format, so they sort correctly
+const SQLITE_TIMESTAMP_FORMAT string = "2006-01-02 15:04:05"
+
+// milliseconds to wait for locks, files processed in parallel use separate connections to the same database file
+const SQLITE_BUSY_TIMEOUT_MILLIS int = 10000
+
+// files processed in parallel open the same database, migrations are applied by one of them
+var sqliteMigrationMutex sync.Mutex
+
+/*
+SQLite storage backend, the database is a single file which is created when it does not exist. Schema migrations are applied when it's opened.
+Semantics are the same as SBOAnalyticsDB (mysql)
+*/
+type SBOSQLiteDB struct {
+	DbInstance     *sql.DB
+	isInitialized  bool
+	syncMutex      sync.Mutex
+	domainIdsCache map[string]int
+	statements     batchStatements
+}
+
+var sqliteBatchInsertDialect = batchInsertDialect{
+	metricInsertPrefix:  "INSERT INTO sbo_metrics (domain_id, metric_type, key_value, time_window, metric_value, created) VALUES ",
+	metricRowTemplate:   "(?, ?, ?, ?, ?, datetime('now'))",
+	metricAddSuffix:     " ON CONFLICT (domain_id, metric_type, key_value, time_window) DO UPDATE SET metric_value=metric_value+excluded.metric_value",
+	metricReplaceSuffix: " ON CONFLICT (domain_id, metric_type, key_value, time_window) DO UPDATE SET metric_value=excluded.metric_value",
+	metricArgs: func(row *MetricDataRow) []any {
+		return []any{row.DomainId, row.Data.MetricType, ReduceToMaxColumnLen(row.Data.KeyValue, 100), row.Data.TimeWindow, row.Data.MetricValue}
+	},
+	rawLogInsertPrefix: "INSERT INTO sbo_rawlogs (domain_id, host_id, request_ts, client_ip, remote_user, http_method, " +
+		" path3, request_uri, http_status, bytes_sent, referer, is_malicious, " +
+		" ua_string, ua_os, ua_family, ua_device_type, ua_is_human, ua_intent, line_hash) VALUES ",
+	rawLogInsertSuffix: " ON CONFLICT (domain_id, line_hash) DO NOTHING",
+	rawLogRowTemplate:  "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	rawLogArgs: func(row *RawLogRow) []any {
+		data := row.Data
+		var clientIP any = nil
+		if !row.MaskIPs && net.ParseIP(data.ClientIP) != nil {
+			clientIP = data.ClientIP
+		}
+		uaString := ReduceToMaxColumnLen(data.UserAgent.FullName, 100)
+		if row.MaskIPs {
+			uaString = ReduceToMaxColumnLenKeepingLastPart(data.UserAgent.FullName, 100)
+		}
+		//status is a string in parsed logs, e.g - for some invalid requests
+		httpStatus, _ := strconv.Atoi(data.Status)
+		return []any{row.DomainId, row.HostId, data.Timestamp.UTC().Format(SQLITE_TIMESTAMP_FORMAT), clientIP,
+			ReduceToMaxColumnLen(data.RemoteUser, 100),
+			ReduceToMaxColumnLen(data.Method, 20),
+			ReduceToMaxColumnLen(rawLogPath3(data), 100),
+			ReduceToMaxColumnLen(data.Path, 100),
+			httpStatus, data.BytesSent,
+			ReduceToMaxColumnLen(data.Referer, 100),
+			data.Malicious,
+			uaString,
+			ReduceToMaxColumnLen(data.UserAgent.OS, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Family, 20),
+			ReduceToMaxColumnLen(data.UserAgent.DeviceType, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Human, 20),
+			ReduceToMaxColumnLen(data.UserAgent.Intent, 20),
+			rawLogLineHash(data)}
+	}}
+
+func NewSBOSQLiteDB() *SBOSQLiteDB {
+	rv := SBOSQLiteDB{
+		domainIdsCache: make(map[string]int)}
+	return &rv
+}
+
+/*
+databaseName is the path of the database file, other parameters are ignored
+*/
+func (sbosdb *SBOSQLiteDB) Init(dbUser string, dbPassword string, dbAddress string, databaseName string) (bool, error) {
+	sbosdb.syncMutex.Lock()
+	defer sbosdb.syncMutex.Unlock()
+	if sbosdb.isInitialized {
+		//already initialized
+		return true, nil
+	}
+	if directory := filepath.Dir(databaseName); len(directory) > 0 {
+		os.MkdirAll(directory, 0755)
+	}
+	//WAL allows reading the database, e.g from SBOanalytics, while metrics are written
+	dsn := "file:" + url.PathEscape(databaseName) + "?_pragma=busy_timeout(" + strconv.Itoa(SQLITE_BUSY_TIMEOUT_MILLIS) + ")&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+
+	var err error
+	sbosdb.DbInstance, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		slog.Error("Failed to open sqlite db", "file", databaseName, "error", err)
+		return false, err
+	}
+	//sqlite allows a single writer anyway
+	sbosdb.DbInstance.SetMaxOpenConns(1)
+
+	//no need to run migrations separately for a local file
+	sqliteMigrationMutex.Lock()
+	_, err = migrateSchema(sbosdb.DbInstance, DB_DRIVER_SQLITE)
+	sqliteMigrationMutex.Unlock()
+	if err != nil {
+		slog.Error("Failed to migrate sqlite db schema", "file", databaseName, "error", err)
+		//so a later Init call doesn't leak the connection pool
+		sbosdb.DbInstance.Close()
+		return false, err
+	}
+	sbosdb.isInitialized = true
+	return true, nil
+}
+
+func (sbosdb *SBOSQLiteDB) IsInitialized() bool {
+	sbosdb.syncMutex.Lock()
+	defer sbosdb.syncMutex.Unlock()
+	return sbosdb.isInitialized
+}
+
+func (sbosdb *SBOSQLiteDB) GetSchemaVersion() (int64, error) {
+	return getSchemaVersion(sbosdb.DbInstance, DB_DRIVER_SQLITE)
+}
+
+func (sbosdb *SBOSQLiteDB) MigrateSchema() ([]SchemaMigration, error) {
+	return migrateSchema(sbosdb.DbInstance, DB_DRIVER_SQLITE)
+}
+
+func (sbosdb *SBOSQLiteDB) GetIngestOffset(domainId int, sourceId string) (int64, error) {
+	return getIngestOffset(sbosdb.DbInstance, &sqliteIngestProgressDialect, domainId, sourceId)
+}
+
+func (sbosdb *SBOSQLiteDB) SaveIngestProgressBatch(rows []IngestProgressRow) error {
+	return saveIngestProgressBatch(sbosdb.DbInstance, &sqliteIngestProgressDialect, rows)
+}
+
+func (sbosdb *SBOSQLiteDB) GetDomains() (map[string]int, error) {
+	return getDomains(sbosdb.DbInstance)
+}
+
+func (sbosdb *SBOSQLiteDB) ApplyRetention(domainId int, policy RetentionPolicy, now time.Time, stop <-chan struct{}) (RetentionResult, error) {
+	return applyRetention(sbosdb.DbInstance, &sqliteRetentionDialect, domainId, policy, now, stop)
+}
+
+func (sbosdb *SBOSQLiteDB) Close() (bool, error) {
+	if sbosdb.DbInstance == nil {
+		stackTrace := debug.Stack()
+		slog.Warn("Trying to close an invalid database connection", "stackTrace", string(stackTrace))
+		return false, nil
+	}
+	//Init can be called again after Close, e.g to reconnect
+	sbosdb.syncMutex.Lock()
+	sbosdb.isInitialized = false
+	sbosdb.syncMutex.Unlock()
+	sbosdb.statements.close()
+	err := sbosdb.DbInstance.Close()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func sqliteNow() string {
+	return time.Now().UTC().Format(SQLITE_TIMESTAMP_FORMAT)
+}
+
+func (sbosdb *SBOSQLiteDB) GetDomainId(domainName string, timeWindowSizeInMinutes int) (int, error) {
+	sbosdb.syncMutex.Lock()
+	defer sbosdb.syncMutex.Unlock()
+
+	if sbosdb.domainIdsCache[domainName] > 0 {
+		return sbosdb.domainIdsCache[domainName], nil
+	}
+	//Note timeWindowSizeInMinutes is set only on initial creation, same as mysql.
+	//DO UPDATE is a no-op update so RETURNING returns the id of an existing row too
+	var domainId int
+	err := sbosdb.DbInstance.QueryRow("INSERT INTO sbo_domains (domain_name, created, timeWindowSizeMinutes) VALUES (?, ?, ?) "+
+		" ON CONFLICT (domain_name) DO UPDATE SET domain_name=excluded.domain_name RETURNING domain_id",
+		ReduceToMaxColumnLen(domainName, 255), sqliteNow(), timeWindowSizeInMinutes).Scan(&domainId)
+	if err != nil {
+		slog.Error("db.GetDomainId failed", "domainName", domainName, "error", err)
+		return -1, err
+	}
+	sbosdb.domainIdsCache[domainName] = domainId
+	return domainId, nil
+}
+
+func (sbosdb *SBOSQLiteDB) GetFileId(domainId int, hostname string, filePath string) (int, error) {
+	var fileId int
+	err := sbosdb.DbInstance.QueryRow("INSERT INTO sbo_log_files (domain_id, host_name, file_path, created) VALUES (?, ?, ?, ?) "+
+		" ON CONFLICT (domain_id, host_name, file_path) DO UPDATE SET file_path=excluded.file_path RETURNING file_id",
+		domainId, hostname, filePath, sqliteNow()).Scan(&fileId)
+	if err != nil {
+		slog.Error("db.GetFileId failed", "domainId", domainId, "hostname", hostname, "filePath", filePath, "error", err)
+		return -1, err
+	}
+	return fileId, nil
+}
+
+func (sbosdb *SBOSQLiteDB) SaveMetricData(data *metrics.SBOMetricWindowDataToBeSaved, domainId int, replaceIfExists bool) (bool, error) {
+	var sql string = "INSERT INTO sbo_metrics (domain_id, metric_type, key_value, time_window, metric_value, created) " +
+		" VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (domain_id, metric_type, key_value, time_window) "
+	if replaceIfExists {
+		sql += "DO UPDATE SET metric_value=excluded.metric_value"
+	} else {
+		sql += "DO UPDATE SET metric_value=metric_value+excluded.metric_value"
+	}
+	_, err := sbosdb.DbInstance.Exec(sql, domainId, data.MetricType, ReduceToMaxColumnLen(data.KeyValue, 100), data.TimeWindow, data.MetricValue, sqliteNow())
+	if err != nil {
+		slog.Error("SaveMetricData failed", "domainId", domainId, "data.FilePath", data.FilePath, "error", err)
+		return false, err
+	} else {
+		return true, nil
+	}
+}
+
+func (sbosdb *SBOSQLiteDB) SaveRawLog(data *logparsers.SBOHttpRequestLog, domainId int, hostId int, maskIPs bool) (bool, error) {
+	dialect := &sqliteBatchInsertDialect
+	row := RawLogRow{Data: data, DomainId: domainId, HostId: hostId, MaskIPs: maskIPs}
+	_, err := sbosdb.DbInstance.Exec(dialect.rawLogInsertPrefix+multiRowValues(dialect.rawLogRowTemplate, 1, dialect.numberedPlaceholders)+dialect.rawLogInsertSuffix,
+		dialect.rawLogArgs(&row)...)
+	if err != nil {
+		slog.Error("SaveRawLog failed", "domainId", domainId, "hostId", hostId, "timestamp", data.Timestamp, "error", err)
+		return false, err
+	}
+	return true, nil
+}
+
+func (sbosdb *SBOSQLiteDB) SaveMetricDataBatch(rows []MetricDataRow) error {
+	return saveMetricDataBatch(sbosdb.DbInstance, &sbosdb.statements, &sqliteBatchInsertDialect, rows)
+}
+
+func (sbosdb *SBOSQLiteDB) SaveRawLogBatch(rows []RawLogRow) error {
+	return saveRawLogBatch(sbosdb.DbInstance, &sbosdb.statements, &sqliteBatchInsertDialect, rows)
+}
+
+func (sbosdb *SBOSQLiteDB) SaveOSMetrics(uptimeInfo *metrics.UptimeInfo, memoryInfo *metrics.MemoryInfo, hostId int) (bool, error) {
+	var sql string = "INSERT INTO sbo_os_metrics (host_id, metrics_ts, up_duration_minutes, users, " +
+		" load_average1, load_average5, load_average15, " +
+		" swap_use, cache_use, memory_use, memory_free, memory_available) " +
+		" VALUES (?, ?, ?, ?, " +
+		" ?, ?, ?, " +
+		" ?, ?, ?, ?, ?) "
+	var swapUse int64 = 0
+	var cacheUse int64 = 0
+	var memUse int64 = 0
+	var memFree int64 = 0
+	var memAvailable int64 = 0
+	//memoryInfo may be nil
+	if memoryInfo != nil {
+		swapUse = memoryInfo.SwapUse
+		cacheUse = memoryInfo.CachUse
+		memUse = memoryInfo.MemUse
+		memFree = memoryInfo.MemFree
+		memAvailable = memoryInfo.MemAvailable
+	}
+	_, err := sbosdb.DbInstance.Exec(sql, hostId, sqliteNow(), uptimeInfo.UpDurationMinutes, uptimeInfo.Users,
+		uptimeInfo.LoadAverage1, uptimeInfo.LoadAverage5, uptimeInfo.LoadAverage15,
+		swapUse, cacheUse, memUse, memFree, memAvailable)
+	if err != nil {
+		slog.Error("SaveOSMetrics failed", "hostId", hostId, "uptimeInfo", uptimeInfo, "memoryInfo", memoryInfo, "error", err)
+		return false, err
+	} else {
+		return true, nil
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func newTestSQLiteDB(t *testing.T) *SBOSQLiteDB {
+	sbosdb := NewSBOSQLiteDB()
+	if ok, err := sbosdb.Init("", "", "", filepath.Join(t.TempDir(), "data", "sbo.db")); !ok {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { sbosdb.Close() })
+	return sbosdb
+}
+
+func TestSQLiteGetDomainId(t *testing.T) {
+	sbosdb := newTestSQLiteDB(t)
+	domainId, err := sbosdb.GetDomainId("example.com", 1)
+	if err != nil || domainId < 1 {
+		t.Fatalf("GetDomainId failed: %v %v", domainId, err)
+	}
+	otherDomainId, _ := sbosdb.GetDomainId("example.org", 1)
+	if otherDomainId == domainId {
+		t.Errorf("Different domains must have different ids")
+	}
+	//not cached
+	sbosdb.domainIdsCache = make(map[string]int)
+	if existingDomainId, err := sbosdb.GetDomainId("example.com", 5); existingDomainId != domainId || err != nil {
+		t.Errorf("Expected existing id %v, got %v %v", domainId, existingDomainId, err)
+	}
+	fileId, _ := sbosdb.GetFileId(domainId, "host", "/var/log/access.log")
+	if existingFileId, _ := sbosdb.GetFileId(domainId, "host", "/var/log/access.log"); fileId < 1 || existingFileId != fileId {
+		t.Errorf("Expected the same file id, got %v %v", fileId, existingFileId)
+	}
+}
+
+func TestSQLiteSaveMetricData(t *testing.T) {
+	sbosdb := newTestSQLiteDB(t)
+	data := metrics.NewSBOMetricWindowDataToBeSaved("/var/log/access.log", 1, "200", 202507011000, 5)
+	sbosdb.SaveMetricData(data, 1, false)
+	sbosdb.SaveMetricData(data, 1, false)
+	var metricValue int64
+	sbosdb.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE domain_id=1 AND metric_type=1 AND key_value='200' AND time_window=202507011000").Scan(&metricValue)
+	if metricValue != 10 {
+		t.Errorf("Expected values to be added, got %v", metricValue)
+	}
+	data.MetricValue = 3
+	sbosdb.SaveMetricData(data, 1, true)
+	sbosdb.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE domain_id=1 AND metric_type=1 AND key_value='200' AND time_window=202507011000").Scan(&metricValue)
+	if metricValue != 3 {
+		t.Errorf("Expected value to be replaced, got %v", metricValue)
+	}
+}
+
+func TestSQLiteSaveRawLogAndOSMetrics(t *testing.T) {
+	sbosdb := newTestSQLiteDB(t)
+	logEntry := &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Date(2025, 7, 1, 10, 0, 0, 0, time.UTC), Method: "GET", Path: "/a", Path1: "/a", Status: "200", BytesSent: 10, UserAgent: logparsers.NewSBOUserAgent("curl/8.5.0")}
+	if ok, err := sbosdb.SaveRawLog(logEntry, 1, 1, false); !ok {
+		t.Fatalf("SaveRawLog failed: %v", err)
+	}
+	sbosdb.SaveRawLog(logEntry, 1, 1, true)
+	var ipCount, masked int
+	sbosdb.DbInstance.QueryRow("SELECT count(client_ip), count(*)-count(client_ip) FROM sbo_rawlogs WHERE request_ts='2025-07-01 10:00:00' AND http_status=200").Scan(&ipCount, &masked)
+	if ipCount != 1 || masked != 1 {
+		t.Errorf("Expected one row with and one row without client ip, got %v %v", ipCount, masked)
+	}
+	if ok, err := sbosdb.SaveOSMetrics(&metrics.UptimeInfo{UpDurationMinutes: 5, LoadAverage1: "0.15"}, nil, 1); !ok {
+		t.Errorf("SaveOSMetrics failed: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	DB_DRIVER_MYSQL    string = "mysql"
+	DB_DRIVER_POSTGRES string = "postgres"
+	DB_DRIVER_SQLITE   string = "sqlite"
+)
+
+/*
+Storage backend for metrics, raw logs and OS metrics. Implementations must be safe for concurrent use.
+*/
+type SBOStorage interface {
+	Init(dbUser string, dbPassword string, dbAddress string, databaseName string) (bool, error)
+	IsInitialized() bool
+	Close() (bool, error)
+	GetDomainId(domainName string, timeWindowSizeInMinutes int) (int, error)
+	GetFileId(domainId int, hostname string, filePath string) (int, error)
+	SaveMetricData(data *metrics.SBOMetricWindowDataToBeSaved, domainId int, replaceIfExists bool) (bool, error)
+	SaveRawLog(data *logparsers.SBOHttpRequestLog, domainId int, hostId int, maskIPs bool) (bool, error)
+	SaveOSMetrics(uptimeInfo *metrics.UptimeInfo, memoryInfo *metrics.MemoryInfo, hostId int) (bool, error)
+	//save rows in a transaction using multi-row inserts. Metric rows must not contain duplicate keys, see MergeMetricDataRows
+	SaveMetricDataBatch(rows []MetricDataRow) error
+	SaveRawLogBatch(rows []RawLogRow) error
+	//see migrations.go
+	GetSchemaVersion() (int64, error)
+	MigrateSchema() ([]SchemaMigration, error)
+	//see ingestprogress.go
+	GetIngestOffset(domainId int, sourceId string) (int64, error)
+	SaveIngestProgressBatch(rows []IngestProgressRow) error
+	//domain name => domain id
+	GetDomains() (map[string]int, error)
+	//see retention.go
+	ApplyRetention(domainId int, policy RetentionPolicy, now time.Time, stop <-chan struct{}) (RetentionResult, error)
+}
+
+// empty means mysql, for backwards compatibility
+func IsValidDbDriver(dbDriver string) bool {
+	switch dbDriver {
+	case "", DB_DRIVER_MYSQL, DB_DRIVER_POSTGRES, DB_DRIVER_SQLITE:
+		return true
+	}
+	return false
+}
+
+/*
+Returns a storage backend for the given driver, see DB_DRIVER_* constants. Init must be called before use
+*/
+func NewSBOStorage(dbDriver string) (SBOStorage, error) {
+	switch dbDriver {
+	case "", DB_DRIVER_MYSQL:
+		return NewSBOAnalyticsDB(), nil
+	case DB_DRIVER_POSTGRES:
+		return NewSBOPostgresDB(), nil
+	case DB_DRIVER_SQLITE:
+		return NewSBOSQLiteDB(), nil
+	}
+	return nil, fmt.Errorf("unsupported database driver '%v'", dbDriver)
+}
+
+// path up to the 3rd level, saved in path3 column of raw logs
+func rawLogPath3(data *logparsers.SBOHttpRequestLog) string {
+	pathUpTo3rd := data.Path3
+	if len(pathUpTo3rd) < 1 {
+		pathUpTo3rd = data.Path2
+	}
+	if len(pathUpTo3rd) < 1 {
+		pathUpTo3rd = data.Path1
+	}
+	return pathUpTo3rd
+}
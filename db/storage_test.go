@@ -0,0 +1,46 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package db
+
+import (
+	"testing"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+)
+
+func TestNewSBOStorage(t *testing.T) {
+	for _, dbDriver := range []string{"", DB_DRIVER_MYSQL} {
+		if storage, err := NewSBOStorage(dbDriver); err != nil || storage.(*SBOAnalyticsDB) == nil {
+			t.Errorf("Expected mysql storage for %q, got %T %v", dbDriver, storage, err)
+		}
+	}
+	if storage, err := NewSBOStorage(DB_DRIVER_POSTGRES); err != nil || storage.(*SBOPostgresDB) == nil || storage.IsInitialized() {
+		t.Errorf("Expected uninitialized postgres storage, got %T %v", storage, err)
+	}
+	if _, err := NewSBOStorage("oracle"); err == nil || IsValidDbDriver("oracle") {
+		t.Errorf("Unsupported drivers must be rejected")
+	}
+}
+
+func TestRawLogPath3(t *testing.T) {
+	if path := rawLogPath3(&logparsers.SBOHttpRequestLog{Path1: "/a", Path2: "/a/b"}); path != "/a/b" {
+		t.Errorf("Expected /a/b, got %v", path)
+	}
+}
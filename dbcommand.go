@@ -0,0 +1,360 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/db"
+)
+
+// sbologp db migrate|status|prune, see runDbCommand
+const DB_COMMAND string = "db"
+const (
+	DB_COMMAND_MIGRATE string = "migrate"
+	DB_COMMAND_STATUS  string = "status"
+	DB_COMMAND_PRUNE   string = "prune"
+)
+
+// retention policies are applied to all databases this often while running, see setupDatabaseRetention
+const DB_RETENTION_INTERVAL time.Duration = time.Hour
+
+// first run is delayed so startup is not slowed down
+const DB_RETENTION_INITIAL_DELAY time.Duration = time.Minute
+
+/*
+Returns configuration entries with distinct database settings, keyed by a description of the database (without the password), sorted.
+Only entries for which usesDatabase returns true are included
+*/
+func getDatabaseConfigs(usesDatabase func(configKey string, config *ConfigForAMonitoredFile) bool) ([]string, map[string]*ConfigForAMonitoredFile) {
+	globalConfigMutex.RLock()
+	defer globalConfigMutex.RUnlock()
+	databaseConfigs := make(map[string]*ConfigForAMonitoredFile)
+	for configKey, config := range globalConfig {
+		if !usesDatabase(configKey, config) {
+			continue
+		}
+		databaseConfigs[getDatabaseDescription(config)] = config
+	}
+	return slices.Sorted(maps.Keys(databaseConfigs)), databaseConfigs
+}
+
+// e.g mysql user@localhost:3306/sboanalytics, without the password
+func getDatabaseDescription(config *ConfigForAMonitoredFile) string {
+	dbDriver := config.DbDriver
+	if len(dbDriver) < 1 {
+		dbDriver = db.DB_DRIVER_MYSQL
+	}
+	if dbDriver == db.DB_DRIVER_SQLITE {
+		return dbDriver + " " + config.DbDatabase
+	}
+	return dbDriver + " " + config.DbUser + "@" + config.DbAddress + "/" + config.DbDatabase
+}
+
+/*
+Returns retention policies keyed by database description (see getDatabaseConfigs) and domain name.
+Policies of entries without DomainName are keyed by "" and used for domains without their own entries.
+When entries of the same domain have different settings the longest retention is used, 0 (forever) being the longest
+*/
+func getRetentionPolicies() map[string]map[string]db.RetentionPolicy {
+	globalConfigMutex.RLock()
+	defer globalConfigMutex.RUnlock()
+	longerRetention := func(days1 int, days2 int) int {
+		if days1 < 1 || days2 < 1 {
+			return 0
+		}
+		return max(days1, days2)
+	}
+	retentionPolicies := make(map[string]map[string]db.RetentionPolicy)
+	for configKey, config := range globalConfig {
+		if configKey == OSMETRICS_CONFIG_KEY || len(config.DbDatabase) < 1 {
+			continue
+		}
+		policy := db.RetentionPolicy{RawLogDays: config.RawLogRetentionDays, MetricDays: config.MetricsRetentionDays,
+			HourlyMetricDays: config.HourlyMetricsRetentionDays}
+		description := getDatabaseDescription(config)
+		if retentionPolicies[description] == nil {
+			retentionPolicies[description] = make(map[string]db.RetentionPolicy)
+		}
+		if existingPolicy, exists := retentionPolicies[description][config.DomainName]; exists {
+			policy.RawLogDays = longerRetention(policy.RawLogDays, existingPolicy.RawLogDays)
+			policy.MetricDays = longerRetention(policy.MetricDays, existingPolicy.MetricDays)
+			policy.HourlyMetricDays = longerRetention(policy.HourlyMetricDays, existingPolicy.HourlyMetricDays)
+		}
+		retentionPolicies[description][config.DomainName] = policy
+	}
+	for description, policies := range retentionPolicies {
+		hasPolicy := false
+		for _, policy := range policies {
+			hasPolicy = hasPolicy || !policy.IsEmpty()
+		}
+		if !hasPolicy {
+			delete(retentionPolicies, description)
+		}
+	}
+	return retentionPolicies
+}
+
+type domainRetentionResult struct {
+	DomainName string
+	Result     db.RetentionResult
+	Err        error
+}
+
+/*
+Applies retention policies to all domains in the database. Returns an error if the database is not available
+*/
+func pruneDatabase(config *ConfigForAMonitoredFile, policies map[string]db.RetentionPolicy, stop <-chan struct{}) ([]domainRetentionResult, error) {
+	storage, err := db.NewSBOStorage(config.DbDriver)
+	if err != nil {
+		return nil, err
+	}
+	if initialized, err := storage.Init(config.DbUser, config.DbPassword, config.DbAddress, config.DbDatabase); !initialized {
+		return nil, err
+	}
+	defer storage.Close()
+	domains, err := storage.GetDomains()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]domainRetentionResult, 0, len(domains))
+	for _, domainName := range slices.Sorted(maps.Keys(domains)) {
+		policy, exists := policies[domainName]
+		if !exists {
+			policy = policies[""]
+		}
+		if policy.IsEmpty() {
+			continue
+		}
+		result, err := storage.ApplyRetention(domains[domainName], policy, time.Now(), stop)
+		results = append(results, domainRetentionResult{DomainName: domainName, Result: result, Err: err})
+		if err != nil {
+			break
+		}
+	}
+	return results, nil
+}
+
+/*
+Applies retention policies every DB_RETENTION_INTERVAL until shutdown, when retention is configured for a database used by the process
+*/
+func setupDatabaseRetention() {
+	retentionPolicies := getRetentionPolicies()
+	if len(retentionPolicies) < 1 {
+		return
+	}
+	_, databaseConfigs := getDatabaseConfigs(func(configKey string, config *ConfigForAMonitoredFile) bool {
+		return retentionPolicies[getDatabaseDescription(config)] != nil
+	})
+	slog.Info("Database retention is enabled", "databases", len(databaseConfigs), "interval", DB_RETENTION_INTERVAL)
+	go func() {
+		timer := time.NewTimer(DB_RETENTION_INITIAL_DELAY)
+		defer timer.Stop()
+		for {
+			select {
+			case <-globalShutdown:
+				return
+			case <-timer.C:
+			}
+			for description, config := range databaseConfigs {
+				results, err := pruneDatabase(config, retentionPolicies[description], globalShutdown)
+				if err != nil {
+					slog.Warn("Database is not available, retention policies were not applied", "database", description, "error", err)
+					continue
+				}
+				for _, result := range results {
+					if result.Err != nil {
+						slog.Error("Failed to apply retention policy", "database", description, "domain", result.DomainName, "error", result.Err)
+					} else {
+						slog.Info("Applied retention policy", "database", description, "domain", result.DomainName,
+							"rawLogsDeleted", result.Result.RawLogsDeleted, "metricsRolledUp", result.Result.MetricsRolledUp,
+							"hourlyMetricsRolledUp", result.Result.HourlyMetricsRolledUp)
+					}
+				}
+			}
+			timer.Reset(DB_RETENTION_INTERVAL)
+		}
+	}()
+}
+
+/*
+Returns false if the schema of a database used for saving metrics or logs is older than the schema this version needs.
+Databases which are not available are not checked, e.g rows may be spooled until they are available
+*/
+func checkDatabaseSchemaVersions() bool {
+	descriptions, databaseConfigs := getDatabaseConfigs(func(configKey string, config *ConfigForAMonitoredFile) bool {
+		if configKey == DEFAULT_CONFIG_KEY {
+			return false
+		}
+		if configKey == OSMETRICS_CONFIG_KEY {
+			return config.OSMetricsEnabled
+		}
+		return config.WriteMetricsToDb || config.SaveLogsToDb
+	})
+	for _, description := range descriptions {
+		config := databaseConfigs[description]
+		storage, err := db.NewSBOStorage(config.DbDriver)
+		if err != nil {
+			//reported later
+			continue
+		}
+		if initialized, err := storage.Init(config.DbUser, config.DbPassword, config.DbAddress, config.DbDatabase); !initialized {
+			slog.Warn("Database is not available, can't check schema version", "database", description, "error", err)
+			continue
+		}
+		schemaVersion, err := storage.GetSchemaVersion()
+		storage.Close()
+		requiredVersion := db.RequiredSchemaVersion(config.DbDriver)
+		if err != nil {
+			slog.Warn("Failed to check database schema version", "database", description, "error", err)
+			continue
+		}
+		if schemaVersion < requiredVersion {
+			slog.Error("Database schema is older than required", "database", description, "schemaVersion", schemaVersion, "requiredVersion", requiredVersion)
+			fmt.Fprintf(os.Stderr, "Database schema of %v is older than required (version %v, required %v). Upgrade the schema using: sbologp %v %v -c <config file>\n",
+				description, schemaVersion, requiredVersion, DB_COMMAND, DB_COMMAND_MIGRATE)
+			return false
+		}
+	}
+	return true
+}
+
+/*
+sbologp db migrate|status|prune -c config-file.json
+Applies pending schema migrations to, shows schema versions of, or applies retention policies to all databases in the configuration file.
+Returns the exit code
+*/
+func runDbCommand(args []string) int {
+	flagSet := flag.NewFlagSet(DB_COMMAND, flag.ExitOnError)
+	confFilePtr := flagSet.String("c", "", "Configuration file in json format, required. Databases of all entries in the file are used")
+	flagSet.Usage = func() {
+		fmt.Println("Usage: 'sbologp db migrate|status|prune -c path-to-config-file.json'")
+		fmt.Println("migrate applies pending database schema migrations, status shows current and required schema versions,")
+		fmt.Println("prune deletes old raw logs and rolls up old metrics using RawLogRetentionDays, MetricsRetentionDays and HourlyMetricsRetentionDays")
+		flagSet.PrintDefaults()
+	}
+	if len(args) < 1 || (args[0] != DB_COMMAND_MIGRATE && args[0] != DB_COMMAND_STATUS && args[0] != DB_COMMAND_PRUNE) {
+		flagSet.Usage()
+		return 1
+	}
+	subcommand := args[0]
+	flagSet.Parse(args[1:])
+	if len(*confFilePtr) < 1 {
+		flagSet.Usage()
+		return 1
+	}
+	if !loadConfigFromFile(*confFilePtr) {
+		fmt.Println("Failed to load configuration file", *confFilePtr)
+		return 1
+	}
+	if subcommand == DB_COMMAND_PRUNE {
+		return runDbPruneCommand()
+	}
+
+	descriptions, databaseConfigs := getDatabaseConfigs(func(configKey string, config *ConfigForAMonitoredFile) bool {
+		return len(config.DbDatabase) > 0
+	})
+	if len(descriptions) < 1 {
+		fmt.Println("No databases found in the configuration file, DbDatabase is not set")
+		return 1
+	}
+	exitCode := 0
+	for _, description := range descriptions {
+		config := databaseConfigs[description]
+		storage, err := db.NewSBOStorage(config.DbDriver)
+		if err != nil {
+			fmt.Printf("%v: %v\n", description, err)
+			exitCode = 1
+			continue
+		}
+		if initialized, err := storage.Init(config.DbUser, config.DbPassword, config.DbAddress, config.DbDatabase); !initialized {
+			fmt.Printf("%v: failed to connect: %v\n", description, err)
+			exitCode = 1
+			continue
+		}
+		if subcommand == DB_COMMAND_MIGRATE {
+			applied, err := storage.MigrateSchema()
+			for _, migration := range applied {
+				fmt.Printf("%v: applied %v %v\n", description, migration.Version, migration.Description)
+			}
+			if err != nil {
+				fmt.Printf("%v: migration failed: %v\n", description, err)
+				exitCode = 1
+			}
+		}
+		schemaVersion, err := storage.GetSchemaVersion()
+		storage.Close()
+		if err != nil {
+			fmt.Printf("%v: failed to get schema version: %v\n", description, err)
+			exitCode = 1
+			continue
+		}
+		migrations, _ := db.SchemaMigrations(config.DbDriver)
+		pending := make([]db.SchemaMigration, 0)
+		for _, migration := range migrations {
+			if migration.Version > schemaVersion {
+				pending = append(pending, migration)
+			}
+		}
+		fmt.Printf("%v: schema version %v, required version %v, %v pending migration(s)\n", description, schemaVersion, db.RequiredSchemaVersion(config.DbDriver), len(pending))
+		for _, migration := range pending {
+			fmt.Printf("    pending %v %v\n", migration.Version, migration.Description)
+		}
+	}
+	return exitCode
+}
+
+/*
+Applies retention policies of the loaded configuration once and prints results, returns the exit code
+*/
+func runDbPruneCommand() int {
+	retentionPolicies := getRetentionPolicies()
+	if len(retentionPolicies) < 1 {
+		fmt.Println("No retention policies found in the configuration file, RawLogRetentionDays, MetricsRetentionDays and HourlyMetricsRetentionDays are not set")
+		return 1
+	}
+	descriptions, databaseConfigs := getDatabaseConfigs(func(configKey string, config *ConfigForAMonitoredFile) bool {
+		return retentionPolicies[getDatabaseDescription(config)] != nil
+	})
+	exitCode := 0
+	for _, description := range descriptions {
+		results, err := pruneDatabase(databaseConfigs[description], retentionPolicies[description], nil)
+		if err != nil {
+			fmt.Printf("%v: failed to connect: %v\n", description, err)
+			exitCode = 1
+			continue
+		}
+		for _, result := range results {
+			fmt.Printf("%v: %v: deleted %v raw logs, rolled up %v metrics and %v hourly metrics\n", description, result.DomainName,
+				result.Result.RawLogsDeleted, result.Result.MetricsRolledUp, result.Result.HourlyMetricsRolledUp)
+			if result.Err != nil {
+				fmt.Printf("%v: %v: failed: %v\n", description, result.DomainName, result.Err)
+				exitCode = 1
+			}
+		}
+	}
+	return exitCode
+}
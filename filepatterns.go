@@ -0,0 +1,186 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+)
+
+/*
+Process files matching filePattern, e.g /var/log/nginx/(*)-access.log, see inputs.FilePathPattern.
+When following, directories are watched and processing starts automatically for new matching files, including files in new directories
+matching the pattern, see inputs.FilePathPattern.Directories
+*/
+func processFilePattern(filePattern string, parentWaitGroup *sync.WaitGroup) {
+	defer parentWaitGroup.Done()
+	config := getConfigForFile(filePattern)
+	filePathPattern, err := inputs.NewFilePathPattern(filePattern)
+	if err != nil {
+		slog.Error("Invalid file path pattern", "filePattern", filePattern, "error", err)
+		return
+	}
+
+	var watcher *fsnotify.Watcher
+	if config.Follow {
+		//start watching before expanding the pattern, so files created in between are not missed
+		watcher, err = fsnotify.NewWatcher()
+		if err != nil {
+			slog.Error("Failed to create watcher for file path pattern", "filePattern", filePattern, "error", err)
+			return
+		}
+		defer watcher.Close()
+		directories, err := filePathPattern.Directories()
+		if err != nil {
+			slog.Error("Failed to find directories for file path pattern", "filePattern", filePattern, "error", err)
+		}
+		for _, directory := range directories {
+			if err := watcher.Add(directory); err != nil {
+				slog.Error("Failed to watch directory for file path pattern", "filePattern", filePattern, "directory", directory, "error", err)
+			}
+		}
+	}
+
+	matchingFiles, err := filePathPattern.Expand()
+	if err != nil {
+		slog.Error("Failed to expand file path pattern", "filePattern", filePattern, "error", err)
+		return
+	}
+	slog.Info("Expanded file path pattern", "filePattern", filePattern, "matchingFiles", matchingFiles)
+	for _, filePath := range matchingFiles {
+		startProcessingFileMatchingPattern(filePathPattern, filePath, false, parentWaitGroup)
+	}
+
+	if watcher == nil {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) {
+				continue
+			}
+			fileInfo, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			if fileInfo.IsDir() {
+				if filePathPattern.MatchesDirectory(event.Name) {
+					watchNewDirectoryForFilePattern(watcher, filePathPattern, event.Name, parentWaitGroup)
+				}
+				continue
+			}
+			if filePathPattern.Matches(event.Name) {
+				startProcessingFileMatchingPattern(filePathPattern, event.Name, true, parentWaitGroup)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("Watcher error for file path pattern", "filePattern", filePattern, "error", err)
+		case <-globalShutdown:
+			return
+		}
+	}
+}
+
+/*
+Watches a directory created after the pattern was expanded, e.g /logs/new-site for /logs/(*)/access.log. Files and directories
+created in it before it was watched are processed too
+*/
+func watchNewDirectoryForFilePattern(watcher *fsnotify.Watcher, filePathPattern *inputs.FilePathPattern, directory string, parentWaitGroup *sync.WaitGroup) {
+	if err := watcher.Add(directory); err != nil {
+		slog.Error("Failed to watch directory for file path pattern", "filePattern", filePathPattern.Pattern, "directory", directory, "error", err)
+		return
+	}
+	slog.Info("Watching new directory for file path pattern", "filePattern", filePathPattern.Pattern, "directory", directory)
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		slog.Error("Failed to read new directory for file path pattern", "filePattern", filePathPattern.Pattern, "directory", directory, "error", err)
+		return
+	}
+	for _, entry := range entries {
+		entryPath := filepath.Join(directory, entry.Name())
+		if entry.IsDir() && filePathPattern.MatchesDirectory(entryPath) {
+			watchNewDirectoryForFilePattern(watcher, filePathPattern, entryPath, parentWaitGroup)
+		} else if !entry.IsDir() && filePathPattern.Matches(entryPath) {
+			startProcessingFileMatchingPattern(filePathPattern, entryPath, true, parentWaitGroup)
+		}
+	}
+}
+
+/*
+Starts processing filePath using a copy of the configuration of the pattern, unless the file is already being processed
+or has its own configuration entry. Domain name is set to the part of the file path captured by the pattern, if any.
+*/
+func startProcessingFileMatchingPattern(filePathPattern *inputs.FilePathPattern, filePath string, isNewFile bool, parentWaitGroup *sync.WaitGroup) {
+	globalConfigMutex.Lock()
+	if _, exists := globalConfig[filePath]; exists {
+		globalConfigMutex.Unlock()
+		return
+	}
+	fileConfig := *globalConfig[filePathPattern.Pattern]
+	fileConfig.FilePath = filePath
+	fileConfig.HandlerInstances = make(map[string]SBOLogHandlerInterface)
+	if capturedDomainName := filePathPattern.Capture(filePath); len(capturedDomainName) > 0 {
+		fileConfig.DomainName = capturedDomainName
+	} else if containerName := inputs.ContainerDomainNameFromLogPath(filePath); fileConfig.ContainerNameAsDomainName && len(containerName) > 0 {
+		fileConfig.DomainName = containerName
+	}
+	if isNewFile {
+		//lines written before we noticed the file must not be skipped
+		fileConfig.StartFrom = START_FROM_BEGINNING
+	}
+	globalConfig[filePath] = &fileConfig
+	globalConfigMutex.Unlock()
+
+	slog.Info("Found file matching file path pattern", "filePattern", filePathPattern.Pattern, "filePath", filePath, "domainName", fileConfig.DomainName, "isNewFile", isNewFile)
+	parentWaitGroup.Add(1)
+	go func() {
+		defer parentWaitGroup.Done()
+		var fileWaitGroup sync.WaitGroup
+		fileWaitGroup.Add(1)
+		processFile(filePath, &fileWaitGroup)
+		if !fileConfig.Follow || isShuttingDown() {
+			return
+		}
+		//following stops when the file is removed and not created again soon, e.g the site was deleted.
+		//The entry is removed so the file is processed again when it's created later
+		globalConfigMutex.Lock()
+		if globalConfig[filePath] == &fileConfig {
+			delete(globalConfig, filePath)
+		}
+		globalConfigMutex.Unlock()
+		slog.Info("Stopped processing file matching file path pattern", "filePattern", filePathPattern.Pattern, "filePath", filePath)
+		//created again before the entry was removed, the create event was ignored
+		if fileInfo, err := os.Stat(filePath); err == nil && !fileInfo.IsDir() {
+			startProcessingFileMatchingPattern(filePathPattern, filePath, true, parentWaitGroup)
+		}
+	}()
+}
@@ -0,0 +1,769 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// files are checked for truncation this often while waiting for new data, in addition to checks on write events
+const FILE_TRUNCATION_CHECK_INTERVAL time.Duration = 5 * time.Second
+
+func produceLinesFromFile(filePath string, lines chan<- inputs.LogLine) {
+	slog.Debug("Enter produceLinesFromFile for file", "filePath", filePath)
+	var watcher *fsnotify.Watcher
+	defer close(lines)
+	config := getConfigForFile(filePath)
+	slog.Debug("produceLinesFromFile config", "config", config)
+
+	//stdin and named pipes can't be seeked or watched
+	if filePath == STDIN_FILE_PATH {
+		produceLinesFromStdin(filePath, lines)
+		return
+	}
+	if fileInfo, err := os.Stat(filePath); err == nil && fileInfo.Mode()&os.ModeNamedPipe != 0 {
+		produceLinesFromNamedPipe(filePath, lines)
+		return
+	}
+
+	var watcherErr error
+	if config.Follow {
+		watcher, watcherErr = fsnotify.NewWatcher()
+		if watcherErr != nil {
+			slog.Error("Error setting up fsnotify.NewWatcher", "filePath", filePath, "error", watcherErr)
+			return
+		}
+		defer watcher.Close()
+
+		// Watch the directory containing the file
+		dir := filepath.Dir(filePath)
+		watcherErr = watcher.Add(dir)
+		if watcherErr != nil {
+			slog.Error("Error adding watcher", "filePath", filePath, "error", watcherErr)
+			return
+		}
+		slog.Debug("Set up watcher", "dir", dir, "watchlist", watcher.WatchList())
+
+	}
+	baseNameForFile := filepath.Base(filePath)
+	var logFile *openedLogFile
+	var err error
+	checkpoint := getSavedCheckpoint(filePath)
+	readFromBeginning := false
+	if config.BackfillRotatedFiles {
+		readFromBeginning = backfillRotatedFiles(filePath, checkpoint, lines)
+	} else if checkpoint != nil {
+		processRotatedFileFromCheckpoint(filePath, checkpoint, lines)
+	}
+	// Initial file open
+	if logFile, err = openFile(readFromBeginning, filePath, checkpoint); err != nil {
+		slog.Error("Error opening file", "filePath", filePath, "error", err)
+		return
+	}
+	defer func() {
+		if logFile != nil {
+			logFile.Close()
+		}
+	}()
+	var waitingForNewData bool = false
+	var isFileAtEnd bool = false
+	var lastTruncationCheck time.Time = time.Now()
+
+	for {
+
+		if isShuttingDown() {
+			slog.Info("Shutting down, stopped reading file", "filePath", filePath)
+			return
+		}
+
+		if logFile != nil {
+			if !waitingForNewData { //dont even try to read if just waiting
+				isFileAtEnd = readSingleLineFromFileReturnTrueIfEOF(filePath, lines, logFile)
+				if isFileAtEnd && !config.Follow {
+					slog.Info("Finished reading the file and not following, so done...")
+					return
+				}
+				if isFileAtEnd && logFile.IsCompressed() {
+					slog.Info("Finished reading the compressed file, compressed files are not followed, so done...", "filePath", filePath)
+					return
+				}
+				if isFileAtEnd {
+					//not seeking to the end, data appended after we got EOF would be skipped.
+					//offset stays where we stopped reading, see restartIfFileWasTruncated
+					waitingForNewData = true
+					slog.Debug("readSingleLineFromFile isFileAtEnd after waitingForNewData was false", "isFileAtEnd", isFileAtEnd)
+				}
+			} else {
+				//slog.Warn("waitingForNewData is true in produceLinesFromFile")
+			}
+
+		} else {
+			slog.Warn("logFile is nil in produceLinesFromFile", "filePath", filePath)
+			break
+		}
+
+		if config.Follow {
+			//slog.Warn("follow in produceLinesFromFile before select")
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					slog.Info("watcher.Events not ok", "event", event)
+					return
+				}
+				//slog.Debug("fsnotify event ", "event", event)
+				if filepath.Base(event.Name) != baseNameForFile {
+					//irrelevant event
+					continue
+				}
+
+				if event.Has(fsnotify.Write) {
+					// File was modified, continue reading, normal case
+					slog.Debug("File was modified after receiving EOF in the previous read. Continue reading", "file", filePath)
+					//comparing first lines costs a read, so only when we were waiting at the end of the file
+					restartIfFileWasTruncated(filePath, logFile, waitingForNewData)
+					waitingForNewData = false
+					continue
+				}
+
+				if event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove) {
+					// File was renamed/removed (log rotation)
+					slog.Info("File was renamed/removed (log rotation)", "file", filePath)
+					metrics.GetPipelineStats(filePath).RecordRotation(false)
+
+					// read file to end before switching
+					readFileToEnd(filePath, lines, logFile)
+
+					logFile.Close()
+					logFile = nil
+
+					waitingForNewData = false
+					// Try to reopen the file
+					for i := 0; i < 5; i++ {
+						if logFile, err = openFile(true, filePath, nil); err == nil {
+							break
+						}
+						time.Sleep(1 * time.Second)
+					}
+					if logFile == nil {
+						slog.Warn("File was renamed/removed (log rotation) but could not be reopened", "file", filePath)
+						return
+					} else {
+						slog.Info("Re-opened file after rotation", "file", filePath)
+					}
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					slog.Error("Watcher error", "error", err)
+					return
+				}
+
+			case <-globalShutdown:
+				slog.Info("Shutting down, stopped following file", "filePath", filePath)
+				return
+
+			default:
+				if waitingForNewData {
+					//slog.Warn("wait while waitingForNewData", "waitingForNewData", waitingForNewData)
+					time.Sleep(1000 * time.Millisecond)
+					if time.Since(lastTruncationCheck) >= FILE_TRUNCATION_CHECK_INTERVAL {
+						//in case write events are missed, e.g on network file systems
+						lastTruncationCheck = time.Now()
+						if restartIfFileWasTruncated(filePath, logFile, true) {
+							waitingForNewData = false
+						}
+					}
+				}
+				continue
+			}
+		} //if follow
+	}
+}
+
+/*
+Detects truncation in place, e.g log rotation using logrotate copytruncate mode, where the file is copied and then truncated.
+The file is truncated if its size is less than the offset we read up to. When compareFirstLine is true, the first line is compared too,
+which detects truncation even if the file grew past the offset again.
+Reading restarts from the beginning of the file. Returns true if the file was truncated
+*/
+func restartIfFileWasTruncated(filePath string, logFile *openedLogFile, compareFirstLine bool) bool {
+	if logFile == nil || logFile.file == nil || logFile.IsCompressed() || logFile.offset < 1 {
+		return false
+	}
+	fileInfo, err := logFile.file.Stat()
+	if err != nil {
+		return false
+	}
+	truncated := fileInfo.Size() < logFile.offset
+	if !truncated && compareFirstLine && logFile.identity != nil && len(logFile.identity.FirstLineHash) > 0 {
+		currentIdentity, err := inputs.GetFileIdentity(logFile.file)
+		truncated = err == nil && len(currentIdentity.FirstLineHash) > 0 && currentIdentity.FirstLineHash != logFile.identity.FirstLineHash
+	}
+	if !truncated {
+		return false
+	}
+	slog.Info("File was truncated (log rotation using copytruncate), reading from the beginning", "file", filePath, "offset", logFile.offset, "size", fileInfo.Size())
+	metrics.GetPipelineStats(filePath).RecordRotation(true)
+	if err = logFile.seekTo(0); err != nil {
+		slog.Error("Error seeking to beginning of truncated file", "file", filePath, "error", err)
+		return false
+	}
+	//first line will be different, it's hashed again when read
+	truncatedIdentity := *logFile.identity
+	truncatedIdentity.FirstLineHash = ""
+	logFile.identity = &truncatedIdentity
+	return true
+}
+
+/*
+Processes rotated versions of filePath (e.g access.log.3.gz, access.log.2.gz, access.log.1) oldest first, see inputs.FindRotatedFiles.
+Lines are sent to the same channel as lines of the file itself, so all files are processed as one continuous stream in chronological order.
+When the checkpoint is in one of the rotated files, processing resumes from the checkpoint and older files are skipped.
+Returns true if rotated files were processed, i.e the file itself must be processed from the beginning
+*/
+func backfillRotatedFiles(filePath string, checkpoint *inputs.FileCheckpoint, lines chan<- inputs.LogLine) bool {
+	rotatedFilePaths, err := inputs.FindRotatedFiles(filePath)
+	if err != nil {
+		slog.Error("Failed to find rotated files", "filePath", filePath, "error", err)
+		return false
+	}
+	if len(rotatedFilePaths) < 1 {
+		slog.Info("No rotated files found to backfill", "filePath", filePath)
+		return false
+	}
+
+	var resumeFrom *inputs.FileCheckpoint = nil
+	if checkpoint != nil {
+		if liveFile, err := openLogFileForReading(filePath); err == nil {
+			checkpointInLiveFile := isCheckpointForFile(checkpoint, liveFile)
+			liveFile.Close()
+			if checkpointInLiveFile {
+				//backfill was completed before
+				return false
+			}
+		}
+		startIndex := -1
+		for index := len(rotatedFilePaths) - 1; index >= 0 && startIndex < 0; index-- {
+			rotatedFile, err := openLogFileForReading(rotatedFilePaths[index])
+			if err != nil {
+				continue
+			}
+			if isCheckpointForFile(checkpoint, rotatedFile) {
+				startIndex = index
+				resumeFrom = checkpoint
+			}
+			rotatedFile.Close()
+		}
+		if startIndex < 0 {
+			slog.Warn("File in the checkpoint was not found among rotated files, processing all rotated files", "filePath", filePath, "checkpoint", checkpoint)
+		} else {
+			rotatedFilePaths = rotatedFilePaths[startIndex:]
+		}
+	}
+
+	progress := newBackfillProgress(filePath, rotatedFilePaths)
+	slog.Info("Backfilling rotated files", "filePath", filePath, "rotatedFiles", rotatedFilePaths, "totalBytes", progress.totalBytes)
+	for index, rotatedFilePath := range rotatedFilePaths {
+		logFile, err := openLogFileForReading(rotatedFilePath)
+		if err != nil {
+			progress.fileDone(index)
+			continue
+		}
+		if index == 0 && resumeFrom != nil {
+			if err = logFile.seekTo(resumeFrom.Offset); err != nil {
+				slog.Error("Error seeking to checkpoint in rotated file, skipping file", "filePath", filePath, "rotatedFilePath", rotatedFilePath, "error", err)
+				logFile.Close()
+				progress.fileDone(index)
+				continue
+			}
+			slog.Info("Resuming backfill from checkpoint", "filePath", filePath, "rotatedFilePath", rotatedFilePath, "offset", resumeFrom.Offset)
+		}
+		for !isShuttingDown() {
+			if readSingleLineFromFileReturnTrueIfEOF(filePath, lines, logFile) {
+				break
+			}
+			progress.report(logFile, false)
+		}
+		logFile.Close()
+		if isShuttingDown() {
+			return true
+		}
+		progress.fileDone(index)
+	}
+	progress.report(nil, true)
+	return true
+}
+
+/*
+Returns true if the checkpoint was saved while reading logFile. Rotated files are often compressed after
+the checkpoint was saved (e.g logrotate delaycompress option), compressing creates a new file so only the first lines are compared
+*/
+func isCheckpointForFile(checkpoint *inputs.FileCheckpoint, logFile *openedLogFile) bool {
+	if checkpoint.SameFileAs(logFile.identity) {
+		return true
+	}
+	return logFile.IsCompressed() && logFile.identity != nil && len(checkpoint.FirstLineHash) > 0 && checkpoint.FirstLineHash == logFile.identity.FirstLineHash
+}
+
+// backfill progress is logged this often
+const BACKFILL_PROGRESS_INTERVAL time.Duration = 30 * time.Second
+
+/*
+Tracks and logs progress of backfilling rotated files. Bytes are file sizes on disk, i.e compressed bytes for compressed files
+*/
+type backfillProgress struct {
+	filePath       string
+	stats          *metrics.SBOPipelineStats
+	fileSizes      []int64
+	totalBytes     int64
+	completedBytes int64
+	filesDone      int
+	startTime      time.Time
+	lastReport     time.Time
+}
+
+func newBackfillProgress(filePath string, rotatedFilePaths []string) *backfillProgress {
+	progress := &backfillProgress{
+		filePath:   filePath,
+		stats:      metrics.GetPipelineStats(filePath),
+		fileSizes:  make([]int64, len(rotatedFilePaths)),
+		startTime:  time.Now(),
+		lastReport: time.Now()}
+	for index, rotatedFilePath := range rotatedFilePaths {
+		if fileInfo, err := os.Stat(rotatedFilePath); err == nil {
+			progress.fileSizes[index] = fileInfo.Size()
+			progress.totalBytes += fileInfo.Size()
+		}
+	}
+	progress.stats.BackfillFilesTotal.Store(int64(len(rotatedFilePaths)))
+	progress.stats.BackfillBytesTotal.Store(progress.totalBytes)
+	return progress
+}
+
+func (progress *backfillProgress) fileDone(index int) {
+	progress.filesDone++
+	progress.completedBytes += progress.fileSizes[index]
+	progress.stats.BackfillFilesDone.Store(int64(progress.filesDone))
+	progress.stats.BackfillBytesDone.Store(progress.completedBytes)
+}
+
+// logs progress if BACKFILL_PROGRESS_INTERVAL passed since the last report, or when force is true
+func (progress *backfillProgress) report(currentFile *openedLogFile, force bool) {
+	if !force && time.Since(progress.lastReport) < BACKFILL_PROGRESS_INTERVAL {
+		return
+	}
+	progress.lastReport = time.Now()
+	bytesDone := progress.completedBytes
+	if currentFile != nil && currentFile.file != nil {
+		//position in the file on disk, read ahead by buffers but close enough
+		if position, err := currentFile.file.Seek(0, io.SeekCurrent); err == nil {
+			bytesDone += position
+		}
+	}
+	progress.stats.BackfillBytesDone.Store(bytesDone)
+	elapsed := time.Since(progress.startTime)
+	var bytesPerSecond int64 = 0
+	var eta time.Duration = 0
+	if elapsed.Seconds() >= 1 {
+		bytesPerSecond = int64(float64(bytesDone) / elapsed.Seconds())
+	}
+	if bytesPerSecond > 0 {
+		eta = time.Duration((progress.totalBytes-bytesDone)/bytesPerSecond) * time.Second
+	}
+	slog.Info("Backfill progress", "filePath", progress.filePath, "filesDone", progress.filesDone, "fileCount", len(progress.fileSizes),
+		"bytesDone", bytesDone, "totalBytes", progress.totalBytes, "bytesPerSecond", bytesPerSecond, "eta", eta, "elapsed", elapsed.Round(time.Second))
+}
+
+/*
+When the file was rotated while we were not running, lines after the checkpoint are in the rotated file, e.g access.log.1.
+Process them before the current file
+*/
+func processRotatedFileFromCheckpoint(filePath string, checkpoint *inputs.FileCheckpoint, lines chan<- inputs.LogLine) {
+	if fileInfo, err := os.Stat(filePath); err == nil {
+		currentIdentity := inputs.NewFileIdentity(fileInfo, nil)
+		if currentIdentity.Device == checkpoint.Device && currentIdentity.Inode == checkpoint.Inode {
+			//not rotated, openFile will resume from the checkpoint
+			return
+		}
+	}
+	rotatedFilePath := inputs.FindRotatedFile(filePath, &checkpoint.FileIdentity)
+	if len(rotatedFilePath) < 1 {
+		slog.Warn("File was replaced after the checkpoint was saved but the rotated file was not found. Lines written to the rotated file after the checkpoint will not be processed", "filePath", filePath, "checkpoint", checkpoint)
+		return
+	}
+	rotatedFile, err := os.Open(rotatedFilePath)
+	if err != nil {
+		slog.Error("Error opening rotated file", "filePath", filePath, "rotatedFilePath", rotatedFilePath, "error", err)
+		return
+	}
+	logFile := &openedLogFile{file: rotatedFile, reader: bufio.NewReaderSize(rotatedFile, 8192), identity: &checkpoint.FileIdentity}
+	defer logFile.Close()
+	if err = logFile.seekTo(checkpoint.Offset); err != nil {
+		slog.Error("Error seeking to checkpoint in rotated file", "filePath", filePath, "rotatedFilePath", rotatedFilePath, "error", err)
+		return
+	}
+	slog.Info("File was rotated after the checkpoint was saved, processing the rest of the rotated file first", "filePath", filePath, "rotatedFilePath", rotatedFilePath, "offset", checkpoint.Offset)
+	readFileToEnd(filePath, lines, logFile)
+}
+
+/*
+Read lines from stdin until EOF, e.g zcat old.log.gz | sbologp -p count -
+*/
+func produceLinesFromStdin(filePath string, lines chan<- inputs.LogLine) {
+	produceLinesFromReader(filePath, os.Stdin, lines)
+	slog.Info("Reached EOF on stdin, done...")
+}
+
+// Read lines from source until EOF, source can be compressed
+func produceLinesFromReader(filePath string, source io.Reader, lines chan<- inputs.LogLine) {
+	config := getConfigForFile(filePath)
+	sourceReader, decompressor, compression, err := newDecompressingLineReader(source)
+	if err != nil {
+		slog.Error("Error reading compressed data", "filePath", filePath, "compression", compression, "error", err)
+		return
+	}
+	logFile := &openedLogFile{reader: sourceReader, decompressor: decompressor, compression: compression}
+	defer logFile.Close()
+	logFile.offset += skipLinesForStartFrom(logFile.reader, config.StartFrom)
+	readFileToEnd(filePath, lines, logFile)
+}
+
+/*
+Read lines from a named pipe (FIFO), e.g when nginx access_log points to a FIFO.
+Opening a FIFO blocks until a writer opens it and reads return EOF when all writers close it.
+When following, the pipe is reopened after EOF and we wait for the next writer, e.g after the web server is restarted.
+*/
+func produceLinesFromNamedPipe(filePath string, lines chan<- inputs.LogLine) {
+	config := getConfigForFile(filePath)
+	isFirstOpen := true
+	for !isShuttingDown() {
+		slog.Info("Opening named pipe, waiting for a writer", "filePath", filePath)
+		pipe, err := openNamedPipe(filePath)
+		if errors.Is(err, errShuttingDown) {
+			return
+		}
+		if err != nil {
+			slog.Error("Error opening named pipe", "filePath", filePath, "error", err)
+			return
+		}
+		pipeReader, decompressor, compression, err := newDecompressingLineReader(pipe)
+		if err != nil {
+			slog.Error("Error reading compressed data from named pipe", "filePath", filePath, "compression", compression, "error", err)
+			pipe.Close()
+			return
+		}
+		logFile := &openedLogFile{file: pipe, reader: pipeReader, decompressor: decompressor, compression: compression}
+		if isFirstOpen {
+			logFile.offset += skipLinesForStartFrom(logFile.reader, config.StartFrom)
+			isFirstOpen = false
+		}
+		readDone := make(chan struct{})
+		shutdown := globalShutdown
+		go func() {
+			select {
+			case <-shutdown:
+				//unblocks a pending read when writers are idle
+				pipe.Close()
+			case <-readDone:
+			}
+		}()
+		readFileToEnd(filePath, lines, logFile)
+		close(readDone)
+		logFile.Close()
+		if !config.Follow {
+			slog.Info("All writers closed the named pipe and not following, so done...", "filePath", filePath)
+			return
+		}
+		slog.Info("All writers closed the named pipe, will reopen", "filePath", filePath)
+	}
+}
+
+/*
+Opens a named pipe for reading. Opening blocks until a writer opens the pipe,
+errShuttingDown is returned when shutdown starts while waiting for a writer
+*/
+func openNamedPipe(filePath string) (*os.File, error) {
+	type openResult struct {
+		pipe *os.File
+		err  error
+	}
+	opened := make(chan openResult, 1)
+	go func() {
+		pipe, err := os.Open(filePath)
+		opened <- openResult{pipe: pipe, err: err}
+	}()
+	select {
+	case result := <-opened:
+		return result.pipe, result.err
+	case <-globalShutdown:
+		//opening the pipe for writing unblocks the pending open, it does not block as there is a reader.
+		//It fails when the pending open has not started yet, the pipe is closed when it's opened later in that case, e.g by a writer
+		if writer, err := os.OpenFile(filePath, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			writer.Close()
+		}
+		go func() {
+			if result := <-opened; result.pipe != nil {
+				result.pipe.Close()
+			}
+		}()
+		return nil, errShuttingDown
+	}
+}
+
+/*
+An opened log file. reader reads decompressed data when the file is compressed.
+file is nil for stdin, identity is nil when the input is not a regular file, e.g stdin or a named pipe
+*/
+type openedLogFile struct {
+	file         *os.File
+	reader       *bufio.Reader
+	decompressor io.Closer
+	compression  string
+	identity     *inputs.FileIdentity
+	//offset of the next line to be read, in decompressed data for compressed files
+	offset int64
+	stats  *metrics.SBOPipelineStats
+}
+
+func (logFile *openedLogFile) IsCompressed() bool {
+	return logFile.compression != inputs.COMPRESSION_NONE
+}
+
+func (logFile *openedLogFile) Close() {
+	if logFile.decompressor != nil {
+		logFile.decompressor.Close()
+	}
+	if logFile.file != nil {
+		logFile.file.Close()
+	}
+}
+
+// Positions the reader at offset. Compressed files can't be seeked, offset bytes of decompressed data are skipped instead
+func (logFile *openedLogFile) seekTo(offset int64) error {
+	if logFile.IsCompressed() {
+		skipped, err := io.CopyN(io.Discard, logFile.reader, offset-logFile.offset)
+		logFile.offset += skipped
+		return err
+	}
+	fileInfo, err := logFile.file.Stat()
+	if err != nil {
+		return err
+	}
+	if fileInfo.Size() < offset {
+		return fmt.Errorf("file size %v is less than offset %v", fileInfo.Size(), offset)
+	}
+	if _, err = logFile.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	logFile.reader.Reset(logFile.file)
+	logFile.offset = offset
+	return nil
+}
+
+/*
+Returns a line reader for source, decompressing data when source is compressed (detected using magic bytes).
+The returned closer must be closed when done
+*/
+func newDecompressingLineReader(source io.Reader) (*bufio.Reader, io.Closer, string, error) {
+	rawReader := bufio.NewReaderSize(source, 8192)
+	decompressor, compression, err := inputs.NewDecompressingReader(rawReader)
+	if err != nil {
+		return nil, nil, compression, err
+	}
+	if compression == inputs.COMPRESSION_NONE {
+		return rawReader, decompressor, compression, nil
+	}
+	return bufio.NewReaderSize(decompressor, 8192), decompressor, compression, nil
+}
+
+/*
+Opens filePath, detecting compression and the identity of the file. Reading starts from the beginning of the (decompressed) data
+*/
+func openLogFileForReading(filePath string) (*openedLogFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		slog.Error("Error opening file", "filePath", filePath, "error", err)
+		return nil, err
+	}
+	logFile := &openedLogFile{file: file}
+
+	logFile.reader, logFile.decompressor, logFile.compression, err = newDecompressingLineReader(file)
+	if err != nil {
+		file.Close()
+		slog.Error("Error reading compressed file", "filePath", filePath, "error", err)
+		return nil, err
+	}
+	if logFile.IsCompressed() {
+		//identity of a compressed file uses the first line of decompressed data
+		fileInfo, statErr := file.Stat()
+		header, _ := logFile.reader.Peek(inputs.FIRST_LINE_MAX_LENGTH)
+		if statErr == nil {
+			logFile.identity = inputs.NewFileIdentity(fileInfo, header)
+		}
+	} else {
+		logFile.identity, err = inputs.GetFileIdentity(file)
+		if err != nil {
+			slog.Warn("Failed to get file identity, checkpoints will not be saved for the file", "filePath", filePath, "error", err)
+		}
+	}
+	return logFile, nil
+}
+
+/*
+Opens filePath for reading. When resumeFrom is not nil and the file is the file in the checkpoint, reading resumes from the checkpoint.
+When resumeFrom belongs to another file (i.e the file was rotated), the file is processed from the beginning.
+*/
+func openFile(reopeningAfterRotate bool, filePath string, resumeFrom *inputs.FileCheckpoint) (*openedLogFile, error) {
+	config := getConfigForFile(filePath)
+	logFile, err := openLogFileForReading(filePath)
+	if err != nil {
+		return nil, err
+	}
+	file := logFile.file
+
+	if resumeFrom != nil {
+		if resumeFrom.SameFileAs(logFile.identity) {
+			err = logFile.seekTo(resumeFrom.Offset)
+			if err == nil {
+				slog.Info("Resuming from checkpoint", "filePath", filePath, "offset", resumeFrom.Offset, "lastTimestamp", resumeFrom.LastTimestamp)
+				return logFile, nil
+			}
+			if logFile.IsCompressed() {
+				logFile.Close()
+				slog.Error("Failed to resume from checkpoint", "filePath", filePath, "error", err)
+				return nil, err
+			}
+			slog.Warn("Failed to resume from checkpoint, file was probably truncated. Processing from the beginning", "filePath", filePath, "error", err)
+		} else {
+			slog.Info("File was replaced after the checkpoint was saved, processing from the beginning", "filePath", filePath)
+		}
+		reopeningAfterRotate = true
+	}
+
+	if logFile.IsCompressed() {
+		//compressed files can't be seeked and they don't grow, so they are always processed from the beginning
+		slog.Info("Opened compressed file", "filePath", filePath, "compression", logFile.compression)
+		if !reopeningAfterRotate {
+			if config.StartFrom < START_FROM_BEGINNING {
+				slog.Warn("StartFrom is ignored for compressed files, file will be processed starting from the beginning", "filePath", filePath)
+			}
+			logFile.offset += skipLinesForStartFrom(logFile.reader, config.StartFrom)
+		}
+		return logFile, nil
+	}
+
+	if reopeningAfterRotate || config.StartFrom >= START_FROM_BEGINNING {
+		// Seek to beginning if file exists, we peeked some bytes to detect compression
+		logFile.offset, err = file.Seek(0, 0)
+		if err != nil {
+			file.Close()
+			slog.Error("Error seeking to beginning of file", "filePath", filePath, "error", err)
+			return nil, err
+		}
+	} else {
+		// Seek to end if file exists
+		logFile.offset, err = file.Seek(0, 2)
+		if err != nil {
+			file.Close()
+			slog.Error("Error seeking to end of file", "filePath", filePath, "error", err)
+			return nil, err
+		}
+	}
+	logFile.reader.Reset(file)
+	if !reopeningAfterRotate {
+		logFile.offset += skipLinesForStartFrom(logFile.reader, config.StartFrom)
+	}
+
+	return logFile, nil
+}
+
+// skip lines until the line number given by StartFrom, when StartFrom > 0. Returns the number of bytes skipped
+func skipLinesForStartFrom(fileReader *bufio.Reader, startFrom int) int64 {
+	var skippedBytes int64 = 0
+	if startFrom <= START_FROM_BEGINNING {
+		return skippedBytes
+	}
+	//skip until the line
+	slog.Info("Skipping lines after opening file", "skippedLines", startFrom)
+	lineNo := 1
+	for {
+		skippedLine, err := fileReader.ReadString('\n')
+		skippedBytes += int64(len(skippedLine))
+		lineNo++
+		if lineNo >= startFrom {
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	return skippedBytes
+}
+
+func readFileToEnd(filePath string, lines chan<- inputs.LogLine, logFile *openedLogFile) {
+	slog.Debug("Reading file to end ", "filePath", filePath)
+	for !isShuttingDown() {
+		isEOF := readSingleLineFromFileReturnTrueIfEOF(filePath, lines, logFile)
+		if isEOF {
+			slog.Debug("readFileToEnd done", "filePath", filePath)
+			return
+		}
+	}
+}
+
+func readSingleLineFromFileReturnTrueIfEOF(filePath string, lines chan<- inputs.LogLine, logFile *openedLogFile) bool {
+	bytesRead, err := logFile.reader.ReadString('\n')
+	if len(bytesRead) > 0 {
+		if logFile.offset == 0 && logFile.identity != nil && len(logFile.identity.FirstLineHash) < 1 && strings.HasSuffix(bytesRead, "\n") {
+			//first line is complete now, e.g the file was empty when opened or it was truncated
+			updatedIdentity := *logFile.identity
+			updatedIdentity.FirstLineHash = inputs.HashFirstLine([]byte(bytesRead))
+			logFile.identity = &updatedIdentity
+		}
+		if logFile.stats == nil {
+			logFile.stats = metrics.GetPipelineStats(filePath)
+		}
+		logFile.stats.LinesRead.Add(1)
+		logFile.stats.BytesRead.Add(int64(len(bytesRead)))
+		logFile.offset += int64(len(bytesRead))
+		theLine := strings.TrimSpace(string(bytesRead[:]))
+		//slog.Debug("Read line:", "filePath", filePath, "line", theLine)
+		lines <- inputs.LogLine{Text: theLine, Source: logFile.identity, Offset: logFile.offset}
+	}
+	if err != nil {
+		//slog.Debug("fileReader error", "filePath", filePath, "error", err)
+		return io.EOF == err
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+)
+
+// number of most recent time windows to keep per client byte counts for
+const BANDWIDTH_TRACKED_WINDOW_COUNT int = 3
+
+/*
+Detects hotlinking (static assets embedded by foreign sites) and clients downloading more than
+clientBytesThreshold bytes in a time window. Used by both METRICS and COUNTER handlers.
+Not safe for concurrent use, each handler must have its own instance.
+*/
+type BandwidthAbuseDetector struct {
+	ownDomains            []string
+	clientBytesThreshold  int64
+	timeWindowSizeMinutes int
+	//client ips are only used for counting, they are not returned as keys or logged, see SaveLogsToDbMaskIPs
+	maskIPs bool
+	//time window => client ip => bytes sent
+	clientBytes map[int64]map[string]int64
+}
+
+type BandwidthCheckResult struct {
+	IsHotlink bool
+	//client exceeded the threshold with this request or with a previous request in the same time window
+	ClientOverThreshold bool
+	//client exceeded the threshold with this request, i.e this is the first request over the threshold
+	ClientJustExceeded bool
+	//total bytes sent to the client in the time window, including this request
+	ClientBytesInWindow int64
+	TimeWindow          int64
+	//key of the client in metrics and counters, i.e the client ip. Empty when ips are masked, client bandwidth is not reported then
+	ClientKey string
+}
+
+/*
+ownDomain and hotlinkAllowedDomains are the domains that are allowed to embed assets, domains found in log lines (e.g vhost logs) are always allowed.
+clientBytesThreshold < 1 disables client bandwidth checks. When maskIPs is true client ips are not used as keys, see BandwidthCheckResult.ClientKey
+*/
+func NewBandwidthAbuseDetector(ownDomain string, hotlinkAllowedDomains []string, clientBytesThreshold int64, timeWindowSizeMinutes int, maskIPs bool) *BandwidthAbuseDetector {
+	ownDomains := make([]string, 0, len(hotlinkAllowedDomains)+1)
+	if len(ownDomain) > 0 {
+		ownDomains = append(ownDomains, ownDomain)
+	}
+	ownDomains = append(ownDomains, hotlinkAllowedDomains...)
+	var rv = BandwidthAbuseDetector{
+		ownDomains:            ownDomains,
+		clientBytesThreshold:  clientBytesThreshold,
+		timeWindowSizeMinutes: timeWindowSizeMinutes,
+		maskIPs:               maskIPs,
+		clientBytes:           make(map[int64]map[string]int64)}
+	return &rv
+}
+
+func (detector *BandwidthAbuseDetector) Check(parsedLogEntry *logparsers.SBOHttpRequestLog) BandwidthCheckResult {
+	result := BandwidthCheckResult{
+		IsHotlink:  parsedLogEntry.IsHotlink(detector.ownDomains),
+		TimeWindow: CalculateTimeWindow(parsedLogEntry.Timestamp, detector.timeWindowSizeMinutes)}
+
+	if detector.clientBytesThreshold < 1 {
+		return result
+	}
+
+	bytesForWindow, ok := detector.clientBytes[result.TimeWindow]
+	if !ok {
+		bytesForWindow = make(map[string]int64)
+		detector.clientBytes[result.TimeWindow] = bytesForWindow
+		detector.removeOldWindows()
+	}
+	previousBytes := bytesForWindow[parsedLogEntry.ClientIP]
+	result.ClientBytesInWindow = previousBytes + int64(parsedLogEntry.BytesSent)
+	bytesForWindow[parsedLogEntry.ClientIP] = result.ClientBytesInWindow
+	result.ClientOverThreshold = result.ClientBytesInWindow > detector.clientBytesThreshold
+	result.ClientJustExceeded = result.ClientOverThreshold && previousBytes <= detector.clientBytesThreshold
+	if !detector.maskIPs {
+		result.ClientKey = parsedLogEntry.ClientIP
+	}
+	if result.ClientJustExceeded {
+		slog.Info("Client exceeded bandwidth threshold", "clientIP", result.ClientKey, "timeWindow", result.TimeWindow, "bytes", result.ClientBytesInWindow, "threshold", detector.clientBytesThreshold)
+	}
+	return result
+}
+
+// keep only the most recent BANDWIDTH_TRACKED_WINDOW_COUNT windows, logs are assumed to be (mostly) in chronological order
+func (detector *BandwidthAbuseDetector) removeOldWindows() {
+	if len(detector.clientBytes) <= BANDWIDTH_TRACKED_WINDOW_COUNT {
+		return
+	}
+	sortedWindows := slices.Sorted(maps.Keys(detector.clientBytes))
+	for _, tw := range sortedWindows[:len(sortedWindows)-BANDWIDTH_TRACKED_WINDOW_COUNT] {
+		delete(detector.clientBytes, tw)
+	}
+}
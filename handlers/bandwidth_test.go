@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func newTestBandwidthEntry(t *testing.T, clientIP string, minute int, path string, bytesSent int, referer string) *logparsers.SBOHttpRequestLog {
+	line := fmt.Sprintf(`%s - - [02/Jul/2025:10:%02d:00 +0000] "GET %s HTTP/1.1" 200 %d "%s" "Mozilla/5.0 (Macintosh)"`, clientIP, minute, path, bytesSent, referer)
+	entry, err := logparsers.ParseNginxCombinedFormat(line)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", line, err)
+	}
+	return entry
+}
+
+func TestBandwidthHotlinkAllowList(t *testing.T) {
+	detector := NewBandwidthAbuseDetector("example.com", []string{"partner.org"}, 0, 1, false)
+	testCases := []struct {
+		path     string
+		referer  string
+		domain   string
+		expected bool
+	}{
+		{"/a.jpg", "https://forum.other.org/t/1", "", true},
+		{"/a.jpg", "https://www.example.com/page", "", false},
+		{"/a.jpg", "https://cdn.example.com/page", "", false},
+		{"/a.jpg", "https://partner.org/page", "", false},
+		{"/a.jpg", "https://blog.partner.org/page", "", false},
+		{"/a.jpg", "https://notpartner.org/page", "", true},
+		{"/a.jpg", "-", "", false},
+		{"/page.html", "https://forum.other.org/t/1", "", false},
+		//domains in log lines are allowed too, e.g vhost logs
+		{"/a.jpg", "https://vhost.net/page", "vhost.net:443", false},
+	}
+	for _, testCase := range testCases {
+		entry := newTestBandwidthEntry(t, "192.0.2.1", 0, testCase.path, 100, testCase.referer)
+		entry.Domain = testCase.domain
+		result := detector.Check(entry)
+		if result.IsHotlink != testCase.expected {
+			t.Errorf("Expected hotlink %t for %s with referer %s", testCase.expected, testCase.path, testCase.referer)
+		}
+		if result.ClientBytesInWindow != 0 || result.ClientOverThreshold {
+			t.Errorf("Client bytes must not be counted when the threshold is disabled, got %+v", result)
+		}
+	}
+}
+
+func TestBandwidthClientThreshold(t *testing.T) {
+	detector := NewBandwidthAbuseDetector("example.com", nil, 1000, 5, false)
+	testCases := []struct {
+		clientIP      string
+		minute        int
+		bytesSent     int
+		bytesInWindow int64
+		over          bool
+		justExceeded  bool
+	}{
+		{"192.0.2.1", 0, 600, 600, false, false},
+		//exactly the threshold is not over it
+		{"192.0.2.1", 1, 400, 1000, false, false},
+		{"192.0.2.1", 2, 1, 1001, true, true},
+		{"192.0.2.1", 3, 500, 1501, true, false},
+		//other clients are counted separately
+		{"192.0.2.2", 4, 999, 999, false, false},
+		//new time window
+		{"192.0.2.1", 5, 100, 100, false, false},
+		{"192.0.2.1", 6, 2000, 2100, true, true},
+	}
+	for index, testCase := range testCases {
+		result := detector.Check(newTestBandwidthEntry(t, testCase.clientIP, testCase.minute, "/", testCase.bytesSent, "-"))
+		if result.ClientBytesInWindow != testCase.bytesInWindow || result.ClientOverThreshold != testCase.over || result.ClientJustExceeded != testCase.justExceeded {
+			t.Errorf("Unexpected result for case %d: %+v", index, result)
+		}
+	}
+}
+
+func TestBandwidthClientKeyIsEmptyWhenIPsAreMasked(t *testing.T) {
+	result := NewBandwidthAbuseDetector("example.com", nil, 1000, 5, false).Check(newTestBandwidthEntry(t, "192.0.2.1", 0, "/", 2000, "-"))
+	if result.ClientKey != "192.0.2.1" {
+		t.Errorf("Unexpected client key %q", result.ClientKey)
+	}
+	result = NewBandwidthAbuseDetector("example.com", nil, 1000, 5, true).Check(newTestBandwidthEntry(t, "192.0.2.1", 0, "/", 2000, "-"))
+	if !result.ClientJustExceeded || len(result.ClientKey) > 0 {
+		t.Errorf("Unexpected result when ips are masked %+v", result)
+	}
+}
+
+func TestBandwidthClientMetricIsNotGeneratedWhenIPsAreMasked(t *testing.T) {
+	for _, maskIPs := range []bool{false, true} {
+		metricsManager := metrics.NewSBOMetricsManager(3)
+		metricsGenerator := NewMetricGeneratorHandler("test-bandwidth", metricsManager, 5)
+		metricsGenerator.SetBandwidthAbuseDetector(NewBandwidthAbuseDetector("example.com", nil, 1000, 5, maskIPs))
+		metricsGenerator.Begin(make(chan *metrics.SBOMetricWindowDataToBeSaved, 100))
+		metricsGenerator.HandleEntry(newTestBandwidthEntry(t, "192.0.2.1", 0, "/", 2000, "-"))
+		clientMetrics := metricsManager.GetAllMetricsForFile("test-bandwidth")[metrics.SBO_METRIC_BANDWIDTH_CLIENT]
+		if _, found := clientMetrics["192.0.2.1"]; found == maskIPs {
+			t.Errorf("Unexpected client metrics %v when maskIPs is %v", clientMetrics, maskIPs)
+		}
+	}
+}
+
+func TestBandwidthWindowEviction(t *testing.T) {
+	detector := NewBandwidthAbuseDetector("example.com", nil, 1000, 1, false)
+	for minute := range BANDWIDTH_TRACKED_WINDOW_COUNT + 2 {
+		detector.Check(newTestBandwidthEntry(t, "192.0.2.1", minute, "/", 10, "-"))
+	}
+	if len(detector.clientBytes) != BANDWIDTH_TRACKED_WINDOW_COUNT {
+		t.Fatalf("Expected %d tracked windows, found %d", BANDWIDTH_TRACKED_WINDOW_COUNT, len(detector.clientBytes))
+	}
+	oldestKept := CalculateTimeWindow(time.Date(2025, 7, 2, 10, 2, 0, 0, time.UTC), 1)
+	for timeWindow := range detector.clientBytes {
+		if timeWindow < oldestKept {
+			t.Errorf("Old time window %d was not removed", timeWindow)
+		}
+	}
+	//a late entry for an evicted window starts counting from zero
+	result := detector.Check(newTestBandwidthEntry(t, "192.0.2.1", 0, "/", 10, "-"))
+	if result.ClientBytesInWindow != 10 {
+		t.Errorf("Expected 10 bytes for an evicted window, found %d", result.ClientBytesInWindow)
+	}
+}
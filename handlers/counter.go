@@ -63,6 +63,8 @@ type CounterHandler struct {
 	RequestsFromNonHumans *CounterValue
 	RequestsFromHumans    *CounterValue
 	MaliciousRequests     *CounterValue
+	SensitiveDataRequests *CounterValue
+	HotlinkRequests       *CounterValue
 
 	StatusCodes         map[string]*CounterValue
 	Methods             map[string]*CounterValue
@@ -73,8 +75,17 @@ type CounterHandler struct {
 	Referers            map[string]*CounterValue
 	RequestedPaths      map[string]*CounterValue
 	RequestIntents      map[string]*CounterValue
+	SensitiveDataPaths  map[string]*CounterValue
+	SpamReferers        map[string]*CounterValue
+	//bytes sent, keyed by referer domain
+	RefererBytes map[string]*CounterValue
+	//bytes sent for hotlinked assets, keyed by referer domain
+	HotlinkReferers map[string]*CounterValue
+	//bytes sent to clients which exceeded the bandwidth threshold, keyed by client ip
+	BandwidthHeavyClients map[string]*CounterValue
 
 	dataToBeSavedChannel chan *metrics.SBOMetricWindowDataToBeSaved
+	bandwidthDetector    *BandwidthAbuseDetector
 
 	isFollowing    bool
 	ticker         *time.Ticker
@@ -93,6 +104,8 @@ func NewCounterHandler(filePath string) *CounterHandler {
 		RequestsFromNonHumans: &CounterValue{CurrentValue: 0, PreviousValue: 0},
 		RequestsFromHumans:    &CounterValue{CurrentValue: 0, PreviousValue: 0},
 		MaliciousRequests:     &CounterValue{CurrentValue: 0, PreviousValue: 0},
+		SensitiveDataRequests: &CounterValue{CurrentValue: 0, PreviousValue: 0},
+		HotlinkRequests:       &CounterValue{CurrentValue: 0, PreviousValue: 0},
 		Clients:               make(map[string]*CounterValue),
 		Methods:               make(map[string]*CounterValue),
 		StatusCodes:           make(map[string]*CounterValue),
@@ -101,7 +114,12 @@ func NewCounterHandler(filePath string) *CounterHandler {
 		DeviceTypes:           make(map[string]*CounterValue),
 		Referers:              make(map[string]*CounterValue),
 		RequestedPaths:        make(map[string]*CounterValue),
-		RequestIntents:        make(map[string]*CounterValue)}
+		RequestIntents:        make(map[string]*CounterValue),
+		SensitiveDataPaths:    make(map[string]*CounterValue),
+		SpamReferers:          make(map[string]*CounterValue),
+		RefererBytes:          make(map[string]*CounterValue),
+		HotlinkReferers:       make(map[string]*CounterValue),
+		BandwidthHeavyClients: make(map[string]*CounterValue)}
 
 	return &rv
 }
@@ -134,6 +152,11 @@ func (handler *CounterHandler) Begin(dataToSaveChan chan *metrics.SBOMetricWindo
 	return nil
 }
 
+// Enables hotlinking and bandwidth abuse counters. Must be called before entries are handled
+func (handler *CounterHandler) SetBandwidthAbuseDetector(detector *BandwidthAbuseDetector) {
+	handler.bandwidthDetector = detector
+}
+
 func (handler *CounterHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpRequestLog) (bool, error) {
 
 	handler.syncMutex.Lock()
@@ -178,6 +201,19 @@ func (handler *CounterHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpReq
 			handler.MaliciousRequests.Increment(1)
 		}
 	}
+	if len(parsedLogEntry.SensitiveData) > 0 {
+		if handler.SensitiveDataRequests == nil {
+			handler.SensitiveDataRequests = &CounterValue{CurrentValue: 1}
+		} else {
+			handler.SensitiveDataRequests.Increment(1)
+		}
+		sensitivePath := logparsers.RedactSensitiveDataInString(parsedLogEntry.Path)
+		if handler.SensitiveDataPaths[sensitivePath] == nil {
+			handler.SensitiveDataPaths[sensitivePath] = &CounterValue{CurrentValue: 1}
+		} else {
+			handler.SensitiveDataPaths[sensitivePath].Increment(1)
+		}
+	}
 	if parsedLogEntry.UserAgent.Human == logparsers.Human_No {
 		if handler.RequestsFromNonHumans == nil {
 			handler.RequestsFromNonHumans = &CounterValue{CurrentValue: 1}
@@ -213,7 +249,13 @@ func (handler *CounterHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpReq
 		handler.UserAgentOSFamilies[parsedLogEntry.UserAgent.OS].Increment(1)
 	}
 
-	if handler.Referers[parsedLogEntry.Referer] == nil {
+	if parsedLogEntry.RefererSpam {
+		if handler.SpamReferers[parsedLogEntry.Referer] == nil {
+			handler.SpamReferers[parsedLogEntry.Referer] = &CounterValue{CurrentValue: 1}
+		} else {
+			handler.SpamReferers[parsedLogEntry.Referer].Increment(1)
+		}
+	} else if handler.Referers[parsedLogEntry.Referer] == nil {
 		handler.Referers[parsedLogEntry.Referer] = &CounterValue{CurrentValue: 1}
 	} else {
 		handler.Referers[parsedLogEntry.Referer].Increment(1)
@@ -225,6 +267,42 @@ func (handler *CounterHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpReq
 		handler.RequestedPaths[parsedLogEntry.Path].Increment(1)
 	}
 
+	if len(parsedLogEntry.Referer) > 0 && !parsedLogEntry.RefererSpam {
+		if handler.RefererBytes[parsedLogEntry.Referer] == nil {
+			handler.RefererBytes[parsedLogEntry.Referer] = &CounterValue{CurrentValue: int64(parsedLogEntry.BytesSent)}
+		} else {
+			handler.RefererBytes[parsedLogEntry.Referer].Increment(int64(parsedLogEntry.BytesSent))
+		}
+	}
+
+	if handler.bandwidthDetector != nil {
+		bandwidthResult := handler.bandwidthDetector.Check(parsedLogEntry)
+		if bandwidthResult.IsHotlink {
+			if handler.HotlinkRequests == nil {
+				handler.HotlinkRequests = &CounterValue{CurrentValue: 1}
+			} else {
+				handler.HotlinkRequests.Increment(1)
+			}
+			if handler.HotlinkReferers[parsedLogEntry.Referer] == nil {
+				handler.HotlinkReferers[parsedLogEntry.Referer] = &CounterValue{CurrentValue: int64(parsedLogEntry.BytesSent)}
+			} else {
+				handler.HotlinkReferers[parsedLogEntry.Referer].Increment(int64(parsedLogEntry.BytesSent))
+			}
+		}
+		if bandwidthResult.ClientOverThreshold && len(bandwidthResult.ClientKey) > 0 {
+			//add everything sent in this time window so far when the client just exceeded the threshold
+			bytesToAdd := int64(parsedLogEntry.BytesSent)
+			if bandwidthResult.ClientJustExceeded {
+				bytesToAdd = bandwidthResult.ClientBytesInWindow
+			}
+			if handler.BandwidthHeavyClients[bandwidthResult.ClientKey] == nil {
+				handler.BandwidthHeavyClients[bandwidthResult.ClientKey] = &CounterValue{CurrentValue: bytesToAdd}
+			} else {
+				handler.BandwidthHeavyClients[bandwidthResult.ClientKey].Increment(bytesToAdd)
+			}
+		}
+	}
+
 	return true, nil
 }
 
@@ -262,6 +340,8 @@ func (handler *CounterHandler) startNewWindow() {
 	handler.TotalBytesSent.PreviousValue = handler.TotalBytesSent.CurrentValue
 	handler.TotalRequests.PreviousValue = handler.TotalRequests.CurrentValue
 	handler.MaliciousRequests.PreviousValue = handler.MaliciousRequests.CurrentValue
+	handler.SensitiveDataRequests.PreviousValue = handler.SensitiveDataRequests.CurrentValue
+	handler.HotlinkRequests.PreviousValue = handler.HotlinkRequests.CurrentValue
 
 	handler.ResetCountersInMapForNewWindow(handler.Clients)
 	handler.ResetCountersInMapForNewWindow(handler.DeviceTypes)
@@ -272,6 +352,11 @@ func (handler *CounterHandler) startNewWindow() {
 	handler.ResetCountersInMapForNewWindow(handler.Referers)
 	handler.ResetCountersInMapForNewWindow(handler.RequestedPaths)
 	handler.ResetCountersInMapForNewWindow(handler.RequestIntents)
+	handler.ResetCountersInMapForNewWindow(handler.SensitiveDataPaths)
+	handler.ResetCountersInMapForNewWindow(handler.SpamReferers)
+	handler.ResetCountersInMapForNewWindow(handler.RefererBytes)
+	handler.ResetCountersInMapForNewWindow(handler.HotlinkReferers)
+	handler.ResetCountersInMapForNewWindow(handler.BandwidthHeavyClients)
 }
 
 func (handler *CounterHandler) ResetCountersInMapForNewWindow(theMap map[string]*CounterValue) {
@@ -371,6 +456,22 @@ func (handler *CounterHandler) PrintCounterData(fromTicker bool) {
 		}
 		fmt.Println()
 	}
+	if handler.SensitiveDataRequests != nil && handler.SensitiveDataRequests.CurrentValue > 0 {
+		if handler.isFollowing {
+			fmt.Printf("Sensitive data    : %v (%+d)", handler.SensitiveDataRequests.CurrentValue, handler.SensitiveDataRequests.CurrentValue-handler.SensitiveDataRequests.PreviousValue)
+		} else {
+			fmt.Printf("Sensitive data    : %v", handler.SensitiveDataRequests.CurrentValue)
+		}
+		fmt.Println()
+	}
+	if handler.HotlinkRequests != nil && handler.HotlinkRequests.CurrentValue > 0 {
+		if handler.isFollowing {
+			fmt.Printf("Hotlink requests  : %v (%+d)", handler.HotlinkRequests.CurrentValue, handler.HotlinkRequests.CurrentValue-handler.HotlinkRequests.PreviousValue)
+		} else {
+			fmt.Printf("Hotlink requests  : %v", handler.HotlinkRequests.CurrentValue)
+		}
+		fmt.Println()
+	}
 	handler.printMapValue("Intents           :", handler.RequestIntents)
 
 	handler.printMapValue("Status codes      :", handler.StatusCodes)
@@ -385,9 +486,24 @@ func (handler *CounterHandler) PrintCounterData(fromTicker bool) {
 	handler.Referers = ShrinkCounterMapLeavingTopN(handler.Referers, handler.topNWindowSize)
 	handler.printMapValue("Referers          :", handler.Referers)
 
+	handler.SpamReferers = ShrinkCounterMapLeavingTopN(handler.SpamReferers, handler.topNWindowSize)
+	handler.printMapValue("Spam referers     :", handler.SpamReferers)
+
+	handler.RefererBytes = ShrinkCounterMapLeavingTopN(handler.RefererBytes, handler.topNWindowSize)
+	handler.printMapValue("Bytes by referer  :", handler.RefererBytes)
+
+	handler.HotlinkReferers = ShrinkCounterMapLeavingTopN(handler.HotlinkReferers, handler.topNWindowSize)
+	handler.printMapValue("Hotlinking (bytes):", handler.HotlinkReferers)
+
+	handler.BandwidthHeavyClients = ShrinkCounterMapLeavingTopN(handler.BandwidthHeavyClients, handler.topNWindowSize)
+	handler.printMapValue("Heavy clients     :", handler.BandwidthHeavyClients)
+
 	handler.RequestedPaths = ShrinkCounterMapLeavingTopN(handler.RequestedPaths, handler.topNWindowSize)
 	handler.printMapValue("Requested Path    :", handler.RequestedPaths)
 
+	handler.SensitiveDataPaths = ShrinkCounterMapLeavingTopN(handler.SensitiveDataPaths, handler.topNWindowSize)
+	handler.printMapValue("Sensitive data in :", handler.SensitiveDataPaths)
+
 	fmt.Println()
 
 }
@@ -0,0 +1,63 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+const ELASTICSEARCH_HANDLER_NAME string = "ELASTICSEARCH"
+
+/*
+Ships log entries to Elasticsearch or OpenSearch, see outputs.ElasticsearchWriter.
+Entries are ignored when writer is nil, e.g ElasticsearchUrl is not configured
+*/
+type ElasticsearchHandler struct {
+	domainName string
+	writer     *outputs.ElasticsearchWriter
+}
+
+// domainName is used when log entries don't include the domain
+func NewElasticsearchHandler(domainName string, writer *outputs.ElasticsearchWriter) *ElasticsearchHandler {
+	return &ElasticsearchHandler{domainName: domainName, writer: writer}
+}
+
+func (handler *ElasticsearchHandler) Name() string {
+	return ELASTICSEARCH_HANDLER_NAME
+}
+
+func (handler *ElasticsearchHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpRequestLog) (bool, error) {
+	if handler.writer == nil {
+		return false, nil
+	}
+	if err := handler.writer.Write(handler.domainName, parsedLogEntry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sends pending entries
+func (handler *ElasticsearchHandler) End() bool {
+	if handler.writer != nil {
+		handler.writer.Close()
+	}
+	return true
+}
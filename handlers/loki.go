@@ -0,0 +1,63 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+const LOKI_HANDLER_NAME string = "LOKI"
+
+/*
+Pushes log entries to Grafana Loki, see outputs.LokiWriter.
+Entries are ignored when writer is nil, e.g LokiUrl is not configured
+*/
+type LokiHandler struct {
+	domainName string
+	writer     *outputs.LokiWriter
+}
+
+// domainName is used when log entries don't include the domain
+func NewLokiHandler(domainName string, writer *outputs.LokiWriter) *LokiHandler {
+	return &LokiHandler{domainName: domainName, writer: writer}
+}
+
+func (handler *LokiHandler) Name() string {
+	return LOKI_HANDLER_NAME
+}
+
+func (handler *LokiHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpRequestLog) (bool, error) {
+	if handler.writer == nil {
+		return false, nil
+	}
+	if err := handler.writer.PushLog(handler.domainName, parsedLogEntry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sends pending entries
+func (handler *LokiHandler) End() bool {
+	if handler.writer != nil {
+		handler.writer.Close()
+	}
+	return true
+}
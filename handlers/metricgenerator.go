@@ -47,6 +47,7 @@ type MetricGeneratorHandler struct {
 	dataToBeSavedChannel  chan *metrics.SBOMetricWindowDataToBeSaved
 	metricsManager        *metrics.SBOMetricsManager
 	timeWindowSizeMinutes int
+	bandwidthDetector     *BandwidthAbuseDetector
 }
 
 func NewMetricGeneratorHandler(filePath string, metricsManager *metrics.SBOMetricsManager, twSizeInMinutes int) *MetricGeneratorHandler {
@@ -70,6 +71,11 @@ func (handler *MetricGeneratorHandler) Begin(dataToSaveChan chan *metrics.SBOMet
 	return nil
 }
 
+// Enables hotlinking and bandwidth abuse metrics. Must be called before entries are handled
+func (handler *MetricGeneratorHandler) SetBandwidthAbuseDetector(detector *BandwidthAbuseDetector) {
+	handler.bandwidthDetector = detector
+}
+
 // TODO implement lastN window processing, e.g to check if we received invalid requests from a client repeatedly -> malicious
 func (handler *MetricGeneratorHandler) addToLastN(parsedLogEntry *logparsers.SBOHttpRequestLog) {
 	handler.lastNEntries[handler.lastNPosition] = parsedLogEntry
@@ -85,6 +91,7 @@ func (handler *MetricGeneratorHandler) PrintMetrics(filePath string) {
 // TODO decide how we will save generated metrics
 func (handler *MetricGeneratorHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpRequestLog) (bool, error) {
 	handler.handledEntryCounter++
+	handler.metricsManager.SetTimeWindowLocation(handler.filePath, handler.calculateTimeWindow(parsedLogEntry.Timestamp), parsedLogEntry.Timestamp.Location())
 	handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_REQ_COUNT, "", 1)
 	handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_BYTES_SENT, "", int64(parsedLogEntry.BytesSent))
 	handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_HTTP_STATUS, parsedLogEntry.Status, 1)
@@ -99,8 +106,26 @@ func (handler *MetricGeneratorHandler) HandleEntry(parsedLogEntry *logparsers.SB
 
 	handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_METHOD, parsedLogEntry.Method, 1)
 
-	if len(parsedLogEntry.Referer) > 0 {
+	if len(parsedLogEntry.Referer) > 0 && parsedLogEntry.RefererSpam {
+		handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_REFERER_SPAM, parsedLogEntry.Referer, 1)
+	} else if len(parsedLogEntry.Referer) > 0 {
 		handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_REFERER, parsedLogEntry.Referer, 1)
+		handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_REFERER_BYTES, parsedLogEntry.Referer, int64(parsedLogEntry.BytesSent))
+	}
+
+	if handler.bandwidthDetector != nil {
+		bandwidthResult := handler.bandwidthDetector.Check(parsedLogEntry)
+		if bandwidthResult.IsHotlink {
+			handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_HOTLINK_REFERER, parsedLogEntry.Referer, int64(parsedLogEntry.BytesSent))
+		}
+		if len(bandwidthResult.ClientKey) < 1 {
+			//client ips are masked, they must not be saved as metric keys
+		} else if bandwidthResult.ClientJustExceeded {
+			//add everything sent in this time window so far
+			handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_BANDWIDTH_CLIENT, bandwidthResult.ClientKey, bandwidthResult.ClientBytesInWindow)
+		} else if bandwidthResult.ClientOverThreshold {
+			handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_BANDWIDTH_CLIENT, bandwidthResult.ClientKey, int64(parsedLogEntry.BytesSent))
+		}
 	}
 
 	//add metrics for paths that return 2xx only. Ignoring others to save space, e.g scanners sending hundreds of paths
@@ -122,6 +147,11 @@ func (handler *MetricGeneratorHandler) HandleEntry(parsedLogEntry *logparsers.SB
 	handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_IS_HUMAN, parsedLogEntry.UserAgent.Human, 1)
 	handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_REQUEST_INTENT, parsedLogEntry.UserAgent.Intent, 1)
 
+	if len(parsedLogEntry.SensitiveData) > 0 {
+		//path is redacted for the key even if redaction is not enabled, we don't want secrets in metric keys
+		handler.handleSingleMetric(parsedLogEntry, metrics.SBO_METRIC_SENSITIVE_DATA, logparsers.RedactSensitiveDataInString(parsedLogEntry.Path), 1)
+	}
+
 	return true, nil
 }
 
@@ -129,12 +159,19 @@ func (handler *MetricGeneratorHandler) HandleEntry(parsedLogEntry *logparsers.SB
 calculate time window
 */
 func (handler *MetricGeneratorHandler) calculateTimeWindow(eventTimestamp time.Time) int64 {
+	return CalculateTimeWindow(eventTimestamp, handler.timeWindowSizeMinutes)
+}
+
+/*
+calculate time window for the given timestamp, e.g 202507021120 for 2025-07-02 11:23:45 when timeWindowSizeMinutes is 10
+*/
+func CalculateTimeWindow(eventTimestamp time.Time, timeWindowSizeMinutes int) int64 {
 	cleanTsUpToMinutes := eventTimestamp.Format("2006010215")
 
 	minutes := eventTimestamp.Minute()
 	minutePart := ""
 
-	switch handler.timeWindowSizeMinutes {
+	switch timeWindowSizeMinutes {
 	case 1:
 		minutePart = fmt.Sprintf("%02d", minutes)
 	case 5:
@@ -173,6 +210,7 @@ func (handler *MetricGeneratorHandler) End() bool {
 		for keyValue, values := range metricData {
 			for timeWindow, metricValue := range values.Values {
 				theData := metrics.NewSBOMetricWindowDataToBeSaved(handler.filePath, metricType, keyValue, timeWindow, metricValue)
+				theData.TimeWindowLocation = handler.metricsManager.TimeWindowLocation(handler.filePath, timeWindow)
 				handler.dataToBeSavedChannel <- theData
 			}
 		}
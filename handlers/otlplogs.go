@@ -0,0 +1,65 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+const OTLP_LOGS_HANDLER_NAME string = "OTLP_LOGS"
+
+/*
+Exports log entries to an OpenTelemetry collector, see outputs.OtlpLogExporter.
+Entries are ignored when exporter is nil, e.g OtlpEndpoint is not configured
+*/
+type OtlpLogsHandler struct {
+	domainName string
+	exporter   *outputs.OtlpLogExporter
+}
+
+// domainName is used when log entries don't include the domain
+func NewOtlpLogsHandler(domainName string, exporter *outputs.OtlpLogExporter) *OtlpLogsHandler {
+	return &OtlpLogsHandler{domainName: domainName, exporter: exporter}
+}
+
+func (handler *OtlpLogsHandler) Name() string {
+	return OTLP_LOGS_HANDLER_NAME
+}
+
+func (handler *OtlpLogsHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpRequestLog) (bool, error) {
+	if handler.exporter == nil {
+		return false, nil
+	}
+	domain := parsedLogEntry.Domain
+	if len(domain) < 1 {
+		domain = handler.domainName
+	}
+	handler.exporter.PushLog(domain, parsedLogEntry)
+	return true, nil
+}
+
+// sends pending log records
+func (handler *OtlpLogsHandler) End() bool {
+	if handler.exporter != nil {
+		handler.exporter.Close()
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+const (
+	PROMETHEUS_HANDLER_NAME string = "PROMETHEUS"
+
+	PROMETHEUS_METRIC_REQUESTS           string = "sbologp_http_requests_total"
+	PROMETHEUS_METRIC_RESPONSE_BYTES     string = "sbologp_http_response_bytes_total"
+	PROMETHEUS_METRIC_REQUESTS_BY_CLIENT string = "sbologp_http_requests_by_client_total"
+	PROMETHEUS_METRIC_MALICIOUS_REQUESTS string = "sbologp_http_malicious_requests_total"
+	PROMETHEUS_METRIC_REQUEST_DURATION   string = "sbologp_http_request_duration_seconds"
+
+	// used for methods and status codes which are not standard, e.g garbage sent by scanners
+	PROMETHEUS_LABEL_VALUE_OTHER string = "other"
+)
+
+// methods not in this list are counted as PROMETHEUS_LABEL_VALUE_OTHER
+var prometheusKnownMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true, "PATCH": true}
+
+var prometheusMaliciousCategories = map[int]string{
+	logparsers.REQUEST_MALICIOUS_INVALID:   "invalid",
+	logparsers.REQUEST_MALICIOUS_SQLINJ:    "sqlinj",
+	logparsers.REQUEST_MALICIOUS_XSS:       "xss",
+	logparsers.REQUEST_MALICIOUS_TRAVERSAL: "traversal",
+	logparsers.REQUEST_MALICIOUS_SCAN:      "scan",
+}
+
+/*
+Counts requests in a Prometheus registry, metrics are exposed by outputs.PrometheusServer.
+Paths and client IPs are not used as labels, there would be too many series
+*/
+type PrometheusHandler struct {
+	domainName string
+	registry   *outputs.PrometheusRegistry
+}
+
+// domainName is used when log entries don't include the domain
+func NewPrometheusHandler(domainName string, registry *outputs.PrometheusRegistry) *PrometheusHandler {
+	registry.RegisterCounter(PROMETHEUS_METRIC_REQUESTS, "HTTP requests", "domain", "status_class", "method")
+	registry.RegisterCounter(PROMETHEUS_METRIC_RESPONSE_BYTES, "Bytes sent in HTTP responses", "domain", "status_class")
+	registry.RegisterCounter(PROMETHEUS_METRIC_REQUESTS_BY_CLIENT, "HTTP requests by user agent", "domain", "ua_family", "device_type", "human", "intent")
+	registry.RegisterCounter(PROMETHEUS_METRIC_MALICIOUS_REQUESTS, "HTTP requests detected as malicious", "domain", "category")
+	registry.RegisterHistogram(PROMETHEUS_METRIC_REQUEST_DURATION, "Time taken to process HTTP requests, only for log formats which include it",
+		outputs.PROMETHEUS_DURATION_BUCKETS, "domain", "status_class")
+	return &PrometheusHandler{domainName: domainName, registry: registry}
+}
+
+func (handler *PrometheusHandler) Name() string {
+	return PROMETHEUS_HANDLER_NAME
+}
+
+func (handler *PrometheusHandler) HandleEntry(parsedLogEntry *logparsers.SBOHttpRequestLog) (bool, error) {
+	domain := parsedLogEntry.Domain
+	if len(domain) < 1 {
+		domain = handler.domainName
+	}
+	statusClass := parsedLogEntry.StatusClass()
+	if len(statusClass) < 1 {
+		statusClass = PROMETHEUS_LABEL_VALUE_OTHER
+	}
+	method := parsedLogEntry.Method
+	if !prometheusKnownMethods[method] {
+		method = PROMETHEUS_LABEL_VALUE_OTHER
+	}
+	handler.registry.Add(PROMETHEUS_METRIC_REQUESTS, 1, domain, statusClass, method)
+	handler.registry.Add(PROMETHEUS_METRIC_RESPONSE_BYTES, float64(parsedLogEntry.BytesSent), domain, statusClass)
+	if parsedLogEntry.UserAgent != nil {
+		handler.registry.Add(PROMETHEUS_METRIC_REQUESTS_BY_CLIENT, 1, domain, parsedLogEntry.UserAgent.Family,
+			parsedLogEntry.UserAgent.DeviceType, parsedLogEntry.UserAgent.Human, parsedLogEntry.UserAgent.Intent)
+	}
+	if parsedLogEntry.Malicious != logparsers.REQUEST_MALICIOUS_UNKNOWN {
+		category, known := prometheusMaliciousCategories[parsedLogEntry.Malicious]
+		if !known {
+			category = strconv.Itoa(parsedLogEntry.Malicious)
+		}
+		handler.registry.Add(PROMETHEUS_METRIC_MALICIOUS_REQUESTS, 1, domain, category)
+	}
+	if parsedLogEntry.RequestTimeLogged {
+		handler.registry.Observe(PROMETHEUS_METRIC_REQUEST_DURATION, parsedLogEntry.RequestTime.Seconds(), domain, statusClass)
+	}
+	return true, nil
+}
+
+func (handler *PrometheusHandler) End() bool {
+	return true
+}
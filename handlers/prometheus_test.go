@@ -0,0 +1,49 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+func TestPrometheusStatusClassLabels(t *testing.T) {
+	registry := outputs.NewPrometheusRegistry(100)
+	handler := NewPrometheusHandler("example.com", registry)
+	for _, status := range []string{"200", "204", "404", "-", "999"} {
+		handler.HandleEntry(&logparsers.SBOHttpRequestLog{Method: "GET", Status: status})
+	}
+	var output strings.Builder
+	if err := registry.Write(&output); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for _, expected := range []string{
+		`sbologp_http_requests_total{domain="example.com",status_class="2xx",method="GET"} 2`,
+		`sbologp_http_requests_total{domain="example.com",status_class="4xx",method="GET"} 1`,
+		`sbologp_http_requests_total{domain="example.com",status_class="other",method="GET"} 2`,
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Output does not contain %q:\n%s", expected, output.String())
+		}
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/db"
+	"github.com/SBOsoft/SBOLogProcessor/handlers"
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// saved offsets of files are read again this often while the database is not available, see ingestProgressTracker.IsProcessed
+var ingestProgressRetryInterval time.Duration = 5 * time.Second
+
+/*
+Skips lines of files which were processed and saved into the database before and saves progress, see db/ingestprogress.go.
+Not safe for concurrent use, IsProcessed and LineProcessed are called by the consumer, see processedLinePositions,
+and Save is called after all metrics were queued for saving.
+A nil *ingestProgressTracker is valid and does nothing, i.e the input is not saved into a database
+*/
+type ingestProgressTracker struct {
+	filePath string
+	sbodb    db.SBOStorage
+	//source id (hash of the first line of the file) => offset saved in the database, lines up to this offset are skipped
+	committedOffsets map[string]int64
+	//source id => offset of the line after the last processed line
+	processedOffsets map[string]int64
+}
+
+func newIngestProgressTracker(filePath string, sbodb db.SBOStorage) *ingestProgressTracker {
+	if sbodb == nil {
+		return nil
+	}
+	if len(getConfigForFile(filePath).DomainName) < 1 {
+		//progress is saved for the domain of the configuration entry, see getDomainId
+		slog.Info("DomainName is not set, lines will be processed again if the file is processed again", "filePath", filePath)
+		return nil
+	}
+	return &ingestProgressTracker{filePath: filePath, sbodb: sbodb, committedOffsets: make(map[string]int64), processedOffsets: make(map[string]int64)}
+}
+
+/*
+Progress is saved for the domain of the configuration entry, domains found in lines (e.g vhost logs) are not used.
+Pending domain ids (see db.SBOBatchWriter.GetDomainId) are resolved by the writer when rows are saved and when offsets are read,
+reading an offset fails while the real domain id is not known
+*/
+func (tracker *ingestProgressTracker) getDomainId() (int, error) {
+	config := getConfigForFile(tracker.filePath)
+	domainId, err := tracker.sbodb.GetDomainId(config.DomainName, config.TimeWindowSizeMinutes)
+	if err == nil && domainId < 1 && domainId > db.DB_PENDING_DOMAIN_ID_BASE {
+		err = fmt.Errorf("invalid domain id %d", domainId)
+	}
+	return domainId, err
+}
+
+// empty if the line was not read from a file or the first line of the file is not known yet
+func ingestSourceId(line inputs.LogLine) string {
+	if line.Source == nil {
+		return ""
+	}
+	return line.Source.FirstLineHash
+}
+
+/*
+Returns true if the line was processed before, i.e it must be skipped.
+When the saved offset of the file can't be read, e.g the database is not available, waits and tries again until it's read,
+processing lines without knowing it would count lines saved before again. Fails only if shutdown starts while waiting,
+the line must not be processed or marked as processed then
+*/
+func (tracker *ingestProgressTracker) IsProcessed(line inputs.LogLine) (bool, error) {
+	sourceId := ingestSourceId(line)
+	if tracker == nil || len(sourceId) < 1 {
+		return false, nil
+	}
+	committedOffset, found := tracker.committedOffsets[sourceId]
+	for attempt := 0; !found; attempt++ {
+		domainId, err := tracker.getDomainId()
+		if err == nil {
+			committedOffset, err = tracker.sbodb.GetIngestOffset(domainId, sourceId)
+		}
+		if err == nil {
+			if committedOffset > 0 {
+				slog.Info("File was processed before, skipping processed lines", "filePath", tracker.filePath, "offset", committedOffset)
+			}
+			//not cached when reading failed
+			tracker.committedOffsets[sourceId] = committedOffset
+			break
+		}
+		if attempt == 0 {
+			slog.Warn("Failed to get ingest progress, waiting until it's available", "filePath", tracker.filePath, "retryIn", ingestProgressRetryInterval, "error", err)
+		}
+		select {
+		case <-globalShutdown:
+			return false, err
+		case <-time.After(ingestProgressRetryInterval):
+		}
+	}
+	return line.Offset <= committedOffset, nil
+}
+
+func (tracker *ingestProgressTracker) LineProcessed(line inputs.LogLine) {
+	sourceId := ingestSourceId(line)
+	if tracker == nil || len(sourceId) < 1 {
+		return
+	}
+	tracker.processedOffsets[sourceId] = max(tracker.processedOffsets[sourceId], line.Offset)
+}
+
+/*
+Returns a function queueing progress rows for lines processed since the last call, which may be called later by another goroutine.
+Rows are saved after rows queued before them. nil if there is nothing to save
+*/
+func (tracker *ingestProgressTracker) progressSaver() func() {
+	if tracker == nil || len(tracker.processedOffsets) < 1 {
+		return nil
+	}
+	domainId, err := tracker.getDomainId()
+	if err != nil {
+		slog.Error("Failed to save ingest progress, lines will be processed again if the file is processed again", "filePath", tracker.filePath, "error", err)
+		return nil
+	}
+	rows := make([]db.IngestProgressRow, 0, len(tracker.processedOffsets))
+	for sourceId, offset := range tracker.processedOffsets {
+		if offset > tracker.committedOffsets[sourceId] {
+			rows = append(rows, db.IngestProgressRow{DomainId: domainId, SourceId: sourceId, Offset: offset})
+			tracker.committedOffsets[sourceId] = offset
+		}
+	}
+	if len(rows) < 1 {
+		return nil
+	}
+	return func() {
+		if err := tracker.sbodb.SaveIngestProgressBatch(rows); err != nil {
+			slog.Error("Failed to save ingest progress", "filePath", tracker.filePath, "error", err)
+		}
+	}
+}
+
+// Queues progress rows, which are saved after rows queued before them
+func (tracker *ingestProgressTracker) Save() {
+	if saveProgress := tracker.progressSaver(); saveProgress != nil {
+		saveProgress()
+	}
+}
+
+/*
+Keeps positions of processed lines until metrics of their time windows are sent for saving, then passes them to the checkpointer and
+the progress tracker, so saved positions only cover lines whose data was saved. Lines after saved positions are processed again
+when processing restarts, e.g after a crash, so their metrics may be counted twice but they are not lost.
+Data sent to metric outputs and log outputs (e.g LOKI) is not waited for.
+Not safe for concurrent use, LineProcessed and Save are called by the consumer
+*/
+type processedLinePositions struct {
+	filePath        string
+	checkpointer    *fileCheckpointer
+	progressTracker *ingestProgressTracker
+	//consecutive lines of the same source, in the order they were processed
+	groups    []processedLineGroup
+	lastSaved time.Time
+}
+
+type processedLineGroup struct {
+	//newest time window of the lines, 0 if no lines were parsed
+	timeWindow int64
+	//last line of the group
+	line          inputs.LogLine
+	lastTimestamp time.Time
+}
+
+func newProcessedLinePositions(filePath string, checkpointer *fileCheckpointer, progressTracker *ingestProgressTracker) *processedLinePositions {
+	return &processedLinePositions{filePath: filePath, checkpointer: checkpointer, progressTracker: progressTracker, lastSaved: time.Now()}
+}
+
+// parsedLogEntry is nil if the line was not parsed, e.g it was skipped
+func (positions *processedLinePositions) LineProcessed(line inputs.LogLine, parsedLogEntry *logparsers.SBOHttpRequestLog) {
+	if positions.checkpointer == nil && positions.progressTracker == nil {
+		return
+	}
+	var timeWindow int64 = 0
+	var timestamp time.Time
+	if parsedLogEntry != nil {
+		timeWindow = handlers.CalculateTimeWindow(parsedLogEntry.Timestamp, getConfigForFile(positions.filePath).TimeWindowSizeMinutes)
+		timestamp = parsedLogEntry.Timestamp
+	}
+	lastIndex := len(positions.groups) - 1
+	//lines of older time windows, e.g lines which were not parsed, are added to the last group
+	if lastIndex >= 0 && positions.groups[lastIndex].line.Source == line.Source && timeWindow <= positions.groups[lastIndex].timeWindow {
+		positions.groups[lastIndex].line = line
+		if !timestamp.IsZero() {
+			positions.groups[lastIndex].lastTimestamp = timestamp
+		}
+		return
+	}
+	positions.groups = append(positions.groups, processedLineGroup{timeWindow: timeWindow, line: line, lastTimestamp: timestamp})
+}
+
+// Passes lines of time windows older than oldestUnsavedTimeWindow to the checkpointer and the progress tracker, all lines if it's 0
+func (positions *processedLinePositions) commit(oldestUnsavedTimeWindow int64) int {
+	count := 0
+	for _, group := range positions.groups {
+		if oldestUnsavedTimeWindow > 0 && group.timeWindow >= oldestUnsavedTimeWindow {
+			break
+		}
+		positions.checkpointer.LineProcessed(group.line, group.lastTimestamp)
+		positions.progressTracker.LineProcessed(group.line)
+		count++
+	}
+	positions.groups = slices.Delete(positions.groups, 0, count)
+	return count
+}
+
+/*
+Saves positions of lines whose metrics were sent for saving, every CHECKPOINT_SAVE_INTERVAL. Progress rows are queued and the checkpoint is saved
+after metrics sent before them are queued (see processMetricDataToBeSaved) and saved into the database, so they don't cover data which is not saved yet
+*/
+func (positions *processedLinePositions) Save(metricsManager *metrics.SBOMetricsManager, dataToBeSavedChannel chan *metrics.SBOMetricWindowDataToBeSaved, sbodb db.SBOStorage) {
+	if len(positions.groups) < 1 || time.Since(positions.lastSaved) < CHECKPOINT_SAVE_INTERVAL {
+		return
+	}
+	positions.lastSaved = time.Now()
+	//metrics of keys which did not receive values for a while would delay saving positions for a long time
+	metricsManager.SaveClosedTimeWindows(positions.filePath, dataToBeSavedChannel)
+	if positions.commit(metricsManager.OldestUnsavedTimeWindow(positions.filePath)) < 1 {
+		return
+	}
+	saveProgress := positions.progressTracker.progressSaver()
+	saveCheckpoint := positions.checkpointer.checkpointSaver()
+	dataToBeSavedChannel <- &metrics.SBOMetricWindowDataToBeSaved{FilePath: positions.filePath, OnQueued: func() {
+		if saveProgress != nil {
+			saveProgress()
+		}
+		if saveCheckpoint != nil {
+			afterQueuedRowsSaved(sbodb, saveCheckpoint)
+		}
+	}}
+}
+
+// callback is called after rows queued before it were saved, immediately if rows are not queued
+func afterQueuedRowsSaved(sbodb db.SBOStorage, callback func()) {
+	if batchWriter, ok := sbodb.(*db.SBOBatchWriter); ok {
+		batchWriter.AfterQueuedRowsSaved(callback)
+		return
+	}
+	callback()
+}
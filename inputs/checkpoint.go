@@ -0,0 +1,190 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// only this many bytes are read to find the first line of a file
+const FIRST_LINE_MAX_LENGTH int = 4096
+
+/*
+Identifies a file independent of its name, so rotated (renamed) files can be recognized.
+Device and Inode are 0 on platforms where they are not available.
+FirstLineHash is empty when the first line is not complete yet, e.g for an empty file
+*/
+type FileIdentity struct {
+	Device        uint64
+	Inode         uint64
+	FirstLineHash string
+}
+
+/*
+Returns true if both identities belong to the same file. Inode numbers are reused after files are deleted,
+so the first line hash must match too, unless the first line of one of the files is not known
+*/
+func (identity *FileIdentity) SameFileAs(other *FileIdentity) bool {
+	if identity == nil || other == nil {
+		return false
+	}
+	if identity.Device != other.Device || identity.Inode != other.Inode {
+		return false
+	}
+	if identity.Inode == 0 && (len(identity.FirstLineHash) < 1 || len(other.FirstLineHash) < 1) {
+		//nothing to compare
+		return false
+	}
+	return len(identity.FirstLineHash) < 1 || len(other.FirstLineHash) < 1 || identity.FirstLineHash == other.FirstLineHash
+}
+
+// Returns the hash of the first line in data, or an empty string if data doesn't contain a complete line
+func HashFirstLine(data []byte) string {
+	firstLine, _, found := bytes.Cut(data, []byte{'\n'})
+	if !found {
+		return ""
+	}
+	hash := sha256.Sum256(firstLine)
+	return hex.EncodeToString(hash[:])
+}
+
+/*
+Returns the identity of an opened, uncompressed file. The first line is read using ReadAt, i.e the current offset is not changed
+*/
+func GetFileIdentity(file *os.File) (*FileIdentity, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, FIRST_LINE_MAX_LENGTH)
+	bytesRead, err := file.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return NewFileIdentity(fileInfo, header[:bytesRead]), nil
+}
+
+// header must contain the beginning of the (decompressed) file, see FIRST_LINE_MAX_LENGTH
+func NewFileIdentity(fileInfo fs.FileInfo, header []byte) *FileIdentity {
+	device, inode := deviceAndInode(fileInfo)
+	return &FileIdentity{Device: device, Inode: inode, FirstLineHash: HashFirstLine(header)}
+}
+
+/*
+Searches for the rotated version of filePath, i.e a file named like filePath.1 or filePath-20250101 in the same directory,
+which has the given identity. Returns an empty string if not found. Rotated files which were compressed can't be found,
+compressing creates a new file
+*/
+func FindRotatedFile(filePath string, identity *FileIdentity) string {
+	if identity == nil || identity.Inode == 0 {
+		return ""
+	}
+	candidates, _ := filepath.Glob(filepath.Clean(filePath) + "*")
+	for _, candidate := range candidates {
+		if candidate == filepath.Clean(filePath) {
+			continue
+		}
+		file, err := os.Open(candidate)
+		if err != nil {
+			continue
+		}
+		candidateIdentity, err := GetFileIdentity(file)
+		file.Close()
+		if err == nil && candidateIdentity.SameFileAs(identity) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+/*
+Read position in a file. Offset is the byte offset (in decompressed data for compressed files) of the first line
+which was not processed yet
+*/
+type FileCheckpoint struct {
+	FileIdentity
+	Offset        int64
+	LastTimestamp time.Time
+	Updated       time.Time
+}
+
+/*
+Checkpoints for multiple files, kept in memory and saved into a local json file, keyed by the file path used in the configuration.
+Safe for concurrent use
+*/
+type CheckpointStore struct {
+	stateFilePath string
+	syncMutex     sync.Mutex
+	checkpoints   map[string]FileCheckpoint
+}
+
+// Loads checkpoints from stateFilePath. It's not an error if the file doesn't exist yet
+func LoadCheckpointStore(stateFilePath string) (*CheckpointStore, error) {
+	store := &CheckpointStore{stateFilePath: stateFilePath, checkpoints: make(map[string]FileCheckpoint)}
+	data, err := os.ReadFile(stateFilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return store, err
+	}
+	if err = json.Unmarshal(data, &store.checkpoints); err != nil {
+		return store, err
+	}
+	return store, nil
+}
+
+func (store *CheckpointStore) Get(filePath string) (FileCheckpoint, bool) {
+	store.syncMutex.Lock()
+	defer store.syncMutex.Unlock()
+	checkpoint, ok := store.checkpoints[filePath]
+	return checkpoint, ok
+}
+
+func (store *CheckpointStore) Set(filePath string, checkpoint FileCheckpoint) {
+	store.syncMutex.Lock()
+	defer store.syncMutex.Unlock()
+	store.checkpoints[filePath] = checkpoint
+}
+
+// Saves all checkpoints. Data is written into a temporary file first, so a crash while saving doesn't corrupt the state file
+func (store *CheckpointStore) Save() error {
+	store.syncMutex.Lock()
+	defer store.syncMutex.Unlock()
+	data, err := json.MarshalIndent(store.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempFilePath := store.stateFilePath + ".tmp"
+	if err = os.WriteFile(tempFilePath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempFilePath, store.stateFilePath)
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointStoreSaveAndLoad(t *testing.T) {
+	stateFilePath := filepath.Join(t.TempDir(), "checkpoints.json")
+	store, err := LoadCheckpointStore(stateFilePath)
+	if err != nil {
+		t.Fatalf("LoadCheckpointStore failed for a missing file: %v", err)
+	}
+	if _, ok := store.Get("/var/log/access.log"); ok {
+		t.Errorf("Expected no checkpoint in a new store")
+	}
+	checkpoint := FileCheckpoint{
+		FileIdentity:  FileIdentity{Device: 1, Inode: 2, FirstLineHash: HashFirstLine([]byte("first\nsecond\n"))},
+		Offset:        123,
+		LastTimestamp: time.Date(2025, 7, 2, 11, 21, 0, 0, time.UTC)}
+	store.Set("/var/log/access.log", checkpoint)
+	if err = store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loadedStore, err := LoadCheckpointStore(stateFilePath)
+	if err != nil {
+		t.Fatalf("LoadCheckpointStore failed: %v", err)
+	}
+	loaded, ok := loadedStore.Get("/var/log/access.log")
+	if !ok || loaded.Offset != 123 || !loaded.LastTimestamp.Equal(checkpoint.LastTimestamp) || !loaded.SameFileAs(&checkpoint.FileIdentity) {
+		t.Errorf("Unexpected loaded checkpoint %v", loaded)
+	}
+}
+
+func TestFileIdentity(t *testing.T) {
+	if HashFirstLine([]byte("incomplete line")) != "" {
+		t.Errorf("Expected empty hash for an incomplete line")
+	}
+	identity := &FileIdentity{Device: 1, Inode: 2, FirstLineHash: HashFirstLine([]byte("a\nb\n"))}
+	if !identity.SameFileAs(&FileIdentity{Device: 1, Inode: 2, FirstLineHash: HashFirstLine([]byte("a\nc\n"))}) {
+		t.Errorf("Expected same file when only later lines differ")
+	}
+	if identity.SameFileAs(&FileIdentity{Device: 1, Inode: 2, FirstLineHash: HashFirstLine([]byte("x\n"))}) {
+		t.Errorf("Expected different files when first lines differ, i.e inode was reused")
+	}
+	if identity.SameFileAs(&FileIdentity{Device: 1, Inode: 3, FirstLineHash: identity.FirstLineHash}) {
+		t.Errorf("Expected different files when inodes differ")
+	}
+	if identity.SameFileAs(nil) {
+		t.Errorf("Expected different files for nil")
+	}
+}
+
+func TestFindRotatedFile(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "access.log")
+	os.WriteFile(filePath, []byte("line 1\nline 2\n"), 0644)
+	file, _ := os.Open(filePath)
+	identity, err := GetFileIdentity(file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("GetFileIdentity failed: %v", err)
+	}
+	if identity.Inode == 0 {
+		t.Skip("Inode numbers are not available on this platform")
+	}
+
+	os.Rename(filePath, filePath+".1")
+	os.WriteFile(filePath, []byte("line 3\n"), 0644)
+	if rotatedFilePath := FindRotatedFile(filePath, identity); rotatedFilePath != filePath+".1" {
+		t.Errorf("Expected rotated file %v got %v", filePath+".1", rotatedFilePath)
+	}
+	os.Remove(filePath + ".1")
+	if rotatedFilePath := FindRotatedFile(filePath, identity); rotatedFilePath != "" {
+		t.Errorf("Expected no rotated file, got %v", rotatedFilePath)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	COMPRESSION_NONE  string = ""
+	COMPRESSION_GZIP  string = "gzip"
+	COMPRESSION_BZIP2 string = "bzip2"
+	COMPRESSION_ZSTD  string = "zstd"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+/*
+Detect compression from the magic bytes at the beginning of a file.
+Returns COMPRESSION_NONE if the header does not match a supported compression format
+*/
+func DetectCompression(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, magicGzip):
+		return COMPRESSION_GZIP
+	case bytes.HasPrefix(header, magicBzip2):
+		return COMPRESSION_BZIP2
+	case bytes.HasPrefix(header, magicZstd):
+		return COMPRESSION_ZSTD
+	}
+	return COMPRESSION_NONE
+}
+
+/*
+Returns a reader which decompresses data read from reader, when it starts with the magic bytes of a supported compression format.
+Otherwise returns reader itself with COMPRESSION_NONE. The returned reader must be closed when done.
+*/
+func NewDecompressingReader(reader *bufio.Reader) (io.ReadCloser, string, error) {
+	header, err := reader.Peek(len(magicZstd))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, COMPRESSION_NONE, err
+	}
+	compression := DetectCompression(header)
+	switch compression {
+	case COMPRESSION_GZIP:
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, compression, err
+		}
+		return gzipReader, compression, nil
+	case COMPRESSION_BZIP2:
+		return io.NopCloser(bzip2.NewReader(reader)), compression, nil
+	case COMPRESSION_ZSTD:
+		zstdDecoder, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, compression, err
+		}
+		return zstdDecoder.IOReadCloser(), compression, nil
+	}
+	return io.NopCloser(reader), COMPRESSION_NONE, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const compressionTestData = "line 1\nline 2\n"
+
+// compressionTestData compressed using bzip2, the standard library doesn't have a bzip2 writer
+var compressionTestDataBzip2 = []byte{0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x31, 0x88, 0x21, 0x68, 0x00, 0x00,
+	0x05, 0x59, 0x00, 0x00, 0x10, 0x40, 0x00, 0x30, 0x00, 0x02, 0x25, 0x20, 0x00, 0x31, 0x0c, 0x08, 0x12, 0x86, 0x46, 0x89,
+	0x31, 0x90, 0x87, 0x10, 0xf1, 0x77, 0x24, 0x53, 0x85, 0x09, 0x03, 0x18, 0x82, 0x16, 0x80}
+
+func readAllUsingDecompressingReader(t *testing.T, data []byte, expectedCompression string) {
+	decompressor, compression, err := NewDecompressingReader(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("NewDecompressingReader failed for %v: %v", expectedCompression, err)
+	}
+	defer decompressor.Close()
+	if compression != expectedCompression {
+		t.Errorf("Expected compression %v got %v", expectedCompression, compression)
+	}
+	decompressed, err := io.ReadAll(decompressor)
+	if err != nil {
+		t.Fatalf("Read failed for %v: %v", expectedCompression, err)
+	}
+	if string(decompressed) != compressionTestData {
+		t.Errorf("Unexpected data for %v: %v", expectedCompression, string(decompressed))
+	}
+}
+
+func TestNewDecompressingReader(t *testing.T) {
+	readAllUsingDecompressingReader(t, []byte(compressionTestData), COMPRESSION_NONE)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write([]byte(compressionTestData))
+	gzipWriter.Close()
+	readAllUsingDecompressingReader(t, gzipped.Bytes(), COMPRESSION_GZIP)
+
+	readAllUsingDecompressingReader(t, compressionTestDataBzip2, COMPRESSION_BZIP2)
+
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	zstdCompressed := zstdEncoder.EncodeAll([]byte(compressionTestData), nil)
+	zstdEncoder.Close()
+	readAllUsingDecompressingReader(t, zstdCompressed, COMPRESSION_ZSTD)
+}
+
+func TestNewDecompressingReaderShortInput(t *testing.T) {
+	//inputs shorter than the longest magic byte sequence must not fail
+	for _, input := range []string{"", "a\n"} {
+		decompressor, compression, err := NewDecompressingReader(bufio.NewReader(bytes.NewReader([]byte(input))))
+		if err != nil || compression != COMPRESSION_NONE {
+			t.Fatalf("Unexpected result for short input %v %v", compression, err)
+		}
+		decompressed, _ := io.ReadAll(decompressor)
+		if string(decompressed) != input {
+			t.Errorf("Unexpected data for short input %v", string(decompressed))
+		}
+		decompressor.Close()
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+/*
+Container log files wrap lines written by containers to stdout/stderr in envelopes:
+  - docker json-file driver, e.g /var/lib/docker/containers/<id>/<id>-json.log:
+    {"log":"a line\n","stream":"stdout","time":"2025-07-01T10:00:00.000000001Z"}
+    Lines longer than 16KB are split, all parts except the last one don't end with a newline.
+  - CRI (containerd, cri-o, kubernetes), e.g /var/log/pods/<namespace>_<pod>_<uid>/<container>/0.log:
+    2025-07-01T10:00:00.000000001Z stdout F a line
+    P instead of F marks a partial line, which continues in the next line for the same stream.
+*/
+
+const (
+	CONTAINER_LOG_FORMAT_NONE   string = ""
+	CONTAINER_LOG_FORMAT_DOCKER string = "docker"
+	CONTAINER_LOG_FORMAT_CRI    string = "cri"
+	// docker or cri, detected for each line
+	CONTAINER_LOG_FORMAT_AUTO string = "auto"
+
+	CONTAINER_LOG_STREAM_STDOUT string = "stdout"
+	CONTAINER_LOG_STREAM_STDERR string = "stderr"
+
+	// partial lines are not joined beyond this length, the rest of the line is dropped
+	CONTAINER_LOG_MAX_LINE_LENGTH int = 1024 * 1024
+)
+
+var errInvalidContainerLogLine = errors.New("invalid container log line")
+
+func IsValidContainerLogFormat(format string) bool {
+	switch format {
+	case CONTAINER_LOG_FORMAT_NONE, CONTAINER_LOG_FORMAT_DOCKER, CONTAINER_LOG_FORMAT_CRI, CONTAINER_LOG_FORMAT_AUTO:
+		return true
+	}
+	return false
+}
+
+// empty means all streams
+func IsValidContainerLogStream(stream string) bool {
+	switch stream {
+	case "", CONTAINER_LOG_STREAM_STDOUT, CONTAINER_LOG_STREAM_STDERR:
+		return true
+	}
+	return false
+}
+
+type ContainerLogEntry struct {
+	Stream    string
+	Timestamp time.Time
+	Text      string
+	//false when the line continues in the next entry for the same stream
+	Complete bool
+}
+
+type dockerJsonLogLine struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// Parses a line written by the docker json-file logging driver
+func ParseDockerJsonLogLine(line string) (*ContainerLogEntry, error) {
+	var jsonLine dockerJsonLogLine
+	if err := json.Unmarshal([]byte(line), &jsonLine); err != nil {
+		return nil, err
+	}
+	if len(jsonLine.Stream) < 1 {
+		return nil, errInvalidContainerLogLine
+	}
+	entry := &ContainerLogEntry{Stream: jsonLine.Stream}
+	entry.Timestamp, _ = time.Parse(time.RFC3339Nano, jsonLine.Time)
+	entry.Text, entry.Complete = strings.CutSuffix(jsonLine.Log, "\n")
+	entry.Text = strings.TrimSuffix(entry.Text, "\r")
+	return entry, nil
+}
+
+// Parses a line in CRI logging format, i.e <timestamp> <stream> <tags> <text> where tags is F (full) or P (partial), possibly followed by other tags separated using ':'
+func ParseCRILogLine(line string) (*ContainerLogEntry, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 {
+		return nil, errInvalidContainerLogLine
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, errInvalidContainerLogLine
+	}
+	if fields[1] != CONTAINER_LOG_STREAM_STDOUT && fields[1] != CONTAINER_LOG_STREAM_STDERR {
+		return nil, errInvalidContainerLogLine
+	}
+	entry := &ContainerLogEntry{Stream: fields[1], Timestamp: timestamp}
+	tag, _, _ := strings.Cut(fields[2], ":")
+	switch tag {
+	case "F":
+		entry.Complete = true
+	case "P":
+		entry.Complete = false
+	default:
+		return nil, errInvalidContainerLogLine
+	}
+	if len(fields) > 3 {
+		entry.Text = fields[3]
+	}
+	return entry, nil
+}
+
+/*
+Unwraps container log lines and joins partial lines. Not safe for concurrent use, each file must have its own instance.
+*/
+type ContainerLogUnwrapper struct {
+	format string
+	//only lines written to this stream are returned, empty for all streams
+	stream string
+	//stream => text of partial lines seen so far
+	partialLines map[string]*strings.Builder
+}
+
+func NewContainerLogUnwrapper(format string, stream string) *ContainerLogUnwrapper {
+	return &ContainerLogUnwrapper{
+		format:       format,
+		stream:       stream,
+		partialLines: make(map[string]*strings.Builder)}
+}
+
+/*
+Returns the line written by the container and true when line completes a line, i.e it's a full line or the last part of a partial line.
+Returns false for partial lines and for lines written to other streams.
+*/
+func (unwrapper *ContainerLogUnwrapper) Unwrap(line string) (string, bool, error) {
+	var entry *ContainerLogEntry
+	var err error
+	switch unwrapper.format {
+	case CONTAINER_LOG_FORMAT_DOCKER:
+		entry, err = ParseDockerJsonLogLine(line)
+	case CONTAINER_LOG_FORMAT_CRI:
+		entry, err = ParseCRILogLine(line)
+	default:
+		if strings.HasPrefix(line, "{") {
+			entry, err = ParseDockerJsonLogLine(line)
+		} else {
+			entry, err = ParseCRILogLine(line)
+		}
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if len(unwrapper.stream) > 0 && entry.Stream != unwrapper.stream {
+		return "", false, nil
+	}
+
+	partialLine, hasPartialLine := unwrapper.partialLines[entry.Stream]
+	if !entry.Complete {
+		if !hasPartialLine {
+			partialLine = &strings.Builder{}
+			unwrapper.partialLines[entry.Stream] = partialLine
+		}
+		if partialLine.Len()+len(entry.Text) <= CONTAINER_LOG_MAX_LINE_LENGTH {
+			partialLine.WriteString(entry.Text)
+		}
+		return "", false, nil
+	}
+	if hasPartialLine {
+		delete(unwrapper.partialLines, entry.Stream)
+		if partialLine.Len()+len(entry.Text) <= CONTAINER_LOG_MAX_LINE_LENGTH {
+			partialLine.WriteString(entry.Text)
+		}
+		return partialLine.String(), true, nil
+	}
+	return entry.Text, true, nil
+}
+
+// true when partial lines were seen but not completed yet
+func (unwrapper *ContainerLogUnwrapper) HasPartialLines() bool {
+	return len(unwrapper.partialLines) > 0
+}
+
+var dockerContainerIdRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// <pod>_<namespace>_<container>-<container id>.log
+var criContainerLogFileRegex = regexp.MustCompile(`^[^_]+_[^_]+_(.+)-([0-9a-f]{64})\.log`)
+
+/*
+Finds the container id and name using the path of a container log file, see the comments at the top of this file for supported paths.
+For docker, the name is read from config.v2.json in the directory of the log file and it's empty if the file can't be read.
+For CRI log files, id is empty for /var/log/pods/ paths.
+*/
+func ContainerInfoFromLogPath(filePath string) (id string, name string) {
+	directory := filepath.Dir(filePath)
+	fileName := filepath.Base(filePath)
+	if directoryName := filepath.Base(directory); dockerContainerIdRegex.MatchString(directoryName) && strings.HasPrefix(fileName, directoryName+"-json.log") {
+		return directoryName, readDockerContainerName(directory)
+	}
+	if matches := criContainerLogFileRegex.FindStringSubmatch(fileName); matches != nil {
+		return matches[2], matches[1]
+	}
+	//e.g /var/log/pods/<namespace>_<pod>_<uid>/<container>/0.log, rotated files are like 0.log.20250701-100000
+	if strings.Count(filepath.Base(filepath.Dir(directory)), "_") >= 2 {
+		return "", filepath.Base(directory)
+	}
+	return "", ""
+}
+
+func readDockerContainerName(containerDirectory string) string {
+	configBytes, err := os.ReadFile(filepath.Join(containerDirectory, "config.v2.json"))
+	if err != nil {
+		return ""
+	}
+	var containerConfig struct {
+		Name string
+	}
+	if json.Unmarshal(configBytes, &containerConfig) != nil {
+		return ""
+	}
+	return strings.TrimPrefix(containerConfig.Name, "/")
+}
+
+/*
+Returns the container name, or the short container id if the name is not known, to be used as domain name. Empty if neither is known
+*/
+func ContainerDomainNameFromLogPath(filePath string) string {
+	id, name := ContainerInfoFromLogPath(filePath)
+	if len(name) > 0 {
+		return name
+	}
+	if len(id) >= 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const containerTestLogLine = `172.17.0.1 - - [01/Jul/2025:10:00:00 +0000] "GET / HTTP/1.1" 200 615 "-" "curl/8.5.0" "-"`
+
+func TestParseDockerJsonLogLine(t *testing.T) {
+	entry, err := ParseDockerJsonLogLine(`{"log":"` + strings.ReplaceAll(containerTestLogLine, `"`, `\"`) + `\n","stream":"stdout","time":"2025-07-01T10:00:00.123456789Z"}`)
+	if err != nil {
+		t.Fatalf("ParseDockerJsonLogLine failed: %v", err)
+	}
+	if entry.Text != containerTestLogLine || entry.Stream != CONTAINER_LOG_STREAM_STDOUT || !entry.Complete || entry.Timestamp.Nanosecond() != 123456789 {
+		t.Errorf("Unexpected result %+v", entry)
+	}
+	entry, _ = ParseDockerJsonLogLine(`{"log":"partial","stream":"stderr","time":"2025-07-01T10:00:00Z"}`)
+	if entry.Complete || entry.Stream != CONTAINER_LOG_STREAM_STDERR {
+		t.Errorf("Expected a partial stderr line, got %+v", entry)
+	}
+	for _, line := range []string{"", "{", `{"log":"x"}`, containerTestLogLine} {
+		if _, err := ParseDockerJsonLogLine(line); err == nil {
+			t.Errorf("ParseDockerJsonLogLine(%q) should fail", line)
+		}
+	}
+}
+
+func TestParseCRILogLine(t *testing.T) {
+	entry, err := ParseCRILogLine("2025-07-01T10:00:00.123456789+00:00 stdout F " + containerTestLogLine)
+	if err != nil {
+		t.Fatalf("ParseCRILogLine failed: %v", err)
+	}
+	if entry.Text != containerTestLogLine || !entry.Complete || entry.Stream != CONTAINER_LOG_STREAM_STDOUT {
+		t.Errorf("Unexpected result %+v", entry)
+	}
+	entry, _ = ParseCRILogLine("2025-07-01T10:00:00Z stderr P:x part")
+	if entry.Complete || entry.Text != "part" {
+		t.Errorf("Expected a partial line, got %+v", entry)
+	}
+	entry, _ = ParseCRILogLine("2025-07-01T10:00:00Z stdout F")
+	if entry == nil || entry.Text != "" {
+		t.Errorf("Expected an empty line, got %+v", entry)
+	}
+	for _, line := range []string{"", "x stdout F a", "2025-07-01T10:00:00Z other F a", "2025-07-01T10:00:00Z stdout X a", containerTestLogLine} {
+		if _, err := ParseCRILogLine(line); err == nil {
+			t.Errorf("ParseCRILogLine(%q) should fail", line)
+		}
+	}
+}
+
+func TestContainerLogUnwrapperJoinsPartialLines(t *testing.T) {
+	tests := map[string][]string{
+		CONTAINER_LOG_FORMAT_DOCKER: {
+			`{"log":"172.17.0.1 - - [01/Jul/2025:10:00:00 +0000] ","stream":"stdout","time":"2025-07-01T10:00:00Z"}`,
+			`{"log":"error","stream":"stderr","time":"2025-07-01T10:00:00Z"}`,
+			`{"log":"\"GET / HTTP/1.1\" 200 615 \"-\" \"curl/8.5.0\" \"-\"\n","stream":"stdout","time":"2025-07-01T10:00:00Z"}`,
+		},
+		CONTAINER_LOG_FORMAT_CRI: {
+			"2025-07-01T10:00:00Z stdout P 172.17.0.1 - - [01/Jul/2025:10:00:00 +0000] ",
+			"2025-07-01T10:00:00Z stderr F error",
+			`2025-07-01T10:00:00Z stdout F "GET / HTTP/1.1" 200 615 "-" "curl/8.5.0" "-"`,
+		},
+	}
+	for format, lines := range tests {
+		for _, unwrapperFormat := range []string{format, CONTAINER_LOG_FORMAT_AUTO} {
+			unwrapper := NewContainerLogUnwrapper(unwrapperFormat, CONTAINER_LOG_STREAM_STDOUT)
+			completeLines := make([]string, 0)
+			for _, line := range lines {
+				text, complete, err := unwrapper.Unwrap(line)
+				if err != nil {
+					t.Fatalf("Unwrap(%q) failed: %v", line, err)
+				}
+				if complete {
+					completeLines = append(completeLines, text)
+				} else if !unwrapper.HasPartialLines() {
+					t.Errorf("Expected a partial line after %q", line)
+				}
+			}
+			if len(completeLines) != 1 || completeLines[0] != containerTestLogLine || unwrapper.HasPartialLines() {
+				t.Errorf("Unexpected lines for %v: %q", unwrapperFormat, completeLines)
+			}
+		}
+	}
+}
+
+func TestIsValidContainerLogFormatAndStream(t *testing.T) {
+	for _, format := range []string{"", "docker", "cri", "auto"} {
+		if !IsValidContainerLogFormat(format) {
+			t.Errorf("Valid format %q was rejected", format)
+		}
+	}
+	if IsValidContainerLogFormat("Docker") {
+		t.Error("Invalid format was accepted")
+	}
+	for _, stream := range []string{"", "stdout", "stderr"} {
+		if !IsValidContainerLogStream(stream) {
+			t.Errorf("Valid stream %q was rejected", stream)
+		}
+	}
+	for _, stream := range []string{"stdOut", "out", "both"} {
+		if IsValidContainerLogStream(stream) {
+			t.Errorf("Invalid stream %q was accepted", stream)
+		}
+	}
+}
+
+func TestContainerInfoFromLogPath(t *testing.T) {
+	containerId := strings.Repeat("0123456789abcdef", 4)
+	containerDirectory := filepath.Join(t.TempDir(), containerId)
+	os.Mkdir(containerDirectory, 0755)
+	dockerLogPath := filepath.Join(containerDirectory, containerId+"-json.log")
+	if domainName := ContainerDomainNameFromLogPath(dockerLogPath); domainName != containerId[:12] {
+		t.Errorf("Expected short container id without config.v2.json, got %q", domainName)
+	}
+	os.WriteFile(filepath.Join(containerDirectory, "config.v2.json"), []byte(`{"ID":"`+containerId+`","Name":"/web"}`), 0644)
+
+	tests := []struct {
+		filePath string
+		id       string
+		name     string
+	}{
+		{dockerLogPath, containerId, "web"},
+		{dockerLogPath + ".1", containerId, "web"},
+		{"/var/log/containers/nginx-7d9f_default_nginx-" + containerId + ".log", containerId, "nginx"},
+		{"/var/log/pods/default_nginx-7d9f_1234-5678/nginx/0.log", "", "nginx"},
+		{"/var/log/pods/default_nginx-7d9f_1234-5678/nginx/0.log.20250701-100000.gz", "", "nginx"},
+		{"/var/log/nginx/access.log", "", ""},
+	}
+	for _, test := range tests {
+		id, name := ContainerInfoFromLogPath(test.filePath)
+		if id != test.id || name != test.name {
+			t.Errorf("ContainerInfoFromLogPath(%v) expected %v %v got %v %v", test.filePath, test.id, test.name, id, name)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+/*
+A file path pattern, e.g /var/log/nginx/*-access.log, supporting the wildcards of filepath.Match (*, ? and [...]).
+A part of the pattern can be enclosed in parentheses to capture it, e.g /var/log/nginx/(*)-access.log,
+the captured part of a matching file path (e.g example.com for /var/log/nginx/example.com-access.log) can be used as the domain name.
+*/
+type FilePathPattern struct {
+	Pattern string
+	// pattern without parentheses, usable with filepath.Glob and filepath.Match
+	GlobPattern string
+	regex       *regexp.Regexp
+	// directories below the last directory without wildcards which may contain matching files, e.g /logs/* and /logs/*/nginx
+	// for /logs/*/nginx/*.log, see MatchesDirectory
+	directoryRegexes []*regexp.Regexp
+}
+
+// Returns true if filePath contains any wildcards, i.e it's not a plain file path. Parentheses are allowed in plain file paths
+func IsFilePathPattern(filePath string) bool {
+	return strings.ContainsAny(filePath, "*?[")
+}
+
+func NewFilePathPattern(pattern string) (*FilePathPattern, error) {
+	globPattern := strings.NewReplacer("(", "", ")", "").Replace(pattern)
+	//validate glob syntax
+	if _, err := filepath.Match(globPattern, ""); err != nil {
+		return nil, err
+	}
+	regex, err := regexp.Compile("^" + globToRegex(filepath.Clean(pattern)) + "$")
+	if err != nil {
+		return nil, err
+	}
+	fpp := &FilePathPattern{Pattern: pattern, GlobPattern: globPattern, regex: regex}
+	directoryPatterns := fpp.directoryPatterns()
+	for _, directoryPattern := range directoryPatterns[1:] {
+		directoryRegex, err := regexp.Compile("^" + globToRegex(directoryPattern) + "$")
+		if err != nil {
+			return nil, err
+		}
+		fpp.directoryRegexes = append(fpp.directoryRegexes, directoryRegex)
+	}
+	return fpp, nil
+}
+
+// Returns the last directory of the pattern without wildcards followed by the patterns of its subdirectories down to the directory
+// part of the pattern, e.g /logs, /logs/* and /logs/*/nginx for /logs/*/nginx/*.log. Only the directory is returned if it has no wildcards
+func (fpp *FilePathPattern) directoryPatterns() []string {
+	dirPattern := filepath.Dir(filepath.Clean(fpp.GlobPattern))
+	parts := strings.Split(dirPattern, string(filepath.Separator))
+	firstPatternPart := slices.IndexFunc(parts, IsFilePathPattern)
+	if firstPatternPart < 0 {
+		return []string{dirPattern}
+	}
+	baseDirectory := strings.Join(parts[:firstPatternPart], string(filepath.Separator))
+	if len(baseDirectory) < 1 {
+		baseDirectory = string(filepath.Separator)
+	}
+	directoryPatterns := []string{baseDirectory}
+	for index := firstPatternPart; index < len(parts); index++ {
+		directoryPatterns = append(directoryPatterns, filepath.Join(baseDirectory, strings.Join(parts[firstPatternPart:index+1], string(filepath.Separator))))
+	}
+	return directoryPatterns
+}
+
+func globToRegex(pattern string) string {
+	var regexBuilder strings.Builder
+	inCharClass := false
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		if inCharClass {
+			switch {
+			case ch == ']':
+				inCharClass = false
+				regexBuilder.WriteByte(ch)
+			case ch == '\\' && i+1 < len(pattern):
+				i++
+				regexBuilder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			default:
+				regexBuilder.WriteByte(ch)
+			}
+			continue
+		}
+		switch ch {
+		case '*':
+			regexBuilder.WriteString(`[^/]*`)
+		case '?':
+			regexBuilder.WriteString(`[^/]`)
+		case '[':
+			inCharClass = true
+			regexBuilder.WriteByte('[')
+			if i+1 < len(pattern) && (pattern[i+1] == '^' || pattern[i+1] == '!') {
+				i++
+				regexBuilder.WriteByte('^')
+			}
+		case '(', ')':
+			regexBuilder.WriteByte(ch)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				regexBuilder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			regexBuilder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	return regexBuilder.String()
+}
+
+// Returns matching files, directories are ignored
+func (fpp *FilePathPattern) Expand() ([]string, error) {
+	matches, err := filepath.Glob(fpp.GlobPattern)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if !fpp.Matches(match) {
+			continue
+		}
+		if fileInfo, err := os.Stat(match); err == nil && !fileInfo.IsDir() {
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+func (fpp *FilePathPattern) Matches(filePath string) bool {
+	return fpp.regex.MatchString(filepath.Clean(filePath))
+}
+
+/*
+Returns the part of filePath captured by the first parenthesized part of the pattern.
+Returns an empty string if there is no match or the pattern doesn't have a capture group
+*/
+func (fpp *FilePathPattern) Capture(filePath string) string {
+	submatches := fpp.regex.FindStringSubmatch(filepath.Clean(filePath))
+	if len(submatches) < 2 {
+		return ""
+	}
+	return submatches[1]
+}
+
+// Returns the directories to watch for new matching files: the last directory of the pattern without wildcards and existing directories
+// below it which match the pattern, e.g /logs, /logs/a, /logs/a/nginx and /logs/b for /logs/*/nginx/*.log. Directories created later
+// can be checked using MatchesDirectory
+func (fpp *FilePathPattern) Directories() ([]string, error) {
+	directoryPatterns := fpp.directoryPatterns()
+	directories := []string{directoryPatterns[0]}
+	for _, directoryPattern := range directoryPatterns[1:] {
+		matches, err := filepath.Glob(directoryPattern)
+		if err != nil {
+			return directories, err
+		}
+		for _, match := range matches {
+			if fileInfo, err := os.Stat(match); err == nil && fileInfo.IsDir() {
+				directories = append(directories, match)
+			}
+		}
+	}
+	return directories, nil
+}
+
+/*
+Returns true if matching files, or directories containing them, may be created in directory, i.e it's one of the directories
+Directories returns when it exists. Always false for the last directory without wildcards, it's expected to exist
+*/
+func (fpp *FilePathPattern) MatchesDirectory(directory string) bool {
+	directory = filepath.Clean(directory)
+	for _, directoryRegex := range fpp.directoryRegexes {
+		if directoryRegex.MatchString(directory) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIsFilePathPattern(t *testing.T) {
+	tests := map[string]bool{
+		"/var/log/nginx/access.log":          false,
+		"/var/log/nginx/*-access.log":        true,
+		"/var/log/nginx/(*)-access.log":      true,
+		"/var/log/nginx/access.log.[0-9]":    true,
+		"/var/log/*/access.log":              true,
+		"/var/log/nginx/access?.log":         true,
+		"/var/log/nginx/example.com.log":     false,
+		"/var/log/nginx/example-com_ssl.log": false,
+		"/var/log/app (old)/access.log":      false,
+		"/var/log/(*)/access.log":            true,
+	}
+	for filePath, expected := range tests {
+		if IsFilePathPattern(filePath) != expected {
+			t.Errorf("IsFilePathPattern(%v) expected %v", filePath, expected)
+		}
+	}
+}
+
+func TestFilePathPatternMatchAndCapture(t *testing.T) {
+	fpp, err := NewFilePathPattern("/var/log/nginx/(*)-access.log")
+	if err != nil {
+		t.Fatalf("NewFilePathPattern failed: %v", err)
+	}
+	if fpp.GlobPattern != "/var/log/nginx/*-access.log" {
+		t.Errorf("Unexpected glob pattern %v", fpp.GlobPattern)
+	}
+	//file path => captured part, empty when the path must not match
+	matchTests := map[string]string{
+		"/var/log/nginx/example.com-access.log":     "example.com",
+		"/var/log/nginx/www.example.org-access.log": "www.example.org",
+		"/var/log/nginx/./example.com-access.log":   "example.com",
+		"/var/log/nginx/example(1).com-access.log":  "example(1).com",
+		"/var/log/nginx/example.com-access.log.1":   "",
+		"/var/log/nginx/example.com-access.log.gz":  "",
+		"/var/log/nginx/sub/example.com-access.log": "",
+		"/var/log/nginx/example.com-error.log":      "",
+		"/var/log/nginx/example.com-accessXlog":     "",
+		"/var/log/nginx-old/example.com-access.log": "",
+	}
+	for filePath, expectedCapture := range matchTests {
+		shouldMatch := len(expectedCapture) > 0
+		if fpp.Matches(filePath) != shouldMatch {
+			t.Errorf("Matches(%v) expected %v", filePath, shouldMatch)
+		}
+		if capture := fpp.Capture(filePath); capture != expectedCapture {
+			t.Errorf("Capture(%v) expected %v got %v", filePath, expectedCapture, capture)
+		}
+	}
+
+	fpp, _ = NewFilePathPattern("/var/log/apache2/access.log.[0-9]")
+	if !fpp.Matches("/var/log/apache2/access.log.1") || fpp.Matches("/var/log/apache2/access.log.a") {
+		t.Errorf("Unexpected character class match result")
+	}
+	if fpp.Capture("/var/log/apache2/access.log.1") != "" {
+		t.Errorf("Capture expected to be empty when there is no capture group")
+	}
+
+	if _, err = NewFilePathPattern("/var/log/[a-"); err == nil {
+		t.Errorf("Expected an error for an invalid pattern")
+	}
+}
+
+func TestFilePathPatternExpand(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.example.com-access.log", "b.example.com-access.log", "a.example.com-error.log"} {
+		os.WriteFile(filepath.Join(tempDir, name), []byte{}, 0644)
+	}
+	os.Mkdir(filepath.Join(tempDir, "dir-access.log"), 0755)
+
+	fpp, err := NewFilePathPattern(filepath.Join(tempDir, "(*)-access.log"))
+	if err != nil {
+		t.Fatalf("NewFilePathPattern failed: %v", err)
+	}
+	files, err := fpp.Expand()
+	if err != nil {
+		t.Fatalf("Expand failed: %v", err)
+	}
+	expected := []string{filepath.Join(tempDir, "a.example.com-access.log"), filepath.Join(tempDir, "b.example.com-access.log")}
+	if !slices.Equal(files, expected) {
+		t.Errorf("Expand expected %v got %v", expected, files)
+	}
+
+	directories, _ := fpp.Directories()
+	if !slices.Equal(directories, []string{tempDir}) {
+		t.Errorf("Directories expected %v got %v", tempDir, directories)
+	}
+}
+
+func TestFilePathPatternDirectories(t *testing.T) {
+	tempDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tempDir, "a", "nginx"), 0755)
+	os.MkdirAll(filepath.Join(tempDir, "b"), 0755)
+	os.WriteFile(filepath.Join(tempDir, "c"), []byte{}, 0644)
+
+	fpp, err := NewFilePathPattern(filepath.Join(tempDir, "(*)", "nginx", "*.log"))
+	if err != nil {
+		t.Fatalf("NewFilePathPattern failed: %v", err)
+	}
+	directories, err := fpp.Directories()
+	if err != nil {
+		t.Fatalf("Directories failed: %v", err)
+	}
+	expected := []string{tempDir, filepath.Join(tempDir, "a"), filepath.Join(tempDir, "b"), filepath.Join(tempDir, "a", "nginx")}
+	if !slices.Equal(directories, expected) {
+		t.Errorf("Directories expected %v got %v", expected, directories)
+	}
+
+	tests := map[string]bool{
+		tempDir:                                       false,
+		filepath.Join(tempDir, "new"):                 true,
+		filepath.Join(tempDir, "new", "nginx"):        true,
+		filepath.Join(tempDir, "new", "apache"):       false,
+		filepath.Join(tempDir, "new", "nginx", "old"): false,
+		filepath.Dir(tempDir):                         false,
+	}
+	for directory, expected := range tests {
+		if got := fpp.MatchesDirectory(directory); got != expected {
+			t.Errorf("MatchesDirectory(%q) expected %v got %v", directory, expected, got)
+		}
+	}
+}
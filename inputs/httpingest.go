@@ -0,0 +1,250 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HTTP_INGEST_PATH string = "/ingest"
+	// request bodies larger than this (after decompression) are rejected with 413
+	HTTP_INGEST_MAX_BODY_BYTES int64 = 32 * 1024 * 1024
+	// lines longer than this are rejected with 413
+	HTTP_INGEST_MAX_LINE_LENGTH int = 65536
+	// seconds, sent in Retry-After header with 429 responses
+	HTTP_INGEST_RETRY_AFTER_SECONDS string        = "1"
+	HTTP_INGEST_SHUTDOWN_TIMEOUT    time.Duration = 10 * time.Second
+)
+
+// returned by ingest handlers when there is no input for the source
+var ErrHttpIngestUnknownSource = errors.New("unknown source")
+
+// returned by ingest handlers when the line can't be accepted now, e.g the lines channel of the input is full
+var ErrHttpIngestBusy = errors.New("too many lines, try again later")
+
+/*
+Response body, Accepted is the number of lines accepted from the request.
+When a request is rejected with 429, lines after the first Accepted lines must be sent again.
+*/
+type HttpIngestResponse struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+/*
+Receives log lines pushed using HTTP POST requests to HTTP_INGEST_PATH?source=<source>.
+Request bodies contain newline delimited log lines and may be gzip compressed (Content-Encoding: gzip).
+Requests must have an Authorization: Bearer <token> header.
+
+handler is called for each line and must not block, it should return ErrHttpIngestBusy instead,
+so clients are told to slow down (HTTP 429) instead of buffering unlimited lines in memory.
+*/
+type HttpIngestServer struct {
+	address    string
+	token      string
+	handler    func(source string, line string) error
+	listener   net.Listener
+	httpServer *http.Server
+	//requests calling handler, Stop waits for them even if the http server could not shut down cleanly
+	activeRequests sync.WaitGroup
+	syncMutex      sync.Mutex
+	stopping       bool
+	stopped        chan struct{}
+}
+
+func NewHttpIngestServer(address string, token string, handler func(source string, line string) error) *HttpIngestServer {
+	server := &HttpIngestServer{
+		address: address,
+		token:   token,
+		handler: handler,
+		stopped: make(chan struct{})}
+	mux := http.NewServeMux()
+	mux.Handle(HTTP_INGEST_PATH, server)
+	server.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       5 * time.Minute}
+	return server
+}
+
+func (server *HttpIngestServer) Start() error {
+	if len(server.token) < 1 {
+		return errors.New("a token is required for http ingest")
+	}
+	var err error
+	server.listener, err = net.Listen("tcp", server.address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := server.httpServer.Serve(server.listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Http ingest server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Returns the address actually listened on, useful when the port is 0
+func (server *HttpIngestServer) Address() net.Addr {
+	if server.listener == nil {
+		return nil
+	}
+	return server.listener.Addr()
+}
+
+/*
+Stops listening and waits until active requests are completed, for up to HTTP_INGEST_SHUTDOWN_TIMEOUT.
+Connections are closed after the timeout and Stop waits until requests still running return, so handler is not called after Stopped is closed
+*/
+func (server *HttpIngestServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), HTTP_INGEST_SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("Http ingest server did not shut down cleanly", "error", err)
+		server.httpServer.Close()
+	}
+	server.syncMutex.Lock()
+	server.stopping = true
+	server.syncMutex.Unlock()
+	server.activeRequests.Wait()
+	close(server.stopped)
+}
+
+// returns false when stopping, i.e handler must not be called anymore. Otherwise activeRequests.Done must be called when the request is done
+func (server *HttpIngestServer) requestStarted() bool {
+	server.syncMutex.Lock()
+	defer server.syncMutex.Unlock()
+	if server.stopping {
+		return false
+	}
+	server.activeRequests.Add(1)
+	return true
+}
+
+// closed when Stop is done, i.e handler will not be called anymore
+func (server *HttpIngestServer) Stopped() <-chan struct{} {
+	return server.stopped
+}
+
+func (server *HttpIngestServer) isAuthorized(request *http.Request) bool {
+	token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(server.token)) == 1
+}
+
+func writeHttpIngestResponse(writer http.ResponseWriter, statusCode int, accepted int, errorMessage string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	json.NewEncoder(writer).Encode(HttpIngestResponse{Accepted: accepted, Error: errorMessage})
+}
+
+func (server *HttpIngestServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if !server.requestStarted() {
+		writeHttpIngestResponse(writer, http.StatusServiceUnavailable, 0, "shutting down")
+		return
+	}
+	defer server.activeRequests.Done()
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeHttpIngestResponse(writer, http.StatusMethodNotAllowed, 0, "only POST is supported")
+		return
+	}
+	if !server.isAuthorized(request) {
+		writer.Header().Set("WWW-Authenticate", "Bearer")
+		writeHttpIngestResponse(writer, http.StatusUnauthorized, 0, "invalid or missing bearer token")
+		return
+	}
+	source := request.URL.Query().Get("source")
+	if len(source) < 1 {
+		writeHttpIngestResponse(writer, http.StatusBadRequest, 0, "source parameter is required")
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(writer, request.Body, HTTP_INGEST_MAX_BODY_BYTES)
+	switch strings.ToLower(request.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			writeHttpIngestResponse(writer, http.StatusBadRequest, 0, "invalid gzip data")
+			return
+		}
+		defer gzipReader.Close()
+		//limit decompressed size too
+		body = io.LimitReader(gzipReader, HTTP_INGEST_MAX_BODY_BYTES+1)
+	default:
+		writeHttpIngestResponse(writer, http.StatusUnsupportedMediaType, 0, "unsupported Content-Encoding, only gzip is supported")
+		return
+	}
+
+	accepted := 0
+	var bytesRead int64 = 0
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 16384), HTTP_INGEST_MAX_LINE_LENGTH)
+	for scanner.Scan() {
+		bytesRead += int64(len(scanner.Bytes())) + 1
+		if bytesRead > HTTP_INGEST_MAX_BODY_BYTES+1 {
+			writeHttpIngestResponse(writer, http.StatusRequestEntityTooLarge, accepted, "request body is too large")
+			return
+		}
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) < 1 {
+			continue
+		}
+		err := server.handler(source, line)
+		if errors.Is(err, ErrHttpIngestUnknownSource) {
+			writeHttpIngestResponse(writer, http.StatusNotFound, accepted, err.Error())
+			return
+		}
+		if errors.Is(err, ErrHttpIngestBusy) {
+			writer.Header().Set("Retry-After", HTTP_INGEST_RETRY_AFTER_SECONDS)
+			writeHttpIngestResponse(writer, http.StatusTooManyRequests, accepted, err.Error())
+			return
+		}
+		if err != nil {
+			writeHttpIngestResponse(writer, http.StatusInternalServerError, accepted, err.Error())
+			return
+		}
+		accepted++
+	}
+	if err := scanner.Err(); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.Is(err, bufio.ErrTooLong) || errors.As(err, &maxBytesError) {
+			writeHttpIngestResponse(writer, http.StatusRequestEntityTooLarge, accepted, "request body or line is too large")
+			return
+		}
+		writeHttpIngestResponse(writer, http.StatusBadRequest, accepted, "error reading request body")
+		return
+	}
+	writeHttpIngestResponse(writer, http.StatusOK, accepted, "")
+}
@@ -0,0 +1,198 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accepts up to capacity lines for source "nginx"
+func newTestHttpIngestServer(capacity int) (*HttpIngestServer, chan string) {
+	lines := make(chan string, capacity)
+	server := NewHttpIngestServer("127.0.0.1:0", "secret", func(source string, line string) error {
+		if source != "nginx" {
+			return ErrHttpIngestUnknownSource
+		}
+		select {
+		case lines <- line:
+			return nil
+		default:
+			return ErrHttpIngestBusy
+		}
+	})
+	return server, lines
+}
+
+func doTestHttpIngestRequest(t *testing.T, server *HttpIngestServer, method string, url string, token string, contentEncoding string, body io.Reader) (int, HttpIngestResponse) {
+	request := httptest.NewRequest(method, url, body)
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	if len(contentEncoding) > 0 {
+		request.Header.Set("Content-Encoding", contentEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	var response HttpIngestResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response body %q: %v", recorder.Body.String(), err)
+	}
+	return recorder.Code, response
+}
+
+func TestHttpIngestAcceptsLines(t *testing.T) {
+	server, lines := newTestHttpIngestServer(10)
+	status, response := doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "", strings.NewReader("line 1\r\n\nline 2\nline 3"))
+	if status != http.StatusOK || response.Accepted != 3 || len(lines) != 3 {
+		t.Fatalf("Unexpected result %v %+v, %v lines", status, response, len(lines))
+	}
+	if line := <-lines; line != "line 1" {
+		t.Errorf("Unexpected line %q", line)
+	}
+}
+
+func TestHttpIngestGzip(t *testing.T) {
+	server, lines := newTestHttpIngestServer(10)
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write([]byte("line 1\nline 2\n"))
+	gzipWriter.Close()
+	status, response := doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "gzip", &compressed)
+	if status != http.StatusOK || response.Accepted != 2 || <-lines != "line 1" {
+		t.Errorf("Unexpected result %v %+v", status, response)
+	}
+	status, _ = doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "gzip", strings.NewReader("not gzip"))
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid gzip data, got %v", status)
+	}
+	status, _ = doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "br", strings.NewReader("x"))
+	if status != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for unsupported encoding, got %v", status)
+	}
+}
+
+func TestHttpIngestBackPressure(t *testing.T) {
+	server, _ := newTestHttpIngestServer(2)
+	request := httptest.NewRequest(http.MethodPost, "/ingest?source=nginx", strings.NewReader("a\nb\nc\nd\n"))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 429 with Retry-After, got %v %v", recorder.Code, recorder.Header())
+	}
+	var response HttpIngestResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.Accepted != 2 {
+		t.Errorf("Expected 2 accepted lines, got %+v", response)
+	}
+}
+
+func TestHttpIngestRejectedRequests(t *testing.T) {
+	server, lines := newTestHttpIngestServer(10)
+	tests := []struct {
+		method   string
+		url      string
+		token    string
+		expected int
+	}{
+		{http.MethodPost, "/ingest?source=nginx", "", http.StatusUnauthorized},
+		{http.MethodPost, "/ingest?source=nginx", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/ingest?source=nginx", "secret", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/ingest", "secret", http.StatusBadRequest},
+		{http.MethodPost, "/ingest?source=apache", "secret", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		status, _ := doTestHttpIngestRequest(t, server, test.method, test.url, test.token, "", strings.NewReader("line\n"))
+		if status != test.expected {
+			t.Errorf("Expected %v for %v %v token=%q, got %v", test.expected, test.method, test.url, test.token, status)
+		}
+	}
+	status, _ := doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "", strings.NewReader(strings.Repeat("x", HTTP_INGEST_MAX_LINE_LENGTH+1)))
+	if status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a long line, got %v", status)
+	}
+	if len(lines) != 0 {
+		t.Errorf("Rejected requests should not produce lines, got %v", len(lines))
+	}
+}
+
+func TestHttpIngestServerStartStop(t *testing.T) {
+	server, lines := newTestHttpIngestServer(10)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	request, _ := http.NewRequest(http.MethodPost, "http://"+server.Address().String()+HTTP_INGEST_PATH+"?source=nginx", strings.NewReader("line\n"))
+	request.Header.Set("Authorization", "Bearer secret")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || len(lines) != 1 {
+		t.Errorf("Unexpected status %v, %v lines", response.StatusCode, len(lines))
+	}
+	server.Stop()
+	<-server.Stopped()
+
+	if err := NewHttpIngestServer("127.0.0.1:0", "", nil).Start(); err == nil {
+		t.Errorf("Start should fail without a token")
+	}
+}
+
+func TestHttpIngestStopWaitsForActiveRequests(t *testing.T) {
+	handlerCalled := make(chan struct{})
+	release := make(chan struct{})
+	server := NewHttpIngestServer("127.0.0.1:0", "secret", func(source string, line string) error {
+		if line == "slow" {
+			close(handlerCalled)
+			<-release
+		}
+		return nil
+	})
+	requestDone := make(chan int)
+	go func() {
+		status, _ := doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "", strings.NewReader("slow\nnext\n"))
+		requestDone <- status
+	}()
+	<-handlerCalled
+	go server.Stop()
+	select {
+	case <-server.Stopped():
+		t.Fatal("Stopped was closed while a request was calling the handler")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if status := <-requestDone; status != http.StatusOK {
+		t.Errorf("Unexpected status %v", status)
+	}
+	<-server.Stopped()
+
+	if status, _ := doTestHttpIngestRequest(t, server, http.MethodPost, "/ingest?source=nginx", "secret", "", strings.NewReader("line\n")); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after Stop, got %v", status)
+	}
+}
@@ -0,0 +1,31 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+/*
+A line read from an input, passed from producers to consumers
+*/
+type LogLine struct {
+	Text string
+	//identity of the file the line was read from, nil when the line was not read from a regular file e.g stdin
+	Source *FileIdentity
+	//offset of the line after this line in the file, i.e where to resume from after this line is processed
+	Offset int64
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type rotatedFile struct {
+	filePath string
+	//rotation number for numbered files, e.g 2 for access.log.2.gz
+	number int
+	//date for files rotated using logrotate dateext option, e.g 20250101 for access.log-20250101.gz
+	date string
+}
+
+/*
+Returns rotated versions of filePath in chronological order, i.e oldest first. Supports logrotate naming conventions:
+numbered files (access.log.1, access.log.2.gz) where higher numbers are older and
+files with dates (access.log-20250101, access.log-2025010112.gz, access.log-2025-01-01.zst) which are ordered by date.
+Files rotated by kubelet (0.log.20250101-123456.gz) are treated as dated files.
+Compressed files (.gz, .bz2, .zst) are included. Dated files are assumed to be older than numbered files, if both exist
+*/
+func FindRotatedFiles(filePath string) ([]string, error) {
+	filePath = filepath.Clean(filePath)
+	rotatedFileRegex := regexp.MustCompile("^" + regexp.QuoteMeta(filepath.Base(filePath)) +
+		`(?:\.(\d{1,6})|-(\d{8}|\d{10}|\d{4}-\d{2}-\d{2})|\.(\d{8}-\d{6}))(?:\.gz|\.bz2|\.zst)?$`)
+	dirEntries, err := os.ReadDir(filepath.Dir(filePath))
+	if err != nil {
+		return nil, err
+	}
+	rotatedFiles := make([]rotatedFile, 0)
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		submatches := rotatedFileRegex.FindStringSubmatch(dirEntry.Name())
+		if submatches == nil {
+			continue
+		}
+		found := rotatedFile{filePath: filepath.Join(filepath.Dir(filePath), dirEntry.Name()), date: strings.ReplaceAll(submatches[2]+submatches[3], "-", "")}
+		if len(submatches[1]) > 0 {
+			found.number, _ = strconv.Atoi(submatches[1])
+		}
+		rotatedFiles = append(rotatedFiles, found)
+	}
+	slices.SortFunc(rotatedFiles, func(a, b rotatedFile) int {
+		switch {
+		case len(a.date) > 0 && len(b.date) > 0:
+			return strings.Compare(a.date, b.date)
+		case len(a.date) > 0:
+			return -1
+		case len(b.date) > 0:
+			return 1
+		}
+		//higher numbers are older
+		return b.number - a.number
+	})
+	rotatedFilePaths := make([]string, len(rotatedFiles))
+	for index, found := range rotatedFiles {
+		rotatedFilePaths[index] = found.filePath
+	}
+	return rotatedFilePaths, nil
+}
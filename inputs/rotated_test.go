@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFindRotatedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"access.log", "access.log.1", "access.log.2.gz", "access.log.10.gz", "access.log.3.bz2",
+		"access.log-20250102.gz", "access.log-20250101", "error.log.1", "access.log.1.tmp", "access.log.old", "other-access.log.1"} {
+		os.WriteFile(filepath.Join(tempDir, name), []byte{}, 0644)
+	}
+	rotatedFiles, err := FindRotatedFiles(filepath.Join(tempDir, "access.log"))
+	if err != nil {
+		t.Fatalf("FindRotatedFiles failed: %v", err)
+	}
+	expected := []string{"access.log-20250101", "access.log-20250102.gz", "access.log.10.gz", "access.log.3.bz2", "access.log.2.gz", "access.log.1"}
+	for index, name := range expected {
+		expected[index] = filepath.Join(tempDir, name)
+	}
+	if !slices.Equal(rotatedFiles, expected) {
+		t.Errorf("FindRotatedFiles expected %v got %v", expected, rotatedFiles)
+	}
+}
+
+func TestFindRotatedFilesKubelet(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"0.log", "0.log.20250701-100000.gz", "0.log.20250701-090000.gz", "0.log.20250701-110000", "1.log.20250701-080000"} {
+		os.WriteFile(filepath.Join(tempDir, name), []byte{}, 0644)
+	}
+	rotatedFiles, _ := FindRotatedFiles(filepath.Join(tempDir, "0.log"))
+	expected := []string{"0.log.20250701-090000.gz", "0.log.20250701-100000.gz", "0.log.20250701-110000"}
+	for index, name := range expected {
+		expected[index] = filepath.Join(tempDir, name)
+	}
+	if !slices.Equal(rotatedFiles, expected) {
+		t.Errorf("FindRotatedFiles expected %v got %v", expected, rotatedFiles)
+	}
+}
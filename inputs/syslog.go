@@ -0,0 +1,402 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SYSLOG_FORMAT_RFC3164 string = "rfc3164"
+	SYSLOG_FORMAT_RFC5424 string = "rfc5424"
+	// messages longer than this are truncated (udp) or cause the connection to be closed (tcp)
+	SYSLOG_MAX_MESSAGE_LENGTH int = 65536
+)
+
+var errSyslogMessageTooLong = errors.New("syslog message is too long")
+
+/*
+A syslog message. Tag is the program name for RFC3164 messages (e.g nginx for "nginx[123]: ...") and APP-NAME for RFC5424 messages
+*/
+type SyslogMessage struct {
+	Format    string
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	Tag       string
+	Message   string
+}
+
+var errInvalidSyslogMessage = errors.New("invalid syslog message")
+
+/*
+Parses an RFC5424 or RFC3164 (BSD) syslog message, without framing (see SyslogServer for framing)
+*/
+func ParseSyslogMessage(data []byte) (*SyslogMessage, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	if len(data) < 3 || data[0] != '<' {
+		return nil, errInvalidSyslogMessage
+	}
+	priEnd := bytes.IndexByte(data, '>')
+	if priEnd < 2 || priEnd > 4 {
+		return nil, errInvalidSyslogMessage
+	}
+	priority, err := strconv.Atoi(string(data[1:priEnd]))
+	if err != nil || priority > 191 {
+		return nil, errInvalidSyslogMessage
+	}
+	message := &SyslogMessage{Facility: priority / 8, Severity: priority % 8}
+	rest := string(data[priEnd+1:])
+	if strings.HasPrefix(rest, "1 ") {
+		message.Format = SYSLOG_FORMAT_RFC5424
+		return message, parseRFC5424(message, rest[2:])
+	}
+	message.Format = SYSLOG_FORMAT_RFC3164
+	parseRFC3164(message, rest)
+	return message, nil
+}
+
+// VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+func parseRFC5424(message *SyslogMessage, rest string) error {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 6 {
+		return errInvalidSyslogMessage
+	}
+	if fields[0] != "-" {
+		message.Timestamp, _ = time.Parse(time.RFC3339Nano, fields[0])
+	}
+	message.Hostname = nilValueToEmpty(fields[1])
+	message.Tag = nilValueToEmpty(fields[2])
+	structuredDataAndMessage := fields[5]
+	if strings.HasPrefix(structuredDataAndMessage, "-") {
+		structuredDataAndMessage = structuredDataAndMessage[1:]
+	} else if strings.HasPrefix(structuredDataAndMessage, "[") {
+		structuredDataEnd := findStructuredDataEnd(structuredDataAndMessage)
+		if structuredDataEnd < 0 {
+			return errInvalidSyslogMessage
+		}
+		structuredDataAndMessage = structuredDataAndMessage[structuredDataEnd:]
+	} else {
+		return errInvalidSyslogMessage
+	}
+	message.Message = strings.TrimPrefix(strings.TrimPrefix(structuredDataAndMessage, " "), "\ufeff")
+	return nil
+}
+
+func nilValueToEmpty(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// returns the index after the last structured data element, e.g [a b="c"][d e="\]"], or -1 if invalid
+func findStructuredDataEnd(data string) int {
+	inQuotes := false
+	inElement := false
+	for i := 0; i < len(data); i++ {
+		switch {
+		case inQuotes && data[i] == '\\':
+			i++
+		case data[i] == '"' && inElement:
+			inQuotes = !inQuotes
+		case inQuotes:
+		case data[i] == '[' && !inElement:
+			inElement = true
+		case data[i] == ']' && inElement:
+			inElement = false
+			if i+1 >= len(data) || data[i+1] != '[' {
+				return i + 1
+			}
+		case !inElement:
+			return -1
+		}
+	}
+	return -1
+}
+
+/*
+TIMESTAMP SP [HOSTNAME SP] TAG[PID]: MSG e.g "Oct 11 22:14:15 web1 nginx: 127.0.0.1 - - ..."
+Hostname is optional, e.g HAProxy may not send it. Messages without a timestamp are accepted, Message is what remains after the tag
+*/
+func parseRFC3164(message *SyslogMessage, rest string) {
+	if len(rest) >= len(time.Stamp) {
+		timestamp, err := time.ParseInLocation(time.Stamp, rest[:len(time.Stamp)], time.Local)
+		if err == nil {
+			now := time.Now()
+			message.Timestamp = timestamp.AddDate(now.Year(), 0, 0)
+			if message.Timestamp.After(now.AddDate(0, 1, 0)) {
+				//december logs received in january
+				message.Timestamp = message.Timestamp.AddDate(-1, 0, 0)
+			}
+			rest = strings.TrimPrefix(rest[len(time.Stamp):], " ")
+		}
+	}
+	firstToken, afterFirstToken, _ := strings.Cut(rest, " ")
+	if !isRFC3164Tag(firstToken) {
+		secondToken, afterSecondToken, _ := strings.Cut(afterFirstToken, " ")
+		if isRFC3164Tag(secondToken) {
+			message.Hostname = firstToken
+			firstToken, afterFirstToken = secondToken, afterSecondToken
+		} else {
+			//no tag
+			message.Message = rest
+			return
+		}
+	}
+	tag, _, _ := strings.Cut(strings.TrimSuffix(firstToken, ":"), "[")
+	message.Tag = tag
+	message.Message = afterFirstToken
+}
+
+// tags end with a colon, e.g "nginx:" or "haproxy[123]:"
+func isRFC3164Tag(token string) bool {
+	return len(token) > 1 && strings.HasSuffix(token, ":")
+}
+
+/*
+Receives syslog messages over UDP and TCP and passes them to handler. handler is called concurrently by multiple goroutines.
+TCP supports both octet counting (RFC6587, e.g "123 <134>1 ...") and newline delimited messages
+*/
+type SyslogServer struct {
+	udpAddress  string
+	tcpAddress  string
+	handler     func(*SyslogMessage)
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	syncMutex   sync.Mutex
+	tcpConns    map[net.Conn]bool
+	//set by Stop, connections accepted after that are closed without reading them
+	stopping   bool
+	goroutines sync.WaitGroup
+	stopped    chan struct{}
+}
+
+// Empty addresses disable the corresponding protocol, e.g ":5140" or "127.0.0.1:5140"
+func NewSyslogServer(udpAddress string, tcpAddress string, handler func(*SyslogMessage)) *SyslogServer {
+	return &SyslogServer{
+		udpAddress: udpAddress,
+		tcpAddress: tcpAddress,
+		handler:    handler,
+		tcpConns:   make(map[net.Conn]bool),
+		stopped:    make(chan struct{})}
+}
+
+func (server *SyslogServer) Start() error {
+	var err error
+	if len(server.udpAddress) > 0 {
+		server.udpConn, err = net.ListenPacket("udp", server.udpAddress)
+		if err != nil {
+			return err
+		}
+		server.goroutines.Add(1)
+		go server.serveUDP()
+	}
+	if len(server.tcpAddress) > 0 {
+		server.tcpListener, err = net.Listen("tcp", server.tcpAddress)
+		if err != nil {
+			if server.udpConn != nil {
+				server.udpConn.Close()
+			}
+			return err
+		}
+		server.goroutines.Add(1)
+		go server.acceptTCP()
+	}
+	return nil
+}
+
+// Returns the addresses actually listened on, useful when ports are 0
+func (server *SyslogServer) Addresses() (udpAddress net.Addr, tcpAddress net.Addr) {
+	if server.udpConn != nil {
+		udpAddress = server.udpConn.LocalAddr()
+	}
+	if server.tcpListener != nil {
+		tcpAddress = server.tcpListener.Addr()
+	}
+	return udpAddress, tcpAddress
+}
+
+// Stops listening, closes connections and waits until handlers return
+func (server *SyslogServer) Stop() {
+	if server.udpConn != nil {
+		server.udpConn.Close()
+	}
+	if server.tcpListener != nil {
+		server.tcpListener.Close()
+	}
+	server.syncMutex.Lock()
+	server.stopping = true
+	for conn := range server.tcpConns {
+		conn.Close()
+	}
+	server.syncMutex.Unlock()
+	server.goroutines.Wait()
+	close(server.stopped)
+}
+
+// closed when Stop is done, i.e handler will not be called anymore
+func (server *SyslogServer) Stopped() <-chan struct{} {
+	return server.stopped
+}
+
+func (server *SyslogServer) handle(data []byte) {
+	message, err := ParseSyslogMessage(data)
+	if err != nil {
+		slog.Debug("Invalid syslog message", "error", err, "length", len(data))
+		return
+	}
+	server.handler(message)
+}
+
+func (server *SyslogServer) serveUDP() {
+	defer server.goroutines.Done()
+	buffer := make([]byte, SYSLOG_MAX_MESSAGE_LENGTH)
+	for {
+		bytesRead, _, err := server.udpConn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("Error reading syslog udp message", "error", err)
+			continue
+		}
+		server.handle(buffer[:bytesRead])
+	}
+}
+
+func (server *SyslogServer) acceptTCP() {
+	defer server.goroutines.Done()
+	for {
+		conn, err := server.tcpListener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("Error accepting syslog tcp connection", "error", err)
+			continue
+		}
+		server.syncMutex.Lock()
+		if server.stopping {
+			//accepted before the listener was closed, Stop would wait for it otherwise
+			server.syncMutex.Unlock()
+			conn.Close()
+			continue
+		}
+		server.tcpConns[conn] = true
+		server.goroutines.Add(1)
+		server.syncMutex.Unlock()
+		go server.serveTCPConnection(conn)
+	}
+}
+
+func (server *SyslogServer) serveTCPConnection(conn net.Conn) {
+	defer server.goroutines.Done()
+	defer func() {
+		server.syncMutex.Lock()
+		delete(server.tcpConns, conn)
+		server.syncMutex.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReaderSize(conn, 16384)
+	for {
+		frame, err := ReadSyslogFrame(reader)
+		if len(frame) > 0 {
+			server.handle(frame)
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Warn("Error reading syslog tcp connection", "remoteAddress", conn.RemoteAddr(), "error", err)
+			}
+			return
+		}
+	}
+}
+
+/*
+Reads a single message from a syslog tcp stream. Messages are either octet counted (length, a space, then the message)
+or delimited by newlines (non-transparent framing, e.g nginx and rsyslog by default).
+Messages longer than SYSLOG_MAX_MESSAGE_LENGTH are not read, an error is returned and the connection should be closed
+*/
+func ReadSyslogFrame(reader *bufio.Reader) ([]byte, error) {
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if firstByte[0] >= '1' && firstByte[0] <= '9' {
+		length, err := readSyslogFrameLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		frame := make([]byte, length)
+		_, err = io.ReadFull(reader, frame)
+		return frame, err
+	}
+	var frame []byte
+	for {
+		part, err := reader.ReadSlice('\n')
+		if len(frame)+len(part) > SYSLOG_MAX_MESSAGE_LENGTH+1 {
+			//+1 for the newline
+			return nil, errSyslogMessageTooLong
+		}
+		frame = append(frame, part...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) && len(frame) > 0 {
+			//last message without a newline
+			err = nil
+		}
+		return frame, err
+	}
+}
+
+// reads the length of an octet counted message and the space after it, at most as many digits as SYSLOG_MAX_MESSAGE_LENGTH has
+func readSyslogFrameLength(reader *bufio.Reader) (int, error) {
+	maxDigits := len(strconv.Itoa(SYSLOG_MAX_MESSAGE_LENGTH))
+	length := 0
+	for digits := 0; ; digits++ {
+		nextByte, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if nextByte == ' ' && digits > 0 {
+			break
+		}
+		if nextByte < '0' || nextByte > '9' || digits >= maxDigits {
+			return 0, errInvalidSyslogMessage
+		}
+		length = length*10 + int(nextByte-'0')
+	}
+	if length > SYSLOG_MAX_MESSAGE_LENGTH {
+		return 0, errSyslogMessageTooLong
+	}
+	return length, nil
+}
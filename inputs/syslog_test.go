@@ -0,0 +1,201 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package inputs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const syslogTestLogLine = `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.1" 200 2326 "-" "Mozilla/5.0"`
+
+func TestParseSyslogMessageRFC3164(t *testing.T) {
+	tests := []struct {
+		data     string
+		hostname string
+		tag      string
+	}{
+		{"<190>Oct 11 22:14:15 web1 nginx: " + syslogTestLogLine, "web1", "nginx"},
+		{"<134>Oct  1 02:04:05 haproxy[1234]: " + syslogTestLogLine, "", "haproxy"},
+		{"<190>Oct 11 22:14:15 web1 nginx[99]: " + syslogTestLogLine + "\n", "web1", "nginx"},
+	}
+	for _, test := range tests {
+		message, err := ParseSyslogMessage([]byte(test.data))
+		if err != nil {
+			t.Fatalf("ParseSyslogMessage(%v) failed: %v", test.data, err)
+		}
+		if message.Format != SYSLOG_FORMAT_RFC3164 || message.Hostname != test.hostname || message.Tag != test.tag || message.Message != syslogTestLogLine {
+			t.Errorf("Unexpected result for %v: %+v", test.data, message)
+		}
+		if message.Timestamp.IsZero() {
+			t.Errorf("Timestamp not parsed for %v", test.data)
+		}
+	}
+	message, _ := ParseSyslogMessage([]byte("<190>Oct 11 22:14:15 web1 nginx: x"))
+	if message.Facility != 23 || message.Severity != 6 {
+		t.Errorf("Unexpected facility/severity %v %v", message.Facility, message.Severity)
+	}
+}
+
+func TestParseSyslogMessageRFC5424(t *testing.T) {
+	tests := map[string]string{
+		"<165>1 2003-10-11T22:14:15.003Z web1 nginx 123 - - " + syslogTestLogLine:                                                  "web1",
+		"<165>1 2003-10-11T22:14:15.003Z - nginx - ID47 [exampleSDID@32473 iut=\"3\" x=\"a\\]b\"][b c=\"d\"] " + syslogTestLogLine: "",
+		"<165>1 - web1 nginx - - - \ufeff" + syslogTestLogLine:                                                                     "web1",
+	}
+	for data, expectedHostname := range tests {
+		message, err := ParseSyslogMessage([]byte(data))
+		if err != nil {
+			t.Fatalf("ParseSyslogMessage(%v) failed: %v", data, err)
+		}
+		if message.Format != SYSLOG_FORMAT_RFC5424 || message.Hostname != expectedHostname || message.Tag != "nginx" || message.Message != syslogTestLogLine {
+			t.Errorf("Unexpected result for %v: %+v", data, message)
+		}
+	}
+}
+
+func TestParseSyslogMessageInvalid(t *testing.T) {
+	for _, data := range []string{"", "no priority", "<>x", "<999>x", "<165>1 2003-10-11T22:14:15.003Z web1 nginx - - [unterminated x"} {
+		if _, err := ParseSyslogMessage([]byte(data)); err == nil {
+			t.Errorf("Expected an error for %v", data)
+		}
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	first := "<190>Oct 11 22:14:15 web1 nginx: line 1\nwith newline"
+	second := "<190>Oct 11 22:14:15 web1 nginx: line 2"
+	stream := fmt.Sprintf("%d %s%d %s", len(first), first, len(second), second) + second + "\n" + second
+	reader := bufio.NewReader(strings.NewReader(stream))
+	expected := []string{first, second, second + "\n", second}
+	for _, expectedFrame := range expected {
+		frame, err := ReadSyslogFrame(reader)
+		if err != nil || string(frame) != expectedFrame {
+			t.Fatalf("Expected frame %q got %q, error %v", expectedFrame, string(frame), err)
+		}
+	}
+	if _, err := ReadSyslogFrame(reader); err == nil {
+		t.Errorf("Expected EOF")
+	}
+}
+
+func TestReadSyslogFrameLimits(t *testing.T) {
+	maxLengthLine := strings.Repeat("a", SYSLOG_MAX_MESSAGE_LENGTH)
+	reader := bufio.NewReader(strings.NewReader(maxLengthLine + "\n"))
+	if frame, err := ReadSyslogFrame(reader); err != nil || len(frame) != SYSLOG_MAX_MESSAGE_LENGTH+1 {
+		t.Errorf("Message of the maximum length was not read, length %v error %v", len(frame), err)
+	}
+	reader = bufio.NewReader(strings.NewReader(maxLengthLine + "a\n"))
+	if _, err := ReadSyslogFrame(reader); err != errSyslogMessageTooLong {
+		t.Errorf("Expected errSyslogMessageTooLong for a long line, got %v", err)
+	}
+	reader = bufio.NewReader(strings.NewReader(maxLengthLine + maxLengthLine))
+	if _, err := ReadSyslogFrame(reader); err != errSyslogMessageTooLong {
+		t.Errorf("Expected errSyslogMessageTooLong for a long line without a newline, got %v", err)
+	}
+	reader = bufio.NewReader(strings.NewReader(fmt.Sprintf("%d <190>", SYSLOG_MAX_MESSAGE_LENGTH+1)))
+	if _, err := ReadSyslogFrame(reader); err != errSyslogMessageTooLong {
+		t.Errorf("Expected errSyslogMessageTooLong for a long octet counted message, got %v", err)
+	}
+	reader = bufio.NewReader(strings.NewReader(strings.Repeat("1", 100) + " <190>"))
+	if _, err := ReadSyslogFrame(reader); err != errInvalidSyslogMessage {
+		t.Errorf("Expected errInvalidSyslogMessage for a long length prefix, got %v", err)
+	}
+}
+
+func TestSyslogConnectionAcceptedWhileStoppingIsClosed(t *testing.T) {
+	server := NewSyslogServer("", "127.0.0.1:0", func(message *SyslogMessage) {})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	_, tcpAddress := server.Addresses()
+	//Stop was called but the listener is not closed yet
+	server.syncMutex.Lock()
+	server.stopping = true
+	server.syncMutex.Unlock()
+	tcpConn, err := net.Dial("tcp", tcpAddress.String())
+	if err != nil {
+		t.Fatalf("Dial tcp failed: %v", err)
+	}
+	defer tcpConn.Close()
+	tcpConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := tcpConn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Connection accepted while stopping was not closed, error %v", err)
+	}
+	server.Stop()
+	<-server.Stopped()
+}
+
+func TestSyslogServer(t *testing.T) {
+	var syncMutex sync.Mutex
+	received := make([]*SyslogMessage, 0)
+	server := NewSyslogServer("127.0.0.1:0", "127.0.0.1:0", func(message *SyslogMessage) {
+		syncMutex.Lock()
+		defer syncMutex.Unlock()
+		received = append(received, message)
+	})
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	udpAddress, tcpAddress := server.Addresses()
+
+	udpConn, err := net.Dial("udp", udpAddress.String())
+	if err != nil {
+		t.Fatalf("Dial udp failed: %v", err)
+	}
+	udpConn.Write([]byte("<190>Oct 11 22:14:15 web1 nginx: " + syslogTestLogLine))
+	udpConn.Close()
+
+	tcpConn, err := net.Dial("tcp", tcpAddress.String())
+	if err != nil {
+		t.Fatalf("Dial tcp failed: %v", err)
+	}
+	octetCounted := "<165>1 - web1 app - - - " + syslogTestLogLine
+	fmt.Fprintf(tcpConn, "%d %s<190>Oct 11 22:14:15 web1 nginx: %s\n", len(octetCounted), octetCounted, syslogTestLogLine)
+	tcpConn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		syncMutex.Lock()
+		count := len(received)
+		syncMutex.Unlock()
+		if count >= 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server.Stop()
+	<-server.Stopped()
+
+	if len(received) != 3 {
+		t.Fatalf("Expected 3 messages got %v", len(received))
+	}
+	for _, message := range received {
+		if message.Message != syslogTestLogLine {
+			t.Errorf("Unexpected message %+v", message)
+		}
+	}
+}
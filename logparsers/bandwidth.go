@@ -0,0 +1,78 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logparsers
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// file extensions of static assets that are typically hotlinked or are expensive to serve
+var staticAssetExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif", ".svg", ".ico", ".bmp", ".tif", ".tiff",
+	".mp4", ".webm", ".mov", ".avi", ".mkv", ".m4v", ".m3u8", ".ts",
+	".mp3", ".ogg", ".wav", ".flac", ".m4a",
+	".pdf", ".zip", ".gz", ".tgz", ".tar", ".rar", ".7z", ".iso", ".dmg", ".exe",
+	".woff", ".woff2", ".ttf", ".otf",
+}
+
+func IsStaticAssetPath(requestPath string) bool {
+	return slices.Contains(staticAssetExtensions, strings.ToLower(path.Ext(requestPath)))
+}
+
+func (sbol *SBOHttpRequestLog) IsStaticAsset() bool {
+	return IsStaticAssetPath(sbol.Path)
+}
+
+/*
+Returns true if the referer is a host name which is neither the domain in the log entry nor one of ownDomains.
+Subdomains of own domains are not considered foreign, e.g cdn.example.com is not foreign when example.com is an own domain.
+Returns false when the referer is not known or there is nothing to compare it to
+*/
+func (sbol *SBOHttpRequestLog) IsForeignReferer(ownDomains []string) bool {
+	if len(sbol.Referer) < 1 || sbol.refererFromUtmSource {
+		return false
+	}
+	referer := strings.ToLower(sbol.Referer)
+	comparedToSomething := false
+	isOwnDomain := func(domain string) bool {
+		//vhost logs may contain the port, e.g example.com:443
+		domain, _, _ = strings.Cut(strings.ToLower(domain), ":")
+		domain = strings.TrimPrefix(domain, "www.")
+		if len(domain) < 1 {
+			return false
+		}
+		comparedToSomething = true
+		return referer == domain || strings.HasSuffix(referer, "."+domain)
+	}
+	if isOwnDomain(sbol.Domain) || slices.ContainsFunc(ownDomains, isOwnDomain) {
+		return false
+	}
+	return comparedToSomething
+}
+
+/*
+Returns true if this is a request for a static asset embedded by a foreign site.
+ownDomains must contain the domain names the site is served from, see IsForeignReferer
+*/
+func (sbol *SBOHttpRequestLog) IsHotlink(ownDomains []string) bool {
+	return sbol.IsStaticAsset() && sbol.IsForeignReferer(ownDomains)
+}
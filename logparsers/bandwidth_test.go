@@ -0,0 +1,62 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logparsers
+
+import (
+	"testing"
+)
+
+func TestIsHotlink(t *testing.T) {
+	ownDomains := []string{"example.com"}
+	tests := map[string]bool{
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /img/a.jpg HTTP/1.1" 200 51200 "https://forum.other.org/t/1" "Mozilla/5.0 (Macintosh)"`:   true,
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /img/a.JPG HTTP/1.1" 200 51200 "https://www.example.com/page" "Mozilla/5.0 (Macintosh)"`:  false,
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /img/a.jpg HTTP/1.1" 200 51200 "https://cdn.example.com/page" "Mozilla/5.0 (Macintosh)"`:  false,
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /img/a.jpg HTTP/1.1" 200 51200 "-" "Mozilla/5.0 (Macintosh)"`:                             false,
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /page.html HTTP/1.1" 200 51200 "https://forum.other.org/t/1" "Mozilla/5.0 (Macintosh)"`:   false,
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /v.mp4?utm_source=news HTTP/1.1" 200 51200 "-" "Mozilla/5.0 (Macintosh)"`:                 false,
+		`1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /videos/v.mp4 HTTP/1.1" 206 9951200 "https://notexample.com/x" "Mozilla/5.0 (Macintosh)"`: true,
+	}
+	for line, expected := range tests {
+		result, err := ParseNginxCombinedFormat(line)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.IsHotlink(ownDomains) != expected {
+			t.Errorf("IsHotlink expected %v for %v", expected, line)
+		}
+	}
+}
+
+func TestIsForeignRefererWithoutOwnDomain(t *testing.T) {
+	line := `1.2.3.4 - - [10/Oct/2000:13:55:36 -0700] "GET /img/a.jpg HTTP/1.1" 200 51200 "https://forum.other.org/t/1" "Mozilla/5.0 (Macintosh)"`
+	result, err := ParseNginxCombinedFormat(line)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	//nothing to compare to
+	if result.IsForeignReferer(nil) {
+		t.Errorf("IsForeignReferer expected false when own domains are not known")
+	}
+	result.Domain = "example.com:443"
+	if !result.IsForeignReferer(nil) {
+		t.Errorf("IsForeignReferer expected true when compared to the domain in the log line")
+	}
+}
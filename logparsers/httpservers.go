@@ -21,6 +21,7 @@ package logparsers
 
 import (
 	"errors"
+	"math"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -58,6 +59,20 @@ type SBOHttpRequestLog struct {
 	//log timestamp is before the timestamps in previous lines. e.g we see logs from 18:01:33 then a log with timestamp 18:00:55 comes
 	//this indicates that this request took longer than others
 	IsOutOfOrder bool
+	//types of sensitive data found in the request uri or referer, e.g Password, Email. See sensitivedata.go
+	SensitiveData []string
+	//referer is a known spam domain, see refererspam.go
+	RefererSpam bool
+	//time taken to process the request, only available for formats which include it, e.g $request_time in nginx custom log format
+	RequestTime       time.Duration `json:",omitempty"`
+	RequestTimeLogged bool          `json:",omitempty"`
+	//identifies the line a raw log is saved for, so it's saved once, see db.LineHash. Empty for lines which were not read from a file
+	LineHash string `json:",omitempty"`
+	//the log line the entry was parsed from, after sensitive data is redacted when RedactSensitiveData is enabled. Not serialised
+	RawLine string `json:"-"`
+
+	//Referer was set from a utm_source parameter, i.e it's not a host name. See SBOHttpRequestLogSetReferer
+	refererFromUtmSource bool
 }
 
 func (sbol *SBOHttpRequestLog) SBOHttpRequestLogSetUserAgent(userAgent string) {
@@ -82,6 +97,7 @@ func (sbol *SBOHttpRequestLog) SBOHttpRequestLogSetReferer(referer string, reque
 	match := rx.FindStringSubmatch(requestUri)
 	if len(match) > 0 {
 		sbol.Referer = match[2]
+		sbol.refererFromUtmSource = true
 	} else if len(referer) > 0 {
 		parsed, err := url.Parse(referer)
 
@@ -130,6 +146,15 @@ func (sbol *SBOHttpRequestLog) SBOHttpRequestLogSetPath(requestUri string) {
 	}
 }
 
+// e.g 2xx for 200, empty if Status is not a valid http status code
+func (sbol *SBOHttpRequestLog) StatusClass() string {
+	statusCode, err := strconv.Atoi(sbol.Status)
+	if err != nil || statusCode < 100 || statusCode > 599 {
+		return ""
+	}
+	return strconv.Itoa(statusCode/100) + "xx"
+}
+
 func isDirectoryTraversal(parsedPath string, requestUriVerbatimFromLog string) bool {
 	if strings.Contains(parsedPath, "/../") || strings.Contains(requestUriVerbatimFromLog, "%00") {
 		return true
@@ -187,6 +212,7 @@ func ParseApacheCommonLogFormat(line string) (*SBOHttpRequestLog, error) {
 		BytesSent: bytesSentInt}
 
 	sbol.SBOHttpRequestLogSetPath(matches[6])
+	sbol.SBOHttpRequestLogSetSensitiveData(matches[6], "")
 
 	return &sbol, nil
 }
@@ -218,6 +244,7 @@ func ParseApacheCombinedLogFormat(line string) (*SBOHttpRequestLog, error) {
 
 	sbol.SBOHttpRequestLogSetPath(matches[6])
 	sbol.SBOHttpRequestLogSetReferer(matches[10], matches[6])
+	sbol.SBOHttpRequestLogSetSensitiveData(matches[6], matches[10])
 	sbol.SBOHttpRequestLogSetUserAgent(matches[11])
 
 	return &sbol, nil
@@ -248,6 +275,7 @@ func ParseApacheVHostCombinedLogFormat(line string) (*SBOHttpRequestLog, error)
 	sbol.Domain = matches[1]
 	sbol.SBOHttpRequestLogSetPath(matches[7])
 	sbol.SBOHttpRequestLogSetReferer(matches[11], matches[7])
+	sbol.SBOHttpRequestLogSetSensitiveData(matches[7], matches[11])
 	sbol.SBOHttpRequestLogSetUserAgent(matches[12])
 
 	return &sbol, nil
@@ -278,6 +306,7 @@ func ParseNginxCombinedFormat(line string) (*SBOHttpRequestLog, error) {
 	//sbol.Domain = matches[1]
 	sbol.SBOHttpRequestLogSetPath(matches[5])
 	sbol.SBOHttpRequestLogSetReferer(matches[9], matches[5])
+	sbol.SBOHttpRequestLogSetSensitiveData(matches[5], matches[9])
 	sbol.SBOHttpRequestLogSetUserAgent(matches[10])
 
 	return &sbol, nil
@@ -307,10 +336,15 @@ func ParseNginxCustomFormat(line string) (*SBOHttpRequestLog, error) {
 	//sbol.Domain = matches[1]
 	sbol.SBOHttpRequestLogSetPath(matches[5])
 	sbol.SBOHttpRequestLogSetReferer(matches[9], matches[5])
+	sbol.SBOHttpRequestLogSetSensitiveData(matches[5], matches[9])
 	sbol.SBOHttpRequestLogSetUserAgent(matches[10])
+	//seconds with millisecond resolution, e.g 0.123
+	if requestTimeSeconds, err := strconv.ParseFloat(matches[11], 64); err == nil && requestTimeSeconds >= 0 {
+		sbol.RequestTime = time.Duration(math.Round(requestTimeSeconds * float64(time.Second)))
+		sbol.RequestTimeLogged = true
+	}
 	//TODO we are ignoring the following fields
 	/*
-		"request_time":           matches[11],
 		"upstream_response_time": matches[12],
 
 	*/
@@ -259,6 +259,29 @@ func TestNginxCustomFormat(t *testing.T) {
 }
 */
 
+func TestNginxCustomFormatRequestTime(t *testing.T) {
+	result, err := ParseNginxCustomFormat(`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 612 "-" "Mozilla/5.0" 0.123 0.456`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.RequestTimeLogged || result.RequestTime != 123*time.Millisecond {
+		t.Errorf("Expected request time 123ms, got %v %v", result.RequestTime, result.RequestTimeLogged)
+	}
+	result, _ = ParseNginxCombinedFormat(`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 612 "-" "Mozilla/5.0"`)
+	if result == nil || result.RequestTimeLogged {
+		t.Errorf("Request time must not be set for formats without it")
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	for status, expected := range map[string]string{"200": "2xx", "304": "3xx", "599": "5xx", "600": "", "99": "", "-": "", "": ""} {
+		entry := SBOHttpRequestLog{Status: status}
+		if statusClass := entry.StatusClass(); statusClass != expected {
+			t.Errorf("Expected %q for status %q, got %q", expected, status, statusClass)
+		}
+	}
+}
+
 func TestParseNginxTimestamp(t *testing.T) {
 	timestamp := "10/Oct/2000:13:55:36 -0700"
 	expected := time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60))
@@ -0,0 +1,248 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logparsers
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Referer spam detection.
+
+Spam referers are detected using a blocklist file (one domain per line, # for comments) and optionally using heuristics.
+Heuristics track visits, i.e requests from a client ip following a page request with a foreign referer:
+  - a visit which is not followed by any static asset requests (css, images etc) is suspicious, browsers load assets, spam bots don't
+  - a visit where the client ip requests only one page, repeatedly, is suspicious
+
+A referer is flagged as spam when at least REFERER_SPAM_MIN_VISITS visits were evaluated and REFERER_SPAM_SUSPICIOUS_PERCENT percent of them were suspicious.
+Note that requests with a spam referer seen before the referer was flagged are not flagged.
+
+Each input has its own RefererSpamDetector, blocklists are loaded for each input and referers flagged by heuristics are spam for that input only.
+*/
+
+const (
+	// a visit is evaluated when no requests are seen from the client ip for this long (log time, not wall clock time)
+	REFERER_SPAM_VISIT_TIMEOUT        time.Duration = 2 * time.Minute
+	REFERER_SPAM_MIN_VISITS           int           = 5
+	REFERER_SPAM_SUSPICIOUS_PERCENT   int           = 90
+	REFERER_SPAM_MAX_TRACKED_VISITS   int           = 100000
+	REFERER_SPAM_MAX_PAGES_PER_VISIT  int           = 10
+	REFERER_SPAM_EVALUATION_INTERVAL  time.Duration = 30 * time.Second
+	REFERER_SPAM_MAX_TRACKED_REFERERS int           = 100000
+)
+
+type refererSpamVisit struct {
+	referer       string
+	lastSeen      time.Time
+	pages         map[string]bool
+	pageHits      int
+	assetRequests int
+}
+
+type refererSpamStats struct {
+	visits           int
+	suspiciousVisits int
+}
+
+type refererSpamHeuristics struct {
+	syncMutex      sync.Mutex
+	visits         map[string]*refererSpamVisit
+	stats          map[string]*refererSpamStats
+	lastEvaluation time.Time
+}
+
+/*
+Detects spam referers of an input. Each input has its own detector, i.e domains flagged by heuristics of an input are not
+flagged for other inputs. Safe for concurrent use
+*/
+type RefererSpamDetector struct {
+	syncMutex sync.RWMutex
+	// domains loaded from blocklist files
+	blocklist map[string]bool
+	// domains flagged by heuristics
+	flagged map[string]bool
+	// nil when heuristics are not used
+	heuristics *refererSpamHeuristics
+}
+
+func NewRefererSpamDetector(useHeuristics bool) *RefererSpamDetector {
+	detector := &RefererSpamDetector{
+		blocklist: make(map[string]bool),
+		flagged:   make(map[string]bool)}
+	if useHeuristics {
+		detector.heuristics = &refererSpamHeuristics{
+			visits: make(map[string]*refererSpamVisit),
+			stats:  make(map[string]*refererSpamStats)}
+	}
+	return detector
+}
+
+func normalizeRefererSpamDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+}
+
+/*
+Load spam referer domains from the given file, one domain per line. Empty lines and lines starting with # are ignored.
+Domains are added to the domains loaded previously, so it's safe to call this for multiple files.
+Returns the number of domains loaded from the file
+*/
+func (detector *RefererSpamDetector) LoadBlocklist(blocklistFilePath string) (int, error) {
+	file, err := os.Open(blocklistFilePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	detector.syncMutex.Lock()
+	defer detector.syncMutex.Unlock()
+	loaded := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := normalizeRefererSpamDomain(scanner.Text())
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		detector.blocklist[line] = true
+		loaded++
+	}
+	return loaded, scanner.Err()
+}
+
+/*
+Returns true if the referer domain, or one of its parent domains, is in the blocklist or was flagged as spam by heuristics
+*/
+func (detector *RefererSpamDetector) IsSpamDomain(refererDomain string) bool {
+	domain := normalizeRefererSpamDomain(refererDomain)
+	if len(domain) < 1 {
+		return false
+	}
+	detector.syncMutex.RLock()
+	defer detector.syncMutex.RUnlock()
+	if detector.flagged[domain] {
+		return true
+	}
+	for len(domain) > 0 {
+		if detector.blocklist[domain] {
+			return true
+		}
+		_, parentDomain, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parentDomain
+	}
+	return false
+}
+
+/*
+Sets RefererSpam of a parsed entry when its referer is a spam domain, and feeds the entry to heuristics when they are used.
+ownDomains are the domains of the site, see IsForeignReferer. Referers taken from utm_source are checked by heuristics only
+*/
+func (detector *RefererSpamDetector) Check(sbol *SBOHttpRequestLog, ownDomains []string) {
+	if len(sbol.Referer) > 0 && !sbol.refererFromUtmSource && detector.IsSpamDomain(sbol.Referer) {
+		sbol.RefererSpam = true
+	}
+	if detector.heuristics == nil {
+		return
+	}
+	detector.heuristics.observe(detector, sbol, ownDomains)
+	if !sbol.RefererSpam && sbol.IsForeignReferer(ownDomains) && detector.IsSpamDomain(sbol.Referer) {
+		sbol.RefererSpam = true
+	}
+}
+
+func (heuristics *refererSpamHeuristics) observe(detector *RefererSpamDetector, sbol *SBOHttpRequestLog, ownDomains []string) {
+	heuristics.syncMutex.Lock()
+	defer heuristics.syncMutex.Unlock()
+
+	//client ips are tracked per site
+	visitKey := sbol.ClientIP + "|" + sbol.Domain
+	if len(ownDomains) > 0 {
+		visitKey += "|" + ownDomains[0]
+	}
+	visit, tracked := heuristics.visits[visitKey]
+	if tracked && sbol.Timestamp.Sub(visit.lastSeen) > REFERER_SPAM_VISIT_TIMEOUT {
+		heuristics.evaluateVisit(detector, visit)
+		delete(heuristics.visits, visitKey)
+		tracked = false
+	}
+	if tracked {
+		visit.lastSeen = sbol.Timestamp
+		if sbol.IsStaticAsset() {
+			visit.assetRequests++
+		} else {
+			visit.pageHits++
+			if len(visit.pages) < REFERER_SPAM_MAX_PAGES_PER_VISIT {
+				visit.pages[sbol.Path] = true
+			}
+		}
+	} else if !sbol.IsStaticAsset() && sbol.IsForeignReferer(ownDomains) && !sbol.RefererSpam &&
+		len(heuristics.visits) < REFERER_SPAM_MAX_TRACKED_VISITS {
+		//landing on a page from a foreign site, start a new visit
+		heuristics.visits[visitKey] = &refererSpamVisit{
+			referer:  normalizeRefererSpamDomain(sbol.Referer),
+			lastSeen: sbol.Timestamp,
+			pages:    map[string]bool{sbol.Path: true},
+			pageHits: 1}
+	}
+
+	if sbol.Timestamp.Sub(heuristics.lastEvaluation) >= REFERER_SPAM_EVALUATION_INTERVAL {
+		heuristics.evaluateExpiredVisits(detector, sbol.Timestamp)
+		heuristics.lastEvaluation = sbol.Timestamp
+	}
+}
+
+func (heuristics *refererSpamHeuristics) evaluateExpiredVisits(detector *RefererSpamDetector, now time.Time) {
+	for visitKey, visit := range heuristics.visits {
+		if now.Sub(visit.lastSeen) > REFERER_SPAM_VISIT_TIMEOUT {
+			heuristics.evaluateVisit(detector, visit)
+			delete(heuristics.visits, visitKey)
+		}
+	}
+}
+
+// flags the referer of the visit in detector when enough visits were suspicious
+func (heuristics *refererSpamHeuristics) evaluateVisit(detector *RefererSpamDetector, visit *refererSpamVisit) {
+	stats, ok := heuristics.stats[visit.referer]
+	if !ok {
+		if len(heuristics.stats) >= REFERER_SPAM_MAX_TRACKED_REFERERS {
+			return
+		}
+		stats = &refererSpamStats{}
+		heuristics.stats[visit.referer] = stats
+	}
+	stats.visits++
+	if visit.assetRequests == 0 || (visit.pageHits > 1 && len(visit.pages) == 1) {
+		stats.suspiciousVisits++
+	}
+	if stats.visits >= REFERER_SPAM_MIN_VISITS && stats.suspiciousVisits*100 >= stats.visits*REFERER_SPAM_SUSPICIOUS_PERCENT {
+		detector.syncMutex.Lock()
+		if !detector.flagged[visit.referer] {
+			detector.flagged[visit.referer] = true
+			slog.Info("Referer flagged as spam by heuristics", "referer", visit.referer, "visits", stats.visits, "suspiciousVisits", stats.suspiciousVisits)
+		}
+		detector.syncMutex.Unlock()
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logparsers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRefererSpamBlocklist(t *testing.T) {
+	detector := NewRefererSpamDetector(false)
+	blocklistFile := filepath.Join(t.TempDir(), "spam.txt")
+	os.WriteFile(blocklistFile, []byte("# comment\n\nspam-seo.xyz\nwww.best-traffic.example\n"), 0644)
+
+	loaded, err := detector.LoadBlocklist(blocklistFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded != 2 {
+		t.Errorf("Expected 2 domains, got %v", loaded)
+	}
+
+	line := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 612 "https://free.spam-seo.xyz/offer" "Mozilla/5.0 (Macintosh)"`
+	result, err := ParseNginxCombinedFormat(line)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	detector.Check(result, []string{"example.com"})
+	if !result.RefererSpam {
+		t.Errorf("RefererSpam expected true for %v", result.Referer)
+	}
+	if !detector.IsSpamDomain("best-traffic.example") {
+		t.Errorf("IsSpamDomain expected true for best-traffic.example")
+	}
+	if detector.IsSpamDomain("example.com") {
+		t.Errorf("IsSpamDomain expected false for example.com")
+	}
+	//other inputs have their own detectors
+	if NewRefererSpamDetector(false).IsSpamDomain("spam-seo.xyz") {
+		t.Errorf("Blocklist of a detector was used by another detector")
+	}
+}
+
+func TestRefererSpamHeuristics(t *testing.T) {
+	detector := NewRefererSpamDetector(true)
+	ownDomains := []string{"example.com"}
+	start := time.Date(2025, time.July, 1, 10, 0, 0, 0, time.UTC)
+	//spam bot visits, no assets
+	for i := 0; i < REFERER_SPAM_MIN_VISITS; i++ {
+		sbol := SBOHttpRequestLog{ClientIP: fmt.Sprintf("10.0.0.%d", i), Path: "/", Referer: "heuristic-spam.test",
+			Timestamp: start.Add(time.Duration(i) * time.Second)}
+		detector.Check(&sbol, ownDomains)
+	}
+	//real users, with assets
+	for i := 0; i < REFERER_SPAM_MIN_VISITS; i++ {
+		clientIP := fmt.Sprintf("10.0.1.%d", i)
+		ts := start.Add(time.Duration(i) * time.Second)
+		page := SBOHttpRequestLog{ClientIP: clientIP, Path: "/", Referer: "news.test", Timestamp: ts}
+		detector.Check(&page, ownDomains)
+		asset := SBOHttpRequestLog{ClientIP: clientIP, Path: "/logo.png", Referer: "example.com", Timestamp: ts}
+		detector.Check(&asset, ownDomains)
+	}
+	//move the clock so that visits are evaluated
+	later := SBOHttpRequestLog{ClientIP: "10.0.2.1", Path: "/", Timestamp: start.Add(10 * time.Minute)}
+	detector.Check(&later, ownDomains)
+
+	if !detector.IsSpamDomain("heuristic-spam.test") {
+		t.Errorf("heuristic-spam.test expected to be flagged as spam")
+	}
+	if detector.IsSpamDomain("news.test") {
+		t.Errorf("news.test expected NOT to be flagged as spam")
+	}
+}
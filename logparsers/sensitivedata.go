@@ -0,0 +1,194 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package logparsers
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+/*
+Sensitive data leakage detection.
+
+Users and applications sometimes put passwords, api keys, JWTs, session ids or email addresses into
+query strings (or even paths), which then end up in access logs and in anything we generate from them.
+We detect such values in request URIs and referers so that the offending endpoints can be found and fixed,
+and optionally redact them before handlers or the database see the parsed log entry.
+*/
+
+const (
+	SENSITIVE_DATA_PASSWORD   string = "Password"
+	SENSITIVE_DATA_API_KEY    string = "APIKey"
+	SENSITIVE_DATA_JWT        string = "JWT"
+	SENSITIVE_DATA_SESSION_ID string = "SessionId"
+	SENSITIVE_DATA_EMAIL      string = "Email"
+
+	SENSITIVE_DATA_REDACTED string = "--REDACTED--"
+)
+
+// lower case query parameter names, values of these parameters are considered sensitive
+var sensitiveParamNames = map[string][]string{
+	SENSITIVE_DATA_PASSWORD: {"password", "passwd", "pwd", "pass", "passphrase", "secret", "client_secret"},
+	SENSITIVE_DATA_API_KEY: {"api_key", "apikey", "api-key", "x-api-key", "access_key", "access_token", "refresh_token",
+		"auth_token", "token", "private_token", "authorization"},
+	SENSITIVE_DATA_SESSION_ID: {"sessionid", "session_id", "session", "sid", "phpsessid", "jsessionid", "aspsessionid", "asp.net_sessionid"},
+}
+
+var reSensitiveJWT *regexp.Regexp = regexp.MustCompile(`eyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]*`)
+
+var reSensitiveEmail *regexp.Regexp = regexp.MustCompile(`[A-Za-z0-9._%+-]+(@|%40)[A-Za-z0-9.-]+\.([A-Za-z]{2,})`)
+
+// e.g logo@2x.png is not an email address
+var notEmailTopLevelDomains = []string{"png", "jpg", "jpeg", "gif", "webp", "svg", "ico", "css", "js", "htm", "html", "php", "json", "xml", "txt"}
+
+// well known api key formats: aws access keys, stripe, github, slack, google
+var reSensitiveAPIKey *regexp.Regexp = regexp.MustCompile(`(AKIA[0-9A-Z]{16}|sk_live_[0-9A-Za-z]{16,}|gh[pousr]_[0-9A-Za-z]{30,}|xox[abprs]-[0-9A-Za-z-]{10,}|AIza[0-9A-Za-z_-]{35})`)
+
+// values end at &, # or ; in fields, e.g a referer value may contain spaces
+var reSensitiveParams *regexp.Regexp = buildSensitiveParamsRegex(`[^&#;]+`)
+
+// values end at whitespace and quotes too in log lines, so that only the value is redacted, not the rest of the line
+var reSensitiveParamsInLine *regexp.Regexp = buildSensitiveParamsRegex(`[^&#;\s"]+`)
+
+func buildSensitiveParamsRegex(valuePattern string) *regexp.Regexp {
+	var names []string
+	for _, paramNames := range sensitiveParamNames {
+		for _, name := range paramNames {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+	}
+	//longest first so that e.g session_id is preferred over session
+	slices.SortFunc(names, func(a, b string) int { return len(b) - len(a) })
+	return regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(names, "|") + `)=)` + valuePattern)
+}
+
+/*
+Returns the types of sensitive data found in the given request uri or referer, e.g [Password, Email].
+Each type is returned only once.
+*/
+func DetectSensitiveData(uriOrReferer string) []string {
+	var found []string
+	if len(uriOrReferer) < 1 {
+		return found
+	}
+	addType := func(dataType string) {
+		if !slices.Contains(found, dataType) {
+			found = append(found, dataType)
+		}
+	}
+
+	_, rawQuery, hasQuery := strings.Cut(uriOrReferer, "?")
+	if hasQuery {
+		rawQuery, _, _ = strings.Cut(rawQuery, "#")
+		queryValues, _ := url.ParseQuery(rawQuery)
+		for paramName, values := range queryValues {
+			if !slices.ContainsFunc(values, func(v string) bool { return len(v) > 0 }) {
+				continue
+			}
+			lowerParamName := strings.ToLower(paramName)
+			for dataType, paramNames := range sensitiveParamNames {
+				if slices.Contains(paramNames, lowerParamName) {
+					addType(dataType)
+				}
+			}
+		}
+	}
+
+	//values may be url encoded, check both
+	unescaped, err := url.QueryUnescape(uriOrReferer)
+	if err != nil {
+		unescaped = uriOrReferer
+	}
+	if reSensitiveJWT.MatchString(unescaped) {
+		addType(SENSITIVE_DATA_JWT)
+	}
+	if reSensitiveAPIKey.MatchString(unescaped) {
+		addType(SENSITIVE_DATA_API_KEY)
+	}
+	if containsEmailAddress(unescaped) {
+		addType(SENSITIVE_DATA_EMAIL)
+	}
+	return found
+}
+
+func isEmailAddressMatch(matches []string) bool {
+	return !slices.Contains(notEmailTopLevelDomains, strings.ToLower(matches[2]))
+}
+
+func containsEmailAddress(str string) bool {
+	for _, matches := range reSensitiveEmail.FindAllStringSubmatch(str, -1) {
+		if isEmailAddressMatch(matches) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Replaces sensitive values in the given string with SENSITIVE_DATA_REDACTED. Parameter names are kept,
+e.g /login?user=a&password=secret becomes /login?user=a&password=--REDACTED--
+*/
+func RedactSensitiveDataInString(str string) string {
+	return redactSensitiveData(str, reSensitiveParams)
+}
+
+func redactSensitiveData(str string, paramsRegex *regexp.Regexp) string {
+	if len(str) < 1 {
+		return str
+	}
+	redacted := paramsRegex.ReplaceAllString(str, "${1}"+SENSITIVE_DATA_REDACTED)
+	redacted = reSensitiveJWT.ReplaceAllString(redacted, SENSITIVE_DATA_REDACTED)
+	redacted = reSensitiveAPIKey.ReplaceAllString(redacted, SENSITIVE_DATA_REDACTED)
+	redacted = reSensitiveEmail.ReplaceAllStringFunc(redacted, func(match string) string {
+		if isEmailAddressMatch(reSensitiveEmail.FindStringSubmatch(match)) {
+			return SENSITIVE_DATA_REDACTED
+		}
+		return match
+	})
+	return redacted
+}
+
+/*
+Detect sensitive data in the request uri and the referer exactly as they appear in the log line.
+Must be called by parsers as the query string is not kept in the parsed entry
+*/
+func (sbol *SBOHttpRequestLog) SBOHttpRequestLogSetSensitiveData(requestUri string, referer string) {
+	sbol.SensitiveData = DetectSensitiveData(requestUri)
+	for _, dataType := range DetectSensitiveData(referer) {
+		if !slices.Contains(sbol.SensitiveData, dataType) {
+			sbol.SensitiveData = append(sbol.SensitiveData, dataType)
+		}
+	}
+}
+
+/*
+Redact sensitive values from fields of the parsed entry, to be called before handlers and db writes see the entry
+*/
+func (sbol *SBOHttpRequestLog) RedactSensitiveData() {
+	sbol.Path = RedactSensitiveDataInString(sbol.Path)
+	sbol.Path1 = RedactSensitiveDataInString(sbol.Path1)
+	sbol.Path2 = RedactSensitiveDataInString(sbol.Path2)
+	sbol.Path3 = RedactSensitiveDataInString(sbol.Path3)
+	sbol.Referer = RedactSensitiveDataInString(sbol.Referer)
+	sbol.RemoteUser = RedactSensitiveDataInString(sbol.RemoteUser)
+	sbol.RawLine = redactSensitiveData(sbol.RawLine, reSensitiveParamsInLine)
+}
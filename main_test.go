@@ -0,0 +1,421 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/db"
+	"github.com/SBOsoft/SBOLogProcessor/handlers"
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// adds a configuration entry for the test, removed when the test ends
+func setTestConfig(t *testing.T, filePath string, config *ConfigForAMonitoredFile) {
+	globalConfigMutex.Lock()
+	defer globalConfigMutex.Unlock()
+	globalConfig[filePath] = config
+	t.Cleanup(func() {
+		globalConfigMutex.Lock()
+		defer globalConfigMutex.Unlock()
+		delete(globalConfig, filePath)
+	})
+}
+
+// replaces globalShutdown for the test, closing the returned channel starts shutdown
+func useTestShutdownChannel(t *testing.T) chan struct{} {
+	savedShutdown := globalShutdown
+	globalShutdown = make(chan struct{})
+	t.Cleanup(func() {
+		globalShutdown = savedShutdown
+	})
+	return globalShutdown
+}
+
+// lines sent to the channel until it's empty
+func receivedTestLines(lines chan inputs.LogLine) []string {
+	var texts []string
+	for {
+		select {
+		case line := <-lines:
+			texts = append(texts, line.Text)
+		default:
+			return texts
+		}
+	}
+}
+
+func TestProduceLinesFromReader(t *testing.T) {
+	setTestConfig(t, "test-reader", &ConfigForAMonitoredFile{StartFrom: 2})
+	lines := make(chan inputs.LogLine, 10)
+	produceLinesFromReader("test-reader", bytes.NewBufferString("line1\nline2\nline3"), lines)
+	if texts := receivedTestLines(lines); !slices.Equal(texts, []string{"line2", "line3"}) {
+		t.Errorf("Unexpected lines %v", texts)
+	}
+
+	//compressed data, e.g zcat is not used
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write([]byte("a\nb\nc\n"))
+	gzipWriter.Close()
+	setTestConfig(t, "test-reader-gzip", &ConfigForAMonitoredFile{})
+	produceLinesFromReader("test-reader-gzip", &compressed, lines)
+	if texts := receivedTestLines(lines); !slices.Equal(texts, []string{"a", "b", "c"}) {
+		t.Errorf("Unexpected lines %v", texts)
+	}
+}
+
+// waits until count lines are sent to the channel
+func waitForTestLines(t *testing.T, lines chan inputs.LogLine, count int) []string {
+	t.Helper()
+	var texts []string
+	timeout := time.After(10 * time.Second)
+	for len(texts) < count {
+		select {
+		case line := <-lines:
+			texts = append(texts, line.Text)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for lines, received %v", texts)
+		}
+	}
+	return texts
+}
+
+// overwrites the beginning of the file without truncating it, i.e the file does not get smaller
+func overwriteTestFile(t *testing.T, filePath string, data string) {
+	t.Helper()
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteAt([]byte(data), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestartIfFileWasTruncated(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "access.log")
+	os.WriteFile(filePath, []byte("first line\nsecond line\n"), 0644)
+	setTestConfig(t, filePath, &ConfigForAMonitoredFile{})
+	logFile, err := openFile(false, filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+	lines := make(chan inputs.LogLine, 10)
+	for !readSingleLineFromFileReturnTrueIfEOF(filePath, lines, logFile) {
+	}
+	receivedTestLines(lines)
+
+	//same size, different first line. Only detected when first lines are compared
+	overwriteTestFile(t, filePath, "other line\nmore lines!\n")
+	if restartIfFileWasTruncated(filePath, logFile, false) {
+		t.Fatal("Truncation was detected without comparing first lines")
+	}
+	if !restartIfFileWasTruncated(filePath, logFile, true) {
+		t.Fatal("Truncation was not detected when first lines were compared")
+	}
+	for !readSingleLineFromFileReturnTrueIfEOF(filePath, lines, logFile) {
+	}
+	if texts := receivedTestLines(lines); !slices.Equal(texts, []string{"other line", "more lines!"}) {
+		t.Errorf("Unexpected lines after truncation %v", texts)
+	}
+	if restartIfFileWasTruncated(filePath, logFile, true) {
+		t.Error("Truncation was detected again")
+	}
+}
+
+func TestFollowedFileIsReadAgainAfterTruncation(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "access.log")
+	os.WriteFile(filePath, []byte("line 1\nline 2\n"), 0644)
+	setTestConfig(t, filePath, &ConfigForAMonitoredFile{Follow: true})
+	shutdown := useTestShutdownChannel(t)
+	lines := make(chan inputs.LogLine, 10)
+	producerDone := make(chan struct{})
+	go func() {
+		produceLinesFromFile(filePath, lines)
+		close(producerDone)
+	}()
+	defer func() {
+		close(shutdown)
+		<-producerDone
+	}()
+	if texts := waitForTestLines(t, lines, 2); !slices.Equal(texts, []string{"line 1", "line 2"}) {
+		t.Fatalf("Unexpected lines %v", texts)
+	}
+	truncations := metrics.GetPipelineStats(filePath).Truncations.Load()
+
+	//copytruncate, the file gets smaller
+	os.WriteFile(filePath, []byte("new 1\n"), 0644)
+	if texts := waitForTestLines(t, lines, 1); !slices.Equal(texts, []string{"new 1"}) {
+		t.Fatalf("Unexpected lines after truncation %v", texts)
+	}
+	if metrics.GetPipelineStats(filePath).Truncations.Load() <= truncations {
+		t.Error("Truncation was not recorded")
+	}
+
+	//truncated and grew past the offset before it was noticed, only the first line is different
+	truncations = metrics.GetPipelineStats(filePath).Truncations.Load()
+	overwriteTestFile(t, filePath, "rewritten 1\nrewritten 2\n")
+	if texts := waitForTestLines(t, lines, 2); !slices.Equal(texts, []string{"rewritten 1", "rewritten 2"}) {
+		t.Fatalf("Unexpected lines after the file was rewritten %v", texts)
+	}
+	if metrics.GetPipelineStats(filePath).Truncations.Load() <= truncations {
+		t.Error("Truncation was not recorded after the file was rewritten")
+	}
+}
+
+func TestCheckpointIsSavedAfterMetricsAreSaved(t *testing.T) {
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoints.json")
+	setTestConfig(t, "test-checkpoint", &ConfigForAMonitoredFile{CheckpointFile: checkpointFile, TimeWindowSizeMinutes: 10})
+	metricsManager := metrics.NewSBOMetricsManager(2)
+	dataToBeSavedChannel := make(chan *metrics.SBOMetricWindowDataToBeSaved, 100)
+	positions := newProcessedLinePositions("test-checkpoint", newFileCheckpointer("test-checkpoint"), nil)
+	source := &inputs.FileIdentity{FirstLineHash: "abc"}
+	processLine := func(offset int64, timestamp time.Time) {
+		//what the METRICS handler does
+		if data := metricsManager.AddMetric("test-checkpoint", metrics.SBO_METRIC_REQ_COUNT, "", handlers.CalculateTimeWindow(timestamp, 10), 1); data != nil {
+			dataToBeSavedChannel <- data
+		}
+		positions.LineProcessed(inputs.LogLine{Source: source, Offset: offset}, &logparsers.SBOHttpRequestLog{Timestamp: timestamp})
+	}
+	savedCheckpoint := func() (inputs.FileCheckpoint, bool) {
+		//loaded again, as if processing restarted after a crash
+		store, err := inputs.LoadCheckpointStore(checkpointFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store.Get("test-checkpoint")
+	}
+	save := func() {
+		positions.lastSaved = time.Time{}
+		positions.Save(metricsManager, dataToBeSavedChannel, nil)
+		//what processMetricDataToBeSaved does
+		for len(dataToBeSavedChannel) > 0 {
+			if data := <-dataToBeSavedChannel; data.OnQueued != nil {
+				data.OnQueued()
+			}
+		}
+	}
+
+	firstWindow := time.Date(2025, 7, 1, 10, 0, 0, 0, time.Local)
+	processLine(100, firstWindow)
+	processLine(200, firstWindow.Add(time.Minute))
+	processLine(300, firstWindow.Add(10*time.Minute))
+	save()
+	if checkpoint, found := savedCheckpoint(); found {
+		t.Fatalf("Checkpoint was saved before metrics were saved %+v", checkpoint)
+	}
+
+	//metrics of the first window are sent for saving now
+	processLine(400, firstWindow.Add(20*time.Minute))
+	save()
+	checkpoint, found := savedCheckpoint()
+	if !found || checkpoint.Offset != 200 || !checkpoint.LastTimestamp.Equal(firstWindow.Add(time.Minute)) {
+		t.Fatalf("Unexpected checkpoint %+v", checkpoint)
+	}
+
+	//all metrics are saved when done
+	positions.commit(0)
+	positions.checkpointer.Save()
+	if checkpoint, _ := savedCheckpoint(); checkpoint.Offset != 400 {
+		t.Errorf("Unexpected checkpoint after processing was done %+v", checkpoint)
+	}
+}
+
+func TestLineUsedToDetectFormatIsProcessed(t *testing.T) {
+	setTestConfig(t, "test-format", &ConfigForAMonitoredFile{})
+	logLine := `192.0.2.1 - - [01/Jul/2025:10:01:00 +0000] "GET /p1 HTTP/1.1" 200 100 "-" "curl/8.5.0"`
+	parsedLogEntry, parserFunction := processSingleLogLine("test-format", logLine, "", nil, nil, nil, nil)
+	if parserFunction == nil {
+		t.Fatal("Format was not detected")
+	}
+	if parsedLogEntry == nil || parsedLogEntry.Path != "/p1" {
+		t.Errorf("Line used to detect the format was not processed %+v", parsedLogEntry)
+	}
+	parsedLogEntry, _ = processSingleLogLine("test-format", logLine, "", parserFunction, nil, nil, nil)
+	if parsedLogEntry == nil {
+		t.Error("Line was not processed using the detected format")
+	}
+}
+
+func TestIngestProgressIsSavedWhileProcessing(t *testing.T) {
+	databaseFile := filepath.Join(t.TempDir(), "sbo.db")
+	setTestConfig(t, "test-progress", &ConfigForAMonitoredFile{DbDriver: db.DB_DRIVER_SQLITE, DbDatabase: databaseFile, DomainName: "example.com",
+		TimeWindowSizeMinutes: 10, WriteMetricsToDb: true})
+	newWriter := func() *db.SBOBatchWriter {
+		storage := db.NewSBOSQLiteDB()
+		storage.Init("", "", "", databaseFile)
+		return db.NewSBOBatchWriter(storage, nil, nil, nil)
+	}
+	writer := newWriter()
+	metricsManager := metrics.NewSBOMetricsManager(2)
+	dataToBeSavedChannel := make(chan *metrics.SBOMetricWindowDataToBeSaved, 100)
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(1)
+	go processMetricDataToBeSaved("test-progress", dataToBeSavedChannel, &waitGroup, writer, nil)
+	defer func() {
+		close(dataToBeSavedChannel)
+		waitGroup.Wait()
+		writer.Close()
+	}()
+	tracker := newIngestProgressTracker("test-progress", writer)
+	positions := newProcessedLinePositions("test-progress", nil, tracker)
+	source := &inputs.FileIdentity{FirstLineHash: "abc"}
+	processLine := func(offset int64, timestamp time.Time) {
+		line := inputs.LogLine{Source: source, Offset: offset}
+		if isProcessed, _ := tracker.IsProcessed(line); isProcessed {
+			t.Fatalf("Line at %v was not processed before", offset)
+		}
+		if data := metricsManager.AddMetric("test-progress", metrics.SBO_METRIC_REQ_COUNT, "", handlers.CalculateTimeWindow(timestamp, 10), 1); data != nil {
+			dataToBeSavedChannel <- data
+		}
+		positions.LineProcessed(line, &logparsers.SBOHttpRequestLog{Timestamp: timestamp})
+	}
+	saveAndWait := func() {
+		positions.lastSaved = time.Time{}
+		positions.Save(metricsManager, dataToBeSavedChannel, writer)
+		saved := make(chan struct{})
+		dataToBeSavedChannel <- &metrics.SBOMetricWindowDataToBeSaved{OnQueued: func() {
+			writer.AfterQueuedRowsSaved(func() { close(saved) })
+		}}
+		select {
+		case <-saved:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Rows were not saved")
+		}
+	}
+
+	firstWindow := time.Date(2025, 7, 1, 10, 0, 0, 0, time.Local)
+	processLine(100, firstWindow)
+	processLine(200, firstWindow.Add(time.Minute))
+	processLine(300, firstWindow.Add(10*time.Minute))
+	processLine(400, firstWindow.Add(20*time.Minute))
+	saveAndWait()
+
+	//crashed, i.e the writer was not closed. Processing again skips lines of the first window only, their metrics were saved
+	restartedWriter := newWriter()
+	defer restartedWriter.Close()
+	restartedTracker := newIngestProgressTracker("test-progress", restartedWriter)
+	if isProcessed, _ := restartedTracker.IsProcessed(inputs.LogLine{Source: source, Offset: 200}); !isProcessed {
+		t.Error("Line of a saved time window was not skipped")
+	}
+	if isProcessed, _ := restartedTracker.IsProcessed(inputs.LogLine{Source: source, Offset: 300}); isProcessed {
+		t.Error("Line of a time window which was not saved was skipped")
+	}
+	var metricValue int64
+	storage := db.NewSBOSQLiteDB()
+	storage.Init("", "", "", databaseFile)
+	defer storage.Close()
+	storage.DbInstance.QueryRow("SELECT metric_value FROM sbo_metrics WHERE metric_type=? AND time_window=?",
+		metrics.SBO_METRIC_REQ_COUNT, handlers.CalculateTimeWindow(firstWindow, 10)).Scan(&metricValue)
+	if metricValue != 2 {
+		t.Errorf("Unexpected metric value of the first window %v", metricValue)
+	}
+}
+
+func TestIngestProgressIsNotTrackedWithoutDomainName(t *testing.T) {
+	setTestConfig(t, "test-progress-no-domain", &ConfigForAMonitoredFile{})
+	storage := db.NewSBOSQLiteDB()
+	storage.Init("", "", "", filepath.Join(t.TempDir(), "sbo.db"))
+	writer := db.NewSBOBatchWriter(storage, nil, nil, nil)
+	defer writer.Close()
+	if tracker := newIngestProgressTracker("test-progress-no-domain", writer); tracker != nil {
+		t.Error("Progress is tracked without a domain name")
+	}
+}
+
+type testIngestOffsetFailingStorage struct {
+	*db.SBOSQLiteDB
+	failures atomic.Int32
+}
+
+func (storage *testIngestOffsetFailingStorage) GetIngestOffset(domainId int, sourceId string) (int64, error) {
+	if storage.failures.Add(-1) >= 0 {
+		return 0, errors.New("database is not available")
+	}
+	return storage.SBOSQLiteDB.GetIngestOffset(domainId, sourceId)
+}
+
+func TestIngestOffsetIsReadAgainAfterFailure(t *testing.T) {
+	setTestConfig(t, "test-progress-failure", &ConfigForAMonitoredFile{DomainName: "example.com", TimeWindowSizeMinutes: 10})
+	previousInterval := ingestProgressRetryInterval
+	ingestProgressRetryInterval = time.Millisecond
+	t.Cleanup(func() { ingestProgressRetryInterval = previousInterval })
+	sqliteStorage := db.NewSBOSQLiteDB()
+	sqliteStorage.Init("", "", "", filepath.Join(t.TempDir(), "sbo.db"))
+	defer sqliteStorage.Close()
+	source := &inputs.FileIdentity{FirstLineHash: "abc"}
+	domainId, _ := sqliteStorage.GetDomainId("example.com", 10)
+	sqliteStorage.SaveIngestProgressBatch([]db.IngestProgressRow{{DomainId: domainId, SourceId: ingestSourceId(inputs.LogLine{Source: source}), Offset: 200}})
+
+	storage := &testIngestOffsetFailingStorage{SBOSQLiteDB: sqliteStorage}
+	storage.failures.Store(3)
+	tracker := newIngestProgressTracker("test-progress-failure", storage)
+	if isProcessed, err := tracker.IsProcessed(inputs.LogLine{Source: source, Offset: 100}); err != nil || !isProcessed {
+		t.Errorf("Line was not skipped after reading the offset failed %v %v", isProcessed, err)
+	}
+	if isProcessed, _ := tracker.IsProcessed(inputs.LogLine{Source: source, Offset: 300}); isProcessed {
+		t.Error("Line after the saved offset was skipped")
+	}
+
+	//shutting down while waiting, the line is neither processed nor skipped
+	useTestShutdownChannel(t)
+	close(globalShutdown)
+	storage.failures.Store(1000)
+	restartedTracker := newIngestProgressTracker("test-progress-failure", storage)
+	if _, err := restartedTracker.IsProcessed(inputs.LogLine{Source: source, Offset: 100}); err == nil {
+		t.Error("Offset was not read but no error was returned")
+	}
+	if _, found := restartedTracker.committedOffsets[ingestSourceId(inputs.LogLine{Source: source})]; found {
+		t.Error("Offset was cached after reading it failed")
+	}
+}
+
+func TestRefererSpamIsDetectedPerInput(t *testing.T) {
+	blocklistFile := filepath.Join(t.TempDir(), "spam.txt")
+	os.WriteFile(blocklistFile, []byte("spam-seo.xyz\n"), 0644)
+	setTestConfig(t, "test-spam", &ConfigForAMonitoredFile{DomainName: "example.com", RefererSpamBlocklistFile: blocklistFile})
+	setTestConfig(t, "test-no-spam", &ConfigForAMonitoredFile{DomainName: "example.com"})
+	logLine := `192.0.2.1 - - [01/Jul/2025:10:01:00 +0000] "GET / HTTP/1.1" 200 100 "https://spam-seo.xyz/" "curl/8.5.0"`
+	parsedLogEntry, _ := processSingleLogLine("test-spam", logLine, "", nil, nil, nil, newRefererSpamDetector("test-spam", getConfigForFile("test-spam")))
+	if parsedLogEntry == nil || !parsedLogEntry.RefererSpam {
+		t.Errorf("Spam referer was not detected %+v", parsedLogEntry)
+	}
+	if detector := newRefererSpamDetector("test-no-spam", getConfigForFile("test-no-spam")); detector != nil {
+		t.Error("Detector was created without a blocklist or heuristics")
+	}
+	parsedLogEntry, _ = processSingleLogLine("test-no-spam", logLine, "", nil, nil, nil, nil)
+	if parsedLogEntry == nil || parsedLogEntry.RefererSpam {
+		t.Errorf("Referer was flagged as spam for an input without a blocklist %+v", parsedLogEntry)
+	}
+}
@@ -0,0 +1,100 @@
+//go:build unix
+
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+)
+
+func newTestNamedPipe(t *testing.T) string {
+	pipePath := filepath.Join(t.TempDir(), "access.pipe")
+	if err := syscall.Mkfifo(pipePath, 0600); err != nil {
+		t.Skipf("Named pipes are not supported: %v", err)
+	}
+	return pipePath
+}
+
+func TestProduceLinesFromNamedPipe(t *testing.T) {
+	useTestShutdownChannel(t)
+	pipePath := newTestNamedPipe(t)
+	setTestConfig(t, pipePath, &ConfigForAMonitoredFile{})
+	lines := make(chan inputs.LogLine, 10)
+	done := make(chan struct{})
+	go func() {
+		produceLinesFromNamedPipe(pipePath, lines)
+		close(done)
+	}()
+	writer, err := os.OpenFile(pipePath, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open pipe for writing: %v", err)
+	}
+	writer.WriteString("line1\nline2\n")
+	writer.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Not following and the writer closed the pipe, but reading did not end")
+	}
+	if texts := receivedTestLines(lines); !slices.Equal(texts, []string{"line1", "line2"}) {
+		t.Errorf("Unexpected lines %v", texts)
+	}
+}
+
+func TestNamedPipeShutdown(t *testing.T) {
+	for _, withWriter := range []bool{false, true} {
+		shutdown := useTestShutdownChannel(t)
+		pipePath := newTestNamedPipe(t)
+		setTestConfig(t, pipePath, &ConfigForAMonitoredFile{Follow: true})
+		lines := make(chan inputs.LogLine, 10)
+		done := make(chan struct{})
+		go func() {
+			produceLinesFromNamedPipe(pipePath, lines)
+			close(done)
+		}()
+		if withWriter {
+			//an idle writer, reading blocks
+			writer, err := os.OpenFile(pipePath, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatalf("Failed to open pipe for writing: %v", err)
+			}
+			defer writer.Close()
+			writer.WriteString("line1\n")
+			time.Sleep(100 * time.Millisecond)
+		} else {
+			//waiting for a writer
+			time.Sleep(100 * time.Millisecond)
+		}
+		close(shutdown)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Reading the named pipe did not stop on shutdown, writer %t", withWriter)
+		}
+	}
+}
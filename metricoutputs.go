@@ -0,0 +1,100 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/SBOsoft/SBOLogProcessor/db"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+/*
+Returns outputs metric windows are pushed to in addition to the database, see MetricPushAddress, InfluxOutput and OtlpEndpoint
+*/
+func createMetricWindowOutputs(filePath string, config *ConfigForAMonitoredFile) []outputs.MetricWindowOutput {
+	var metricOutputs []outputs.MetricWindowOutput
+	if len(config.MetricPushAddress) > 0 {
+		format := config.MetricPushFormat
+		if len(format) < 1 {
+			format = outputs.METRIC_PUSH_FORMAT_STATSD
+		}
+		metricPusher, err := outputs.NewMetricPusher(format, config.MetricPushNetwork, config.MetricPushAddress, config.MetricPushNameTemplate, metrics.GetPipelineStats(filePath))
+		if err != nil {
+			slog.Error("Failed to create metric pusher, metrics will not be pushed", "filePath", filePath, "error", err)
+		} else {
+			metricOutputs = append(metricOutputs, metricPusher)
+		}
+	}
+	if len(config.InfluxOutput) > 0 {
+		metricOutputs = append(metricOutputs, outputs.NewInfluxWriter(config.InfluxOutput, config.InfluxToken, config.InfluxGzip, config.HostId, metrics.GetPipelineStats(filePath)))
+	}
+	if len(config.OtlpEndpoint) > 0 {
+		metricExporter, err := outputs.NewOtlpMetricExporter(config.OtlpEndpoint, config.OtlpEncoding, config.OtlpHeaders, config.HostId,
+			config.TimeWindowSizeMinutes, metrics.GetPipelineStats(filePath))
+		if err != nil {
+			slog.Error("Failed to create OTLP metric exporter, metrics will not be exported", "filePath", filePath, "error", err)
+		} else {
+			metricOutputs = append(metricOutputs, metricExporter)
+		}
+	}
+	return metricOutputs
+}
+
+/*
+Saves metric windows closed by the METRICS handler into the database when WriteMetricsToDb is true, and pushes them to metricOutputs
+*/
+func processMetricDataToBeSaved(filePath string, dataToBeSavedChannel chan *metrics.SBOMetricWindowDataToBeSaved, wg *sync.WaitGroup, sbodb db.SBOStorage,
+	metricOutputs []outputs.MetricWindowOutput) {
+
+	defer wg.Done()
+	config := getConfigForFile(filePath)
+	for dataToSave := range dataToBeSavedChannel {
+		if dataToSave.OnQueued != nil {
+			//metric data sent before it was pushed and queued for saving
+			dataToSave.OnQueued()
+			continue
+		}
+		domainName := config.DomainName
+		if len(dataToSave.DomainName) > 0 {
+			domainName = dataToSave.DomainName
+		}
+		for _, metricOutput := range metricOutputs {
+			metricOutput.Push(domainName, dataToSave)
+		}
+		if !config.WriteMetricsToDb || sbodb == nil {
+			//nothing to do here, just move
+			continue
+		}
+
+		domainId, _ := sbodb.GetDomainId(domainName, config.TimeWindowSizeMinutes)
+		/*
+			if domainId < 1 {
+				slog.Warn("domainId < 1 for data", "data", dataToSave)
+			}
+		*/
+		sbodb.SaveMetricData(dataToSave, domainId, config.ReplaceExistingMetrics)
+		slog.Debug("processMetricDataToBeSaved save data:", "dataToSave", dataToSave)
+	}
+
+	slog.Debug("processMetricDataToBeSaved done")
+}
@@ -22,6 +22,8 @@ package metrics
 import (
 	"log/slog"
 	"slices"
+	"strconv"
+	"time"
 )
 
 type SBOMetricMap map[int]map[string]*SBOMetric
@@ -30,6 +32,8 @@ type SBOMetricsManager struct {
 	allMetrics            map[string]SBOMetricMap
 	timeWindowTrackingMap map[string][]int64
 	windowSize            int
+	//file path => time window => location of timestamps in the time window, see SetTimeWindowLocation
+	timeWindowLocations map[string]map[int64]*time.Location
 }
 
 const SBO_METRIC_REQ_COUNT int = 1
@@ -46,6 +50,62 @@ const SBO_METRIC_DEVICE_TYPE int = 13
 const SBO_METRIC_IS_HUMAN int = 14
 const SBO_METRIC_REQUEST_INTENT int = 15
 
+// requests containing sensitive data such as passwords or api keys in the request uri or referer, keyed by path
+const SBO_METRIC_SENSITIVE_DATA int = 16
+
+// bytes sent for static assets embedded by foreign sites, keyed by referer domain
+const SBO_METRIC_HOTLINK_REFERER int = 17
+
+// bytes sent, keyed by referer domain
+const SBO_METRIC_REFERER_BYTES int = 18
+
+// bytes sent to clients exceeding the configured bytes per time window threshold, keyed by client ip
+const SBO_METRIC_BANDWIDTH_CLIENT int = 19
+
+// requests with a spam referer, keyed by referer domain. Spam referers are not included in SBO_METRIC_REFERER
+const SBO_METRIC_REFERER_SPAM int = 20
+
+// names of metric types, e.g for metric names in push outputs
+var sboMetricTypeNames = map[int]string{
+	SBO_METRIC_REQ_COUNT:        "requests",
+	SBO_METRIC_BYTES_SENT:       "bytes_sent",
+	SBO_METRIC_HTTP_STATUS:      "http_status",
+	SBO_METRIC_CLIENT_IP:        "client_ip",
+	SBO_METRIC_METHOD:           "method",
+	SBO_METRIC_REFERER:          "referer",
+	SBO_METRIC_PATH:             "path",
+	SBO_METRIC_UA_FAMILY:        "ua_family",
+	SBO_METRIC_OS_FAMILY:        "os_family",
+	SBO_METRIC_DEVICE_TYPE:      "device_type",
+	SBO_METRIC_IS_HUMAN:         "human",
+	SBO_METRIC_REQUEST_INTENT:   "intent",
+	SBO_METRIC_SENSITIVE_DATA:   "sensitive_data",
+	SBO_METRIC_HOTLINK_REFERER:  "hotlink_referer_bytes",
+	SBO_METRIC_REFERER_BYTES:    "referer_bytes",
+	SBO_METRIC_BANDWIDTH_CLIENT: "bandwidth_client_bytes",
+	SBO_METRIC_REFERER_SPAM:     "referer_spam",
+}
+
+// e.g requests for SBO_METRIC_REQ_COUNT, metric_<type> for unknown types
+func MetricTypeName(metricType int) string {
+	name, ok := sboMetricTypeNames[metricType]
+	if !ok {
+		return "metric_" + strconv.Itoa(metricType)
+	}
+	return name
+}
+
+/*
+Returns the start of a time window, e.g 2025-07-02 11:20 for 202507021120. Time windows don't include time zones,
+they are in the time zone of timestamps in logs, see SBOMetricWindowDataToBeSaved.TimeWindowLocation. Local time is used when location is nil
+*/
+func TimeWindowStartTime(timeWindow int64, location *time.Location) (time.Time, error) {
+	if location == nil {
+		location = time.Local
+	}
+	return time.ParseInLocation("200601021504", strconv.FormatInt(timeWindow, 10), location)
+}
+
 type SBOMetric struct {
 	//for keeping track of keys in sorted order
 	keys       []int64 `json:"-"`
@@ -61,6 +121,10 @@ type SBOMetricWindowDataToBeSaved struct {
 	KeyValue    string
 	TimeWindow  int64
 	MetricValue int64
+	//time zone of TimeWindow, i.e of log timestamps, nil if not known. Not saved in databases, time windows are saved as in logs
+	TimeWindowLocation *time.Location `json:"-"`
+	//when set, this is not metric data. Called by the receiver after data sent before it was queued for saving
+	OnQueued func() `json:"-"`
 }
 
 func NewSBOMetricWindowDataToBeSaved(filePath string, metricType int, keyValue string, timeWindow int64, metricValue int64) *SBOMetricWindowDataToBeSaved {
@@ -80,7 +144,8 @@ func NewSBOMetricsManager(timeWindowSize int) *SBOMetricsManager {
 	manager := SBOMetricsManager{
 		allMetrics:            m,
 		timeWindowTrackingMap: t,
-		windowSize:            timeWindowSize}
+		windowSize:            timeWindowSize,
+		timeWindowLocations:   make(map[string]map[int64]*time.Location)}
 
 	return &manager
 }
@@ -121,12 +186,36 @@ func (manager *SBOMetricsManager) AddMetric(filePath string, metricType int, key
 	timeWindowToBeSavedAsItMovedOutOfScope, metricValueToBeSaved := sbom.addValue(filePath, timeWindow, valueToAdd)
 
 	if timeWindowToBeSavedAsItMovedOutOfScope > 0 {
-		return NewSBOMetricWindowDataToBeSaved(filePath, metricType, keyValue, timeWindowToBeSavedAsItMovedOutOfScope, metricValueToBeSaved)
+		return manager.newDataToBeSaved(filePath, metricType, keyValue, timeWindowToBeSavedAsItMovedOutOfScope, metricValueToBeSaved)
 	} else {
 		return nil
 	}
 }
 
+/*
+Sets the time zone of a time window, e.g of the timestamp used to calculate it. Time windows are formatted in the time zone
+of log timestamps which may not be the local time zone, e.g logs received from other servers, and it may change, e.g daylight saving time
+*/
+func (manager *SBOMetricsManager) SetTimeWindowLocation(filePath string, timeWindow int64, location *time.Location) {
+	locations, ok := manager.timeWindowLocations[filePath]
+	if !ok {
+		locations = make(map[int64]*time.Location)
+		manager.timeWindowLocations[filePath] = locations
+	}
+	locations[timeWindow] = location
+}
+
+// nil if not set
+func (manager *SBOMetricsManager) TimeWindowLocation(filePath string, timeWindow int64) *time.Location {
+	return manager.timeWindowLocations[filePath][timeWindow]
+}
+
+func (manager *SBOMetricsManager) newDataToBeSaved(filePath string, metricType int, keyValue string, timeWindow int64, metricValue int64) *SBOMetricWindowDataToBeSaved {
+	data := NewSBOMetricWindowDataToBeSaved(filePath, metricType, keyValue, timeWindow, metricValue)
+	data.TimeWindowLocation = manager.TimeWindowLocation(filePath, timeWindow)
+	return data
+}
+
 func (sbm *SBOMetric) IncrementKeyCounter() {
 	sbm.keyCounter++
 }
@@ -176,6 +265,61 @@ func (manager *SBOMetricsManager) doTimeWindowTracking(filePath string, timeWind
 
 }
 
+/*
+Sends values of time windows older than the most recent time windows of the file to dataToBeSavedChannel and removes them,
+i.e values of keys which did not receive values for a while. Other values are sent when newer values are added, see addValue
+*/
+func (manager *SBOMetricsManager) SaveClosedTimeWindows(filePath string, dataToBeSavedChannel chan *SBOMetricWindowDataToBeSaved) {
+	trackedTimeWindows := manager.timeWindowTrackingMap[filePath]
+	if len(trackedTimeWindows) < 1 || slices.Contains(trackedTimeWindows, 0) {
+		//not enough time windows yet
+		return
+	}
+	oldestTrackedTimeWindow := slices.Min(trackedTimeWindows)
+	for metricType, keyMap := range manager.allMetrics[filePath] {
+		for keyValue, sbom := range keyMap {
+			removed := false
+			for index, timeWindow := range sbom.keys {
+				if timeWindow > 0 && timeWindow < oldestTrackedTimeWindow {
+					dataToBeSavedChannel <- manager.newDataToBeSaved(filePath, metricType, keyValue, timeWindow, sbom.Values[timeWindow])
+					delete(sbom.Values, timeWindow)
+					sbom.keys[index] = 0
+					removed = true
+				}
+			}
+			if len(sbom.Values) < 1 {
+				delete(keyMap, keyValue)
+			} else if removed {
+				slices.Sort(sbom.keys)
+			}
+		}
+	}
+	//older time windows don't have values anymore
+	for timeWindow := range manager.timeWindowLocations[filePath] {
+		if timeWindow < oldestTrackedTimeWindow {
+			delete(manager.timeWindowLocations[filePath], timeWindow)
+		}
+	}
+}
+
+/*
+Returns the oldest time window with values which were not sent for saving yet, 0 if there are none.
+Values of older time windows were sent for saving, or dropped as they were received too late
+*/
+func (manager *SBOMetricsManager) OldestUnsavedTimeWindow(filePath string) int64 {
+	var oldestTimeWindow int64 = 0
+	for _, keyMap := range manager.allMetrics[filePath] {
+		for _, sbom := range keyMap {
+			for timeWindow := range sbom.Values {
+				if oldestTimeWindow == 0 || timeWindow < oldestTimeWindow {
+					oldestTimeWindow = timeWindow
+				}
+			}
+		}
+	}
+	return oldestTimeWindow
+}
+
 /*
 return timeWindow and the metric value for that timeWindow when the timeWindow is removed out of scope
 the caller may want to save the removed timeWindow and the metric value
@@ -185,22 +329,21 @@ func (sbm *SBOMetric) addValue(filePath string, timeWindow int64, valueToAdd int
 	var timeWindowToBeSaved int64 = 0
 	var metricValue int64 = 0
 	//	slog.Warn("timeWindow for timestamp", "timestamp", eventTimestamp, "timeWindow", timeWindow, "error", err)
-	if sbm.Values[timeWindow] < 1 {
-		sbm.keys[0] = timeWindow
-		slices.Sort(sbm.keys)
-		//after this sort, [0] will always be the smallest key value
-		if sbm.keyCounter >= sbm.manager.windowSize {
-			if sbm.keys[0] == timeWindow {
+	if _, found := sbm.Values[timeWindow]; !found {
+		//keys is sorted, unused items are 0 so [0] is either unused or the smallest key value when all items are used
+		if sbm.keys[0] > 0 {
+			if timeWindow < sbm.keys[0] {
 				//don't add or save as the new timeWindow is less than existing items. e.g we received an old entry unexpectedly
 				//TODO report?
 				return 0, 0
-			} else {
-				//now remove the smallest item which is at keys[0]
-				metricValue = sbm.Values[sbm.keys[0]]
-				delete(sbm.Values, sbm.keys[0])
-				timeWindowToBeSaved = sbm.keys[0]
 			}
+			//now remove the smallest item which is at keys[0]
+			metricValue = sbm.Values[sbm.keys[0]]
+			delete(sbm.Values, sbm.keys[0])
+			timeWindowToBeSaved = sbm.keys[0]
 		}
+		sbm.keys[0] = timeWindow
+		slices.Sort(sbm.keys)
 		sbm.Values[timeWindow] = valueToAdd
 		sbm.IncrementKeyCounter()
 	} else {
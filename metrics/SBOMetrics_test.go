@@ -21,6 +21,7 @@ package metrics
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSBOMetricTimeWindow(t *testing.T) {
@@ -36,3 +37,113 @@ func TestSBOMetricTimeWindow(t *testing.T) {
 	}
 
 }
+
+func TestMetricTypeName(t *testing.T) {
+	if name := MetricTypeName(SBO_METRIC_UA_FAMILY); name != "ua_family" {
+		t.Errorf("Unexpected name %q", name)
+	}
+	if name := MetricTypeName(999); name != "metric_999" {
+		t.Errorf("Unexpected name %q for unknown type", name)
+	}
+}
+
+func TestTimeWindowStartTime(t *testing.T) {
+	start, err := TimeWindowStartTime(202511172030, nil)
+	if err != nil || !start.Equal(time.Date(2025, 11, 17, 20, 30, 0, 0, time.Local)) {
+		t.Errorf("Unexpected start time %v %v", start, err)
+	}
+	//e.g logs of a server in another time zone
+	start, err = TimeWindowStartTime(202511172030, time.FixedZone("", 3*3600))
+	if err != nil || !start.Equal(time.Date(2025, 11, 17, 17, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected start time %v %v in another time zone", start, err)
+	}
+	if _, err := TimeWindowStartTime(2025, nil); err == nil {
+		t.Error("Invalid time window was parsed")
+	}
+}
+
+func TestAddMetricSavesOldestTimeWindow(t *testing.T) {
+	metricManager := NewSBOMetricsManager(3)
+	timeWindows := []int64{202511172010, 202511172020, 202511172030}
+	for _, tw := range timeWindows {
+		if data := metricManager.AddMetric("unittest", SBO_METRIC_REQ_COUNT, "", tw, 1); data != nil {
+			t.Errorf("Unexpected data to be saved for %d: %v", tw, data)
+		}
+	}
+	data := metricManager.AddMetric("unittest", SBO_METRIC_REQ_COUNT, "", 202511172040, 1)
+	if data == nil || data.TimeWindow != 202511172010 || data.MetricValue != 1 {
+		t.Errorf("Oldest time window was not returned for saving: %v", data)
+	}
+	if data := metricManager.AddMetric("unittest", SBO_METRIC_REQ_COUNT, "", 202511172000, 1); data != nil {
+		t.Errorf("Unexpected data to be saved for an old time window: %v", data)
+	}
+	if oldest := metricManager.OldestUnsavedTimeWindow("unittest"); oldest != 202511172020 {
+		t.Errorf("Unexpected oldest unsaved time window %d", oldest)
+	}
+	if oldest := metricManager.OldestUnsavedTimeWindow("other"); oldest != 0 {
+		t.Errorf("Unexpected oldest unsaved time window %d for a file without metrics", oldest)
+	}
+}
+
+func TestSaveClosedTimeWindows(t *testing.T) {
+	metricManager := NewSBOMetricsManager(3)
+	dataToBeSavedChannel := make(chan *SBOMetricWindowDataToBeSaved, 100)
+	metricManager.AddMetric("unittest", SBO_METRIC_HTTP_STATUS, "418", 202511172010, 1)
+	metricManager.SaveClosedTimeWindows("unittest", dataToBeSavedChannel)
+	if len(dataToBeSavedChannel) > 0 {
+		t.Fatal("Time windows were saved before enough time windows were seen")
+	}
+	for _, tw := range []int64{202511172020, 202511172030, 202511172040, 202511172050} {
+		metricManager.AddMetric("unittest", SBO_METRIC_HTTP_STATUS, "200", tw, 1)
+	}
+	metricManager.SaveClosedTimeWindows("unittest", dataToBeSavedChannel)
+	if len(dataToBeSavedChannel) != 1 {
+		t.Fatalf("Unexpected number of saved values %d", len(dataToBeSavedChannel))
+	}
+	data := <-dataToBeSavedChannel
+	if data.KeyValue != "418" || data.TimeWindow != 202511172010 || data.MetricValue != 1 {
+		t.Errorf("Unexpected saved value %v", data)
+	}
+	if _, found := metricManager.GetAllMetricsForFile("unittest")[SBO_METRIC_HTTP_STATUS]["418"]; found {
+		t.Error("Key without values was not removed")
+	}
+	if oldest := metricManager.OldestUnsavedTimeWindow("unittest"); oldest != 202511172030 {
+		t.Errorf("Unexpected oldest unsaved time window %d", oldest)
+	}
+	//the key can be used again
+	metricManager.AddMetric("unittest", SBO_METRIC_HTTP_STATUS, "418", 202511172050, 2)
+	if value := metricManager.GetAllMetricsForFile("unittest")[SBO_METRIC_HTTP_STATUS]["418"].Values[202511172050]; value != 2 {
+		t.Errorf("Unexpected value %d", value)
+	}
+}
+
+func TestTimeWindowLocationIsSaved(t *testing.T) {
+	metricManager := NewSBOMetricsManager(3)
+	dataToBeSavedChannel := make(chan *SBOMetricWindowDataToBeSaved, 100)
+	//e.g daylight saving time started
+	beforeDst := time.FixedZone("", 2*3600)
+	afterDst := time.FixedZone("", 3*3600)
+	metricManager.SetTimeWindowLocation("unittest", 202503300150, beforeDst)
+	metricManager.AddMetric("unittest", SBO_METRIC_HTTP_STATUS, "418", 202503300150, 1)
+	for _, tw := range []int64{202503300300, 202503300310, 202503300320} {
+		metricManager.SetTimeWindowLocation("unittest", tw, afterDst)
+		metricManager.AddMetric("unittest", SBO_METRIC_REQ_COUNT, "", tw, 1)
+	}
+	data := metricManager.AddMetric("unittest", SBO_METRIC_REQ_COUNT, "", 202503300330, 1)
+	if data == nil || data.TimeWindow != 202503300300 || data.TimeWindowLocation != afterDst {
+		t.Errorf("Unexpected data %+v", data)
+	}
+	metricManager.SaveClosedTimeWindows("unittest", dataToBeSavedChannel)
+	if len(dataToBeSavedChannel) != 1 {
+		t.Fatalf("Unexpected number of saved values %d", len(dataToBeSavedChannel))
+	}
+	if data := <-dataToBeSavedChannel; data.TimeWindow != 202503300150 || data.TimeWindowLocation != beforeDst {
+		t.Errorf("Unexpected data %+v", data)
+	}
+	if location := metricManager.TimeWindowLocation("unittest", 202503300150); location != nil {
+		t.Errorf("Location of a time window without values was not removed %v", location)
+	}
+	if location := metricManager.TimeWindowLocation("unittest", 202503300330); location != nil {
+		t.Errorf("Unexpected location of a time window without a location %v", location)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package metrics
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Counters about reading and processing an input, e.g a monitored file. These are about the app itself, not about the logs.
+Safe for concurrent use
+*/
+type SBOPipelineStats struct {
+	FilePath       string
+	LinesRead      atomic.Int64
+	BytesRead      atomic.Int64
+	LinesProcessed atomic.Int64
+	ParseErrors    atomic.Int64
+	//lines which were skipped because they were processed and saved into the database before, see db/ingestprogress.go
+	LinesSkipped atomic.Int64
+	//lines which were received but not processed, e.g syslog messages without a matching configuration entry
+	Dropped atomic.Int64
+	//files renamed or removed (e.g logrotate default mode) while following
+	Rotations atomic.Int64
+	//files truncated in place (e.g logrotate copytruncate mode) while following
+	Truncations atomic.Int64
+	//unix timestamp of the last rotation or truncation, 0 if none
+	LastRotationTime atomic.Int64
+	//progress of processing rotated files before the file itself, bytes are compressed bytes for compressed files
+	BackfillFilesTotal atomic.Int64
+	BackfillFilesDone  atomic.Int64
+	BackfillBytesTotal atomic.Int64
+	BackfillBytesDone  atomic.Int64
+	//database writes, see db.SBOBatchWriter. Rows are metric and raw log rows, DbWriteNanos is the total time spent in flushes
+	DbRowsWritten    atomic.Int64
+	DbBatchesWritten atomic.Int64
+	DbWriteErrors    atomic.Int64
+	DbWriteNanos     atomic.Int64
+	//rows waiting in the spool because the database was not available and the size of the spool, see db.SBOSpool
+	DbSpoolRows  atomic.Int64
+	DbSpoolBytes atomic.Int64
+	//spooled rows which were deleted because the spool was full or invalid
+	DbSpoolDroppedRows atomic.Int64
+	//lines (e.g statsd metrics) sent by push outputs, failed sends and lines dropped because sends failed repeatedly, see outputs.MetricPusher
+	OutputLinesSent    atomic.Int64
+	OutputSendErrors   atomic.Int64
+	OutputDroppedLines atomic.Int64
+}
+
+func (stats *SBOPipelineStats) RecordRotation(truncated bool) {
+	if truncated {
+		stats.Truncations.Add(1)
+	} else {
+		stats.Rotations.Add(1)
+	}
+	stats.LastRotationTime.Store(time.Now().Unix())
+}
+
+var pipelineStatsMutex sync.Mutex
+var pipelineStatsRegistry map[string]*SBOPipelineStats = make(map[string]*SBOPipelineStats)
+
+// Returns stats for the file, creating them on first use
+func GetPipelineStats(filePath string) *SBOPipelineStats {
+	pipelineStatsMutex.Lock()
+	defer pipelineStatsMutex.Unlock()
+	stats, ok := pipelineStatsRegistry[filePath]
+	if !ok {
+		stats = &SBOPipelineStats{FilePath: filePath}
+		pipelineStatsRegistry[filePath] = stats
+	}
+	return stats
+}
+
+// Returns stats for all files, keyed by file path
+func GetAllPipelineStats() map[string]*SBOPipelineStats {
+	pipelineStatsMutex.Lock()
+	defer pipelineStatsMutex.Unlock()
+	return maps.Clone(pipelineStatsRegistry)
+}
@@ -0,0 +1,40 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package metrics
+
+import "testing"
+
+func TestPipelineStats(t *testing.T) {
+	stats := GetPipelineStats("/tmp/pipelinestats-test.log")
+	if GetPipelineStats("/tmp/pipelinestats-test.log") != stats {
+		t.Fatalf("Expected the same stats instance for the same file")
+	}
+	stats.LinesRead.Add(2)
+	stats.RecordRotation(true)
+	stats.RecordRotation(false)
+	stats.RecordRotation(true)
+	if stats.Truncations.Load() != 2 || stats.Rotations.Load() != 1 || stats.LastRotationTime.Load() == 0 {
+		t.Errorf("Unexpected rotation stats %v %v", stats.Truncations.Load(), stats.Rotations.Load())
+	}
+	allStats := GetAllPipelineStats()
+	if allStats["/tmp/pipelinestats-test.log"].LinesRead.Load() != 2 {
+		t.Errorf("Unexpected stats in GetAllPipelineStats")
+	}
+}
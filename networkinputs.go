@@ -0,0 +1,167 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/SBOsoft/SBOLogProcessor/inputs"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// there may be an entry with this name in the config file, to receive logs via syslog, see SYSLOG_INPUT_KEY_PREFIX
+const SYSLOG_CONFIG_KEY string = "--syslog--"
+
+// configuration entries for logs received via syslog are keyed using this prefix and the syslog tag (program name), e.g syslog:nginx
+// syslog:* receives messages with tags without a configuration entry
+const SYSLOG_INPUT_KEY_PREFIX string = "syslog:"
+const SYSLOG_INPUT_ANY_TAG string = "*"
+
+// there may be an entry with this name in the config file, to receive logs pushed via http, see HTTP_INGEST_INPUT_KEY_PREFIX
+const HTTP_INGEST_CONFIG_KEY string = "--http-ingest--"
+
+// configuration entries for logs pushed via http are keyed using this prefix and the source parameter of requests, e.g http:myapp
+const HTTP_INGEST_INPUT_KEY_PREFIX string = "http:"
+
+// lines channel size for http ingest inputs, requests are rejected with HTTP 429 when the channel is full
+const HTTP_INGEST_INPUT_BUFFER_SIZE int = 1000
+
+/*
+Receives logs via syslog (see SYSLOG_CONFIG_KEY) and routes messages to syslog:<tag> configuration entries using syslog tags.
+Each entry is processed like a file, with its own handlers.
+*/
+func processSyslogInputs(parentWaitGroup *sync.WaitGroup) {
+	defer parentWaitGroup.Done()
+	config := getConfigForFile(SYSLOG_CONFIG_KEY)
+	//tag => lines channel of the input
+	routes := make(map[string]chan inputs.LogLine)
+	routeStats := make(map[string]*metrics.SBOPipelineStats)
+	globalConfigMutex.RLock()
+	for inputKey := range globalConfig {
+		if tag, found := strings.CutPrefix(inputKey, SYSLOG_INPUT_KEY_PREFIX); found {
+			routes[tag] = make(chan inputs.LogLine, 100)
+			routeStats[tag] = metrics.GetPipelineStats(inputKey)
+		}
+	}
+	globalConfigMutex.RUnlock()
+	if len(routes) < 1 {
+		slog.Error("Syslog receiver is configured but there are no syslog inputs, add configuration entries like " + SYSLOG_INPUT_KEY_PREFIX + "nginx")
+		return
+	}
+
+	syslogStats := metrics.GetPipelineStats(SYSLOG_CONFIG_KEY)
+	server := inputs.NewSyslogServer(config.SyslogUDPAddress, config.SyslogTCPAddress, func(message *inputs.SyslogMessage) {
+		syslogStats.LinesRead.Add(1)
+		tag := message.Tag
+		lines, ok := routes[tag]
+		if !ok {
+			tag = SYSLOG_INPUT_ANY_TAG
+			lines, ok = routes[tag]
+		}
+		if !ok {
+			syslogStats.Dropped.Add(1)
+			return
+		}
+		routeStats[tag].LinesRead.Add(1)
+		routeStats[tag].BytesRead.Add(int64(len(message.Message)))
+		lines <- inputs.LogLine{Text: strings.TrimSpace(message.Message)}
+	})
+	if err := server.Start(); err != nil {
+		slog.Error("Failed to start syslog receiver", "udpAddress", config.SyslogUDPAddress, "tcpAddress", config.SyslogTCPAddress, "error", err)
+		return
+	}
+	slog.Info("Started syslog receiver", "udpAddress", config.SyslogUDPAddress, "tcpAddress", config.SyslogTCPAddress, "tags", slices.Collect(maps.Keys(routes)))
+
+	for tag, lines := range routes {
+		parentWaitGroup.Add(1)
+		//lines channels are closed after the server is stopped, i.e nothing will be sent to them anymore
+		go processInput(SYSLOG_INPUT_KEY_PREFIX+tag, lines, func() {
+			<-server.Stopped()
+			close(lines)
+		}, parentWaitGroup)
+	}
+
+	<-globalShutdown
+	server.Stop()
+	slog.Info("Stopped syslog receiver", "received", syslogStats.LinesRead.Load(), "dropped", syslogStats.Dropped.Load())
+}
+
+/*
+Receives log lines pushed via http (see HTTP_INGEST_CONFIG_KEY) and routes them to http:<source> configuration entries
+using the source parameter of requests. Each entry is processed like a file, with its own handlers.
+*/
+func processHttpIngestInputs(parentWaitGroup *sync.WaitGroup) {
+	defer parentWaitGroup.Done()
+	config := getConfigForFile(HTTP_INGEST_CONFIG_KEY)
+	//source => lines channel of the input
+	routes := make(map[string]chan inputs.LogLine)
+	routeStats := make(map[string]*metrics.SBOPipelineStats)
+	globalConfigMutex.RLock()
+	for inputKey := range globalConfig {
+		if source, found := strings.CutPrefix(inputKey, HTTP_INGEST_INPUT_KEY_PREFIX); found {
+			routes[source] = make(chan inputs.LogLine, HTTP_INGEST_INPUT_BUFFER_SIZE)
+			routeStats[source] = metrics.GetPipelineStats(inputKey)
+		}
+	}
+	globalConfigMutex.RUnlock()
+	if len(routes) < 1 {
+		slog.Error("Http ingest is configured but there are no http inputs, add configuration entries like " + HTTP_INGEST_INPUT_KEY_PREFIX + "myapp")
+		return
+	}
+
+	server := inputs.NewHttpIngestServer(config.HttpIngestAddress, config.HttpIngestToken, func(source string, line string) error {
+		lines, ok := routes[source]
+		if !ok {
+			return inputs.ErrHttpIngestUnknownSource
+		}
+		select {
+		case lines <- inputs.LogLine{Text: line}:
+			routeStats[source].LinesRead.Add(1)
+			routeStats[source].BytesRead.Add(int64(len(line)))
+			return nil
+		default:
+			//consumer is behind, don't buffer more lines
+			routeStats[source].Dropped.Add(1)
+			return inputs.ErrHttpIngestBusy
+		}
+	})
+	if err := server.Start(); err != nil {
+		slog.Error("Failed to start http ingest server", "address", config.HttpIngestAddress, "error", err)
+		return
+	}
+	slog.Info("Started http ingest server", "address", config.HttpIngestAddress, "path", inputs.HTTP_INGEST_PATH, "sources", slices.Collect(maps.Keys(routes)))
+
+	for source, lines := range routes {
+		parentWaitGroup.Add(1)
+		//lines channels are closed after the server is stopped, i.e nothing will be sent to them anymore
+		go processInput(HTTP_INGEST_INPUT_KEY_PREFIX+source, lines, func() {
+			<-server.Stopped()
+			close(lines)
+		}, parentWaitGroup)
+	}
+
+	<-globalShutdown
+	server.Stop()
+	slog.Info("Stopped http ingest server")
+}
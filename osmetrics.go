@@ -0,0 +1,180 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/db"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+	"github.com/SBOsoft/SBOLogProcessor/outputs"
+)
+
+func setupOSMetricsCollection(wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	now := time.Now()
+	currentMinute := now.Minute()
+
+	//Find the next target minute. We want to start OS metrics collection on the scheduled minute
+	// e.g if you want to collect metrics at 0, 10, 20, 30, 40, 50, 60 minutes and the process was started at 07:33
+	// we will wait for 2 minutes 27 seconds and start at 10:00
+	var metricsRunInterval int = 0
+	nextTargetMinute := 0
+	switch getConfigForFile(OSMETRICS_CONFIG_KEY).OSMetricsIntervalMinutes {
+	case 1:
+		nextTargetMinute = currentMinute + 1
+		metricsRunInterval = 1
+	case 5:
+		//must end with 0 or 5
+		if currentMinute%10 == 0 {
+			nextTargetMinute = currentMinute
+		} else if currentMinute%10 > 5 {
+			nextTargetMinute = currentMinute + (10 - (currentMinute % 10))
+		} else {
+			nextTargetMinute = currentMinute + (5 - (currentMinute % 10))
+		}
+		metricsRunInterval = 5
+	case 15:
+		//must end with one of 00 15 30 45
+		if currentMinute > 45 {
+			nextTargetMinute = 60
+		} else if currentMinute > 30 {
+			nextTargetMinute = 45
+		} else if currentMinute > 15 {
+			nextTargetMinute = 30
+		} else if currentMinute > 0 {
+			nextTargetMinute = 15
+		} else {
+			nextTargetMinute = 0
+		}
+		metricsRunInterval = 15
+	case 30:
+		//must end with 00 or 30
+		if currentMinute > 30 {
+			nextTargetMinute = 60
+		} else {
+			nextTargetMinute = 30
+		}
+		metricsRunInterval = 30
+	case 60:
+		//must end with 00
+		nextTargetMinute = 60
+		metricsRunInterval = 60
+	default: //default is 10. time window  must end with one of 00, 10, 20, 30, 40, 50
+		//must end with 0 or 5
+		if currentMinute%10 == 0 {
+			nextTargetMinute = currentMinute
+		} else {
+			nextTargetMinute = currentMinute + (10 - (currentMinute % 10))
+		}
+		metricsRunInterval = 10
+	}
+
+	// Calculate the time to the next target minute
+	nextRunTime := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), nextTargetMinute, 0, 0, now.Location())
+
+	initialDelay := nextRunTime.Sub(now)
+
+	if initialDelay > 0 {
+		slog.Info("Will start OS metrics collection at", "time", nextRunTime, "initialDelay", initialDelay.Round(time.Second))
+		// Wait for the initial delay
+		select {
+		case <-time.After(initialDelay):
+		case <-globalShutdown:
+			return
+		}
+	}
+
+	osMetricsConfig := getConfigForFile(OSMETRICS_CONFIG_KEY)
+	var influxWriter *outputs.InfluxWriter
+	if len(osMetricsConfig.InfluxOutput) > 0 {
+		influxWriter = outputs.NewInfluxWriter(osMetricsConfig.InfluxOutput, osMetricsConfig.InfluxToken, osMetricsConfig.InfluxGzip, osMetricsConfig.HostId,
+			metrics.GetPipelineStats(OSMETRICS_CONFIG_KEY))
+		defer influxWriter.Close()
+	}
+
+	//db conn, not needed when OS metrics are written only to influx
+	var sbodb db.SBOStorage
+	if influxWriter == nil || len(osMetricsConfig.DbDatabase) > 0 {
+		storage, err := db.NewSBOStorage(osMetricsConfig.DbDriver)
+		if err != nil {
+			slog.Warn("Failed to create database storage for OS metrics", "error", err)
+			return
+		}
+		dbInitialized, err := storage.Init(osMetricsConfig.DbUser, osMetricsConfig.DbPassword, osMetricsConfig.DbAddress, osMetricsConfig.DbDatabase)
+		if !dbInitialized {
+			slog.Warn("Failed to initialize database connection for OS metrics. Check database settings for OS metrics entry with key "+OSMETRICS_CONFIG_KEY+" in the configuration file", "error", err)
+			return
+		}
+		sbodb = storage
+		defer sbodb.Close()
+	}
+
+	// Run the function immediately after the initial delay
+	slog.Debug("Start OS metrics initial run")
+	if !processOSMetrics(sbodb, influxWriter, true) {
+		//if it didn't work on the first attempt it's probably not necessary to try again, e.g it's an unsupported OS
+		slog.Warn("NOT starting OS metrics collection. Initial attempt failed and won't try again. See supported operating systems in documentation")
+		return
+	}
+
+	// Set up a ticker to run every metricsRunInterval minutes
+	ticker := time.NewTicker(time.Duration(metricsRunInterval) * time.Minute)
+	defer ticker.Stop() // Ensure the ticker is stopped when func exits
+
+	for {
+		select {
+		case <-ticker.C:
+			slog.Debug("Collecting OS metrics in scheduled task")
+			processOSMetrics(sbodb, influxWriter, false)
+		case <-globalShutdown:
+			return
+		}
+	}
+
+}
+
+// sbodb or influxWriter may be nil
+func processOSMetrics(sbodb db.SBOStorage, influxWriter *outputs.InfluxWriter, isInitialCall bool) bool {
+	uptimeInfo, err := metrics.GetOSUptimeInfo()
+
+	if err != nil {
+		slog.Warn("Failed to collect OS uptime info. This feature is not available on all platforms. Check supported operating systems.", "error", err)
+		return false
+	}
+
+	memoryInfo, err := metrics.GetOSMemoryInfo()
+	if err != nil && isInitialCall { //don't repeat the same log message forever, log only the first time
+		slog.Warn("Failed to collect OS memory info. This feature is not available on all platforms. Check supported operating systems.", "error", err)
+		//not returning false as at least uptime worked
+		//return false
+	}
+	if influxWriter != nil {
+		influxWriter.PushOSMetrics(uptimeInfo, memoryInfo, time.Now())
+	}
+	if sbodb == nil {
+		return true
+	}
+	saveResult, _ := sbodb.SaveOSMetrics(uptimeInfo, memoryInfo, getConfigForFile(OSMETRICS_CONFIG_KEY).HostId)
+	return saveResult
+}
@@ -0,0 +1,329 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	// index names can include {domain} and {date} placeholders, dates are in UTC
+	ELASTICSEARCH_DEFAULT_INDEX     string = "sbologp-{date}"
+	ELASTICSEARCH_INDEX_DATE_LAYOUT string = "2006.01.02"
+	// used when the index name has no text other than placeholders
+	ELASTICSEARCH_DEFAULT_TEMPLATE_NAME string = "sbologp"
+
+	ELASTICSEARCH_BATCH_SIZE     int           = 1000
+	ELASTICSEARCH_MAX_PENDING    int           = 50000
+	ELASTICSEARCH_FLUSH_INTERVAL time.Duration = 10 * time.Second
+	ELASTICSEARCH_HTTP_TIMEOUT   time.Duration = 30 * time.Second
+)
+
+// characters which are not allowed in index names are replaced with _ in domain names, see elasticsearchIndexName
+var elasticsearchInvalidIndexCharsRegex = regexp.MustCompile(`[^a-z0-9._-]`)
+
+/*
+Mappings for log entries, strings are keywords. ClientIP is an ip field, malformed values (e.g host names) are not indexed.
+Created as a composable index template, supported by Elasticsearch 7.8+ and OpenSearch
+*/
+var elasticsearchTemplateMappings = map[string]any{
+	"dynamic_templates": []any{
+		map[string]any{"strings": map[string]any{
+			"match_mapping_type": "string",
+			"mapping":            map[string]any{"type": "keyword", "ignore_above": 2048}}}},
+	"properties": map[string]any{
+		"Timestamp":         map[string]any{"type": "date"},
+		"ClientIP":          map[string]any{"type": "ip", "ignore_malformed": true},
+		"BytesSent":         map[string]any{"type": "long"},
+		"Malicious":         map[string]any{"type": "integer"},
+		"RequestTime":       map[string]any{"type": "long"},
+		"RequestTimeLogged": map[string]any{"type": "boolean"},
+		"IsOutOfOrder":      map[string]any{"type": "boolean"},
+		"RefererSpam":       map[string]any{"type": "boolean"},
+		"HostId":            map[string]any{"type": "integer"}}}
+
+type elasticsearchBulkItem struct {
+	index string
+	//LineHash of the entry, makes sending the same line again idempotent. Empty if not available, e.g logs are not saved into the database
+	id       string
+	document []byte
+}
+
+// log entry with the host id, ClientIP shadows ClientIP of the entry so it's omitted when IPs are masked
+type elasticsearchDocument struct {
+	logparsers.SBOHttpRequestLog
+	ClientIP string `json:",omitempty"`
+	HostId   int
+}
+
+/*
+Ships parsed log entries to Elasticsearch or OpenSearch using the _bulk api, into indices named using an index name template,
+e.g sbologp-{date} for daily indices. An index template with mappings is created before the first bulk request if there is none.
+Entries are sent in batches, see lineBatcher. Items rejected with 429 or server errors are sent again, other rejected items are dropped
+*/
+type ElasticsearchWriter struct {
+	baseUrl      string
+	index        string
+	templateName string
+	templateDone bool
+	user         string
+	password     string
+	apiKey       string
+	hostId       int
+	maskIPs      bool
+	httpClient   *http.Client
+	batcher      *lineBatcher[elasticsearchBulkItem]
+}
+
+/*
+baseUrl is the url of the cluster, e.g http://localhost:9200. index is the index name template, defaults to ELASTICSEARCH_DEFAULT_INDEX.
+Basic authentication is used when user is not empty, apiKey is sent as "Authorization: ApiKey <apiKey>" when not empty
+*/
+func NewElasticsearchWriter(baseUrl string, index string, user string, password string, apiKey string, hostId int, maskIPs bool,
+	stats *metrics.SBOPipelineStats) (*ElasticsearchWriter, error) {
+	if !strings.HasPrefix(baseUrl, "http://") && !strings.HasPrefix(baseUrl, "https://") {
+		return nil, fmt.Errorf("elasticsearch url %q is not an http url", baseUrl)
+	}
+	if len(index) < 1 {
+		index = ELASTICSEARCH_DEFAULT_INDEX
+	}
+	writer := &ElasticsearchWriter{
+		baseUrl:      strings.TrimSuffix(baseUrl, "/"),
+		index:        strings.ToLower(index),
+		templateName: elasticsearchTemplateName(index),
+		user:         user,
+		password:     password,
+		apiKey:       apiKey,
+		hostId:       hostId,
+		maskIPs:      maskIPs,
+		httpClient:   &http.Client{Timeout: ELASTICSEARCH_HTTP_TIMEOUT}}
+	writer.batcher = newLineBatcher("elasticsearch "+redactUrlQuery(writer.baseUrl), ELASTICSEARCH_BATCH_SIZE, ELASTICSEARCH_MAX_PENDING,
+		ELASTICSEARCH_FLUSH_INTERVAL, writer.send, stats)
+	return writer, nil
+}
+
+func (writer *ElasticsearchWriter) Write(domainName string, entry *logparsers.SBOHttpRequestLog) error {
+	document := elasticsearchDocument{SBOHttpRequestLog: *entry, HostId: writer.hostId}
+	if len(document.Domain) < 1 {
+		document.Domain = domainName
+	}
+	if !writer.maskIPs {
+		document.ClientIP = entry.ClientIP
+	}
+	documentJson, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	writer.batcher.Add(elasticsearchBulkItem{
+		index:    elasticsearchIndexName(writer.index, document.Domain, entry.Timestamp),
+		id:       entry.LineHash,
+		document: documentJson})
+	return nil
+}
+
+// Sends remaining entries
+func (writer *ElasticsearchWriter) Close() {
+	writer.batcher.Close()
+}
+
+// e.g sbologp-2025.07.02 for sbologp-{date}
+func elasticsearchIndexName(index string, domainName string, timestamp time.Time) string {
+	domainName = elasticsearchInvalidIndexCharsRegex.ReplaceAllString(strings.ToLower(domainName), "_")
+	return strings.NewReplacer("{domain}", domainName, "{date}", timestamp.UTC().Format(ELASTICSEARCH_INDEX_DATE_LAYOUT)).Replace(index)
+}
+
+// index pattern matching names built using the index name template, e.g sbologp-* for sbologp-{date}
+func elasticsearchIndexPattern(index string) string {
+	pattern := strings.NewReplacer("{domain}", "*", "{date}", "*").Replace(strings.ToLower(index))
+	for strings.Contains(pattern, "**") {
+		pattern = strings.ReplaceAll(pattern, "**", "*")
+	}
+	return pattern
+}
+
+// e.g sbologp for sbologp-{date}
+func elasticsearchTemplateName(index string) string {
+	name := strings.Trim(strings.ReplaceAll(elasticsearchIndexPattern(index), "*", ""), "-_.")
+	if len(name) < 1 {
+		return ELASTICSEARCH_DEFAULT_TEMPLATE_NAME
+	}
+	return name
+}
+
+func (writer *ElasticsearchWriter) newRequest(method string, path string, body []byte) (*http.Request, error) {
+	request, err := http.NewRequest(method, writer.baseUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(writer.user) > 0 {
+		request.SetBasicAuth(writer.user, writer.password)
+	}
+	if len(writer.apiKey) > 0 {
+		request.Header.Set("Authorization", "ApiKey "+writer.apiKey)
+	}
+	return request, nil
+}
+
+/*
+Creates the index template unless it exists, existing templates are not modified.
+Returns an error if the cluster is not available. Other failures are logged and ignored, e.g the user is not allowed to manage templates
+*/
+func (writer *ElasticsearchWriter) ensureIndexTemplate() error {
+	templatePath := "/_index_template/" + url.PathEscape(writer.templateName)
+	request, err := writer.newRequest(http.MethodHead, templatePath, nil)
+	if err != nil {
+		return err
+	}
+	response, err := writer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	switch {
+	case response.StatusCode == http.StatusOK:
+		return nil
+	case response.StatusCode >= 500:
+		return fmt.Errorf("checking index template failed with status %d", response.StatusCode)
+	case response.StatusCode != http.StatusNotFound:
+		slog.Warn("Failed to check elasticsearch index template, default mappings will be used", "template", writer.templateName, "status", response.StatusCode)
+		return nil
+	}
+
+	templateJson, err := json.Marshal(map[string]any{
+		"index_patterns": []string{elasticsearchIndexPattern(writer.index)},
+		"template":       map[string]any{"mappings": elasticsearchTemplateMappings}})
+	if err != nil {
+		return err
+	}
+	request, err = writer.newRequest(http.MethodPut, templatePath, templateJson)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err = writer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		slog.Info("Created elasticsearch index template", "template", writer.templateName)
+	case response.StatusCode >= 500:
+		return fmt.Errorf("creating index template failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+	default:
+		slog.Warn("Failed to create elasticsearch index template, default mappings will be used", "template", writer.templateName,
+			"status", response.StatusCode, "response", strings.TrimSpace(string(responseBody)))
+	}
+	return nil
+}
+
+type elasticsearchBulkResponse struct {
+	Errors bool
+	//action name (e.g index) => result for each item, in the order of the request
+	Items []map[string]struct {
+		Status int
+		Error  json.RawMessage
+	}
+}
+
+// called by the batcher. 429 and server errors are retried, for the request and for each item
+func (writer *ElasticsearchWriter) send(items []elasticsearchBulkItem) error {
+	if !writer.templateDone {
+		if err := writer.ensureIndexTemplate(); err != nil {
+			return err
+		}
+		writer.templateDone = true
+	}
+
+	var body bytes.Buffer
+	for _, item := range items {
+		action := map[string]string{"_index": item.index}
+		if len(item.id) > 0 {
+			action["_id"] = item.id
+		}
+		actionJson, _ := json.Marshal(map[string]any{"index": action})
+		body.Write(actionJson)
+		body.WriteByte('\n')
+		body.Write(item.document)
+		body.WriteByte('\n')
+	}
+	request, err := writer.newRequest(http.MethodPost, "/_bulk", body.Bytes())
+	if err != nil {
+		return &permanentSendError{err}
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	response, err := writer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		err = fmt.Errorf("bulk request failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+		if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+			return err
+		}
+		return &permanentSendError{err}
+	}
+
+	var bulkResponse elasticsearchBulkResponse
+	if err := json.NewDecoder(response.Body).Decode(&bulkResponse); err != nil {
+		return fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if !bulkResponse.Errors {
+		return nil
+	}
+	if len(bulkResponse.Items) != len(items) {
+		return fmt.Errorf("bulk response has %d items for %d documents", len(bulkResponse.Items), len(items))
+	}
+	partialErr := &partialSendError{}
+	for index, item := range bulkResponse.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				partialErr.retryIndexes = append(partialErr.retryIndexes, index)
+			} else {
+				partialErr.rejectedCount++
+			}
+			if partialErr.err == nil {
+				partialErr.err = fmt.Errorf("bulk item failed with status %d: %s", result.Status, result.Error)
+			}
+		}
+	}
+	if partialErr.err == nil {
+		return nil
+	}
+	return partialErr
+}
@@ -0,0 +1,224 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func TestElasticsearchIndexNames(t *testing.T) {
+	timestamp := time.Date(2025, 7, 2, 23, 30, 0, 0, time.FixedZone("", -3600))
+	testCases := []struct {
+		index        string
+		domainName   string
+		expected     string
+		pattern      string
+		templateName string
+	}{
+		{"sbologp-{date}", "example.com", "sbologp-2025.07.03", "sbologp-*", "sbologp"},
+		{"Logs-{domain}-{date}", "WWW.Example.com:8080", "logs-www.example.com_8080-2025.07.03", "logs-*-*", "logs"},
+		{"{domain}{date}", "a.com", "a.com2025.07.03", "*", ELASTICSEARCH_DEFAULT_TEMPLATE_NAME},
+		{"access", "a.com", "access", "access", "access"},
+	}
+	for _, testCase := range testCases {
+		index := strings.ToLower(testCase.index)
+		if name := elasticsearchIndexName(index, testCase.domainName, timestamp); name != testCase.expected {
+			t.Errorf("Expected index %q for %q, found %q", testCase.expected, testCase.index, name)
+		}
+		if pattern := elasticsearchIndexPattern(testCase.index); pattern != testCase.pattern {
+			t.Errorf("Expected pattern %q for %q, found %q", testCase.pattern, testCase.index, pattern)
+		}
+		if templateName := elasticsearchTemplateName(testCase.index); templateName != testCase.templateName {
+			t.Errorf("Expected template name %q for %q, found %q", testCase.templateName, testCase.index, templateName)
+		}
+	}
+}
+
+// stub cluster, bulkStatuses are item statuses returned for bulk requests in order, 201 when there are no more
+type testElasticsearchServer struct {
+	syncMutex      sync.Mutex
+	templateExists bool
+	requests       []string
+	templates      [][]byte
+	bulkBodies     [][]byte
+	bulkStatuses   []int
+}
+
+func (server *testElasticsearchServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.syncMutex.Lock()
+	defer server.syncMutex.Unlock()
+	body, _ := io.ReadAll(request.Body)
+	server.requests = append(server.requests, request.Method+" "+request.URL.Path)
+	switch {
+	case request.Method == http.MethodHead && !server.templateExists:
+		writer.WriteHeader(http.StatusNotFound)
+	case request.Method == http.MethodPut:
+		server.templates = append(server.templates, body)
+		server.templateExists = true
+	case request.URL.Path == "/_bulk":
+		server.bulkBodies = append(server.bulkBodies, body)
+		var items []string
+		errors := false
+		for range bytes.Count(body, []byte("\n")) / 2 {
+			status := http.StatusCreated
+			if len(server.bulkStatuses) > 0 {
+				status, server.bulkStatuses = server.bulkStatuses[0], server.bulkStatuses[1:]
+			}
+			errors = errors || status >= 300
+			items = append(items, fmt.Sprintf(`{"index":{"status":%d,"error":{"type":"test_%d"}}}`, status, status))
+		}
+		fmt.Fprintf(writer, `{"took":1,"errors":%t,"items":[%s]}`, errors, strings.Join(items, ","))
+	}
+}
+
+// action and document lines of a bulk request
+func parseTestBulkBody(t *testing.T, body []byte) ([]map[string]map[string]string, []map[string]any) {
+	var actions []map[string]map[string]string
+	var documents []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			t.Fatalf("Invalid action %s: %v", scanner.Bytes(), err)
+		}
+		scanner.Scan()
+		var document map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &document); err != nil {
+			t.Fatalf("Invalid document %s: %v", scanner.Bytes(), err)
+		}
+		actions = append(actions, action)
+		documents = append(documents, document)
+	}
+	return actions, documents
+}
+
+func newTestElasticsearchEntry(path string) *logparsers.SBOHttpRequestLog {
+	return &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Date(2025, 7, 2, 10, 0, 0, 0, time.UTC), Method: "GET", Path: path, Status: "200"}
+}
+
+func TestElasticsearchBulkAndTemplate(t *testing.T) {
+	server := &testElasticsearchServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	stats := &metrics.SBOPipelineStats{}
+	writer, err := NewElasticsearchWriter(httpServer.URL+"/", "", "", "", "key1", 4, true, stats)
+	if err != nil {
+		t.Fatalf("NewElasticsearchWriter failed: %v", err)
+	}
+	entry := newTestElasticsearchEntry("/a")
+	entry.LineHash = "abc"
+	writer.Write("example.com", entry)
+	writer.Write("example.com", newTestElasticsearchEntry("/b"))
+	writer.Close()
+
+	server.syncMutex.Lock()
+	defer server.syncMutex.Unlock()
+	if strings.Join(server.requests, ",") != "HEAD /_index_template/sbologp,PUT /_index_template/sbologp,POST /_bulk" {
+		t.Fatalf("Unexpected requests %v", server.requests)
+	}
+	var template struct {
+		IndexPatterns []string `json:"index_patterns"`
+		Template      struct {
+			Mappings struct {
+				Properties map[string]map[string]any
+			}
+		}
+	}
+	if err := json.Unmarshal(server.templates[0], &template); err != nil || template.IndexPatterns[0] != "sbologp-*" ||
+		template.Template.Mappings.Properties["ClientIP"]["type"] != "ip" {
+		t.Errorf("Unexpected template %s: %v", server.templates[0], err)
+	}
+	actions, documents := parseTestBulkBody(t, server.bulkBodies[0])
+	if len(documents) != 2 || actions[0]["index"]["_index"] != "sbologp-2025.07.02" || actions[0]["index"]["_id"] != "abc" || len(actions[1]["index"]["_id"]) != 0 {
+		t.Errorf("Unexpected actions %v", actions)
+	}
+	if _, found := documents[0]["ClientIP"]; found {
+		t.Errorf("Client IP is not masked in %v", documents[0])
+	}
+	if documents[1]["Path"] != "/b" || documents[1]["Domain"] != "example.com" || documents[1]["HostId"] != float64(4) {
+		t.Errorf("Unexpected document %v", documents[1])
+	}
+	if stats.OutputLinesSent.Load() != 2 {
+		t.Errorf("Expected 2 sent, found %d", stats.OutputLinesSent.Load())
+	}
+}
+
+func TestElasticsearchPartialFailures(t *testing.T) {
+	//first bulk request: 2nd item is retried and 3rd item is dropped
+	server := &testElasticsearchServer{templateExists: true, bulkStatuses: []int{201, 429, 400, 200}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	stats := &metrics.SBOPipelineStats{}
+	writer, _ := NewElasticsearchWriter(httpServer.URL, "logs-{domain}-{date}", "", "", "", 1, false, stats)
+	for _, path := range []string{"/1", "/2", "/3"} {
+		writer.Write("example.com", newTestElasticsearchEntry(path))
+	}
+	if writer.batcher.flush() {
+		t.Error("Partially failed flush returned true")
+	}
+	writer.Write("example.com", newTestElasticsearchEntry("/4"))
+	writer.Close()
+
+	server.syncMutex.Lock()
+	defer server.syncMutex.Unlock()
+	if len(server.bulkBodies) != 2 || server.requests[0] != "HEAD /_index_template/logs" {
+		t.Fatalf("Unexpected requests %v", server.requests)
+	}
+	actions, documents := parseTestBulkBody(t, server.bulkBodies[1])
+	if len(documents) != 2 || documents[0]["Path"] != "/2" || documents[1]["Path"] != "/4" || documents[0]["ClientIP"] != "192.0.2.1" ||
+		actions[0]["index"]["_index"] != "logs-example.com-2025.07.02" {
+		t.Errorf("Unexpected retry %s", server.bulkBodies[1])
+	}
+	if stats.OutputLinesSent.Load() != 3 || stats.OutputDroppedLines.Load() != 1 || stats.OutputSendErrors.Load() != 1 {
+		t.Errorf("Unexpected stats sent %d dropped %d errors %d", stats.OutputLinesSent.Load(), stats.OutputDroppedLines.Load(), stats.OutputSendErrors.Load())
+	}
+}
+
+func TestElasticsearchClusterUnavailable(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer httpServer.Close()
+	stats := &metrics.SBOPipelineStats{}
+	writer, _ := NewElasticsearchWriter(httpServer.URL, "", "", "", "", 1, false, stats)
+	writer.Write("example.com", newTestElasticsearchEntry("/"))
+	writer.Close()
+	if writer.templateDone || stats.OutputDroppedLines.Load() != 1 || stats.OutputLinesSent.Load() != 0 {
+		t.Errorf("Unexpected state, template done %t, dropped %d", writer.templateDone, stats.OutputDroppedLines.Load())
+	}
+	if _, err := NewElasticsearchWriter("localhost:9200", "", "", "", "", 1, false, nil); err == nil {
+		t.Error("Url without scheme was accepted")
+	}
+}
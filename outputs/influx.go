@@ -0,0 +1,257 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	// measurement names are this prefix and the metric type name, e.g sbologp_requests
+	INFLUX_MEASUREMENT_PREFIX string = "sbologp_"
+	INFLUX_OS_MEASUREMENT     string = "sbologp_os"
+
+	INFLUX_BATCH_SIZE     int           = 5000
+	INFLUX_MAX_PENDING    int           = 100000
+	INFLUX_FLUSH_INTERVAL time.Duration = 10 * time.Second
+	INFLUX_HTTP_TIMEOUT   time.Duration = 30 * time.Second
+	// free output is in KiB
+	INFLUX_FREE_OUTPUT_UNIT_BYTES int64 = 1024
+)
+
+/*
+Writes closed metric windows and OS metrics in InfluxDB line protocol, into a file or to an http write endpoint,
+e.g http://localhost:8086/api/v2/write?org=myorg&bucket=sbologp. Metric windows are written using INFLUX_MEASUREMENT_PREFIX
+and the metric type name as measurement, domain, host_id, source (file path of the input) and key tags and a value field, timestamped
+with the start of the window. InfluxDB keeps the last value written for a series and timestamp, so inputs of a domain are written
+as different series using the source tag and sums of values pushed for the window are written, see metricWindowTotals.
+Timestamps are in nanoseconds, i.e the default precision. Lines are sent in batches, optionally gzip compressed, see lineBatcher
+*/
+type InfluxWriter struct {
+	target     string
+	token      string
+	useGzip    bool
+	hostId     string
+	httpClient *http.Client
+	batcher    *lineBatcher[string]
+	totals     *metricWindowTotals
+}
+
+/*
+target is an http(s) url or a file path, lines are appended to files. token is sent as "Authorization: Token <token>" when not empty.
+When useGzip is true http requests are compressed, and batches are appended to files as gzip members (i.e files are valid gzip files)
+*/
+func NewInfluxWriter(target string, token string, useGzip bool, hostId int, stats *metrics.SBOPipelineStats) *InfluxWriter {
+	writer := &InfluxWriter{
+		target:     target,
+		token:      token,
+		useGzip:    useGzip,
+		hostId:     strconv.Itoa(hostId),
+		httpClient: &http.Client{Timeout: INFLUX_HTTP_TIMEOUT},
+		totals:     newMetricWindowTotals()}
+	send := writer.appendToFile
+	if writer.isHttp() {
+		send = writer.post
+	}
+	writer.batcher = newLineBatcher("influx "+redactUrlQuery(target), INFLUX_BATCH_SIZE, INFLUX_MAX_PENDING, INFLUX_FLUSH_INTERVAL, send, stats)
+	return writer
+}
+
+func (writer *InfluxWriter) isHttp() bool {
+	return strings.HasPrefix(writer.target, "http://") || strings.HasPrefix(writer.target, "https://")
+}
+
+func (writer *InfluxWriter) Push(domainName string, data *metrics.SBOMetricWindowDataToBeSaved) {
+	windowStart, err := metrics.TimeWindowStartTime(data.TimeWindow, data.TimeWindowLocation)
+	if err != nil {
+		return
+	}
+	measurement := INFLUX_MEASUREMENT_PREFIX + metrics.MetricTypeName(data.MetricType)
+	tags := map[string]string{"domain": domainName, "host_id": writer.hostId, "source": data.FilePath, "key": data.KeyValue}
+	//host_id is the same for all series of the writer
+	series := measurement + "\x00" + domainName + "\x00" + data.FilePath + "\x00" + data.KeyValue
+	writer.totals.add(series, windowStart, data.MetricValue, func(total int64) {
+		writer.batcher.Add(FormatInfluxLine(measurement, tags, map[string]any{"value": total}, windowStart))
+	})
+}
+
+// memoryInfo may be nil, e.g when free is not available
+func (writer *InfluxWriter) PushOSMetrics(uptimeInfo *metrics.UptimeInfo, memoryInfo *metrics.MemoryInfo, timestamp time.Time) {
+	fields := map[string]any{
+		"uptime_minutes": int64(uptimeInfo.UpDurationMinutes),
+		"users":          int64(uptimeInfo.Users)}
+	for name, loadAverage := range map[string]string{"load1": uptimeInfo.LoadAverage1, "load5": uptimeInfo.LoadAverage5, "load15": uptimeInfo.LoadAverage15} {
+		if value, err := strconv.ParseFloat(loadAverage, 64); err == nil {
+			fields[name] = value
+		}
+	}
+	if memoryInfo != nil {
+		fields["memory_used_bytes"] = memoryInfo.MemUse * INFLUX_FREE_OUTPUT_UNIT_BYTES
+		fields["memory_free_bytes"] = memoryInfo.MemFree * INFLUX_FREE_OUTPUT_UNIT_BYTES
+		fields["memory_available_bytes"] = memoryInfo.MemAvailable * INFLUX_FREE_OUTPUT_UNIT_BYTES
+		fields["memory_cache_bytes"] = memoryInfo.CachUse * INFLUX_FREE_OUTPUT_UNIT_BYTES
+		fields["swap_used_bytes"] = memoryInfo.SwapUse * INFLUX_FREE_OUTPUT_UNIT_BYTES
+	}
+	writer.batcher.Add(FormatInfluxLine(INFLUX_OS_MEASUREMENT, map[string]string{"host_id": writer.hostId}, fields, timestamp))
+}
+
+// Writes remaining lines
+func (writer *InfluxWriter) Close() {
+	writer.batcher.Close()
+}
+
+func (writer *InfluxWriter) encodeBatch(lines []string) ([]byte, error) {
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	if !writer.useGzip {
+		return body, nil
+	}
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	if _, err := gzipWriter.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+func (writer *InfluxWriter) appendToFile(lines []string) error {
+	body, err := writer.encodeBatch(lines)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(writer.target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	//single write, so batches of writers sharing the file are not mixed
+	_, err = file.Write(body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// server errors and 429 (too many requests) are retried, other errors mean the lines are invalid or the request is not authorized
+func (writer *InfluxWriter) post(lines []string) error {
+	body, err := writer.encodeBatch(lines)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, writer.target, bytes.NewReader(body))
+	if err != nil {
+		return &permanentSendError{err}
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if writer.useGzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	if len(writer.token) > 0 {
+		request.Header.Set("Authorization", "Token "+writer.token)
+	}
+	response, err := writer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("influx write failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return err
+	}
+	return &permanentSendError{err}
+}
+
+/*
+Returns a line in InfluxDB line protocol. Tags with empty values are omitted, tags and fields are sorted by key.
+Field values can be int64 (written as integers), float64, bool or string, fields with other types are omitted
+*/
+func FormatInfluxLine(measurement string, tags map[string]string, fields map[string]any, timestamp time.Time) string {
+	var builder strings.Builder
+	builder.WriteString(escapeInfluxMeasurement(measurement))
+	for _, key := range slices.Sorted(maps.Keys(tags)) {
+		if len(tags[key]) < 1 {
+			continue
+		}
+		builder.WriteString("," + escapeInfluxKey(key) + "=" + escapeInfluxKey(tags[key]))
+	}
+	separator := " "
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		var value string
+		switch typedValue := fields[key].(type) {
+		case int64:
+			value = strconv.FormatInt(typedValue, 10) + "i"
+		case float64:
+			value = strconv.FormatFloat(typedValue, 'f', -1, 64)
+		case bool:
+			value = strconv.FormatBool(typedValue)
+		case string:
+			value = `"` + escapeInfluxStringField(typedValue) + `"`
+		default:
+			continue
+		}
+		builder.WriteString(separator + escapeInfluxKey(key) + "=" + value)
+		separator = ","
+	}
+	builder.WriteString(" " + strconv.FormatInt(timestamp.UnixNano(), 10))
+	return builder.String()
+}
+
+// new lines can't be escaped, they are replaced with spaces
+var influxMeasurementReplacer = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+var influxKeyReplacer = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+var influxStringFieldReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func escapeInfluxMeasurement(measurement string) string {
+	return influxMeasurementReplacer.Replace(measurement)
+}
+
+// tag keys, tag values and field keys
+func escapeInfluxKey(key string) string {
+	return influxKeyReplacer.Replace(key)
+}
+
+func escapeInfluxStringField(value string) string {
+	return influxStringFieldReplacer.Replace(value)
+}
+
+// query parameters may contain credentials, e.g InfluxDB 1.x u and p parameters
+func redactUrlQuery(target string) string {
+	if index := strings.Index(target, "?"); index >= 0 {
+		return target[:index]
+	}
+	return target
+}
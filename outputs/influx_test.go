@@ -0,0 +1,203 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func TestInfluxLineEscaping(t *testing.T) {
+	timestamp := time.Unix(1751455200, 0)
+	testCases := []struct {
+		name        string
+		measurement string
+		tags        map[string]string
+		fields      map[string]any
+		expected    string
+	}{
+		{"plain", "sbologp_requests", map[string]string{"domain": "example.com", "host_id": "1"}, map[string]any{"value": int64(10)},
+			"sbologp_requests,domain=example.com,host_id=1 value=10i 1751455200000000000"},
+		{"empty tag is omitted", "m", map[string]string{"domain": "example.com", "key": ""}, map[string]any{"value": int64(1)},
+			"m,domain=example.com value=1i 1751455200000000000"},
+		{"measurement comma and space", "my measurement,x", nil, map[string]any{"value": int64(1)},
+			`my\ measurement\,x value=1i 1751455200000000000`},
+		{"measurement equals sign is not escaped", "a=b", nil, map[string]any{"value": int64(1)},
+			`a=b value=1i 1751455200000000000`},
+		{"tag value comma equals space", "m", map[string]string{"key": "a,b=c d"}, map[string]any{"value": int64(1)},
+			`m,key=a\,b\=c\ d value=1i 1751455200000000000`},
+		{"tag key special characters", "m", map[string]string{"my key=": "v"}, map[string]any{"value": int64(1)},
+			`m,my\ key\==v value=1i 1751455200000000000`},
+		{"tag value backslash", "m", map[string]string{"key": `C:\path\`}, map[string]any{"value": int64(1)},
+			`m,key=C:\\path\\ value=1i 1751455200000000000`},
+		{"tag value new line", "m", map[string]string{"key": "a\nb"}, map[string]any{"value": int64(1)},
+			`m,key=a\ b value=1i 1751455200000000000`},
+		{"tag value quotes are not escaped", "m", map[string]string{"key": `"a"`}, map[string]any{"value": int64(1)},
+			`m,key="a" value=1i 1751455200000000000`},
+		{"string field quotes and backslash", "m", nil, map[string]any{"path": `/a "b" \c`},
+			`m path="/a \"b\" \\c" 1751455200000000000`},
+		{"string field comma space equals are not escaped", "m", nil, map[string]any{"text": "a, b=c"},
+			`m text="a, b=c" 1751455200000000000`},
+		{"field key special characters", "m", nil, map[string]any{"load avg,1=": 0.5},
+			`m load\ avg\,1\==0.5 1751455200000000000`},
+		{"field types and order", "m", map[string]string{"b": "2", "a": "1"}, map[string]any{"z": true, "f": 1.25, "i": int64(-3), "ignored": 3},
+			"m,a=1,b=2 f=1.25,i=-3i,z=true 1751455200000000000"},
+		{"large float is not in exponent form", "m", nil, map[string]any{"value": 12345678901234.5},
+			"m value=12345678901234.5 1751455200000000000"},
+		{"unicode", "m", map[string]string{"domain": "bücher.de"}, map[string]any{"value": int64(1)},
+			"m,domain=bücher.de value=1i 1751455200000000000"},
+	}
+	for _, testCase := range testCases {
+		if line := FormatInfluxLine(testCase.measurement, testCase.tags, testCase.fields, timestamp); line != testCase.expected {
+			t.Errorf("%s: unexpected line\n%s\nexpected\n%s", testCase.name, line, testCase.expected)
+		}
+	}
+}
+
+func TestInfluxMetricWindowLine(t *testing.T) {
+	var lines []string
+	writer := NewInfluxWriter("/dev/null", "", false, 3, nil)
+	writer.batcher.Close()
+	writer.batcher = newLineBatcher("test", 10, 10, time.Hour, func(batch []string) error {
+		lines = append(lines, batch...)
+		return nil
+	}, nil)
+	writer.Push("example.com", metrics.NewSBOMetricWindowDataToBeSaved("/var/log/access.log", metrics.SBO_METRIC_HTTP_STATUS, "404", 202507021120, 7))
+	writer.Push("example.com", metrics.NewSBOMetricWindowDataToBeSaved("/var/log/access.log", metrics.SBO_METRIC_REQ_COUNT, "", 202507021120, 9))
+	//another file of the domain is another series
+	writer.Push("example.com", metrics.NewSBOMetricWindowDataToBeSaved("/var/log/access2.log", metrics.SBO_METRIC_REQ_COUNT, "", 202507021120, 4))
+	//the window pushed again, e.g after late lines, the sum is written
+	writer.Push("example.com", metrics.NewSBOMetricWindowDataToBeSaved("/var/log/access.log", metrics.SBO_METRIC_REQ_COUNT, "", 202507021120, 2))
+	writer.PushOSMetrics(&metrics.UptimeInfo{UpDurationMinutes: 10, Users: 2, LoadAverage1: "0.50"}, nil, time.Unix(100, 0))
+	writer.Close()
+
+	windowStart := time.Date(2025, 7, 2, 11, 20, 0, 0, time.Local).UnixNano()
+	expected := []string{
+		"sbologp_http_status,domain=example.com,host_id=3,key=404,source=/var/log/access.log value=7i " + strconv.FormatInt(windowStart, 10),
+		"sbologp_requests,domain=example.com,host_id=3,source=/var/log/access.log value=9i " + strconv.FormatInt(windowStart, 10),
+		"sbologp_requests,domain=example.com,host_id=3,source=/var/log/access2.log value=4i " + strconv.FormatInt(windowStart, 10),
+		"sbologp_requests,domain=example.com,host_id=3,source=/var/log/access.log value=11i " + strconv.FormatInt(windowStart, 10),
+		"sbologp_os,host_id=3 load1=0.5,uptime_minutes=10i,users=2i 100000000000",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected lines\n%s\nexpected\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+// returns the server and received bodies, responses are taken from statuses in order and 204 after that
+func newTestInfluxServer(t *testing.T, statuses ...int) (*httptest.Server, func() []string) {
+	var syncMutex sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		syncMutex.Lock()
+		defer syncMutex.Unlock()
+		if request.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Unexpected authorization header %q", request.Header.Get("Authorization"))
+		}
+		var body io.Reader = request.Body
+		if request.Header.Get("Content-Encoding") == "gzip" {
+			gzipReader, err := gzip.NewReader(request.Body)
+			if err != nil {
+				t.Errorf("Invalid gzip body: %v", err)
+				return
+			}
+			body = gzipReader
+		}
+		bodyBytes, _ := io.ReadAll(body)
+		bodies = append(bodies, string(bodyBytes))
+		if len(statuses) > 0 {
+			status := statuses[0]
+			statuses = statuses[1:]
+			writer.WriteHeader(status)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	return server, func() []string {
+		syncMutex.Lock()
+		defer syncMutex.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestInfluxHttpGzipAndRetry(t *testing.T) {
+	server, getBodies := newTestInfluxServer(t, http.StatusServiceUnavailable)
+	defer server.Close()
+	stats := &metrics.SBOPipelineStats{}
+	writer := NewInfluxWriter(server.URL+"/api/v2/write?org=o&bucket=b", "secret", true, 1, stats)
+	writer.PushOSMetrics(&metrics.UptimeInfo{UpDurationMinutes: 1}, nil, time.Unix(1, 0))
+	//first request fails with 503 and is sent again when closing
+	writer.batcher.flush()
+	writer.Close()
+
+	bodies := getBodies()
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[1] != "sbologp_os,host_id=1 uptime_minutes=1i,users=0i 1000000000\n" {
+		t.Errorf("Unexpected bodies %q", bodies)
+	}
+	if stats.OutputSendErrors.Load() != 1 || stats.OutputLinesSent.Load() != 1 || stats.OutputDroppedLines.Load() != 0 {
+		t.Errorf("Unexpected stats: errors %d sent %d dropped %d", stats.OutputSendErrors.Load(), stats.OutputLinesSent.Load(), stats.OutputDroppedLines.Load())
+	}
+}
+
+func TestInfluxHttpRejectedLinesAreDropped(t *testing.T) {
+	server, getBodies := newTestInfluxServer(t, http.StatusBadRequest)
+	defer server.Close()
+	stats := &metrics.SBOPipelineStats{}
+	writer := NewInfluxWriter(server.URL, "secret", false, 1, stats)
+	writer.PushOSMetrics(&metrics.UptimeInfo{}, nil, time.Unix(1, 0))
+	writer.Close()
+	if len(getBodies()) != 1 || stats.OutputDroppedLines.Load() != 1 || stats.OutputSendErrors.Load() != 1 {
+		t.Errorf("Unexpected result: %d requests, dropped %d errors %d", len(getBodies()), stats.OutputDroppedLines.Load(), stats.OutputSendErrors.Load())
+	}
+}
+
+func TestInfluxFileGzip(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "metrics.lp.gz")
+	for _, timestamp := range []int64{1, 2} {
+		writer := NewInfluxWriter(filePath, "", true, 1, nil)
+		writer.PushOSMetrics(&metrics.UptimeInfo{}, nil, time.Unix(timestamp, 0))
+		writer.Close()
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Invalid gzip file: %v", err)
+	}
+	content, _ := io.ReadAll(gzipReader)
+	expected := "sbologp_os,host_id=1 uptime_minutes=0i,users=0i 1000000000\nsbologp_os,host_id=1 uptime_minutes=0i,users=0i 2000000000\n"
+	if string(content) != expected {
+		t.Errorf("Unexpected content %q", content)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+/*
+Returned by send functions when sending the lines again would fail too, e.g the server rejected them as invalid.
+The lines are dropped instead of being sent again
+*/
+type permanentSendError struct {
+	err error
+}
+
+func (sendError *permanentSendError) Error() string {
+	return sendError.err.Error()
+}
+
+func (sendError *permanentSendError) Unwrap() error {
+	return sendError.err
+}
+
+/*
+Returned by send functions when only some of the lines were accepted, e.g by bulk APIs reporting a result for each item.
+Lines at retryIndexes (indexes in the batch) are sent again later, rejectedCount lines are dropped, others were sent
+*/
+type partialSendError struct {
+	err           error
+	retryIndexes  []int
+	rejectedCount int
+}
+
+func (sendError *partialSendError) Error() string {
+	return sendError.err.Error()
+}
+
+func (sendError *partialSendError) Unwrap() error {
+	return sendError.err
+}
+
+/*
+Collects lines (e.g metrics in a text protocol, or other items like log records) and sends them in batches, when batchSize lines are waiting and every flushInterval.
+Lines are kept when sending fails and sent again later, up to maxPending lines, oldest lines are dropped first.
+After a failure, sending is not attempted again before flushInterval passes.
+Lines are sent by a background goroutine, adding lines does not wait for sends.
+Safe for concurrent use
+*/
+type lineBatcher[T any] struct {
+	name          string
+	syncMutex     sync.Mutex
+	sendMutex     sync.Mutex
+	pending       []T
+	batchSize     int
+	maxPending    int
+	flushInterval time.Duration
+	send          func(lines []T) error
+	stats         *metrics.SBOPipelineStats
+	retryAfter    time.Time
+	failing       bool
+	wake          chan struct{}
+	done          chan struct{}
+	stopped       chan struct{}
+}
+
+// name is used in logs. stats may be nil
+func newLineBatcher[T any](name string, batchSize int, maxPending int, flushInterval time.Duration, send func(lines []T) error, stats *metrics.SBOPipelineStats) *lineBatcher[T] {
+	if stats == nil {
+		stats = &metrics.SBOPipelineStats{}
+	}
+	batcher := &lineBatcher[T]{
+		name:          name,
+		batchSize:     batchSize,
+		maxPending:    max(maxPending, batchSize),
+		flushInterval: flushInterval,
+		send:          send,
+		stats:         stats,
+		wake:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{})}
+	go batcher.flushPeriodically()
+	return batcher
+}
+
+func (batcher *lineBatcher[T]) flushPeriodically() {
+	defer close(batcher.stopped)
+	ticker := time.NewTicker(batcher.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-batcher.done:
+			return
+		case <-ticker.C:
+			batcher.flush()
+		case <-batcher.wake:
+			batcher.flush()
+		}
+	}
+}
+
+func (batcher *lineBatcher[T]) Add(line T) {
+	batcher.syncMutex.Lock()
+	defer batcher.syncMutex.Unlock()
+	batcher.pending = append(batcher.pending, line)
+	batcher.dropOldestLines()
+	if len(batcher.pending) >= batcher.batchSize && time.Now().After(batcher.retryAfter) {
+		select {
+		case batcher.wake <- struct{}{}:
+		default:
+			//already signalled
+		}
+	}
+}
+
+// must be called with syncMutex held
+func (batcher *lineBatcher[T]) dropOldestLines() {
+	if len(batcher.pending) > batcher.maxPending {
+		dropCount := len(batcher.pending) - batcher.maxPending
+		batcher.pending = batcher.pending[dropCount:]
+		batcher.stats.OutputDroppedLines.Add(int64(dropCount))
+	}
+}
+
+/*
+Sends pending lines in batches. Pending lines are taken under syncMutex and sent without holding it so Add does not wait for sends,
+lines which were not sent are put back before lines added during the send. Returns false if sending failed
+*/
+func (batcher *lineBatcher[T]) flush() bool {
+	batcher.sendMutex.Lock()
+	defer batcher.sendMutex.Unlock()
+	batcher.syncMutex.Lock()
+	lines := batcher.pending
+	batcher.pending = nil
+	batcher.syncMutex.Unlock()
+	for len(lines) > 0 {
+		batch := lines[:min(batcher.batchSize, len(lines))]
+		err := batcher.send(batch)
+		var partialErr *partialSendError
+		if errors.As(err, &partialErr) {
+			retryLines := make([]T, 0, len(partialErr.retryIndexes))
+			for _, index := range partialErr.retryIndexes {
+				retryLines = append(retryLines, batch[index])
+			}
+			batcher.stats.OutputSendErrors.Add(1)
+			batcher.stats.OutputLinesSent.Add(int64(len(batch) - len(retryLines) - partialErr.rejectedCount))
+			if partialErr.rejectedCount > 0 {
+				batcher.stats.OutputDroppedLines.Add(int64(partialErr.rejectedCount))
+				slog.Error("Lines were rejected, they are dropped", "output", batcher.name, "lines", partialErr.rejectedCount, "error", err)
+			}
+			//lines to retry are sent first, before newer lines
+			lines = append(retryLines, lines[len(batch):]...)
+			if len(retryLines) < 1 {
+				continue
+			}
+			batcher.sendFailed(lines, "Failed to send some lines, will retry", err)
+			return false
+		}
+		var permanentErr *permanentSendError
+		if errors.As(err, &permanentErr) {
+			batcher.stats.OutputSendErrors.Add(1)
+			batcher.stats.OutputDroppedLines.Add(int64(len(batch)))
+			slog.Error("Lines were rejected, they are dropped", "output", batcher.name, "lines", len(batch), "error", err)
+			lines = lines[len(batch):]
+			continue
+		}
+		if err != nil {
+			batcher.stats.OutputSendErrors.Add(1)
+			batcher.sendFailed(lines, "Failed to send lines, will retry", err)
+			return false
+		}
+		batcher.stats.OutputLinesSent.Add(int64(len(batch)))
+		lines = lines[len(batch):]
+		batcher.syncMutex.Lock()
+		if batcher.failing {
+			batcher.failing = false
+			slog.Info("Sending lines works again", "output", batcher.name)
+		}
+		batcher.syncMutex.Unlock()
+	}
+	return true
+}
+
+// puts unsent lines back before lines added during the send and delays the next attempt
+func (batcher *lineBatcher[T]) sendFailed(unsentLines []T, message string, err error) {
+	batcher.syncMutex.Lock()
+	defer batcher.syncMutex.Unlock()
+	batcher.pending = append(unsentLines, batcher.pending...)
+	batcher.dropOldestLines()
+	batcher.retryAfter = time.Now().Add(batcher.flushInterval)
+	if !batcher.failing {
+		//logged once until sending works again
+		batcher.failing = true
+		slog.Warn(message, "output", batcher.name, "pendingLines", len(batcher.pending), "error", err)
+	}
+}
+
+// Stops periodic flushes and sends remaining lines, lines which can't be sent are dropped
+func (batcher *lineBatcher[T]) Close() {
+	close(batcher.done)
+	<-batcher.stopped
+	if !batcher.flush() {
+		batcher.syncMutex.Lock()
+		defer batcher.syncMutex.Unlock()
+		slog.Error("Failed to send remaining lines, they are lost", "output", batcher.name, "lines", len(batcher.pending))
+		batcher.stats.OutputDroppedLines.Add(int64(len(batcher.pending)))
+		batcher.pending = nil
+	}
+}
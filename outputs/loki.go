@@ -0,0 +1,256 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	LOKI_PUSH_PATH string = "/loki/api/v1/push"
+
+	// raw lines are sent as read, entries without raw lines (e.g pushed by other means) are sent as json
+	LOKI_LINE_FORMAT_RAW  string = "raw"
+	LOKI_LINE_FORMAT_JSON string = "json"
+
+	LOKI_BATCH_SIZE     int           = 1000
+	LOKI_MAX_PENDING    int           = 50000
+	LOKI_FLUSH_INTERVAL time.Duration = 10 * time.Second
+	LOKI_HTTP_TIMEOUT   time.Duration = 30 * time.Second
+)
+
+type lokiEntry struct {
+	labels    map[string]string
+	timestamp time.Time
+	line      string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	//timestamp in nanoseconds as a string and the line
+	Values [][2]string `json:"values"`
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// json lines, ClientIP is omitted when it's masked
+type lokiJsonLine struct {
+	logparsers.SBOHttpRequestLog
+	ClientIP string `json:",omitempty"`
+}
+
+/*
+Pushes parsed log entries to Grafana Loki. Only low cardinality fields are used as labels: domain, host (host id),
+status_class (e.g 2xx), ua_family and human. Lines are raw log lines or json serialised entries, see LOKI_LINE_FORMAT_RAW.
+Entries are sent in batches (see lineBatcher), grouped into streams by labels and sorted by timestamp in each stream
+*/
+type LokiWriter struct {
+	url        string
+	lineFormat string
+	tenantId   string
+	user       string
+	password   string
+	hostId     string
+	maskIPs    bool
+	httpClient *http.Client
+	batcher    *lineBatcher[lokiEntry]
+}
+
+/*
+baseUrl is the url of Loki, e.g http://localhost:3100, LOKI_PUSH_PATH is appended to it. lineFormat defaults to LOKI_LINE_FORMAT_RAW.
+tenantId is sent as X-Scope-OrgID when not empty, basic authentication is used when user is not empty.
+Client IPs are omitted from json lines and replaced with - in raw lines when maskIPs is true
+*/
+func NewLokiWriter(baseUrl string, lineFormat string, tenantId string, user string, password string, hostId int, maskIPs bool,
+	stats *metrics.SBOPipelineStats) (*LokiWriter, error) {
+	if len(lineFormat) < 1 {
+		lineFormat = LOKI_LINE_FORMAT_RAW
+	}
+	if lineFormat != LOKI_LINE_FORMAT_RAW && lineFormat != LOKI_LINE_FORMAT_JSON {
+		return nil, fmt.Errorf("unsupported loki line format %q, use %s or %s", lineFormat, LOKI_LINE_FORMAT_RAW, LOKI_LINE_FORMAT_JSON)
+	}
+	if !strings.HasPrefix(baseUrl, "http://") && !strings.HasPrefix(baseUrl, "https://") {
+		return nil, fmt.Errorf("loki url %q is not an http url", baseUrl)
+	}
+	writer := &LokiWriter{
+		url:        strings.TrimSuffix(baseUrl, "/") + LOKI_PUSH_PATH,
+		lineFormat: lineFormat,
+		tenantId:   tenantId,
+		user:       user,
+		password:   password,
+		hostId:     strconv.Itoa(hostId),
+		maskIPs:    maskIPs,
+		httpClient: &http.Client{Timeout: LOKI_HTTP_TIMEOUT}}
+	writer.batcher = newLineBatcher("loki "+redactUrlQuery(writer.url), LOKI_BATCH_SIZE, LOKI_MAX_PENDING, LOKI_FLUSH_INTERVAL, writer.send, stats)
+	return writer, nil
+}
+
+func (writer *LokiWriter) PushLog(domainName string, entry *logparsers.SBOHttpRequestLog) error {
+	line, err := writer.formatLine(entry)
+	if err != nil {
+		return err
+	}
+	writer.batcher.Add(lokiEntry{labels: writer.labels(domainName, entry), timestamp: entry.Timestamp, line: line})
+	return nil
+}
+
+// Sends remaining entries
+func (writer *LokiWriter) Close() {
+	writer.batcher.Close()
+}
+
+// labels with empty values are omitted
+func (writer *LokiWriter) labels(domainName string, entry *logparsers.SBOHttpRequestLog) map[string]string {
+	labels := map[string]string{"host": writer.hostId, "domain": entry.Domain}
+	if len(entry.Domain) < 1 {
+		labels["domain"] = domainName
+	}
+	if statusClass := entry.StatusClass(); len(statusClass) > 0 {
+		labels["status_class"] = statusClass
+	}
+	if entry.UserAgent != nil {
+		labels["ua_family"] = entry.UserAgent.Family
+		labels["human"] = entry.UserAgent.Human
+	}
+	maps.DeleteFunc(labels, func(name string, value string) bool { return len(value) < 1 })
+	return labels
+}
+
+func (writer *LokiWriter) formatLine(entry *logparsers.SBOHttpRequestLog) (string, error) {
+	if writer.lineFormat == LOKI_LINE_FORMAT_RAW && len(entry.RawLine) > 0 {
+		if writer.maskIPs && len(entry.ClientIP) > 0 {
+			return maskClientIP(entry.RawLine, entry.ClientIP), nil
+		}
+		return entry.RawLine, nil
+	}
+	jsonLine := lokiJsonLine{SBOHttpRequestLog: *entry}
+	if !writer.maskIPs {
+		jsonLine.ClientIP = entry.ClientIP
+	}
+	lineJson, err := json.Marshal(jsonLine)
+	return string(lineJson), err
+}
+
+/*
+Replaces every occurrence of clientIP in line with -, e.g in the client ip field and in X-Forwarded-For values.
+Occurrences which are a part of a longer address, e.g 10.0.0.1 in 10.0.0.10, are kept
+*/
+func maskClientIP(line string, clientIP string) string {
+	var maskedLine strings.Builder
+	start := 0
+	for {
+		index := strings.Index(line[start:], clientIP)
+		if index < 0 {
+			break
+		}
+		index += start
+		end := index + len(clientIP)
+		maskedLine.WriteString(line[start:index])
+		if (index > 0 && isIPAddressChar(line[index-1])) || (end < len(line) && isIPAddressChar(line[end])) {
+			maskedLine.WriteString(clientIP)
+		} else {
+			maskedLine.WriteString("-")
+		}
+		start = end
+	}
+	maskedLine.WriteString(line[start:])
+	return maskedLine.String()
+}
+
+// characters of ipv4 and ipv6 addresses
+func isIPAddressChar(char byte) bool {
+	return (char >= '0' && char <= '9') || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F') || char == '.' || char == ':'
+}
+
+// streams are sorted by labels and entries by timestamp, stable so entries with the same timestamp keep their order
+func buildLokiPushRequest(entries []lokiEntry) *lokiPushRequest {
+	streamsByLabels := make(map[string]*lokiStream)
+	var streamKeys []string
+	sortedEntries := slices.Clone(entries)
+	slices.SortStableFunc(sortedEntries, func(a, b lokiEntry) int { return a.timestamp.Compare(b.timestamp) })
+	for _, entry := range sortedEntries {
+		var keyBuilder strings.Builder
+		for _, name := range slices.Sorted(maps.Keys(entry.labels)) {
+			keyBuilder.WriteString(name + "=" + entry.labels[name] + "\x00")
+		}
+		streamKey := keyBuilder.String()
+		stream, found := streamsByLabels[streamKey]
+		if !found {
+			stream = &lokiStream{Stream: entry.labels}
+			streamsByLabels[streamKey] = stream
+			streamKeys = append(streamKeys, streamKey)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.timestamp.UnixNano(), 10), entry.line})
+	}
+	slices.SortFunc(streamKeys, cmp.Compare)
+	request := &lokiPushRequest{}
+	for _, streamKey := range streamKeys {
+		request.Streams = append(request.Streams, *streamsByLabels[streamKey])
+	}
+	return request
+}
+
+// called by the batcher. 429 and server errors are retried, other errors mean entries are invalid (e.g too old) or the request is not authorized
+func (writer *LokiWriter) send(entries []lokiEntry) error {
+	body, err := json.Marshal(buildLokiPushRequest(entries))
+	if err != nil {
+		return &permanentSendError{err}
+	}
+	request, err := http.NewRequest(http.MethodPost, writer.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentSendError{err}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if len(writer.tenantId) > 0 {
+		request.Header.Set("X-Scope-OrgID", writer.tenantId)
+	}
+	if len(writer.user) > 0 {
+		request.SetBasicAuth(writer.user, writer.password)
+	}
+	response, err := writer.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("loki push failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500 {
+		return err
+	}
+	return &permanentSendError{err}
+}
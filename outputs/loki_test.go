@@ -0,0 +1,166 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const testLokiRawLine string = `192.0.2.1 - - [02/Jul/2025:10:00:00 +0000] "GET /a HTTP/1.1" 404 10 "-" "curl/8.0"`
+
+func newTestLokiEntry() *logparsers.SBOHttpRequestLog {
+	return &logparsers.SBOHttpRequestLog{ClientIP: "192.0.2.1", Timestamp: time.Unix(100, 0), Method: "GET", Path: "/a", Status: "404",
+		UserAgent: &logparsers.SBOUserAgent{Family: "curl", Human: logparsers.Human_No}, RawLine: testLokiRawLine}
+}
+
+func TestLokiLabelsAndLines(t *testing.T) {
+	writer, err := NewLokiWriter("http://127.0.0.1:1/", "", "", "", "", 2, false, nil)
+	if err != nil {
+		t.Fatalf("NewLokiWriter failed: %v", err)
+	}
+	defer writer.batcher.Close()
+	entry := newTestLokiEntry()
+	expectedLabels := map[string]string{"domain": "example.com", "host": "2", "status_class": "4xx", "ua_family": "curl", "human": logparsers.Human_No}
+	if labels := writer.labels("example.com", entry); !maps.Equal(labels, expectedLabels) {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if labels := writer.labels("example.com", &logparsers.SBOHttpRequestLog{Domain: "a.com", Status: "-"}); !maps.Equal(labels, map[string]string{"domain": "a.com", "host": "2"}) {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+
+	if line, _ := writer.formatLine(entry); line != testLokiRawLine {
+		t.Errorf("Unexpected raw line %q", line)
+	}
+	writer.maskIPs = true
+	if line, _ := writer.formatLine(entry); !strings.HasPrefix(line, `- - - [02/Jul/2025`) {
+		t.Errorf("Client IP is not masked in %q", line)
+	}
+	//entries without raw lines and the json format
+	entry.RawLine = ""
+	jsonLine, _ := writer.formatLine(entry)
+	writer.lineFormat = LOKI_LINE_FORMAT_JSON
+	entry.RawLine = testLokiRawLine
+	if line, _ := writer.formatLine(entry); line != jsonLine {
+		t.Errorf("Expected the same json lines, found %q and %q", jsonLine, line)
+	}
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(jsonLine), &parsed); err != nil || parsed["ClientIP"] != nil || parsed["Path"] != "/a" || parsed["RawLine"] != nil {
+		t.Errorf("Unexpected json line %q: %v", jsonLine, err)
+	}
+	if entry.ClientIP != "192.0.2.1" {
+		t.Error("Entry was modified")
+	}
+}
+
+func TestLokiMasksEveryClientIPOccurrence(t *testing.T) {
+	testCases := []struct {
+		clientIP string
+		line     string
+		expected string
+	}{
+		{"192.0.2.1", `192.0.2.1 - - [02/Jul/2025:11:20:00 +0000] "GET /a HTTP/1.1" 404 0 "-" "curl/8.0" "192.0.2.1"`,
+			`- - - [02/Jul/2025:11:20:00 +0000] "GET /a HTTP/1.1" 404 0 "-" "curl/8.0" "-"`},
+		{"192.0.2.1", `example.com 192.0.2.1 - - "GET /?ip=192.0.2.1&b=192.0.2.10 HTTP/1.1" 200 0 "-" "-" "10.192.0.2.1, 192.0.2.1"`,
+			`example.com - - - "GET /?ip=-&b=192.0.2.10 HTTP/1.1" 200 0 "-" "-" "10.192.0.2.1, -"`},
+		{"2001:db8::1", `2001:db8::1 - - "GET /2001:db8::10 HTTP/1.1" 200 0 "-" "-"`, `- - - "GET /2001:db8::10 HTTP/1.1" 200 0 "-" "-"`},
+	}
+	for _, testCase := range testCases {
+		if masked := maskClientIP(testCase.line, testCase.clientIP); masked != testCase.expected {
+			t.Errorf("Unexpected masked line %q, expected %q", masked, testCase.expected)
+		}
+	}
+}
+
+func TestLokiStreamsAreSorted(t *testing.T) {
+	labelsA := map[string]string{"domain": "a.com"}
+	labelsB := map[string]string{"domain": "b.com"}
+	request := buildLokiPushRequest([]lokiEntry{
+		{labels: labelsB, timestamp: time.Unix(3, 0), line: "b3"},
+		{labels: labelsA, timestamp: time.Unix(2, 0), line: "a2"},
+		{labels: map[string]string{"domain": "a.com"}, timestamp: time.Unix(1, 0), line: "a1"},
+		{labels: labelsB, timestamp: time.Unix(1, 0), line: "b1"},
+		{labels: labelsA, timestamp: time.Unix(1, 0), line: "a1-2"},
+	})
+	requestJson, _ := json.Marshal(request)
+	expected := `{"streams":[{"stream":{"domain":"a.com"},"values":[["1000000000","a1"],["1000000000","a1-2"],["2000000000","a2"]]},` +
+		`{"stream":{"domain":"b.com"},"values":[["1000000000","b1"],["3000000000","b3"]]}]}`
+	if string(requestJson) != expected {
+		t.Errorf("Unexpected request %s", requestJson)
+	}
+}
+
+func TestLokiPushRetriesAndDrops(t *testing.T) {
+	var syncMutex sync.Mutex
+	var bodies []string
+	statuses := []int{http.StatusServiceUnavailable, http.StatusNoContent, http.StatusBadRequest}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		syncMutex.Lock()
+		defer syncMutex.Unlock()
+		user, password, _ := request.BasicAuth()
+		if request.URL.Path != LOKI_PUSH_PATH || request.Header.Get("X-Scope-OrgID") != "tenant1" || user != "u" || password != "p" {
+			t.Errorf("Unexpected request %s %v", request.URL.Path, request.Header)
+		}
+		body, _ := io.ReadAll(request.Body)
+		bodies = append(bodies, string(body))
+		writer.WriteHeader(statuses[0])
+		statuses = statuses[1:]
+	}))
+	defer server.Close()
+
+	stats := &metrics.SBOPipelineStats{}
+	writer, err := NewLokiWriter(server.URL, LOKI_LINE_FORMAT_RAW, "tenant1", "u", "p", 1, false, stats)
+	if err != nil {
+		t.Fatalf("NewLokiWriter failed: %v", err)
+	}
+	writer.PushLog("example.com", newTestLokiEntry())
+	writer.batcher.flush()
+	writer.batcher.flush()
+	writer.PushLog("example.com", newTestLokiEntry())
+	writer.Close()
+
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+	if len(bodies) != 3 || bodies[0] != bodies[1] || !strings.Contains(bodies[0], `"status_class":"4xx"`) {
+		t.Errorf("Unexpected requests %v", bodies)
+	}
+	if stats.OutputLinesSent.Load() != 1 || stats.OutputDroppedLines.Load() != 1 || stats.OutputSendErrors.Load() != 2 {
+		t.Errorf("Unexpected stats sent %d dropped %d errors %d", stats.OutputLinesSent.Load(), stats.OutputDroppedLines.Load(), stats.OutputSendErrors.Load())
+	}
+}
+
+func TestLokiValidation(t *testing.T) {
+	if _, err := NewLokiWriter("http://localhost:3100", "xml", "", "", "", 1, false, nil); err == nil {
+		t.Error("Unsupported line format was accepted")
+	}
+	if _, err := NewLokiWriter("localhost:3100", "", "", "", "", 1, false, nil); err == nil {
+		t.Error("Url without scheme was accepted")
+	}
+}
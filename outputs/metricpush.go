@@ -0,0 +1,281 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	METRIC_PUSH_FORMAT_STATSD    string = "statsd"
+	METRIC_PUSH_FORMAT_DOGSTATSD string = "dogstatsd"
+	METRIC_PUSH_FORMAT_GRAPHITE  string = "graphite"
+
+	METRIC_PUSH_NETWORK_UDP string = "udp"
+	METRIC_PUSH_NETWORK_TCP string = "tcp"
+
+	// placeholders in metric name templates
+	METRIC_PUSH_TEMPLATE_DOMAIN string = "{domain}"
+	METRIC_PUSH_TEMPLATE_METRIC string = "{metric}"
+	METRIC_PUSH_TEMPLATE_KEY    string = "{key}"
+	// file path of the input, e.g var_log_nginx_access_log for /var/log/nginx/access.log
+	METRIC_PUSH_TEMPLATE_SOURCE string = "{source}"
+
+	METRIC_PUSH_DEFAULT_NAME_TEMPLATE string = "sbologp.{domain}.{metric}.{key}"
+	// domain and key are sent as tags
+	METRIC_PUSH_DEFAULT_DOGSTATSD_NAME_TEMPLATE string = "sbologp.{metric}"
+	// Graphite keeps the last value of a name and timestamp, inputs of a domain would overwrite each other without the source
+	METRIC_PUSH_DEFAULT_GRAPHITE_NAME_TEMPLATE string = "sbologp.{domain}.{source}.{metric}.{key}"
+
+	METRIC_PUSH_BATCH_SIZE     int           = 500
+	METRIC_PUSH_MAX_PENDING    int           = 50000
+	METRIC_PUSH_FLUSH_INTERVAL time.Duration = 10 * time.Second
+	METRIC_PUSH_DIAL_TIMEOUT   time.Duration = 5 * time.Second
+	METRIC_PUSH_WRITE_TIMEOUT  time.Duration = 10 * time.Second
+	// udp datagrams are kept below a common MTU, lines are newline delimited in datagrams
+	METRIC_PUSH_MAX_DATAGRAM_SIZE int = 1432
+	// longer name parts and tag values are truncated
+	METRIC_PUSH_MAX_PART_LENGTH int = 200
+)
+
+/*
+Destination of closed metric windows in addition to the database, e.g MetricPusher or InfluxWriter
+*/
+type MetricWindowOutput interface {
+	Push(domainName string, data *metrics.SBOMetricWindowDataToBeSaved)
+	// sends remaining data
+	Close()
+}
+
+/*
+Pushes closed metric windows (see metrics.SBOMetricsManager) in StatsD, DogStatsD or Graphite plaintext format over udp or tcp.
+Metric names are built using a template with METRIC_PUSH_TEMPLATE_* placeholders, e.g sbologp.{domain}.{metric}.{key}.
+Windows are sent as StatsD counters, and as Graphite values timestamped with the start of the window. Graphite keeps the last value
+sent for a name and timestamp, so sums of values pushed for the window are sent (see metricWindowTotals) and the default name includes the source.
+Lines are sent in batches, see lineBatcher
+*/
+type MetricPusher struct {
+	format       string
+	nameTemplate string
+	connection   *metricPushConnection
+	batcher      *lineBatcher[string]
+	//nil for StatsD, counters are added by the server
+	totals *metricWindowTotals
+}
+
+/*
+network defaults to udp for StatsD and tcp for Graphite, nameTemplate defaults to METRIC_PUSH_DEFAULT_NAME_TEMPLATE
+(METRIC_PUSH_DEFAULT_DOGSTATSD_NAME_TEMPLATE for DogStatsD). Connections are opened when lines are sent
+*/
+func NewMetricPusher(format string, network string, address string, nameTemplate string, stats *metrics.SBOPipelineStats) (*MetricPusher, error) {
+	switch format {
+	case METRIC_PUSH_FORMAT_STATSD, METRIC_PUSH_FORMAT_DOGSTATSD:
+		if len(network) < 1 {
+			network = METRIC_PUSH_NETWORK_UDP
+		}
+	case METRIC_PUSH_FORMAT_GRAPHITE:
+		if len(network) < 1 {
+			network = METRIC_PUSH_NETWORK_TCP
+		}
+	default:
+		return nil, fmt.Errorf("unsupported metric push format %q, use %s, %s or %s", format, METRIC_PUSH_FORMAT_STATSD, METRIC_PUSH_FORMAT_DOGSTATSD, METRIC_PUSH_FORMAT_GRAPHITE)
+	}
+	if network != METRIC_PUSH_NETWORK_UDP && network != METRIC_PUSH_NETWORK_TCP {
+		return nil, fmt.Errorf("unsupported metric push network %q, use %s or %s", network, METRIC_PUSH_NETWORK_UDP, METRIC_PUSH_NETWORK_TCP)
+	}
+	if len(address) < 1 {
+		return nil, errors.New("metric push address is empty")
+	}
+	if len(nameTemplate) < 1 {
+		nameTemplate = METRIC_PUSH_DEFAULT_NAME_TEMPLATE
+		if format == METRIC_PUSH_FORMAT_DOGSTATSD {
+			nameTemplate = METRIC_PUSH_DEFAULT_DOGSTATSD_NAME_TEMPLATE
+		} else if format == METRIC_PUSH_FORMAT_GRAPHITE {
+			nameTemplate = METRIC_PUSH_DEFAULT_GRAPHITE_NAME_TEMPLATE
+		}
+	}
+	pusher := &MetricPusher{
+		format:       format,
+		nameTemplate: nameTemplate,
+		connection:   &metricPushConnection{network: network, address: address}}
+	if format == METRIC_PUSH_FORMAT_GRAPHITE {
+		pusher.totals = newMetricWindowTotals()
+	}
+	pusher.batcher = newLineBatcher(format+" "+network+"://"+address, METRIC_PUSH_BATCH_SIZE, METRIC_PUSH_MAX_PENDING, METRIC_PUSH_FLUSH_INTERVAL,
+		pusher.connection.send, stats)
+	return pusher, nil
+}
+
+func (pusher *MetricPusher) Push(domainName string, data *metrics.SBOMetricWindowDataToBeSaved) {
+	if pusher.totals == nil {
+		line, err := pusher.formatLine(domainName, data)
+		if err != nil {
+			return
+		}
+		pusher.batcher.Add(line)
+		return
+	}
+	windowStart, err := metrics.TimeWindowStartTime(data.TimeWindow, data.TimeWindowLocation)
+	if err != nil {
+		return
+	}
+	series := buildMetricPushName(pusher.nameTemplate, domainName, data.FilePath, metrics.MetricTypeName(data.MetricType), data.KeyValue)
+	pusher.totals.add(series, windowStart, data.MetricValue, func(total int64) {
+		totalData := *data
+		totalData.MetricValue = total
+		if line, err := pusher.formatLine(domainName, &totalData); err == nil {
+			pusher.batcher.Add(line)
+		}
+	})
+}
+
+// Sends remaining lines and closes the connection
+func (pusher *MetricPusher) Close() {
+	pusher.batcher.Close()
+	pusher.connection.close()
+}
+
+func (pusher *MetricPusher) formatLine(domainName string, data *metrics.SBOMetricWindowDataToBeSaved) (string, error) {
+	metricName := metrics.MetricTypeName(data.MetricType)
+	name := buildMetricPushName(pusher.nameTemplate, domainName, data.FilePath, metricName, data.KeyValue)
+	value := strconv.FormatInt(data.MetricValue, 10)
+	switch pusher.format {
+	case METRIC_PUSH_FORMAT_GRAPHITE:
+		windowStart, err := metrics.TimeWindowStartTime(data.TimeWindow, data.TimeWindowLocation)
+		if err != nil {
+			return "", err
+		}
+		return name + " " + value + " " + strconv.FormatInt(windowStart.Unix(), 10), nil
+	case METRIC_PUSH_FORMAT_DOGSTATSD:
+		tags := []string{"domain:" + sanitizeDogStatsDTagValue(domainName), "metric:" + metricName}
+		if len(data.KeyValue) > 0 {
+			tags = append(tags, "key:"+sanitizeDogStatsDTagValue(data.KeyValue))
+		}
+		return name + ":" + value + "|c|#" + strings.Join(tags, ","), nil
+	}
+	return name + ":" + value + "|c", nil
+}
+
+/*
+Replaces placeholders in the template with sanitized values (see sanitizeMetricNamePart). Empty parts are removed,
+e.g sbologp.example_com.requests for sbologp.{domain}.{metric}.{key} when the key is empty
+*/
+func buildMetricPushName(template string, domainName string, source string, metricName string, keyValue string) string {
+	replacer := strings.NewReplacer(
+		METRIC_PUSH_TEMPLATE_DOMAIN, sanitizeMetricNamePart(domainName),
+		METRIC_PUSH_TEMPLATE_SOURCE, sanitizeMetricNamePart(strings.TrimLeft(source, "/")),
+		METRIC_PUSH_TEMPLATE_METRIC, sanitizeMetricNamePart(metricName),
+		METRIC_PUSH_TEMPLATE_KEY, sanitizeMetricNamePart(keyValue))
+	parts := strings.Split(replacer.Replace(template), ".")
+	parts = slices.DeleteFunc(parts, func(part string) bool { return len(part) < 1 })
+	return strings.Join(parts, ".")
+}
+
+// characters other than ascii letters, digits, _ and - are replaced with _, e.g example_com for example.com
+func sanitizeMetricNamePart(part string) string {
+	if len(part) > METRIC_PUSH_MAX_PART_LENGTH {
+		part = part[:METRIC_PUSH_MAX_PART_LENGTH]
+	}
+	return strings.Map(func(char rune) rune {
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '_' || char == '-' {
+			return char
+		}
+		return '_'
+	}, part)
+}
+
+// characters which separate tags or fields, and white space, are replaced with _
+func sanitizeDogStatsDTagValue(value string) string {
+	if len(value) > METRIC_PUSH_MAX_PART_LENGTH {
+		value = value[:METRIC_PUSH_MAX_PART_LENGTH]
+	}
+	return strings.Map(func(char rune) rune {
+		switch char {
+		case ',', '|', '#', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return char
+	}, strings.ToValidUTF8(value, "_"))
+}
+
+// Not safe for concurrent use, used by lineBatcher while holding its mutex
+type metricPushConnection struct {
+	network string
+	address string
+	conn    net.Conn
+}
+
+// udp lines are packed into datagrams, tcp lines are newline terminated. The connection is closed on errors and opened again on the next send
+func (connection *metricPushConnection) send(lines []string) error {
+	if connection.conn == nil {
+		conn, err := net.DialTimeout(connection.network, connection.address, METRIC_PUSH_DIAL_TIMEOUT)
+		if err != nil {
+			return err
+		}
+		connection.conn = conn
+	}
+	connection.conn.SetWriteDeadline(time.Now().Add(METRIC_PUSH_WRITE_TIMEOUT))
+	var err error
+	if connection.network == METRIC_PUSH_NETWORK_UDP {
+		err = connection.sendDatagrams(lines)
+	} else {
+		_, err = connection.conn.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	}
+	if err != nil {
+		connection.close()
+	}
+	return err
+}
+
+func (connection *metricPushConnection) sendDatagrams(lines []string) error {
+	datagram := make([]byte, 0, METRIC_PUSH_MAX_DATAGRAM_SIZE)
+	for _, line := range lines {
+		if len(datagram) > 0 && len(datagram)+1+len(line) > METRIC_PUSH_MAX_DATAGRAM_SIZE {
+			if _, err := connection.conn.Write(datagram); err != nil {
+				return err
+			}
+			datagram = datagram[:0]
+		}
+		if len(datagram) > 0 {
+			datagram = append(datagram, '\n')
+		}
+		datagram = append(datagram, line...)
+	}
+	if len(datagram) > 0 {
+		_, err := connection.conn.Write(datagram)
+		return err
+	}
+	return nil
+}
+
+func (connection *metricPushConnection) close() {
+	if connection.conn != nil {
+		connection.conn.Close()
+		connection.conn = nil
+	}
+}
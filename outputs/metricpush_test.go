@@ -0,0 +1,231 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func newTestMetricWindowData(metricType int, keyValue string, metricValue int64) *metrics.SBOMetricWindowDataToBeSaved {
+	return metrics.NewSBOMetricWindowDataToBeSaved("/var/log/access.log", metricType, keyValue, 202507021120, metricValue)
+}
+
+func TestMetricPushFormats(t *testing.T) {
+	windowStart := time.Date(2025, 7, 2, 11, 20, 0, 0, time.Local).Unix()
+	testCases := []struct {
+		format       string
+		nameTemplate string
+		data         *metrics.SBOMetricWindowDataToBeSaved
+		expected     string
+	}{
+		{METRIC_PUSH_FORMAT_STATSD, "", newTestMetricWindowData(metrics.SBO_METRIC_REQ_COUNT, "", 12), "sbologp.example_com.requests:12|c"},
+		{METRIC_PUSH_FORMAT_STATSD, "", newTestMetricWindowData(metrics.SBO_METRIC_PATH, "/a/b.html", 3), "sbologp.example_com.path._a_b_html:3|c"},
+		{METRIC_PUSH_FORMAT_STATSD, "web.{metric}.{key}.{domain}", newTestMetricWindowData(metrics.SBO_METRIC_HTTP_STATUS, "404", 2), "web.http_status.404.example_com:2|c"},
+		{METRIC_PUSH_FORMAT_STATSD, "web.{source}.{metric}", newTestMetricWindowData(metrics.SBO_METRIC_REQ_COUNT, "", 1), "web.var_log_access_log.requests:1|c"},
+		{METRIC_PUSH_FORMAT_DOGSTATSD, "", newTestMetricWindowData(metrics.SBO_METRIC_REQ_COUNT, "", 12), "sbologp.requests:12|c|#domain:example.com,metric:requests"},
+		{METRIC_PUSH_FORMAT_DOGSTATSD, "", newTestMetricWindowData(metrics.SBO_METRIC_REFERER, "a,b|c#d e", 1), "sbologp.referer:1|c|#domain:example.com,metric:referer,key:a_b_c_d_e"},
+		{METRIC_PUSH_FORMAT_GRAPHITE, "", newTestMetricWindowData(metrics.SBO_METRIC_UA_FAMILY, "Chrome", 7), "sbologp.example_com.var_log_access_log.ua_family.Chrome 7 " + strconv.FormatInt(windowStart, 10)},
+	}
+	for _, testCase := range testCases {
+		pusher, err := NewMetricPusher(testCase.format, "", "127.0.0.1:1", testCase.nameTemplate, nil)
+		if err != nil {
+			t.Fatalf("NewMetricPusher failed: %v", err)
+		}
+		line, err := pusher.formatLine("example.com", testCase.data)
+		if err != nil || line != testCase.expected {
+			t.Errorf("Unexpected line for %s: %q %v, expected %q", testCase.format, line, err, testCase.expected)
+		}
+		pusher.batcher.Close()
+	}
+}
+
+func TestNewMetricPusherValidation(t *testing.T) {
+	if _, err := NewMetricPusher("collectd", "", "127.0.0.1:8125", "", nil); err == nil {
+		t.Error("Unsupported format was accepted")
+	}
+	if _, err := NewMetricPusher(METRIC_PUSH_FORMAT_STATSD, "unix", "127.0.0.1:8125", "", nil); err == nil {
+		t.Error("Unsupported network was accepted")
+	}
+	if _, err := NewMetricPusher(METRIC_PUSH_FORMAT_GRAPHITE, "", "", "", nil); err == nil {
+		t.Error("Empty address was accepted")
+	}
+}
+
+func TestMetricPushUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	defer listener.Close()
+	stats := &metrics.SBOPipelineStats{}
+	pusher, err := NewMetricPusher(METRIC_PUSH_FORMAT_STATSD, "", listener.LocalAddr().String(), "", stats)
+	if err != nil {
+		t.Fatalf("NewMetricPusher failed: %v", err)
+	}
+	//enough lines for more than one datagram
+	for index := range 100 {
+		pusher.Push("example.com", newTestMetricWindowData(metrics.SBO_METRIC_PATH, "/page"+strconv.Itoa(index), 1))
+	}
+	pusher.Close()
+
+	receivedLines := 0
+	buffer := make([]byte, 65536)
+	for receivedLines < 100 {
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		size, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("ReadFrom failed after %d lines: %v", receivedLines, err)
+		}
+		if size > METRIC_PUSH_MAX_DATAGRAM_SIZE {
+			t.Errorf("Datagram is too large: %d bytes", size)
+		}
+		receivedLines += len(strings.Split(string(buffer[:size]), "\n"))
+	}
+	if stats.OutputLinesSent.Load() != 100 {
+		t.Errorf("Unexpected sent line count %d", stats.OutputLinesSent.Load())
+	}
+}
+
+func TestMetricPushTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			received <- scanner.Text()
+		}
+	}()
+	pusher, err := NewMetricPusher(METRIC_PUSH_FORMAT_GRAPHITE, "", listener.Addr().String(), "", nil)
+	if err != nil {
+		t.Fatalf("NewMetricPusher failed: %v", err)
+	}
+	pusher.Push("example.com", newTestMetricWindowData(metrics.SBO_METRIC_REQ_COUNT, "", 5))
+	pusher.Push("example.com", newTestMetricWindowData(metrics.SBO_METRIC_BYTES_SENT, "", 500))
+	//the same window pushed again, e.g after late lines, the sum is sent
+	pusher.Push("example.com", newTestMetricWindowData(metrics.SBO_METRIC_REQ_COUNT, "", 3))
+	pusher.Close()
+	for _, expectedPrefix := range []string{"sbologp.example_com.var_log_access_log.requests 5 ", "sbologp.example_com.var_log_access_log.bytes_sent 500 ",
+		"sbologp.example_com.var_log_access_log.requests 8 "} {
+		select {
+		case line := <-received:
+			if !strings.HasPrefix(line, expectedPrefix) {
+				t.Errorf("Unexpected line %q, expected prefix %q", line, expectedPrefix)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for lines")
+		}
+	}
+}
+
+func TestLineBatcherRetriesAndDrops(t *testing.T) {
+	var sentLines []string
+	var failing atomic.Bool
+	failing.Store(true)
+	stats := &metrics.SBOPipelineStats{}
+	batcher := newLineBatcher("test", 2, 4, time.Hour, func(lines []string) error {
+		if failing.Load() {
+			return errors.New("unavailable")
+		}
+		sentLines = append(sentLines, lines...)
+		return nil
+	}, stats)
+	batcher.Add("0")
+	batcher.Add("1")
+	//wait until the failed lines are put back
+	waitForTestCondition(t, func() bool {
+		batcher.syncMutex.Lock()
+		defer batcher.syncMutex.Unlock()
+		return batcher.failing && len(batcher.pending) == 2
+	})
+	for index := 2; index < 6; index++ {
+		batcher.Add(strconv.Itoa(index))
+	}
+	//later sends are not attempted before the flush interval and the oldest lines are dropped
+	if stats.OutputSendErrors.Load() != 1 || stats.OutputDroppedLines.Load() != 2 || len(sentLines) != 0 {
+		t.Errorf("Unexpected stats: errors %d dropped %d sent %v", stats.OutputSendErrors.Load(), stats.OutputDroppedLines.Load(), sentLines)
+	}
+	failing.Store(false)
+	batcher.Close()
+	if strings.Join(sentLines, ",") != "2,3,4,5" || stats.OutputLinesSent.Load() != 4 {
+		t.Errorf("Unexpected sent lines %v, %d", sentLines, stats.OutputLinesSent.Load())
+	}
+}
+
+func TestLineBatcherAddDoesNotWaitForSends(t *testing.T) {
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	var sentLines []string
+	batcher := newLineBatcher("test", 1, 10, time.Hour, func(lines []string) error {
+		if len(sentLines) == 0 {
+			close(sending)
+			<-release
+		}
+		sentLines = append(sentLines, lines...)
+		return nil
+	}, nil)
+	batcher.Add("a")
+	<-sending
+	added := make(chan struct{})
+	go func() {
+		batcher.Add("b")
+		batcher.Add("c")
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Add waited for a send")
+	}
+	close(release)
+	batcher.Close()
+	if strings.Join(sentLines, ",") != "a,b,c" {
+		t.Errorf("Unexpected sent lines %v", sentLines)
+	}
+}
+
+// fails the test if condition does not become true in 2 seconds
+func waitForTestCondition(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,517 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	OTLP_ENCODING_PROTOBUF string = "protobuf"
+	OTLP_ENCODING_JSON     string = "json"
+
+	// appended to the endpoint, e.g http://localhost:4318/v1/metrics
+	OTLP_METRICS_PATH string = "/v1/metrics"
+	OTLP_LOGS_PATH    string = "/v1/logs"
+
+	OTLP_SERVICE_NAME string = "sbologp"
+	OTLP_SCOPE_NAME   string = "github.com/SBOsoft/SBOLogProcessor"
+	// metric names are this prefix and the metric type name, e.g sbologp.requests
+	OTLP_METRIC_NAME_PREFIX string = "sbologp."
+
+	OTLP_BATCH_SIZE     int           = 1000
+	OTLP_MAX_PENDING    int           = 50000
+	OTLP_FLUSH_INTERVAL time.Duration = 10 * time.Second
+	OTLP_HTTP_TIMEOUT   time.Duration = 30 * time.Second
+
+	OTLP_AGGREGATION_TEMPORALITY_DELTA int = 1
+	OTLP_SEVERITY_INFO                 int = 9
+	OTLP_SEVERITY_WARN                 int = 13
+	OTLP_SEVERITY_ERROR                int = 17
+)
+
+// OTLP messages, json field names are used by OTLP/JSON. Only the fields used by sbologp are defined
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *int64   `json:"intValue,omitempty,string"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano uint64         `json:"startTimeUnixNano,string"`
+	TimeUnixNano      uint64         `json:"timeUnixNano,string"`
+	AsInt             int64          `json:"asInt,string"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpMetric struct {
+	Name string   `json:"name"`
+	Unit string   `json:"unit,omitempty"`
+	Sum  *otlpSum `json:"sum"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         uint64         `json:"timeUnixNano,string"`
+	ObservedTimeUnixNano uint64         `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText,omitempty"`
+	Body                 otlpAnyValue   `json:"body"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+func otlpStringAttribute(key string, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpIntAttribute(key string, value int64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &value}}
+}
+
+func otlpDoubleAttribute(key string, value float64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{DoubleValue: &value}}
+}
+
+// protobuf field numbers are from opentelemetry-proto
+func (value *otlpAnyValue) encodeProto(encoder *protoEncoder) {
+	switch {
+	case value.StringValue != nil:
+		encoder.StringAlways(1, *value.StringValue)
+	case value.BoolValue != nil:
+		encoder.BoolAlways(2, *value.BoolValue)
+	case value.IntValue != nil:
+		encoder.Int64Always(3, *value.IntValue)
+	case value.DoubleValue != nil:
+		encoder.DoubleAlways(4, *value.DoubleValue)
+	}
+}
+
+func encodeOtlpAttributes(encoder *protoEncoder, fieldNumber int, attributes []otlpKeyValue) {
+	for _, attribute := range attributes {
+		encoder.Message(fieldNumber, func(encoder *protoEncoder) {
+			encoder.String(1, attribute.Key)
+			encoder.Message(2, attribute.Value.encodeProto)
+		})
+	}
+}
+
+func (resource *otlpResource) encodeProto(encoder *protoEncoder) {
+	encodeOtlpAttributes(encoder, 1, resource.Attributes)
+}
+
+func (scope *otlpScope) encodeProto(encoder *protoEncoder) {
+	encoder.String(1, scope.Name)
+}
+
+func (request *otlpMetricsRequest) encodeProto(encoder *protoEncoder) {
+	for _, resourceMetrics := range request.ResourceMetrics {
+		encoder.Message(1, func(encoder *protoEncoder) {
+			encoder.Message(1, resourceMetrics.Resource.encodeProto)
+			for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+				encoder.Message(2, func(encoder *protoEncoder) {
+					encoder.Message(1, scopeMetrics.Scope.encodeProto)
+					for _, metric := range scopeMetrics.Metrics {
+						encoder.Message(2, metric.encodeProto)
+					}
+				})
+			}
+		})
+	}
+}
+
+func (metric *otlpMetric) encodeProto(encoder *protoEncoder) {
+	encoder.String(1, metric.Name)
+	encoder.String(3, metric.Unit)
+	encoder.Message(7, func(encoder *protoEncoder) {
+		for _, dataPoint := range metric.Sum.DataPoints {
+			encoder.Message(1, dataPoint.encodeProto)
+		}
+		encoder.Int64(2, int64(metric.Sum.AggregationTemporality))
+		encoder.Bool(3, metric.Sum.IsMonotonic)
+	})
+}
+
+func (dataPoint *otlpNumberDataPoint) encodeProto(encoder *protoEncoder) {
+	encoder.Fixed64(2, dataPoint.StartTimeUnixNano)
+	encoder.Fixed64(3, dataPoint.TimeUnixNano)
+	encoder.Fixed64Always(6, uint64(dataPoint.AsInt))
+	encodeOtlpAttributes(encoder, 7, dataPoint.Attributes)
+}
+
+func (request *otlpLogsRequest) encodeProto(encoder *protoEncoder) {
+	for _, resourceLogs := range request.ResourceLogs {
+		encoder.Message(1, func(encoder *protoEncoder) {
+			encoder.Message(1, resourceLogs.Resource.encodeProto)
+			for _, scopeLogs := range resourceLogs.ScopeLogs {
+				encoder.Message(2, func(encoder *protoEncoder) {
+					encoder.Message(1, scopeLogs.Scope.encodeProto)
+					for _, logRecord := range scopeLogs.LogRecords {
+						encoder.Message(2, logRecord.encodeProto)
+					}
+				})
+			}
+		})
+	}
+}
+
+func (logRecord *otlpLogRecord) encodeProto(encoder *protoEncoder) {
+	encoder.Fixed64(1, logRecord.TimeUnixNano)
+	encoder.Int64(2, int64(logRecord.SeverityNumber))
+	encoder.String(3, logRecord.SeverityText)
+	encoder.Message(5, logRecord.Body.encodeProto)
+	encodeOtlpAttributes(encoder, 6, logRecord.Attributes)
+	encoder.Fixed64(11, logRecord.ObservedTimeUnixNano)
+}
+
+// resource attributes of data of a domain, domain is omitted when empty
+func newOtlpResource(hostId string, domainName string) otlpResource {
+	attributes := []otlpKeyValue{otlpStringAttribute("service.name", OTLP_SERVICE_NAME), otlpStringAttribute("host.id", hostId)}
+	if len(domainName) > 0 {
+		attributes = append(attributes, otlpStringAttribute("sbologp.domain", domainName))
+	}
+	return otlpResource{Attributes: attributes}
+}
+
+/*
+Sends OTLP requests over http using protobuf or json encoding
+*/
+type otlpClient struct {
+	url        string
+	encoding   string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+// endpoint is the base url, e.g http://localhost:4318, path is appended to it. encoding defaults to protobuf
+func newOtlpClient(endpoint string, path string, encoding string, headers map[string]string) (*otlpClient, error) {
+	if len(encoding) < 1 {
+		encoding = OTLP_ENCODING_PROTOBUF
+	}
+	if encoding != OTLP_ENCODING_PROTOBUF && encoding != OTLP_ENCODING_JSON {
+		return nil, fmt.Errorf("unsupported OTLP encoding %q, use %s or %s", encoding, OTLP_ENCODING_PROTOBUF, OTLP_ENCODING_JSON)
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("OTLP endpoint %q is not an http url", endpoint)
+	}
+	return &otlpClient{
+		url:        strings.TrimSuffix(endpoint, "/") + path,
+		encoding:   encoding,
+		headers:    headers,
+		httpClient: &http.Client{Timeout: OTLP_HTTP_TIMEOUT}}, nil
+}
+
+// 429, 502, 503 and 504 responses are retried as OTLP/HTTP requires, other errors are permanent
+func (client *otlpClient) post(request interface{ encodeProto(*protoEncoder) }) error {
+	var body []byte
+	contentType := "application/x-protobuf"
+	if client.encoding == OTLP_ENCODING_JSON {
+		contentType = "application/json"
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return &permanentSendError{err}
+		}
+	} else {
+		var encoder protoEncoder
+		request.encodeProto(&encoder)
+		body = encoder.Bytes()
+	}
+	httpRequest, err := http.NewRequest(http.MethodPost, client.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentSendError{err}
+	}
+	httpRequest.Header.Set("Content-Type", contentType)
+	for name, value := range client.headers {
+		httpRequest.Header.Set(name, value)
+	}
+	response, err := client.httpClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("OTLP export failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+	return &permanentSendError{err}
+}
+
+type otlpMetricPoint struct {
+	domainName string
+	metricName string
+	dataPoint  otlpNumberDataPoint
+}
+
+/*
+Exports closed metric windows as OTLP delta sums, one data point per metric key and window, with the key as the key attribute.
+Data of each domain is sent with its own resource, see newOtlpResource. Data points are sent in batches, see lineBatcher
+*/
+type OtlpMetricExporter struct {
+	client         *otlpClient
+	hostId         string
+	timeWindowSize time.Duration
+	batcher        *lineBatcher[otlpMetricPoint]
+}
+
+// timeWindowSizeMinutes is used for the end time of data points, see handlers.CalculateTimeWindow
+func NewOtlpMetricExporter(endpoint string, encoding string, headers map[string]string, hostId int, timeWindowSizeMinutes int,
+	stats *metrics.SBOPipelineStats) (*OtlpMetricExporter, error) {
+	client, err := newOtlpClient(endpoint, OTLP_METRICS_PATH, encoding, headers)
+	if err != nil {
+		return nil, err
+	}
+	exporter := &OtlpMetricExporter{client: client, hostId: strconv.Itoa(hostId), timeWindowSize: otlpTimeWindowSize(timeWindowSizeMinutes)}
+	exporter.batcher = newLineBatcher("otlp "+client.url, OTLP_BATCH_SIZE, OTLP_MAX_PENDING, OTLP_FLUSH_INTERVAL, exporter.send, stats)
+	return exporter, nil
+}
+
+// supported time window sizes are the same as handlers.CalculateTimeWindow, 10 minutes is used for others
+func otlpTimeWindowSize(timeWindowSizeMinutes int) time.Duration {
+	switch timeWindowSizeMinutes {
+	case 1, 5, 15, 30, 60:
+		return time.Duration(timeWindowSizeMinutes) * time.Minute
+	}
+	return 10 * time.Minute
+}
+
+func (exporter *OtlpMetricExporter) Push(domainName string, data *metrics.SBOMetricWindowDataToBeSaved) {
+	windowStart, err := metrics.TimeWindowStartTime(data.TimeWindow, data.TimeWindowLocation)
+	if err != nil {
+		return
+	}
+	dataPoint := otlpNumberDataPoint{
+		StartTimeUnixNano: uint64(windowStart.UnixNano()),
+		TimeUnixNano:      uint64(windowStart.Add(exporter.timeWindowSize).UnixNano()),
+		AsInt:             data.MetricValue}
+	if len(data.KeyValue) > 0 {
+		dataPoint.Attributes = []otlpKeyValue{otlpStringAttribute("key", data.KeyValue)}
+	}
+	exporter.batcher.Add(otlpMetricPoint{domainName: domainName, metricName: OTLP_METRIC_NAME_PREFIX + metrics.MetricTypeName(data.MetricType), dataPoint: dataPoint})
+}
+
+// Sends remaining data points
+func (exporter *OtlpMetricExporter) Close() {
+	exporter.batcher.Close()
+}
+
+// data points are grouped by domain and metric name, in the order they were pushed
+func (exporter *OtlpMetricExporter) buildRequest(points []otlpMetricPoint) *otlpMetricsRequest {
+	request := &otlpMetricsRequest{}
+	resourceIndexes := make(map[string]int)
+	metricIndexes := make(map[string]map[string]int)
+	for _, point := range points {
+		resourceIndex, exists := resourceIndexes[point.domainName]
+		if !exists {
+			resourceIndex = len(request.ResourceMetrics)
+			resourceIndexes[point.domainName] = resourceIndex
+			metricIndexes[point.domainName] = make(map[string]int)
+			request.ResourceMetrics = append(request.ResourceMetrics, otlpResourceMetrics{
+				Resource:     newOtlpResource(exporter.hostId, point.domainName),
+				ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: OTLP_SCOPE_NAME}}}})
+		}
+		scopeMetrics := &request.ResourceMetrics[resourceIndex].ScopeMetrics[0]
+		metricIndex, exists := metricIndexes[point.domainName][point.metricName]
+		if !exists {
+			metricIndex = len(scopeMetrics.Metrics)
+			metricIndexes[point.domainName][point.metricName] = metricIndex
+			scopeMetrics.Metrics = append(scopeMetrics.Metrics, otlpMetric{Name: point.metricName, Unit: "1",
+				Sum: &otlpSum{AggregationTemporality: OTLP_AGGREGATION_TEMPORALITY_DELTA, IsMonotonic: true}})
+		}
+		sum := scopeMetrics.Metrics[metricIndex].Sum
+		sum.DataPoints = append(sum.DataPoints, point.dataPoint)
+	}
+	return request
+}
+
+func (exporter *OtlpMetricExporter) send(points []otlpMetricPoint) error {
+	return exporter.client.post(exporter.buildRequest(points))
+}
+
+type otlpLogItem struct {
+	domainName string
+	logRecord  otlpLogRecord
+}
+
+/*
+Exports parsed log entries as OTLP log records with HTTP semantic convention attributes, e.g http.request.method and url.path.
+Client IPs are omitted when maskIPs is true. Records are sent in batches, see lineBatcher
+*/
+type OtlpLogExporter struct {
+	client  *otlpClient
+	hostId  string
+	maskIPs bool
+	batcher *lineBatcher[otlpLogItem]
+}
+
+func NewOtlpLogExporter(endpoint string, encoding string, headers map[string]string, hostId int, maskIPs bool, stats *metrics.SBOPipelineStats) (*OtlpLogExporter, error) {
+	client, err := newOtlpClient(endpoint, OTLP_LOGS_PATH, encoding, headers)
+	if err != nil {
+		return nil, err
+	}
+	exporter := &OtlpLogExporter{client: client, hostId: strconv.Itoa(hostId), maskIPs: maskIPs}
+	exporter.batcher = newLineBatcher("otlp "+client.url, OTLP_BATCH_SIZE, OTLP_MAX_PENDING, OTLP_FLUSH_INTERVAL, exporter.send, stats)
+	return exporter, nil
+}
+
+func (exporter *OtlpLogExporter) PushLog(domainName string, entry *logparsers.SBOHttpRequestLog) {
+	exporter.batcher.Add(otlpLogItem{domainName: domainName, logRecord: newOtlpLogRecord(domainName, entry, exporter.maskIPs, time.Now())})
+}
+
+// Sends remaining log records
+func (exporter *OtlpLogExporter) Close() {
+	exporter.batcher.Close()
+}
+
+func newOtlpLogRecord(domainName string, entry *logparsers.SBOHttpRequestLog, maskIPs bool, observedTime time.Time) otlpLogRecord {
+	logRecord := otlpLogRecord{
+		TimeUnixNano:         uint64(entry.Timestamp.UnixNano()),
+		ObservedTimeUnixNano: uint64(observedTime.UnixNano()),
+		SeverityNumber:       OTLP_SEVERITY_INFO,
+		SeverityText:         "INFO"}
+	body := strings.TrimSpace(entry.Method + " " + entry.Path + " " + entry.Protocol + " " + entry.Status)
+	logRecord.Body = otlpAnyValue{StringValue: &body}
+
+	attributes := []otlpKeyValue{}
+	addString := func(key string, value string) {
+		if len(value) > 0 {
+			attributes = append(attributes, otlpStringAttribute(key, value))
+		}
+	}
+	addString("http.request.method", entry.Method)
+	addString("url.path", entry.Path)
+	if statusCode, err := strconv.Atoi(entry.Status); err == nil {
+		attributes = append(attributes, otlpIntAttribute("http.response.status_code", int64(statusCode)))
+		if statusCode >= 500 {
+			logRecord.SeverityNumber, logRecord.SeverityText = OTLP_SEVERITY_ERROR, "ERROR"
+		} else if statusCode >= 400 {
+			logRecord.SeverityNumber, logRecord.SeverityText = OTLP_SEVERITY_WARN, "WARN"
+		}
+	}
+	attributes = append(attributes, otlpIntAttribute("http.response.body.size", int64(entry.BytesSent)))
+	//e.g HTTP/1.1
+	if protocolName, protocolVersion, found := strings.Cut(entry.Protocol, "/"); found {
+		addString("network.protocol.name", strings.ToLower(protocolName))
+		addString("network.protocol.version", protocolVersion)
+	}
+	if !maskIPs {
+		addString("client.address", entry.ClientIP)
+	}
+	addString("server.address", domainName)
+	if entry.UserAgent != nil {
+		addString("user_agent.original", entry.UserAgent.FullName)
+		addString("sbologp.ua_family", entry.UserAgent.Family)
+		addString("sbologp.device_type", entry.UserAgent.DeviceType)
+		addString("sbologp.human", entry.UserAgent.Human)
+		addString("sbologp.intent", entry.UserAgent.Intent)
+	}
+	addString("sbologp.referer", entry.Referer)
+	if entry.Malicious != logparsers.REQUEST_MALICIOUS_UNKNOWN {
+		attributes = append(attributes, otlpIntAttribute("sbologp.malicious", int64(entry.Malicious)))
+	}
+	if entry.RequestTimeLogged {
+		attributes = append(attributes, otlpDoubleAttribute("sbologp.request_time_seconds", entry.RequestTime.Seconds()))
+	}
+	logRecord.Attributes = attributes
+	return logRecord
+}
+
+// log records are grouped by domain, in the order they were pushed
+func (exporter *OtlpLogExporter) buildRequest(items []otlpLogItem) *otlpLogsRequest {
+	request := &otlpLogsRequest{}
+	resourceIndexes := make(map[string]int)
+	for _, item := range items {
+		resourceIndex, exists := resourceIndexes[item.domainName]
+		if !exists {
+			resourceIndex = len(request.ResourceLogs)
+			resourceIndexes[item.domainName] = resourceIndex
+			request.ResourceLogs = append(request.ResourceLogs, otlpResourceLogs{
+				Resource:  newOtlpResource(exporter.hostId, item.domainName),
+				ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: OTLP_SCOPE_NAME}}}})
+		}
+		scopeLogs := &request.ResourceLogs[resourceIndex].ScopeLogs[0]
+		scopeLogs.LogRecords = append(scopeLogs.LogRecords, item.logRecord)
+	}
+	return request
+}
+
+func (exporter *OtlpLogExporter) send(items []otlpLogItem) error {
+	return exporter.client.post(exporter.buildRequest(items))
+}
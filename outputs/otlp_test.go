@@ -0,0 +1,269 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/logparsers"
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+// field number => values, varint and fixed values are uint64, length delimited values are []byte
+func decodeTestProto(t *testing.T, data []byte) map[int][]any {
+	fields := make(map[int][]any)
+	for len(data) > 0 {
+		tag, size := binary.Uvarint(data)
+		if size <= 0 {
+			t.Fatalf("Invalid tag in %x", data)
+		}
+		data = data[size:]
+		fieldNumber := int(tag >> 3)
+		switch int(tag & 7) {
+		case PROTO_WIRE_VARINT:
+			value, size := binary.Uvarint(data)
+			fields[fieldNumber] = append(fields[fieldNumber], value)
+			data = data[size:]
+		case PROTO_WIRE_FIXED64:
+			fields[fieldNumber] = append(fields[fieldNumber], binary.LittleEndian.Uint64(data))
+			data = data[8:]
+		case PROTO_WIRE_BYTES:
+			length, size := binary.Uvarint(data)
+			data = data[size:]
+			fields[fieldNumber] = append(fields[fieldNumber], data[:length])
+			data = data[length:]
+		default:
+			t.Fatalf("Unexpected wire type in tag %d", tag)
+		}
+	}
+	return fields
+}
+
+// follows embedded messages using field numbers, the first value is used for each field
+func getTestProtoMessage(t *testing.T, data []byte, fieldNumbers ...int) map[int][]any {
+	fields := decodeTestProto(t, data)
+	for _, fieldNumber := range fieldNumbers {
+		if len(fields[fieldNumber]) < 1 {
+			t.Fatalf("Field %d not found in %v", fieldNumber, fields)
+		}
+		fields = decodeTestProto(t, fields[fieldNumber][0].([]byte))
+	}
+	return fields
+}
+
+func TestOtlpAttributeProtoEncoding(t *testing.T) {
+	var encoder protoEncoder
+	encodeOtlpAttributes(&encoder, 1, []otlpKeyValue{otlpStringAttribute("a", "b"), otlpIntAttribute("n", 0)})
+	//KeyValue{key: "a", value: AnyValue{string_value: "b"}} and KeyValue{key: "n", value: AnyValue{int_value: 0}}, zero is written for oneof fields
+	if encoded := hex.EncodeToString(encoder.Bytes()); encoded != "0a080a016112030a01620a070a016e12021800" {
+		t.Errorf("Unexpected encoding %s", encoded)
+	}
+}
+
+func newTestOtlpMetricExporter(t *testing.T, encoding string) *OtlpMetricExporter {
+	exporter, err := NewOtlpMetricExporter("http://127.0.0.1:1/", encoding, nil, 7, 5, nil)
+	if err != nil {
+		t.Fatalf("NewOtlpMetricExporter failed: %v", err)
+	}
+	exporter.batcher.Close()
+	return exporter
+}
+
+func newTestOtlpMetricPoints(exporter *OtlpMetricExporter) []otlpMetricPoint {
+	var points []otlpMetricPoint
+	exporter.batcher = newLineBatcher("test", 10, 10, time.Hour, func(batch []otlpMetricPoint) error {
+		points = append(points, batch...)
+		return nil
+	}, nil)
+	exporter.Push("a.com", metrics.NewSBOMetricWindowDataToBeSaved("", metrics.SBO_METRIC_REQ_COUNT, "", 202507021120, 12))
+	exporter.Push("b.com", metrics.NewSBOMetricWindowDataToBeSaved("", metrics.SBO_METRIC_HTTP_STATUS, "404", 202507021120, 3))
+	exporter.Push("a.com", metrics.NewSBOMetricWindowDataToBeSaved("", metrics.SBO_METRIC_REQ_COUNT, "", 202507021125, 4))
+	exporter.Close()
+	return points
+}
+
+func TestOtlpMetricsProtobuf(t *testing.T) {
+	exporter := newTestOtlpMetricExporter(t, "")
+	request := exporter.buildRequest(newTestOtlpMetricPoints(exporter))
+	var encoder protoEncoder
+	request.encodeProto(&encoder)
+	data := encoder.Bytes()
+
+	if resourceMetrics := decodeTestProto(t, data)[1]; len(resourceMetrics) != 2 {
+		t.Fatalf("Expected resource metrics for 2 domains, found %d", len(resourceMetrics))
+	}
+	//resource_metrics.resource.attributes[2] is sbologp.domain
+	domainAttribute := getTestProtoMessage(t, data, 1, 1)[1][2].([]byte)
+	if value := getTestProtoMessage(t, domainAttribute, 2)[1][0].([]byte); string(value) != "a.com" {
+		t.Errorf("Unexpected domain %q", value)
+	}
+	//resource_metrics.scope_metrics.metrics
+	metric := getTestProtoMessage(t, data, 1, 2, 2)
+	if name := string(metric[1][0].([]byte)); name != "sbologp.requests" {
+		t.Errorf("Unexpected metric name %q", name)
+	}
+	sum := getTestProtoMessage(t, data, 1, 2, 2, 7)
+	if len(sum[1]) != 2 || sum[2][0].(uint64) != uint64(OTLP_AGGREGATION_TEMPORALITY_DELTA) || sum[3][0].(uint64) != 1 {
+		t.Errorf("Unexpected sum %v", sum)
+	}
+	dataPoint := getTestProtoMessage(t, data, 1, 2, 2, 7, 1)
+	windowStart := time.Date(2025, 7, 2, 11, 20, 0, 0, time.Local)
+	if dataPoint[2][0].(uint64) != uint64(windowStart.UnixNano()) || dataPoint[3][0].(uint64) != uint64(windowStart.Add(5*time.Minute).UnixNano()) ||
+		dataPoint[6][0].(uint64) != 12 || len(dataPoint[7]) != 0 {
+		t.Errorf("Unexpected data point %v", dataPoint)
+	}
+}
+
+func TestOtlpMetricsJson(t *testing.T) {
+	exporter := newTestOtlpMetricExporter(t, OTLP_ENCODING_JSON)
+	jsonBytes, err := json.Marshal(exporter.buildRequest(newTestOtlpMetricPoints(exporter)))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var request struct {
+		ResourceMetrics []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]any
+				}
+			}
+			ScopeMetrics []struct {
+				Metrics []struct {
+					Name string
+					Sum  struct {
+						AggregationTemporality int
+						IsMonotonic            bool
+						DataPoints             []struct {
+							Attributes        []map[string]any
+							StartTimeUnixNano string
+							AsInt             string
+						}
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(jsonBytes, &request); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(request.ResourceMetrics) != 2 {
+		t.Fatalf("Unexpected json %s", jsonBytes)
+	}
+	hostAttribute := request.ResourceMetrics[0].Resource.Attributes[1]
+	if hostAttribute.Key != "host.id" || hostAttribute.Value["stringValue"] != "7" {
+		t.Errorf("Unexpected host attribute %+v", hostAttribute)
+	}
+	requests := request.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if requests.Name != "sbologp.requests" || requests.Sum.AggregationTemporality != 1 || !requests.Sum.IsMonotonic || len(requests.Sum.DataPoints) != 2 ||
+		requests.Sum.DataPoints[1].AsInt != "4" || len(requests.Sum.DataPoints[0].StartTimeUnixNano) < 19 {
+		t.Errorf("Unexpected json %s", jsonBytes)
+	}
+	status := request.ResourceMetrics[1].ScopeMetrics[0].Metrics[0]
+	if status.Name != "sbologp.http_status" || status.Sum.DataPoints[0].Attributes[0]["key"] != "key" {
+		t.Errorf("Unexpected json %s", jsonBytes)
+	}
+}
+
+func TestOtlpLogRecord(t *testing.T) {
+	entry := &logparsers.SBOHttpRequestLog{
+		ClientIP: "192.0.2.1", Timestamp: time.Unix(100, 0), Method: "GET", Path: "/a?b=c", Protocol: "HTTP/1.1", Status: "404", BytesSent: 10,
+		UserAgent: logparsers.NewSBOUserAgent("curl/8.0"), RequestTime: 1500 * time.Millisecond, RequestTimeLogged: true}
+	attributeValues := func(logRecord otlpLogRecord) map[string]otlpAnyValue {
+		values := make(map[string]otlpAnyValue)
+		for _, attribute := range logRecord.Attributes {
+			values[attribute.Key] = attribute.Value
+		}
+		return values
+	}
+	logRecord := newOtlpLogRecord("example.com", entry, false, time.Unix(200, 0))
+	values := attributeValues(logRecord)
+	if logRecord.SeverityNumber != OTLP_SEVERITY_WARN || *logRecord.Body.StringValue != "GET /a?b=c HTTP/1.1 404" || logRecord.TimeUnixNano != 100e9 {
+		t.Errorf("Unexpected log record %+v", logRecord)
+	}
+	if *values["http.response.status_code"].IntValue != 404 || *values["url.path"].StringValue != "/a?b=c" || *values["client.address"].StringValue != "192.0.2.1" ||
+		*values["network.protocol.version"].StringValue != "1.1" || *values["server.address"].StringValue != "example.com" ||
+		math.Abs(*values["sbologp.request_time_seconds"].DoubleValue-1.5) > 1e-9 || *values["user_agent.original"].StringValue != "curl/8.0" {
+		t.Errorf("Unexpected attributes %+v", values)
+	}
+	if _, found := attributeValues(newOtlpLogRecord("example.com", entry, true, time.Unix(200, 0)))["client.address"]; found {
+		t.Error("Client address is not masked")
+	}
+}
+
+func TestOtlpLogExportHttp(t *testing.T) {
+	var syncMutex sync.Mutex
+	var requestPaths, contentTypes []string
+	var bodies [][]byte
+	statuses := []int{http.StatusServiceUnavailable}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		syncMutex.Lock()
+		defer syncMutex.Unlock()
+		if request.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected authorization header %q", request.Header.Get("Authorization"))
+		}
+		body, _ := io.ReadAll(request.Body)
+		requestPaths = append(requestPaths, request.URL.Path)
+		contentTypes = append(contentTypes, request.Header.Get("Content-Type"))
+		bodies = append(bodies, body)
+		if len(statuses) > 0 {
+			writer.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	defer server.Close()
+
+	stats := &metrics.SBOPipelineStats{}
+	exporter, err := NewOtlpLogExporter(server.URL, OTLP_ENCODING_JSON, map[string]string{"Authorization": "Bearer secret"}, 1, true, stats)
+	if err != nil {
+		t.Fatalf("NewOtlpLogExporter failed: %v", err)
+	}
+	exporter.PushLog("example.com", &logparsers.SBOHttpRequestLog{Method: "GET", Path: "/", Status: "200", Timestamp: time.Unix(1, 0)})
+	exporter.batcher.flush()
+	exporter.Close()
+
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+	if len(bodies) != 2 || requestPaths[1] != OTLP_LOGS_PATH || contentTypes[1] != "application/json" || stats.OutputLinesSent.Load() != 1 {
+		t.Fatalf("Unexpected requests %v %v, %d sent", requestPaths, contentTypes, stats.OutputLinesSent.Load())
+	}
+	var request otlpLogsRequest
+	if err := json.Unmarshal(bodies[1], &request); err != nil || len(request.ResourceLogs) != 1 || len(request.ResourceLogs[0].ScopeLogs[0].LogRecords) != 1 {
+		t.Errorf("Unexpected body %s: %v", bodies[1], err)
+	}
+}
+
+func TestOtlpValidation(t *testing.T) {
+	if _, err := NewOtlpMetricExporter("http://localhost:4318", "xml", nil, 1, 1, nil); err == nil {
+		t.Error("Unsupported encoding was accepted")
+	}
+	if _, err := NewOtlpLogExporter("localhost:4318", "", nil, 1, false, nil); err == nil {
+		t.Error("Endpoint without scheme was accepted")
+	}
+}
@@ -0,0 +1,378 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PROMETHEUS_METRICS_PATH string = "/metrics"
+	PROMETHEUS_CONTENT_TYPE string = "text/plain; version=0.0.4; charset=utf-8"
+	// series (label value combinations) per metric, observations with new label values are counted using PROMETHEUS_OTHER_LABEL_VALUE after this
+	PROMETHEUS_DEFAULT_MAX_SERIES int = 1000
+	// all label values of a series are set to this when the series limit of the metric is reached
+	PROMETHEUS_OTHER_LABEL_VALUE string = "__other__"
+	// longer label values are truncated
+	PROMETHEUS_MAX_LABEL_VALUE_LENGTH int           = 100
+	PROMETHEUS_SHUTDOWN_TIMEOUT       time.Duration = 10 * time.Second
+
+	PROMETHEUS_TYPE_COUNTER   string = "counter"
+	PROMETHEUS_TYPE_GAUGE     string = "gauge"
+	PROMETHEUS_TYPE_HISTOGRAM string = "histogram"
+)
+
+// histogram buckets for request durations in seconds
+var PROMETHEUS_DURATION_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type prometheusSeries struct {
+	labelValues []string
+	//counter value, or sum of observed values for histograms
+	value float64
+	//histograms only, not cumulative
+	bucketCounts []uint64
+	count        uint64
+}
+
+type prometheusFamily struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	//histograms only, upper bounds in increasing order without +Inf
+	buckets []float64
+	//keyed by label values joined with \xff
+	series map[string]*prometheusSeries
+	//observations counted using PROMETHEUS_OTHER_LABEL_VALUE because the series limit was reached
+	limitedObservations uint64
+}
+
+/*
+Counters and histograms exposed in Prometheus text format. Metrics must be registered before values are added.
+The number of series of a metric is limited (see PROMETHEUS_DEFAULT_MAX_SERIES), so label values like paths or
+client IPs can't create unlimited series. Collectors are called when metrics are written, e.g to add gauges.
+Safe for concurrent use
+*/
+type PrometheusRegistry struct {
+	syncMutex  sync.Mutex
+	maxSeries  int
+	families   map[string]*prometheusFamily
+	collectors []func(writer *PrometheusTextWriter)
+}
+
+// PROMETHEUS_DEFAULT_MAX_SERIES is used when maxSeries is less than 1
+func NewPrometheusRegistry(maxSeries int) *PrometheusRegistry {
+	if maxSeries < 1 {
+		maxSeries = PROMETHEUS_DEFAULT_MAX_SERIES
+	}
+	return &PrometheusRegistry{maxSeries: maxSeries, families: make(map[string]*prometheusFamily)}
+}
+
+// Registering the same metric again does nothing
+func (registry *PrometheusRegistry) RegisterCounter(name string, help string, labelNames ...string) {
+	registry.register(&prometheusFamily{name: name, help: help, metricType: PROMETHEUS_TYPE_COUNTER, labelNames: labelNames})
+}
+
+// buckets are upper bounds in increasing order, +Inf is added automatically
+func (registry *PrometheusRegistry) RegisterHistogram(name string, help string, buckets []float64, labelNames ...string) {
+	registry.register(&prometheusFamily{name: name, help: help, metricType: PROMETHEUS_TYPE_HISTOGRAM, labelNames: labelNames, buckets: buckets})
+}
+
+func (registry *PrometheusRegistry) register(family *prometheusFamily) {
+	registry.syncMutex.Lock()
+	defer registry.syncMutex.Unlock()
+	if _, exists := registry.families[family.name]; !exists {
+		family.series = make(map[string]*prometheusSeries)
+		registry.families[family.name] = family
+	}
+}
+
+// collect is called each time metrics are written, after registered metrics
+func (registry *PrometheusRegistry) AddCollector(collect func(writer *PrometheusTextWriter)) {
+	registry.syncMutex.Lock()
+	defer registry.syncMutex.Unlock()
+	registry.collectors = append(registry.collectors, collect)
+}
+
+/*
+Adds value to the counter. labelValues must be in the order of label names used when registering.
+Does nothing if the counter is not registered
+*/
+func (registry *PrometheusRegistry) Add(name string, value float64, labelValues ...string) {
+	registry.syncMutex.Lock()
+	defer registry.syncMutex.Unlock()
+	series := registry.getSeries(name, PROMETHEUS_TYPE_COUNTER, labelValues)
+	if series != nil {
+		series.value += value
+	}
+}
+
+// Adds an observation to the histogram, see Add
+func (registry *PrometheusRegistry) Observe(name string, value float64, labelValues ...string) {
+	registry.syncMutex.Lock()
+	defer registry.syncMutex.Unlock()
+	series := registry.getSeries(name, PROMETHEUS_TYPE_HISTOGRAM, labelValues)
+	if series == nil {
+		return
+	}
+	family := registry.families[name]
+	//values larger than all buckets are only counted in +Inf, i.e count
+	if bucketIndex, _ := slices.BinarySearch(family.buckets, value); bucketIndex < len(family.buckets) {
+		series.bucketCounts[bucketIndex]++
+	}
+	series.value += value
+	series.count++
+}
+
+// must be called with the mutex held
+func (registry *PrometheusRegistry) getSeries(name string, metricType string, labelValues []string) *prometheusSeries {
+	family, exists := registry.families[name]
+	if !exists || family.metricType != metricType || len(labelValues) != len(family.labelNames) {
+		return nil
+	}
+	cleanLabelValues := make([]string, len(labelValues))
+	for index, labelValue := range labelValues {
+		cleanLabelValues[index] = cleanPrometheusLabelValue(labelValue)
+	}
+	key := strings.Join(cleanLabelValues, "\xff")
+	series, exists := family.series[key]
+	if exists {
+		return series
+	}
+	if len(family.series) >= registry.maxSeries {
+		family.limitedObservations++
+		for index := range cleanLabelValues {
+			cleanLabelValues[index] = PROMETHEUS_OTHER_LABEL_VALUE
+		}
+		key = strings.Join(cleanLabelValues, "\xff")
+		if series, exists = family.series[key]; exists {
+			return series
+		}
+	}
+	series = &prometheusSeries{labelValues: cleanLabelValues}
+	if metricType == PROMETHEUS_TYPE_HISTOGRAM {
+		series.bucketCounts = make([]uint64, len(family.buckets))
+	}
+	family.series[key] = series
+	return series
+}
+
+func cleanPrometheusLabelValue(labelValue string) string {
+	labelValue = strings.ToValidUTF8(labelValue, "?")
+	if len(labelValue) > PROMETHEUS_MAX_LABEL_VALUE_LENGTH {
+		labelValue = strings.ToValidUTF8(labelValue[:PROMETHEUS_MAX_LABEL_VALUE_LENGTH], "")
+	}
+	return labelValue
+}
+
+/*
+Writes all metrics in Prometheus text format, metrics and series are sorted.
+sbologp_prometheus_limited_observations_total shows metrics which reached the series limit
+*/
+func (registry *PrometheusRegistry) Write(output io.Writer) error {
+	writer := NewPrometheusTextWriter(output)
+	registry.syncMutex.Lock()
+	limitedObservations := make(map[string]uint64)
+	for _, name := range slices.Sorted(maps.Keys(registry.families)) {
+		family := registry.families[name]
+		if family.limitedObservations > 0 {
+			limitedObservations[name] = family.limitedObservations
+		}
+		if len(family.series) < 1 {
+			continue
+		}
+		writer.WriteHeader(family.name, family.help, family.metricType)
+		for _, key := range slices.Sorted(maps.Keys(family.series)) {
+			series := family.series[key]
+			if family.metricType != PROMETHEUS_TYPE_HISTOGRAM {
+				writer.WriteSample(family.name, family.labelNames, series.labelValues, series.value)
+				continue
+			}
+			bucketLabelNames := append(slices.Clone(family.labelNames), "le")
+			var cumulativeCount uint64 = 0
+			for index, upperBound := range family.buckets {
+				cumulativeCount += series.bucketCounts[index]
+				writer.WriteSample(family.name+"_bucket", bucketLabelNames, append(slices.Clone(series.labelValues), formatPrometheusValue(upperBound)), float64(cumulativeCount))
+			}
+			writer.WriteSample(family.name+"_bucket", bucketLabelNames, append(slices.Clone(series.labelValues), "+Inf"), float64(series.count))
+			writer.WriteSample(family.name+"_sum", family.labelNames, series.labelValues, series.value)
+			writer.WriteSample(family.name+"_count", family.labelNames, series.labelValues, float64(series.count))
+		}
+	}
+	collectors := slices.Clone(registry.collectors)
+	registry.syncMutex.Unlock()
+
+	if len(limitedObservations) > 0 {
+		writer.WriteHeader("sbologp_prometheus_limited_observations_total", "Observations counted using the "+PROMETHEUS_OTHER_LABEL_VALUE+
+			" label value because the series limit of the metric was reached", PROMETHEUS_TYPE_COUNTER)
+		for _, name := range slices.Sorted(maps.Keys(limitedObservations)) {
+			writer.WriteSample("sbologp_prometheus_limited_observations_total", []string{"metric"}, []string{name}, float64(limitedObservations[name]))
+		}
+	}
+	for _, collect := range collectors {
+		collect(writer)
+	}
+	return writer.Flush()
+}
+
+/*
+Writes metrics in Prometheus text format. Errors are returned by Flush
+*/
+type PrometheusTextWriter struct {
+	writer *bufio.Writer
+}
+
+func NewPrometheusTextWriter(output io.Writer) *PrometheusTextWriter {
+	return &PrometheusTextWriter{writer: bufio.NewWriter(output)}
+}
+
+// must be written once before the samples of a metric
+func (writer *PrometheusTextWriter) WriteHeader(name string, help string, metricType string) {
+	writer.writer.WriteString("# HELP " + name + " " + escapePrometheusText(help, false) + "\n")
+	writer.writer.WriteString("# TYPE " + name + " " + metricType + "\n")
+}
+
+func (writer *PrometheusTextWriter) WriteSample(name string, labelNames []string, labelValues []string, value float64) {
+	writer.writer.WriteString(name)
+	if len(labelNames) > 0 {
+		writer.writer.WriteByte('{')
+		for index, labelName := range labelNames {
+			if index > 0 {
+				writer.writer.WriteByte(',')
+			}
+			writer.writer.WriteString(labelName + "=\"" + escapePrometheusText(labelValues[index], true) + "\"")
+		}
+		writer.writer.WriteByte('}')
+	}
+	writer.writer.WriteString(" " + formatPrometheusValue(value) + "\n")
+}
+
+func (writer *PrometheusTextWriter) Flush() error {
+	return writer.writer.Flush()
+}
+
+// backslashes and new lines are escaped in help texts, double quotes are escaped too in label values
+func escapePrometheusText(text string, isLabelValue bool) string {
+	var builder strings.Builder
+	for _, char := range text {
+		switch {
+		case char == '\\':
+			builder.WriteString(`\\`)
+		case char == '\n':
+			builder.WriteString(`\n`)
+		case char == '"' && isLabelValue:
+			builder.WriteString(`\"`)
+		default:
+			builder.WriteRune(char)
+		}
+	}
+	return builder.String()
+}
+
+func formatPrometheusValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+/*
+Serves metrics of a registry at PROMETHEUS_METRICS_PATH for Prometheus scrapes
+*/
+type PrometheusServer struct {
+	address    string
+	registry   *PrometheusRegistry
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+func NewPrometheusServer(address string, registry *PrometheusRegistry) *PrometheusServer {
+	server := &PrometheusServer{address: address, registry: registry}
+	mux := http.NewServeMux()
+	mux.Handle(PROMETHEUS_METRICS_PATH, server)
+	server.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      time.Minute}
+	return server
+}
+
+func (server *PrometheusServer) Start() error {
+	var err error
+	server.listener, err = net.Listen("tcp", server.address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		err := server.httpServer.Serve(server.listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Prometheus server failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Returns the address actually listened on, useful when the port is 0
+func (server *PrometheusServer) Address() net.Addr {
+	if server.listener == nil {
+		return nil
+	}
+	return server.listener.Addr()
+}
+
+// Stops listening and waits until active requests are completed, for up to PROMETHEUS_SHUTDOWN_TIMEOUT
+func (server *PrometheusServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), PROMETHEUS_SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("Prometheus server did not shut down cleanly", "error", err)
+		server.httpServer.Close()
+	}
+}
+
+func (server *PrometheusServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writer.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+	if err := server.registry.Write(writer); err != nil {
+		slog.Debug("Failed to write Prometheus metrics", "error", err)
+	}
+}
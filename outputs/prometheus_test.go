@@ -0,0 +1,180 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+func writeTestPrometheusRegistry(t *testing.T, registry *PrometheusRegistry) string {
+	var output strings.Builder
+	if err := registry.Write(&output); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	return output.String()
+}
+
+func TestPrometheusCounters(t *testing.T) {
+	registry := NewPrometheusRegistry(0)
+	registry.RegisterCounter("test_requests_total", "Requests", "domain", "status_class")
+	registry.RegisterCounter("test_unused_total", "Not written without samples", "domain")
+	registry.Add("test_requests_total", 1, "b.com", "2xx")
+	registry.Add("test_requests_total", 2, "a.com", "2xx")
+	registry.Add("test_requests_total", 1, "a.com", "2xx")
+	//ignored, wrong number of labels and not registered
+	registry.Add("test_requests_total", 1, "a.com")
+	registry.Add("test_missing_total", 1)
+
+	expected := `# HELP test_requests_total Requests
+# TYPE test_requests_total counter
+test_requests_total{domain="a.com",status_class="2xx"} 3
+test_requests_total{domain="b.com",status_class="2xx"} 1
+`
+	if output := writeTestPrometheusRegistry(t, registry); output != expected {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+func TestPrometheusHistogram(t *testing.T) {
+	registry := NewPrometheusRegistry(0)
+	registry.RegisterHistogram("test_duration_seconds", "Duration", []float64{0.1, 1}, "domain")
+	registry.Observe("test_duration_seconds", 0.05, "a.com")
+	registry.Observe("test_duration_seconds", 0.1, "a.com")
+	registry.Observe("test_duration_seconds", 0.5, "a.com")
+	registry.Observe("test_duration_seconds", 3, "a.com")
+
+	expected := `# HELP test_duration_seconds Duration
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{domain="a.com",le="0.1"} 2
+test_duration_seconds_bucket{domain="a.com",le="1"} 3
+test_duration_seconds_bucket{domain="a.com",le="+Inf"} 4
+test_duration_seconds_sum{domain="a.com"} 3.65
+test_duration_seconds_count{domain="a.com"} 4
+`
+	if output := writeTestPrometheusRegistry(t, registry); output != expected {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+func TestPrometheusEscaping(t *testing.T) {
+	registry := NewPrometheusRegistry(0)
+	registry.RegisterCounter("test_total", "Help with \\ and\nnew line, \"quotes\" are not escaped", "value")
+	registry.Add("test_total", 1, "a\"b\\c\nd")
+	registry.Add("test_total", 1, strings.Repeat("x", PROMETHEUS_MAX_LABEL_VALUE_LENGTH+10))
+
+	output := writeTestPrometheusRegistry(t, registry)
+	if !strings.Contains(output, `# HELP test_total Help with \\ and\nnew line, "quotes" are not escaped`) {
+		t.Errorf("Help is not escaped:\n%s", output)
+	}
+	if !strings.Contains(output, `test_total{value="a\"b\\c\nd"} 1`) {
+		t.Errorf("Label value is not escaped:\n%s", output)
+	}
+	if !strings.Contains(output, `test_total{value="`+strings.Repeat("x", PROMETHEUS_MAX_LABEL_VALUE_LENGTH)+`"} 1`) {
+		t.Errorf("Label value is not truncated:\n%s", output)
+	}
+}
+
+func TestPrometheusSeriesLimit(t *testing.T) {
+	registry := NewPrometheusRegistry(2)
+	registry.RegisterCounter("test_paths_total", "Paths", "domain", "path")
+	registry.Add("test_paths_total", 1, "a.com", "/1")
+	registry.Add("test_paths_total", 1, "a.com", "/2")
+	registry.Add("test_paths_total", 1, "a.com", "/3")
+	registry.Add("test_paths_total", 1, "a.com", "/4")
+	//existing series are still updated
+	registry.Add("test_paths_total", 1, "a.com", "/1")
+
+	expected := `# HELP test_paths_total Paths
+# TYPE test_paths_total counter
+test_paths_total{domain="__other__",path="__other__"} 2
+test_paths_total{domain="a.com",path="/1"} 2
+test_paths_total{domain="a.com",path="/2"} 1
+# HELP sbologp_prometheus_limited_observations_total Observations counted using the __other__ label value because the series limit of the metric was reached
+# TYPE sbologp_prometheus_limited_observations_total counter
+sbologp_prometheus_limited_observations_total{metric="test_paths_total"} 2
+`
+	if output := writeTestPrometheusRegistry(t, registry); output != expected {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+func TestPrometheusCollectors(t *testing.T) {
+	registry := NewPrometheusRegistry(0)
+	metrics.GetPipelineStats("/var/log/prometheus_test.log").LinesRead.Add(5)
+	registry.AddCollector(CollectPipelineStats)
+	collector := NewPrometheusOSMetricsCollector()
+	collector.readUptime = func() (*metrics.UptimeInfo, error) {
+		return &metrics.UptimeInfo{UpDurationMinutes: 2, Users: 1, LoadAverage1: "0.50", LoadAverage5: "", LoadAverage15: "0.25"}, nil
+	}
+	collector.readMemory = func() (*metrics.MemoryInfo, error) {
+		return nil, errors.New("free is not available")
+	}
+	registry.AddCollector(collector.Collect)
+
+	output := writeTestPrometheusRegistry(t, registry)
+	for _, expected := range []string{
+		`sbologp_lines_read_total{input="/var/log/prometheus_test.log"} 5`,
+		"sbologp_os_uptime_seconds 120\n",
+		"sbologp_os_load1 0.5\n",
+		"sbologp_os_load15 0.25\n"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Output does not contain %q:\n%s", expected, output)
+		}
+	}
+	for _, unexpected := range []string{"sbologp_os_load5", "sbologp_os_memory"} {
+		if strings.Contains(output, unexpected) {
+			t.Errorf("Output contains %q:\n%s", unexpected, output)
+		}
+	}
+}
+
+func TestPrometheusServer(t *testing.T) {
+	registry := NewPrometheusRegistry(0)
+	registry.RegisterCounter("test_total", "Test")
+	registry.Add("test_total", 1)
+	server := NewPrometheusServer("127.0.0.1:0", registry)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Stop()
+
+	response, err := http.Get("http://" + server.Address().String() + PROMETHEUS_METRICS_PATH)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != PROMETHEUS_CONTENT_TYPE || !strings.Contains(string(body), "test_total 1\n") {
+		t.Errorf("Unexpected response %v %q %q", response.StatusCode, response.Header.Get("Content-Type"), body)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, PROMETHEUS_METRICS_PATH, nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status for POST %v", recorder.Code)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SBOsoft/SBOLogProcessor/metrics"
+)
+
+const (
+	// uptime and free are executed at most once in this interval, scrapes in between use the previous values
+	PROMETHEUS_OS_METRICS_CACHE_DURATION time.Duration = 15 * time.Second
+	// free output is in KiB
+	PROMETHEUS_FREE_OUTPUT_UNIT_BYTES float64 = 1024
+)
+
+type prometheusPipelineCounter struct {
+	name  string
+	help  string
+	value func(stats *metrics.SBOPipelineStats) int64
+}
+
+type prometheusPipelineGauge prometheusPipelineCounter
+
+var prometheusPipelineCounters = []prometheusPipelineCounter{
+	{"sbologp_lines_read_total", "Lines read from the input", func(stats *metrics.SBOPipelineStats) int64 { return stats.LinesRead.Load() }},
+	{"sbologp_bytes_read_total", "Bytes read from the input", func(stats *metrics.SBOPipelineStats) int64 { return stats.BytesRead.Load() }},
+	{"sbologp_lines_processed_total", "Lines parsed and passed to handlers", func(stats *metrics.SBOPipelineStats) int64 { return stats.LinesProcessed.Load() }},
+	{"sbologp_parse_errors_total", "Lines which could not be parsed", func(stats *metrics.SBOPipelineStats) int64 { return stats.ParseErrors.Load() }},
+	{"sbologp_lines_skipped_total", "Lines skipped because they were processed before", func(stats *metrics.SBOPipelineStats) int64 { return stats.LinesSkipped.Load() }},
+	{"sbologp_lines_dropped_total", "Lines received but not processed", func(stats *metrics.SBOPipelineStats) int64 { return stats.Dropped.Load() }},
+	{"sbologp_rotations_total", "Files renamed or removed while following", func(stats *metrics.SBOPipelineStats) int64 { return stats.Rotations.Load() }},
+	{"sbologp_truncations_total", "Files truncated while following", func(stats *metrics.SBOPipelineStats) int64 { return stats.Truncations.Load() }},
+	{"sbologp_db_rows_written_total", "Rows written to the database", func(stats *metrics.SBOPipelineStats) int64 { return stats.DbRowsWritten.Load() }},
+	{"sbologp_db_batches_written_total", "Batches written to the database", func(stats *metrics.SBOPipelineStats) int64 { return stats.DbBatchesWritten.Load() }},
+	{"sbologp_db_write_errors_total", "Failed database writes", func(stats *metrics.SBOPipelineStats) int64 { return stats.DbWriteErrors.Load() }},
+	{"sbologp_db_spool_dropped_rows_total", "Spooled rows deleted because the spool was full or invalid", func(stats *metrics.SBOPipelineStats) int64 { return stats.DbSpoolDroppedRows.Load() }},
+	{"sbologp_output_lines_sent_total", "Lines sent by push outputs", func(stats *metrics.SBOPipelineStats) int64 { return stats.OutputLinesSent.Load() }},
+	{"sbologp_output_send_errors_total", "Failed sends of push outputs", func(stats *metrics.SBOPipelineStats) int64 { return stats.OutputSendErrors.Load() }},
+	{"sbologp_output_dropped_lines_total", "Lines of push outputs dropped because sends failed", func(stats *metrics.SBOPipelineStats) int64 { return stats.OutputDroppedLines.Load() }},
+}
+
+var prometheusPipelineGauges = []prometheusPipelineGauge{
+	{"sbologp_backfill_files", "Rotated files to be processed before the input", func(stats *metrics.SBOPipelineStats) int64 { return stats.BackfillFilesTotal.Load() }},
+	{"sbologp_backfill_files_done", "Rotated files processed", func(stats *metrics.SBOPipelineStats) int64 { return stats.BackfillFilesDone.Load() }},
+	{"sbologp_db_spool_rows", "Rows waiting in the spool", func(stats *metrics.SBOPipelineStats) int64 { return stats.DbSpoolRows.Load() }},
+	{"sbologp_db_spool_bytes", "Size of the spool", func(stats *metrics.SBOPipelineStats) int64 { return stats.DbSpoolBytes.Load() }},
+	{"sbologp_last_rotation_timestamp_seconds", "Unix time of the last rotation or truncation, 0 if none", func(stats *metrics.SBOPipelineStats) int64 { return stats.LastRotationTime.Load() }},
+}
+
+/*
+Writes pipeline stats of all inputs, see metrics.SBOPipelineStats. Inputs are used as the input label
+*/
+func CollectPipelineStats(writer *PrometheusTextWriter) {
+	allStats := metrics.GetAllPipelineStats()
+	if len(allStats) < 1 {
+		return
+	}
+	inputs := slices.Sorted(maps.Keys(allStats))
+	labelNames := []string{"input"}
+	writeAll := func(name string, help string, metricType string, value func(stats *metrics.SBOPipelineStats) int64) {
+		writer.WriteHeader(name, help, metricType)
+		for _, input := range inputs {
+			writer.WriteSample(name, labelNames, []string{input}, float64(value(allStats[input])))
+		}
+	}
+	for _, counter := range prometheusPipelineCounters {
+		writeAll(counter.name, counter.help, PROMETHEUS_TYPE_COUNTER, counter.value)
+	}
+	writer.WriteHeader("sbologp_db_write_seconds_total", "Time spent writing to the database", PROMETHEUS_TYPE_COUNTER)
+	for _, input := range inputs {
+		writer.WriteSample("sbologp_db_write_seconds_total", labelNames, []string{input}, time.Duration(allStats[input].DbWriteNanos.Load()).Seconds())
+	}
+	for _, gauge := range prometheusPipelineGauges {
+		writeAll(gauge.name, gauge.help, PROMETHEUS_TYPE_GAUGE, gauge.value)
+	}
+}
+
+/*
+Writes OS metrics, see metrics.GetOSUptimeInfo and metrics.GetOSMemoryInfo. Metrics which can't be read, e.g because
+free is not available, are not written
+*/
+type PrometheusOSMetricsCollector struct {
+	syncMutex   sync.Mutex
+	lastRead    time.Time
+	uptimeInfo  *metrics.UptimeInfo
+	memoryInfo  *metrics.MemoryInfo
+	readUptime  func() (*metrics.UptimeInfo, error)
+	readMemory  func() (*metrics.MemoryInfo, error)
+	loggedError bool
+}
+
+func NewPrometheusOSMetricsCollector() *PrometheusOSMetricsCollector {
+	return &PrometheusOSMetricsCollector{readUptime: metrics.GetOSUptimeInfo, readMemory: metrics.GetOSMemoryInfo}
+}
+
+func (collector *PrometheusOSMetricsCollector) refresh() {
+	if !collector.lastRead.IsZero() && time.Since(collector.lastRead) < PROMETHEUS_OS_METRICS_CACHE_DURATION {
+		return
+	}
+	collector.lastRead = time.Now()
+	var uptimeErr, memoryErr error
+	collector.uptimeInfo, uptimeErr = collector.readUptime()
+	collector.memoryInfo, memoryErr = collector.readMemory()
+	if (uptimeErr != nil || memoryErr != nil) && !collector.loggedError {
+		//logged once, e.g free is never available on macOS
+		collector.loggedError = true
+		slog.Warn("Failed to read OS metrics for Prometheus", "uptimeError", uptimeErr, "memoryError", memoryErr)
+	}
+}
+
+func (collector *PrometheusOSMetricsCollector) Collect(writer *PrometheusTextWriter) {
+	collector.syncMutex.Lock()
+	defer collector.syncMutex.Unlock()
+	collector.refresh()
+
+	writeGauge := func(name string, help string, value float64) {
+		writer.WriteHeader(name, help, PROMETHEUS_TYPE_GAUGE)
+		writer.WriteSample(name, nil, nil, value)
+	}
+	if collector.uptimeInfo != nil {
+		writeGauge("sbologp_os_uptime_seconds", "Time since the OS was started", float64(collector.uptimeInfo.UpDurationMinutes*60))
+		writeGauge("sbologp_os_users", "Logged in users", float64(collector.uptimeInfo.Users))
+		loadAverages := []struct {
+			name  string
+			value string
+		}{
+			{"sbologp_os_load1", collector.uptimeInfo.LoadAverage1},
+			{"sbologp_os_load5", collector.uptimeInfo.LoadAverage5},
+			{"sbologp_os_load15", collector.uptimeInfo.LoadAverage15},
+		}
+		for _, loadAverage := range loadAverages {
+			if value, err := strconv.ParseFloat(loadAverage.value, 64); err == nil {
+				writeGauge(loadAverage.name, "Load average", value)
+			}
+		}
+	}
+	if collector.memoryInfo != nil {
+		writeGauge("sbologp_os_memory_used_bytes", "Used memory", float64(collector.memoryInfo.MemUse)*PROMETHEUS_FREE_OUTPUT_UNIT_BYTES)
+		writeGauge("sbologp_os_memory_free_bytes", "Free memory", float64(collector.memoryInfo.MemFree)*PROMETHEUS_FREE_OUTPUT_UNIT_BYTES)
+		writeGauge("sbologp_os_memory_available_bytes", "Memory available for new processes", float64(collector.memoryInfo.MemAvailable)*PROMETHEUS_FREE_OUTPUT_UNIT_BYTES)
+		writeGauge("sbologp_os_memory_cache_bytes", "Memory used by buffers and caches", float64(collector.memoryInfo.CachUse)*PROMETHEUS_FREE_OUTPUT_UNIT_BYTES)
+		writeGauge("sbologp_os_swap_used_bytes", "Used swap", float64(collector.memoryInfo.SwapUse)*PROMETHEUS_FREE_OUTPUT_UNIT_BYTES)
+	}
+}
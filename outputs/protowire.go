@@ -0,0 +1,122 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protobuf wire types
+const (
+	PROTO_WIRE_VARINT  int = 0
+	PROTO_WIRE_FIXED64 int = 1
+	PROTO_WIRE_BYTES   int = 2
+	PROTO_WIRE_FIXED32 int = 5
+)
+
+/*
+Minimal protobuf encoder, enough to encode OTLP messages without generated code.
+Fields with default values are omitted like proto3 does, except by the *Always methods, which are needed for oneof fields
+*/
+type protoEncoder struct {
+	buffer []byte
+}
+
+func (encoder *protoEncoder) Bytes() []byte {
+	return encoder.buffer
+}
+
+func (encoder *protoEncoder) varint(value uint64) {
+	encoder.buffer = binary.AppendUvarint(encoder.buffer, value)
+}
+
+func (encoder *protoEncoder) tag(fieldNumber int, wireType int) {
+	encoder.varint(uint64(fieldNumber)<<3 | uint64(wireType))
+}
+
+func (encoder *protoEncoder) Uint64(fieldNumber int, value uint64) {
+	if value != 0 {
+		encoder.tag(fieldNumber, PROTO_WIRE_VARINT)
+		encoder.varint(value)
+	}
+}
+
+// int64 and enum fields, negative values take 10 bytes like in protobuf
+func (encoder *protoEncoder) Int64(fieldNumber int, value int64) {
+	encoder.Uint64(fieldNumber, uint64(value))
+}
+
+func (encoder *protoEncoder) Int64Always(fieldNumber int, value int64) {
+	encoder.tag(fieldNumber, PROTO_WIRE_VARINT)
+	encoder.varint(uint64(value))
+}
+
+func (encoder *protoEncoder) BoolAlways(fieldNumber int, value bool) {
+	encoder.tag(fieldNumber, PROTO_WIRE_VARINT)
+	if value {
+		encoder.varint(1)
+	} else {
+		encoder.varint(0)
+	}
+}
+
+func (encoder *protoEncoder) Bool(fieldNumber int, value bool) {
+	if value {
+		encoder.BoolAlways(fieldNumber, value)
+	}
+}
+
+// fixed64 and sfixed64 fields
+func (encoder *protoEncoder) Fixed64(fieldNumber int, value uint64) {
+	if value != 0 {
+		encoder.Fixed64Always(fieldNumber, value)
+	}
+}
+
+func (encoder *protoEncoder) Fixed64Always(fieldNumber int, value uint64) {
+	encoder.tag(fieldNumber, PROTO_WIRE_FIXED64)
+	encoder.buffer = binary.LittleEndian.AppendUint64(encoder.buffer, value)
+}
+
+func (encoder *protoEncoder) DoubleAlways(fieldNumber int, value float64) {
+	encoder.Fixed64Always(fieldNumber, math.Float64bits(value))
+}
+
+func (encoder *protoEncoder) String(fieldNumber int, value string) {
+	if len(value) > 0 {
+		encoder.StringAlways(fieldNumber, value)
+	}
+}
+
+func (encoder *protoEncoder) StringAlways(fieldNumber int, value string) {
+	encoder.tag(fieldNumber, PROTO_WIRE_BYTES)
+	encoder.varint(uint64(len(value)))
+	encoder.buffer = append(encoder.buffer, value...)
+}
+
+// Writes an embedded message, encode writes the fields of the message. Empty messages are written too
+func (encoder *protoEncoder) Message(fieldNumber int, encode func(encoder *protoEncoder)) {
+	var messageEncoder protoEncoder
+	encode(&messageEncoder)
+	encoder.tag(fieldNumber, PROTO_WIRE_BYTES)
+	encoder.varint(uint64(len(messageEncoder.buffer)))
+	encoder.buffer = append(encoder.buffer, messageEncoder.buffer...)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// sums of windows older than this, relative to the newest window, are removed
+	METRIC_WINDOW_TOTALS_MAX_AGE time.Duration = 24 * time.Hour
+	// old sums are removed at most this often
+	METRIC_WINDOW_TOTALS_PRUNE_INTERVAL time.Duration = time.Hour
+)
+
+type metricWindowTotalsKey struct {
+	series      string
+	windowStart int64
+}
+
+/*
+Sums of values pushed for the same series (e.g metric name) and time window. Outputs which overwrite values having the same series
+and timestamp (Graphite and InfluxDB) send sums instead of pushed values, so values pushed for a window more than once are added
+instead of overwriting each other, e.g values of a key sent when its window was closed and values of late lines sent later.
+Sums are kept in memory, a window pushed again after a restart is overwritten with values pushed after the restart
+*/
+type metricWindowTotals struct {
+	syncMutex         sync.Mutex
+	totals            map[metricWindowTotalsKey]int64
+	newestWindowStart time.Time
+	lastPruned        time.Time
+}
+
+func newMetricWindowTotals() *metricWindowTotals {
+	return &metricWindowTotals{totals: make(map[metricWindowTotalsKey]int64)}
+}
+
+/*
+Adds value to the sum of the series and window and calls send with the new sum. send is called while holding the lock,
+i.e sums of a series are sent in the order they are calculated
+*/
+func (totals *metricWindowTotals) add(series string, windowStart time.Time, value int64, send func(total int64)) {
+	totals.syncMutex.Lock()
+	defer totals.syncMutex.Unlock()
+	key := metricWindowTotalsKey{series: series, windowStart: windowStart.Unix()}
+	total := totals.totals[key] + value
+	totals.totals[key] = total
+	if windowStart.After(totals.newestWindowStart) {
+		totals.newestWindowStart = windowStart
+		if totals.newestWindowStart.Sub(totals.lastPruned) >= METRIC_WINDOW_TOTALS_PRUNE_INTERVAL {
+			totals.prune()
+		}
+	}
+	send(total)
+}
+
+// must be called with syncMutex held
+func (totals *metricWindowTotals) prune() {
+	oldestKept := totals.newestWindowStart.Add(-METRIC_WINDOW_TOTALS_MAX_AGE).Unix()
+	for key := range totals.totals {
+		if key.windowStart < oldestKept {
+			delete(totals.totals, key)
+		}
+	}
+	totals.lastPruned = totals.newestWindowStart
+}
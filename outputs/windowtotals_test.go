@@ -0,0 +1,55 @@
+/*
+Copyright (C) 2025 SBOSOFT, Serkan Özkan
+
+This file is part of, SBOLogProcessor, https://github.com/SBOsoft/SBOLogProcessor/
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package outputs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricWindowTotals(t *testing.T) {
+	totals := newMetricWindowTotals()
+	var sent []int64
+	send := func(total int64) {
+		sent = append(sent, total)
+	}
+	windowStart := time.Date(2025, 7, 2, 11, 20, 0, 0, time.UTC)
+	totals.add("requests", windowStart, 5, send)
+	totals.add("requests", windowStart, 3, send)
+	totals.add("bytes", windowStart, 100, send)
+	//the same time in another time zone is the same window
+	totals.add("requests", windowStart.In(time.FixedZone("", 3600)), 1, send)
+	totals.add("requests", windowStart.Add(10*time.Minute), 2, send)
+	expected := []int64{5, 8, 100, 9, 2}
+	if len(sent) != len(expected) {
+		t.Fatalf("Unexpected sums %v", sent)
+	}
+	for index := range expected {
+		if sent[index] != expected[index] {
+			t.Errorf("Unexpected sums %v, expected %v", sent, expected)
+			break
+		}
+	}
+
+	totals.add("requests", windowStart.Add(METRIC_WINDOW_TOTALS_MAX_AGE+time.Hour), 1, send)
+	if len(totals.totals) != 1 {
+		t.Errorf("Old sums were not removed %v", totals.totals)
+	}
+}